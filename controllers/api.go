@@ -0,0 +1,1110 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/internal/logger"
+	"github.com/toozej/podgrab/model"
+	"github.com/toozej/podgrab/pkg/version"
+	"github.com/toozej/podgrab/service"
+	"gorm.io/gorm"
+)
+
+// Error codes of the /api/v1 error envelope.
+const (
+	apiInvalidRequest = "invalid_request"
+	apiUnauthorized   = "unauthorized"
+	apiForbidden      = "forbidden"
+	apiNotFound       = "not_found"
+	apiConflict       = "conflict"
+	apiInternalError  = "internal_error"
+)
+
+// maxPageCount is the largest page the API returns.
+const maxPageCount = 100
+
+// APIError is the body of every failed /api/v1 response.
+type APIError struct {
+	Error APIErrorDetail `json:"error"`
+}
+
+// APIErrorDetail describes what went wrong. Code is stable and meant for programs,
+// Message for people.
+type APIErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// APIList is the body of paginated /api/v1 list responses.
+type APIList struct {
+	Data       interface{}      `json:"data"`
+	Pagination model.Pagination `json:"pagination"`
+}
+
+// DeletePodcastQuery represents delete podcast query data.
+type DeletePodcastQuery struct {
+	KeepFiles bool `form:"keepFiles" json:"keepFiles" query:"keepFiles"`
+}
+
+// PatchEpisode represents the episode fields the API changes. Played, bookmarked and
+// queued apply to the current user.
+type PatchEpisode struct {
+	IsPlayed   *bool `json:"isPlayed"`
+	Bookmarked *bool `json:"bookmarked"`
+	Queued     *bool `json:"queued"`
+	// EnclosureChanged only accepts false, which dismisses the changed media flag.
+	EnclosureChanged *bool `json:"enclosureChanged"`
+}
+
+// AddAPITokenData represents add api token data. ExpiresInDays 0 creates a token that
+// never expires.
+type AddAPITokenData struct {
+	Name          string `binding:"required" json:"name"`
+	Scope         string `binding:"required" json:"scope"`
+	ExpiresInDays int    `json:"expiresInDays"`
+}
+
+// PlaybackProgress is the current user's place in an episode. Times are in seconds.
+type PlaybackProgress struct {
+	EpisodeID string     `json:"episodeId"`
+	Position  int        `json:"position"`
+	Duration  int        `json:"duration"`
+	IsPlayed  bool       `json:"isPlayed"`
+	UpdatedAt *time.Time `json:"updatedAt"`
+}
+
+// PutProgressData represents put progress data. Duration may be left out to use the
+// one from the feed.
+type PutProgressData struct {
+	Position *int `binding:"required" json:"position"`
+	Duration int  `json:"duration"`
+}
+
+// CreatedAPIToken is a new token with its value, which is only ever shown here.
+type CreatedAPIToken struct {
+	db.APIToken
+	Token string `json:"token"`
+}
+
+// AddUserData represents add user data.
+type AddUserData struct {
+	Username string `binding:"required" json:"username"`
+	Password string `binding:"required" json:"password"`
+	IsAdmin  bool   `json:"isAdmin"`
+}
+
+// PatchUser represents the user fields the API changes. CurrentPassword is needed to
+// change the password of the signed in account.
+type PatchUser struct {
+	Password        *string `json:"password"`
+	CurrentPassword string  `json:"currentPassword"`
+	IsAdmin         *bool   `json:"isAdmin"`
+}
+
+// AddWebhookData represents the settings of a webhook. Events empty sends every event.
+// Secret and Headers are never returned: leaving them out keeps the stored values when
+// updating, an empty secret removes it.
+type AddWebhookData struct {
+	Secret  *string           `json:"secret"`
+	Headers map[string]string `json:"headers"`
+	Enabled *bool             `json:"enabled"`
+	Name    string            `json:"name"`
+	URL     string            `binding:"required" json:"url"`
+	Events  []string          `json:"events"`
+}
+
+// AddNotifierData represents the settings of a notifier. Events empty sends every event,
+// empty templates the default message of each event. PodcastIDs are the podcasts opted in
+// when AllPodcasts is off. The URL holds tokens and passwords and is never returned:
+// leaving it out keeps the stored URL when updating.
+type AddNotifierData struct {
+	URL           *string  `json:"url"`
+	Enabled       *bool    `json:"enabled"`
+	Name          string   `json:"name"`
+	TitleTemplate string   `json:"titleTemplate"`
+	BodyTemplate  string   `json:"bodyTemplate"`
+	Events        []string `json:"events"`
+	PodcastIDs    []string `json:"podcastIds"`
+	AllPodcasts   bool     `json:"allPodcasts"`
+}
+
+// MergedEpisodes is the result of merging duplicate episodes.
+type MergedEpisodes struct {
+	Merged int `json:"merged"`
+}
+
+// apiError aborts a request with the error envelope.
+func apiError(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, APIError{Error: APIErrorDetail{Code: code, Message: message}})
+}
+
+// apiLookupError reports a failed lookup as not found or as an internal error.
+func apiLookupError(c *gin.Context, err error, notFoundMsg string) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apiError(c, http.StatusNotFound, apiNotFound, notFoundMsg)
+		return
+	}
+	logger.Log.Errorw("api lookup", "error", err, "path", c.FullPath())
+	apiError(c, http.StatusInternalServerError, apiInternalError, "Internal error")
+}
+
+// apiBindPagination binds and checks the page and count of a list request.
+func apiBindPagination(c *gin.Context, pagination *model.Pagination) bool {
+	pagination.SetDefaults()
+	if pagination.Page < 1 || pagination.Count < 1 || pagination.Count > maxPageCount {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, "page must be at least 1 and count between 1 and 100")
+		return false
+	}
+	return true
+}
+
+// pageOf returns the items on the page and sets the pagination metadata.
+func pageOf[T any](items []T, pagination *model.Pagination) []T {
+	pagination.SetCounts(int64(len(items)))
+	start := min(pagination.Offset(), len(items))
+	end := min(start+pagination.Count, len(items))
+	return items[start:end]
+}
+
+// apiPodcast loads the podcast named in the path, aborting the request when there is none.
+func apiPodcast(c *gin.Context) (*db.Podcast, bool) {
+	var searchByIDQuery SearchByIDQuery
+	if c.ShouldBindUri(&searchByIDQuery) != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, "Invalid podcast id")
+		return nil, false
+	}
+	var podcast db.Podcast
+	if err := db.GetPodcastByID(searchByIDQuery.ID, &podcast); err != nil {
+		apiLookupError(c, err, "Podcast not found")
+		return nil, false
+	}
+	if err := service.ApplyEpisodeStates(currentUser(c).ID, podcast.PodcastItems); err != nil {
+		apiLookupError(c, err, "")
+		return nil, false
+	}
+	return &podcast, true
+}
+
+// apiEpisode loads the episode named in the path, aborting the request when there is none.
+func apiEpisode(c *gin.Context) (*db.PodcastItem, bool) {
+	var searchByIDQuery SearchByIDQuery
+	if c.ShouldBindUri(&searchByIDQuery) != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, "Invalid episode id")
+		return nil, false
+	}
+	var item db.PodcastItem
+	if err := db.GetPodcastItemByID(searchByIDQuery.ID, &item); err != nil {
+		apiLookupError(c, err, "Episode not found")
+		return nil, false
+	}
+	items := []db.PodcastItem{item}
+	if err := service.ApplyEpisodeStates(currentUser(c).ID, items); err != nil {
+		apiLookupError(c, err, "")
+		return nil, false
+	}
+	return &items[0], true
+}
+
+// apiTag loads the tag named by a path parameter, aborting the request when there is none.
+func apiTag(c *gin.Context, param string) (*db.Tag, bool) {
+	tag, err := db.GetTagByID(c.Param(param))
+	if err != nil {
+		apiLookupError(c, err, "Tag not found")
+		return nil, false
+	}
+	return tag, true
+}
+
+// apiListPodcasts lists podcasts a page at a time.
+func apiListPodcasts(c *gin.Context) {
+	var query struct {
+		PodcastListQuery
+		model.Pagination
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	if !apiBindPagination(c, &query.Pagination) {
+		return
+	}
+	sorting := "created_at"
+	switch strings.ToLower(query.Sort) {
+	case Name:
+		sorting = "title"
+	case LastEpisode:
+		sorting = "last_episode"
+	}
+	if strings.ToLower(query.Order) == Desc {
+		sorting += " desc"
+	}
+	podcasts := pageOf(*service.GetAllPodcasts(sorting), &query.Pagination)
+	c.JSON(http.StatusOK, APIList{Data: podcasts, Pagination: query.Pagination})
+}
+
+// apiAddPodcast subscribes to a feed.
+func apiAddPodcast(c *gin.Context) {
+	var addPodcastData AddPodcastData
+	if err := c.ShouldBindJSON(&addPodcastData); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	podcast, err := service.AddPrivatePodcast(addPodcastData.URL, addPodcastData.credentials())
+	if err != nil {
+		var exists *model.PodcastAlreadyExistsError
+		if errors.As(err, &exists) {
+			apiError(c, http.StatusConflict, apiConflict, err.Error())
+			return
+		}
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	go func() {
+		if refreshErr := service.RefreshEpisodes(); refreshErr != nil {
+			logger.Log.Errorw("refreshing episodes", "error", refreshErr)
+		}
+	}()
+	c.JSON(http.StatusCreated, podcast)
+}
+
+// apiGetPodcast returns a podcast.
+func apiGetPodcast(c *gin.Context) {
+	if podcast, ok := apiPodcast(c); ok {
+		c.JSON(http.StatusOK, podcast)
+	}
+}
+
+// apiPatchPodcast changes the options of a podcast.
+func apiPatchPodcast(c *gin.Context) {
+	podcast, ok := apiPodcast(c)
+	if !ok {
+		return
+	}
+	var input PatchPodcast
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	if err := input.apply(podcast); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, podcast)
+}
+
+// apiDeletePodcast unsubscribes from a podcast, deleting its files unless asked not to.
+func apiDeletePodcast(c *gin.Context) {
+	podcast, ok := apiPodcast(c)
+	if !ok {
+		return
+	}
+	var query DeletePodcastQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	if err := service.DeletePodcast(podcast.ID, !query.KeepFiles); err != nil {
+		apiLookupError(c, err, "Podcast not found")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// apiDeletePodcastFiles deletes the downloaded episodes of a podcast.
+func apiDeletePodcastFiles(c *gin.Context) {
+	podcast, ok := apiPodcast(c)
+	if !ok {
+		return
+	}
+	if err := service.DeletePodcastEpisodes(podcast.ID); err != nil {
+		apiLookupError(c, err, "Podcast not found")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// apiRefreshPodcast starts refreshing a podcast's feed.
+func apiRefreshPodcast(c *gin.Context) {
+	podcast, ok := apiPodcast(c)
+	if !ok {
+		return
+	}
+	go func() {
+		if err := service.RefreshPodcastByPodcastID(podcast.ID); err != nil {
+			logger.Log.Errorw("refreshing podcast", "id", podcast.ID, "error", err)
+		}
+	}()
+	c.Status(http.StatusAccepted)
+}
+
+// apiDownloadPodcast queues every episode of a podcast for download.
+func apiDownloadPodcast(c *gin.Context) {
+	podcast, ok := apiPodcast(c)
+	if !ok {
+		return
+	}
+	if err := service.SetAllEpisodesToDownload(podcast.ID); err != nil {
+		apiLookupError(c, err, "Podcast not found")
+		return
+	}
+	go func() {
+		if err := service.RefreshEpisodes(); err != nil {
+			logger.Log.Errorw("refreshing episodes", "error", err)
+		}
+	}()
+	c.Status(http.StatusAccepted)
+}
+
+// apiDedupePodcast merges the duplicate episodes of a podcast.
+func apiDedupePodcast(c *gin.Context) {
+	podcast, ok := apiPodcast(c)
+	if !ok {
+		return
+	}
+	merged, err := service.MergeDuplicatePodcastItems(podcast.ID)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, MergedEpisodes{Merged: merged})
+}
+
+// apiPodcastHistory lists the metadata changes of a podcast.
+func apiPodcastHistory(c *gin.Context) {
+	podcast, ok := apiPodcast(c)
+	if !ok {
+		return
+	}
+	changes := []db.PodcastMetadataChange{}
+	if err := db.GetPodcastMetadataChangesByPodcastID(podcast.ID, &changes); err != nil {
+		apiLookupError(c, err, "Podcast not found")
+		return
+	}
+	c.JSON(http.StatusOK, changes)
+}
+
+// apiSetPodcastCredentials replaces the credentials of a private feed.
+func apiSetPodcastCredentials(c *gin.Context) {
+	podcast, ok := apiPodcast(c)
+	if !ok {
+		return
+	}
+	var input PodcastCredentialsData
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	if err := service.SetPodcastCredentials(podcast.ID, input.credentials()); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// apiDeletePodcastCredentials removes the credentials of a private feed.
+func apiDeletePodcastCredentials(c *gin.Context) {
+	podcast, ok := apiPodcast(c)
+	if !ok {
+		return
+	}
+	if err := service.SetPodcastCredentials(podcast.ID, nil); err != nil {
+		apiLookupError(c, err, "Podcast not found")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// apiTagPodcast adds a tag to a podcast.
+func apiTagPodcast(c *gin.Context) {
+	podcast, ok := apiPodcast(c)
+	if !ok {
+		return
+	}
+	tag, ok := apiTag(c, "tagID")
+	if !ok {
+		return
+	}
+	if err := db.AddTagToPodcast(podcast.ID, tag.ID); err != nil {
+		apiLookupError(c, err, "Tag not found")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// apiUntagPodcast removes a tag from a podcast.
+func apiUntagPodcast(c *gin.Context) {
+	podcast, ok := apiPodcast(c)
+	if !ok {
+		return
+	}
+	tag, ok := apiTag(c, "tagID")
+	if !ok {
+		return
+	}
+	if err := db.RemoveTagFromPodcast(podcast.ID, tag.ID); err != nil {
+		apiLookupError(c, err, "Tag not found")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// apiFeedHealth reports broken, stale and redirected feeds.
+func apiFeedHealth(c *gin.Context) {
+	var query FeedHealthQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	report, err := service.GetFeedHealthReport(query.StaleDays)
+	if err != nil {
+		apiLookupError(c, err, "")
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// apiListEpisodes lists the episodes matching a filter a page at a time. podcastIDs
+// restricts the episodes to some podcasts.
+func apiListEpisodes(c *gin.Context, podcastIDs ...string) {
+	var filter model.EpisodesFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	if !apiBindPagination(c, &filter.Pagination) {
+		return
+	}
+	filter.VerifyPaginationValues()
+	if len(podcastIDs) > 0 {
+		filter.PodcastIDs = podcastIDs
+	}
+	filter.UserID = currentUser(c).ID
+	items, totalCount, err := db.GetPaginatedPodcastItemsNew(&filter)
+	if err == nil {
+		err = service.ApplyEpisodeStates(filter.UserID, *items)
+	}
+	if err != nil {
+		apiLookupError(c, err, "")
+		return
+	}
+	filter.SetCounts(totalCount)
+	c.JSON(http.StatusOK, APIList{Data: items, Pagination: filter.Pagination})
+}
+
+// apiListPodcastEpisodes lists the episodes of a podcast a page at a time.
+func apiListPodcastEpisodes(c *gin.Context) {
+	if podcast, ok := apiPodcast(c); ok {
+		apiListEpisodes(c, podcast.ID)
+	}
+}
+
+// apiGetEpisode returns an episode.
+func apiGetEpisode(c *gin.Context) {
+	if item, ok := apiEpisode(c); ok {
+		c.JSON(http.StatusOK, item)
+	}
+}
+
+// apiPatchEpisode marks an episode played or bookmarked.
+func apiPatchEpisode(c *gin.Context) {
+	item, ok := apiEpisode(c)
+	if !ok {
+		return
+	}
+	var input PatchEpisode
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	if input.EnclosureChanged != nil && *input.EnclosureChanged {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, "enclosureChanged can only be cleared")
+		return
+	}
+	userID := currentUser(c).ID
+	if input.IsPlayed != nil {
+		if err := service.SetPodcastItemPlayedStatus(userID, item.ID, *input.IsPlayed); err != nil {
+			apiLookupError(c, err, "Episode not found")
+			return
+		}
+	}
+	if input.Bookmarked != nil {
+		if err := service.SetPodcastItemBookmarkStatus(userID, item.ID, *input.Bookmarked); err != nil {
+			apiLookupError(c, err, "Episode not found")
+			return
+		}
+	}
+	if input.Queued != nil {
+		if err := service.SetPodcastItemQueued(userID, item.ID, *input.Queued); err != nil {
+			apiLookupError(c, err, "Episode not found")
+			return
+		}
+	}
+	if input.EnclosureChanged != nil {
+		if err := db.DB.Model(item).Update("enclosure_changed", false).Error; err != nil {
+			apiLookupError(c, err, "Episode not found")
+			return
+		}
+	}
+	if err := db.GetPodcastItemByID(item.ID, item); err != nil {
+		apiLookupError(c, err, "Episode not found")
+		return
+	}
+	items := []db.PodcastItem{*item}
+	if err := service.ApplyEpisodeStates(userID, items); err != nil {
+		apiLookupError(c, err, "")
+		return
+	}
+	c.JSON(http.StatusOK, items[0])
+}
+
+// apiDownloadEpisode starts downloading an episode.
+func apiDownloadEpisode(c *gin.Context) {
+	item, ok := apiEpisode(c)
+	if !ok {
+		return
+	}
+	go func() {
+		if err := service.DownloadSingleEpisode(item.ID); err != nil {
+			logger.Log.Errorw("downloading episode", "error", err)
+		}
+	}()
+	c.Status(http.StatusAccepted)
+}
+
+// apiDeleteEpisodeFile deletes the downloaded file of an episode.
+func apiDeleteEpisodeFile(c *gin.Context) {
+	item, ok := apiEpisode(c)
+	if !ok {
+		return
+	}
+	if err := service.DeleteEpisodeFile(item.ID); err != nil {
+		apiLookupError(c, err, "Episode not found")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// apiListTags lists tags a page at a time.
+func apiListTags(c *gin.Context) {
+	var pagination model.Pagination
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	if !apiBindPagination(c, &pagination) {
+		return
+	}
+	tags, err := db.GetAllTags("")
+	if err != nil {
+		apiLookupError(c, err, "")
+		return
+	}
+	c.JSON(http.StatusOK, APIList{Data: pageOf(*tags, &pagination), Pagination: pagination})
+}
+
+// apiAddTag creates a tag.
+func apiAddTag(c *gin.Context) {
+	var addTagData AddTagData
+	if err := c.ShouldBindJSON(&addTagData); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	tag, err := service.AddTag(addTagData.Label, addTagData.Description)
+	if err != nil {
+		var exists *model.TagAlreadyExistsError
+		if errors.As(err, &exists) {
+			apiError(c, http.StatusConflict, apiConflict, err.Error())
+			return
+		}
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, tag)
+}
+
+// apiGetTag returns a tag with its podcasts.
+func apiGetTag(c *gin.Context) {
+	if tag, ok := apiTag(c, "id"); ok {
+		c.JSON(http.StatusOK, tag)
+	}
+}
+
+// apiDeleteTag deletes a tag, untagging its podcasts.
+func apiDeleteTag(c *gin.Context) {
+	tag, ok := apiTag(c, "id")
+	if !ok {
+		return
+	}
+	if err := service.DeleteTag(tag.ID); err != nil {
+		apiLookupError(c, err, "Tag not found")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// apiRefreshAll starts refreshing every feed.
+func apiRefreshAll(c *gin.Context) {
+	go func() {
+		if err := service.RefreshEpisodes(); err != nil {
+			logger.Log.Errorw("refreshing episodes", "error", err)
+		}
+	}()
+	c.Status(http.StatusAccepted)
+}
+
+// newSettingModel returns the settings in the shape UpdateSetting accepts.
+func newSettingModel(setting *db.Setting) SettingModel {
+	return SettingModel{
+		BaseURL:                     setting.BaseURL,
+		UserAgent:                   setting.UserAgent,
+		FileNameFormat:              setting.FileNameFormat,
+		InitialDownloadCount:        setting.InitialDownloadCount,
+		MaxDownloadConcurrency:      setting.MaxDownloadConcurrency,
+		MaxDownloadKeep:             setting.MaxDownloadKeep,
+		AutoPauseAfterFailures:      setting.AutoPauseAfterFailures,
+		StaleFeedDays:               setting.StaleFeedDays,
+		EnclosurePreference:         string(setting.EnclosurePreference),
+		ProxyURL:                    setting.ProxyURL,
+		IPPreference:                string(setting.IPPreference),
+		ConnectTimeout:              setting.ConnectTimeout,
+		ReadTimeout:                 setting.ReadTimeout,
+		BandwidthLimit:              setting.BandwidthLimit,
+		HostBandwidthLimits:         setting.HostBandwidthLimits,
+		DownloadSchedule:            setting.DownloadSchedule,
+		EgressAllowlist:             setting.EgressAllowlist,
+		MaxRedirects:                setting.MaxRedirects,
+		PlayedThreshold:             setting.PlayedThreshold,
+		BlockPrivateNetworks:        setting.BlockPrivateNetworks,
+		AutoDownload:                setting.AutoDownload,
+		DownloadOnAdd:               setting.DownloadOnAdd,
+		DarkMode:                    setting.DarkMode,
+		DownloadEpisodeImages:       setting.DownloadEpisodeImages,
+		GenerateNFOFile:             setting.GenerateNFOFile,
+		DontDownloadDeletedFromDisk: setting.DontDownloadDeletedFromDisk,
+		PassthroughPodcastGUID:      setting.PassthroughPodcastGUID,
+		KeepRemovedUpstream:         setting.KeepRemovedUpstream,
+	}
+}
+
+// apiGetSettings returns the settings.
+func apiGetSettings(c *gin.Context) {
+	c.JSON(http.StatusOK, newSettingModel(visibleSetting(c, db.GetOrCreateSetting())))
+}
+
+// apiUpdateSettings replaces the settings; fields left out are reset to their zero value.
+func apiUpdateSettings(c *gin.Context) {
+	var settingModel SettingModel
+	if err := c.ShouldBindJSON(&settingModel); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	if err := settingModel.save(); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, newSettingModel(db.GetOrCreateSetting()))
+}
+
+// apiVersion returns the build information.
+func apiVersion(c *gin.Context) {
+	info, err := version.Get()
+	if err != nil {
+		apiLookupError(c, err, "")
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// apiListTokens lists the API tokens.
+func apiListTokens(c *gin.Context) {
+	tokens, err := service.GetAPITokens(currentUser(c).ID)
+	if err != nil {
+		apiLookupError(c, err, "")
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// apiAddToken creates an API token.
+func apiAddToken(c *gin.Context) {
+	var input AddAPITokenData
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	value, token, err := service.CreateAPIToken(currentUser(c).ID, input.Name, db.TokenScope(input.Scope), input.ExpiresInDays)
+	if errors.Is(err, service.ErrAdminScope) {
+		apiError(c, http.StatusForbidden, apiForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, CreatedAPIToken{APIToken: *token, Token: value})
+}
+
+// apiRevokeToken deletes an API token.
+func apiRevokeToken(c *gin.Context) {
+	if err := service.RevokeAPIToken(c.Param("id"), currentUser(c).ID); err != nil {
+		apiLookupError(c, err, "Token not found")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// newPlaybackProgress returns the progress held by an episode state.
+func newPlaybackProgress(state *db.EpisodeState) PlaybackProgress {
+	progress := PlaybackProgress{
+		EpisodeID: state.PodcastItemID,
+		Position:  state.Position,
+		Duration:  state.Duration,
+		IsPlayed:  state.IsPlayed,
+	}
+	if !state.PositionUpdatedAt.IsZero() {
+		progress.UpdatedAt = &state.PositionUpdatedAt
+	}
+	return progress
+}
+
+// apiGetProgress returns the current user's playback position in an episode.
+func apiGetProgress(c *gin.Context) {
+	state, err := service.GetPlaybackProgress(currentUser(c).ID, c.Param("id"))
+	if err != nil {
+		apiLookupError(c, err, "Episode not found")
+		return
+	}
+	c.JSON(http.StatusOK, newPlaybackProgress(state))
+}
+
+// apiPutProgress stores the current user's playback position in an episode.
+func apiPutProgress(c *gin.Context) {
+	var input PutProgressData
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	if *input.Position < 0 || input.Duration < 0 {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, "position and duration cannot be negative")
+		return
+	}
+	state, err := service.SavePlaybackProgress(currentUser(c).ID, c.Param("id"), *input.Position, input.Duration, time.Now())
+	if err != nil {
+		apiLookupError(c, err, "Episode not found")
+		return
+	}
+	c.JSON(http.StatusOK, newPlaybackProgress(state))
+}
+
+// apiQueue lists the episodes in the current user's queue, in order.
+func apiQueue(c *gin.Context) {
+	items, err := service.GetQueue(currentUser(c).ID)
+	if err != nil {
+		apiLookupError(c, err, "")
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// apiMe returns the current user.
+func apiMe(c *gin.Context) {
+	c.JSON(http.StatusOK, currentUser(c))
+}
+
+// apiRequireAdmin aborts the request unless the current user is an admin. what names
+// the resources in the error message.
+func apiRequireAdmin(c *gin.Context, what string) bool {
+	if !currentUser(c).IsAdmin {
+		apiError(c, http.StatusForbidden, apiForbidden, "Only admins can manage "+what)
+		return false
+	}
+	return true
+}
+
+// apiUserError reports a failed user change.
+func apiUserError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		apiError(c, http.StatusNotFound, apiNotFound, "User not found")
+	case errors.Is(err, service.ErrLastAdmin), errors.Is(err, service.ErrUserExists):
+		apiError(c, http.StatusConflict, apiConflict, err.Error())
+	case errors.Is(err, service.ErrWrongPassword):
+		apiError(c, http.StatusForbidden, apiForbidden, err.Error())
+	default:
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+	}
+}
+
+// apiListUsers lists the accounts.
+func apiListUsers(c *gin.Context) {
+	if !apiRequireAdmin(c, "users") {
+		return
+	}
+	users, err := service.GetAllUsers()
+	if err != nil {
+		apiLookupError(c, err, "")
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+// apiAddUser creates an account.
+func apiAddUser(c *gin.Context) {
+	if !apiRequireAdmin(c, "users") {
+		return
+	}
+	var input AddUserData
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	user, err := service.CreateUser(input.Username, input.Password, input.IsAdmin)
+	if err != nil {
+		apiUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, user)
+}
+
+// apiPatchUser changes the password or admin flag of an account. Users may change
+// their own password, giving the current one, everything else needs an admin.
+func apiPatchUser(c *gin.Context) {
+	var input PatchUser
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	id := c.Param("id")
+	if (id != currentUser(c).ID || input.IsAdmin != nil) && !apiRequireAdmin(c, "users") {
+		return
+	}
+	if id == currentUser(c).ID && input.Password != nil {
+		if err := service.CheckCurrentPassword(id, input.CurrentPassword); err != nil {
+			apiUserError(c, err)
+			return
+		}
+	}
+	user, err := service.UpdateUser(id, input.Password, input.IsAdmin)
+	if err != nil {
+		apiUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// apiDeleteUser deletes an account with its listening state.
+func apiDeleteUser(c *gin.Context) {
+	if !apiRequireAdmin(c, "users") {
+		return
+	}
+	if err := service.DeleteUser(c.Param("id")); err != nil {
+		apiUserError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// webhookInput returns the service input of a webhook request.
+func webhookInput(input *AddWebhookData) *service.WebhookInput {
+	return &service.WebhookInput{
+		Secret:  input.Secret,
+		Headers: input.Headers,
+		Enabled: input.Enabled,
+		Name:    input.Name,
+		URL:     input.URL,
+		Events:  input.Events,
+	}
+}
+
+// apiListWebhooks lists the webhooks.
+func apiListWebhooks(c *gin.Context) {
+	if !apiRequireAdmin(c, "webhooks") {
+		return
+	}
+	webhooks, err := service.GetAllWebhooks()
+	if err != nil {
+		apiLookupError(c, err, "")
+		return
+	}
+	c.JSON(http.StatusOK, webhooks)
+}
+
+// apiAddWebhook creates a webhook.
+func apiAddWebhook(c *gin.Context) {
+	if !apiRequireAdmin(c, "webhooks") {
+		return
+	}
+	var input AddWebhookData
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	webhook, err := service.CreateWebhook(webhookInput(&input))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, webhook)
+}
+
+// apiUpdateWebhook replaces the settings of a webhook.
+func apiUpdateWebhook(c *gin.Context) {
+	if !apiRequireAdmin(c, "webhooks") {
+		return
+	}
+	var input AddWebhookData
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	webhook, err := service.UpdateWebhook(c.Param("id"), webhookInput(&input))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apiLookupError(c, err, "Webhook not found")
+		return
+	}
+	if err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, webhook)
+}
+
+// apiDeleteWebhook deletes a webhook with its delivery log.
+func apiDeleteWebhook(c *gin.Context) {
+	if !apiRequireAdmin(c, "webhooks") {
+		return
+	}
+	if err := service.DeleteWebhook(c.Param("id")); err != nil {
+		apiLookupError(c, err, "Webhook not found")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// apiWebhookDeliveries lists the latest deliveries of a webhook.
+func apiWebhookDeliveries(c *gin.Context) {
+	if !apiRequireAdmin(c, "webhooks") {
+		return
+	}
+	deliveries, err := service.GetWebhookDeliveries(c.Param("id"))
+	if err != nil {
+		apiLookupError(c, err, "Webhook not found")
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// apiTestWebhook sends a test event to a webhook and returns the delivery.
+func apiTestWebhook(c *gin.Context) {
+	if !apiRequireAdmin(c, "webhooks") {
+		return
+	}
+	delivery, err := service.TestWebhook(c.Param("id"))
+	if err != nil {
+		apiLookupError(c, err, "Webhook not found")
+		return
+	}
+	c.JSON(http.StatusOK, delivery)
+}
+
+// notifierInput returns the service input of a notifier request.
+func notifierInput(input *AddNotifierData) *service.NotifierInput {
+	return &service.NotifierInput{
+		URL:           input.URL,
+		Enabled:       input.Enabled,
+		Name:          input.Name,
+		TitleTemplate: input.TitleTemplate,
+		BodyTemplate:  input.BodyTemplate,
+		Events:        input.Events,
+		PodcastIDs:    input.PodcastIDs,
+		AllPodcasts:   input.AllPodcasts,
+	}
+}
+
+// apiListNotifiers lists the notifiers.
+func apiListNotifiers(c *gin.Context) {
+	if !apiRequireAdmin(c, "notifiers") {
+		return
+	}
+	notifiers, err := service.GetAllNotifiers()
+	if err != nil {
+		apiLookupError(c, err, "")
+		return
+	}
+	c.JSON(http.StatusOK, notifiers)
+}
+
+// apiAddNotifier creates a notifier.
+func apiAddNotifier(c *gin.Context) {
+	if !apiRequireAdmin(c, "notifiers") {
+		return
+	}
+	var input AddNotifierData
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	notifier, err := service.CreateNotifier(notifierInput(&input))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, notifier)
+}
+
+// apiUpdateNotifier replaces the settings of a notifier.
+func apiUpdateNotifier(c *gin.Context) {
+	if !apiRequireAdmin(c, "notifiers") {
+		return
+	}
+	var input AddNotifierData
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	notifier, err := service.UpdateNotifier(c.Param("id"), notifierInput(&input))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apiLookupError(c, err, "Notifier not found")
+		return
+	}
+	if err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, notifier)
+}
+
+// apiDeleteNotifier deletes a notifier.
+func apiDeleteNotifier(c *gin.Context) {
+	if !apiRequireAdmin(c, "notifiers") {
+		return
+	}
+	if err := service.DeleteNotifier(c.Param("id")); err != nil {
+		apiLookupError(c, err, "Notifier not found")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// apiTestNotifier sends an example message through a notifier. Sending errors are
+// returned so that the settings can be fixed.
+func apiTestNotifier(c *gin.Context) {
+	if !apiRequireAdmin(c, "notifiers") {
+		return
+	}
+	err := service.TestNotifier(c.Param("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apiLookupError(c, err, "Notifier not found")
+		return
+	}
+	if err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,314 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/internal/logger"
+	"github.com/toozej/podgrab/service"
+)
+
+// sessionCookie is the name of the login session cookie.
+const sessionCookie = "podgrab_session"
+
+// Context keys set by Authenticate.
+const (
+	// userKey holds the *db.User a request acts for.
+	userKey = "user"
+	// apiTokenKey holds the *db.APIToken a request was authenticated with.
+	apiTokenKey = "apiToken"
+	// tokenQueryKey holds a token given as ?token=, which generated feeds pass on to
+	// the files they link.
+	tokenQueryKey = "tokenQuery"
+)
+
+// feedRoutes are the routes feeds tokens may use, and the only ones accepting ?token=
+// since podcast apps cannot send headers.
+var feedRoutes = map[string]bool{
+	"/rss":                    true,
+	"/podcasts/:id/rss":       true,
+	"/tags/:id/rss":           true,
+	"/podcasts/:id/image":     true,
+	"/podcastitems/:id/file":  true,
+	"/podcastitems/:id/image": true,
+}
+
+// mutatingGetRoutes are legacy routes that change state despite using GET, and the
+// websocket, whose messages save playback progress.
+var mutatingGetRoutes = map[string]bool{
+	"/podcasts/:id/download":         true,
+	"/podcasts/:id/refresh":          true,
+	"/podcasts/:id/pause":            true,
+	"/podcasts/:id/unpause":          true,
+	"/podcastitems/:id/markPlayed":   true,
+	"/podcastitems/:id/markUnplayed": true,
+	"/podcastitems/:id/bookmark":     true,
+	"/podcastitems/:id/unbookmark":   true,
+	"/podcastitems/:id/download":     true,
+	"/podcastitems/:id/delete":       true,
+	"/refreshAll":                    true,
+	"/ws":                            true,
+}
+
+// adminRoute reports whether a request needs an admin user, whatever it signed in with:
+// webhook and notifier management, changing the settings, and the database backups,
+// which hold the token and password hashes.
+func adminRoute(method, route string) bool {
+	switch {
+	case strings.HasPrefix(route, "/api/v1/webhooks"), strings.HasPrefix(route, "/api/v1/notifiers"),
+		strings.HasSuffix(route, "/backups/*filepath"), route == "/backups":
+		return true
+	case route == "/settings", route == "/api/v1/settings":
+		return method != http.MethodGet && method != http.MethodHead
+	}
+	return false
+}
+
+// adminScopeRoute reports whether a request needs an admin token even to read: the
+// admin routes, and token and user management, which users may do for themselves when
+// signed in with their password.
+func adminScopeRoute(method, route string) bool {
+	return adminRoute(method, route) || strings.HasPrefix(route, "/api/v1/tokens") ||
+		strings.HasPrefix(route, "/api/v1/users")
+}
+
+// syncRoute reports whether a route belongs to the gpodder or Nextcloud sync APIs.
+func syncRoute(route string) bool {
+	return strings.HasPrefix(route, "/api/2/") || strings.HasPrefix(route, "/index.php/apps/gpoddersync/")
+}
+
+// scopeAllows reports whether a token scope may make a request to a route.
+func scopeAllows(scope db.TokenScope, method, route string) bool {
+	if adminScopeRoute(method, route) {
+		return scope == db.TokenScopeAdmin
+	}
+	safe := method == http.MethodGet || method == http.MethodHead
+	switch scope {
+	case db.TokenScopeAdmin:
+		return true
+	case db.TokenScopeRead:
+		return safe && !mutatingGetRoutes[route]
+	case db.TokenScopeFeeds:
+		return safe && feedRoutes[route]
+	case db.TokenScopeSync:
+		return syncRoute(route)
+	}
+	return false
+}
+
+// Authenticate works out the user a request acts for, from an API token, a login
+// session or HTTP basic auth with a user name and password. Tokens are accepted as a
+// bearer header or basic auth password anywhere and as ?token= on feed and file URLs. Until an account has a
+// password, requests without credentials act for the default user; after that browsers
+// are sent to the login page and other clients get 401. Admin routes need an admin
+// user whichever way the request signed in.
+func Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := time.Now()
+		if value, fromQuery := requestToken(c); value != "" {
+			authenticateToken(c, value, fromQuery, now)
+			return
+		}
+		if value, err := c.Cookie(sessionCookie); err == nil && value != "" {
+			if user, err := service.AuthenticateSession(value, now); err == nil {
+				authorize(c, user)
+				return
+			}
+		}
+		if username, password, ok := c.Request.BasicAuth(); ok {
+			if service.IsAPITokenValue(password) {
+				authenticateToken(c, password, false, now)
+				return
+			}
+			if user, err := service.AuthenticatePassword(username, password); err == nil {
+				authorize(c, user)
+				return
+			}
+		}
+		required, err := service.LoginRequired()
+		if err != nil {
+			logger.Log.Errorw("checking whether login is required", "error", err)
+			authError(c, http.StatusInternalServerError, apiInternalError, "Could not check credentials")
+			return
+		}
+		if !required {
+			authorize(c, currentUser(c))
+			return
+		}
+		if c.Request.Method == http.MethodGet && strings.Contains(c.GetHeader("Accept"), "text/html") {
+			c.Redirect(http.StatusFound, "/login?next="+url.QueryEscape(c.Request.URL.RequestURI()))
+			c.Abort()
+			return
+		}
+		c.Header("WWW-Authenticate", `Basic realm="Podgrab"`)
+		authError(c, http.StatusUnauthorized, apiUnauthorized, "Authentication required")
+	}
+}
+
+// authenticateToken lets a request with an API token through when the token is valid
+// and its scope allows the request.
+func authenticateToken(c *gin.Context, value string, fromQuery bool, now time.Time) {
+	token, err := service.AuthenticateAPIToken(value, now)
+	if err != nil {
+		authError(c, http.StatusUnauthorized, apiUnauthorized, err.Error())
+		return
+	}
+	if !scopeAllows(token.Scope, c.Request.Method, c.FullPath()) {
+		authError(c, http.StatusForbidden, apiForbidden, "API token scope "+string(token.Scope)+" does not allow this request")
+		return
+	}
+	user, err := service.UserForAPIToken(token)
+	if err != nil {
+		authError(c, http.StatusUnauthorized, apiUnauthorized, err.Error())
+		return
+	}
+	c.Set(apiTokenKey, token)
+	if fromQuery {
+		c.Set(tokenQueryKey, value)
+	}
+	authorize(c, user)
+}
+
+// authorize lets a request through for a user, unless the route needs an admin and the
+// user is not one.
+func authorize(c *gin.Context, user *db.User) {
+	if adminRoute(c.Request.Method, c.FullPath()) && !user.IsAdmin {
+		authError(c, http.StatusForbidden, apiForbidden, "Only admins can do this")
+		return
+	}
+	c.Set(userKey, user)
+	c.Next()
+}
+
+// currentUser returns the user a request acts for. Handlers mounted without
+// Authenticate act for the default user.
+func currentUser(c *gin.Context) *db.User {
+	if value, ok := c.Get(userKey); ok {
+		if user, ok := value.(*db.User); ok {
+			return user
+		}
+	}
+	user, err := service.DefaultUser()
+	if err != nil {
+		logger.Log.Errorw("getting the default user", "error", err)
+		return &db.User{}
+	}
+	c.Set(userKey, user)
+	return user
+}
+
+// visibleSetting returns the settings the user of a request may see. Users who are not
+// admins get the proxy without its user and password, and no egress allowlist.
+func visibleSetting(c *gin.Context, setting *db.Setting) *db.Setting {
+	if currentUser(c).IsAdmin {
+		return setting
+	}
+	visible := *setting
+	visible.ProxyURL = service.RedactURL(setting.ProxyURL)
+	visible.EgressAllowlist = ""
+	return &visible
+}
+
+// requestToken returns the API token of a request and whether it came from the query.
+func requestToken(c *gin.Context) (string, bool) {
+	scheme, value, found := strings.Cut(c.GetHeader("Authorization"), " ")
+	if found && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(value), false
+	}
+	if value := c.Query("token"); value != "" && feedRoutes[c.FullPath()] {
+		return value, true
+	}
+	return "", false
+}
+
+// authError rejects a request, with the error envelope on /api paths.
+func authError(c *gin.Context, status int, code, message string) {
+	if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+		apiError(c, status, code, message)
+		return
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": message})
+}
+
+// feedTokenQuery returns the query string passing on the token a feed was requested
+// with, or an empty string.
+func feedTokenQuery(c *gin.Context) string {
+	if token := c.GetString(tokenQueryKey); token != "" {
+		return "?token=" + token
+	}
+	return ""
+}
+
+// LoginData represents login form data.
+type LoginData struct {
+	Username string `binding:"required" form:"username" json:"username"`
+	Password string `binding:"required" form:"password" json:"password"`
+	Next     string `form:"next" json:"next"`
+}
+
+// LoginPage handles the login page request.
+func LoginPage(c *gin.Context) {
+	renderLogin(c, http.StatusOK, c.Query("next"), "")
+}
+
+// Login handles the login request. It starts a session and goes on to the page that
+// asked for the login.
+func Login(c *gin.Context) {
+	var input LoginData
+	if err := c.ShouldBind(&input); err != nil {
+		renderLogin(c, http.StatusBadRequest, input.Next, "Enter your user name and password")
+		return
+	}
+	value, _, err := service.Login(input.Username, input.Password, time.Now())
+	if err != nil {
+		renderLogin(c, http.StatusUnauthorized, input.Next, "Invalid user name or password")
+		return
+	}
+	setSessionCookie(c, value, int(service.SessionDuration.Seconds()))
+	c.Redirect(http.StatusSeeOther, safeRedirect(input.Next))
+}
+
+// Logout handles the logout request.
+func Logout(c *gin.Context) {
+	if value, err := c.Cookie(sessionCookie); err == nil && value != "" {
+		if err := service.Logout(value); err != nil {
+			logger.Log.Errorw("ending session", "error", err)
+		}
+	}
+	setSessionCookie(c, "", -1)
+	c.Redirect(http.StatusSeeOther, "/login")
+}
+
+func renderLogin(c *gin.Context, status int, next, message string) {
+	setting, ok := c.MustGet("setting").(*db.Setting)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve settings"})
+		return
+	}
+	c.HTML(status, "login.html", gin.H{
+		"title":   "Log in",
+		"setting": setting,
+		"next":    safeRedirect(next),
+		"error":   message,
+	})
+}
+
+// setSessionCookie sets the session cookie, marked secure when the request came over
+// HTTPS, possibly through a proxy.
+func setSessionCookie(c *gin.Context, value string, maxAge int) {
+	secure := c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, value, maxAge, "/", "", secure, true)
+}
+
+// safeRedirect returns next when it is a path on this site, and the home page otherwise.
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
@@ -0,0 +1,295 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/service"
+)
+
+// setupAuthRouter creates the default user with password and a router with
+// Authenticate in front of stub handlers, which respond with the user name.
+func setupAuthRouter(t *testing.T, password string) *gin.Engine {
+	t.Helper()
+	_, err := service.EnsureDefaultUser(password)
+	require.NoError(t, err)
+	router := setupTestRouter()
+	router.POST("/login", Login)
+	router.POST("/logout", Logout)
+	group := router.Group("/", Authenticate())
+	ok := func(c *gin.Context) { c.String(http.StatusOK, currentUser(c).Username) }
+	group.GET("/", ok)
+	group.GET("/rss", ok)
+	group.GET("/podcastitems/:id/file", ok)
+	group.GET("/podcasts/:id/pause", ok)
+	group.GET("/backups/*filepath", ok)
+	group.GET("/settings", ok)
+	group.POST("/settings", ok)
+	api := group.Group("/api/v1")
+	api.GET("/podcasts", ok)
+	api.POST("/podcasts", ok)
+	api.GET("/tokens", ok)
+	api.POST("/tokens", apiAddToken)
+	api.GET("/webhooks", ok)
+	api.GET("/notifiers", ok)
+	group.POST("/api/2/episodes/:username", ok)
+	group.GET("/index.php/apps/gpoddersync/subscriptions", ok)
+	return router
+}
+
+// authRequest performs a request with an optional bearer token.
+func authRequest(router *gin.Engine, method, target, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthenticateTokenScopes(t *testing.T) {
+	_, _, cleanup := setupTestDBAndEnv(t)
+	defer cleanup()
+	router := setupAuthRouter(t, "secret-password")
+	admin, err := service.DefaultUser()
+	require.NoError(t, err)
+
+	tokens := map[db.TokenScope]string{}
+	for _, scope := range []db.TokenScope{db.TokenScopeFeeds, db.TokenScopeRead, db.TokenScopeSync, db.TokenScopeAdmin} {
+		value, _, err := service.CreateAPIToken(admin.ID, string(scope), scope, 0)
+		require.NoError(t, err)
+		tokens[scope] = value
+	}
+
+	tests := []struct {
+		method string
+		target string
+		want   map[db.TokenScope]int
+	}{
+		{http.MethodGet, "/rss", map[db.TokenScope]int{db.TokenScopeFeeds: 200, db.TokenScopeRead: 200, db.TokenScopeSync: 403, db.TokenScopeAdmin: 200}},
+		{http.MethodGet, "/podcastitems/1/file", map[db.TokenScope]int{db.TokenScopeFeeds: 200, db.TokenScopeRead: 200, db.TokenScopeSync: 403, db.TokenScopeAdmin: 200}},
+		{http.MethodGet, "/", map[db.TokenScope]int{db.TokenScopeFeeds: 403, db.TokenScopeRead: 200, db.TokenScopeSync: 403, db.TokenScopeAdmin: 200}},
+		{http.MethodGet, "/api/v1/podcasts", map[db.TokenScope]int{db.TokenScopeFeeds: 403, db.TokenScopeRead: 200, db.TokenScopeSync: 403, db.TokenScopeAdmin: 200}},
+		{http.MethodGet, "/podcasts/1/pause", map[db.TokenScope]int{db.TokenScopeFeeds: 403, db.TokenScopeRead: 403, db.TokenScopeSync: 403, db.TokenScopeAdmin: 200}},
+		{http.MethodPost, "/api/v1/podcasts", map[db.TokenScope]int{db.TokenScopeFeeds: 403, db.TokenScopeRead: 403, db.TokenScopeSync: 403, db.TokenScopeAdmin: 200}},
+		{http.MethodGet, "/api/v1/tokens", map[db.TokenScope]int{db.TokenScopeFeeds: 403, db.TokenScopeRead: 403, db.TokenScopeSync: 403, db.TokenScopeAdmin: 200}},
+		{http.MethodGet, "/api/v1/webhooks", map[db.TokenScope]int{db.TokenScopeFeeds: 403, db.TokenScopeRead: 403, db.TokenScopeSync: 403, db.TokenScopeAdmin: 200}},
+		{http.MethodGet, "/api/v1/notifiers", map[db.TokenScope]int{db.TokenScopeFeeds: 403, db.TokenScopeRead: 403, db.TokenScopeSync: 403, db.TokenScopeAdmin: 200}},
+		{http.MethodGet, "/backups/podgrab.db", map[db.TokenScope]int{db.TokenScopeFeeds: 403, db.TokenScopeRead: 403, db.TokenScopeSync: 403, db.TokenScopeAdmin: 200}},
+		{http.MethodPost, "/api/2/episodes/podgrab.json", map[db.TokenScope]int{db.TokenScopeFeeds: 403, db.TokenScopeRead: 403, db.TokenScopeSync: 200, db.TokenScopeAdmin: 200}},
+		{http.MethodGet, "/index.php/apps/gpoddersync/subscriptions", map[db.TokenScope]int{db.TokenScopeFeeds: 403, db.TokenScopeRead: 200, db.TokenScopeSync: 200, db.TokenScopeAdmin: 200}},
+	}
+	for _, tt := range tests {
+		for scope, status := range tt.want {
+			w := authRequest(router, tt.method, tt.target, tokens[scope])
+			assert.Equal(t, status, w.Code, "%s %s with a %s token", tt.method, tt.target, scope)
+		}
+	}
+
+	w := authRequest(router, http.MethodPost, "/api/v1/podcasts", tokens[db.TokenScopeRead])
+	assertAPIError(t, w, http.StatusForbidden, apiForbidden)
+}
+
+func TestAuthenticateCredentials(t *testing.T) {
+	_, _, cleanup := setupTestDBAndEnv(t)
+	defer cleanup()
+	router := setupAuthRouter(t, "secret-password")
+	alice, err := service.CreateUser("alice", "alice-password", false)
+	require.NoError(t, err)
+
+	value, _, err := service.CreateAPIToken(alice.ID, "Phone", db.TokenScopeFeeds, 0)
+	require.NoError(t, err)
+
+	w := authRequest(router, http.MethodGet, "/rss?token="+value, "")
+	assert.Equal(t, http.StatusOK, w.Code, "Feed routes should accept the token in the query")
+	assert.Equal(t, "alice", w.Body.String(), "Tokens should act for their user")
+	w = authRequest(router, http.MethodGet, "/api/v1/podcasts?token="+value, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "Other routes should ignore a token in the query")
+
+	w = authRequest(router, http.MethodGet, "/rss", "pg_unknown")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = authRequest(router, http.MethodGet, "/api/v1/podcasts", "pg_unknown")
+	assertAPIError(t, w, http.StatusUnauthorized, apiUnauthorized)
+
+	w = authRequest(router, http.MethodGet, "/", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+
+	req := httptest.NewRequest(http.MethodGet, "/podcasts/1/pause?x=1", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code, "Browsers should be sent to the login page")
+	assert.Equal(t, "/login?next="+url.QueryEscape("/podcasts/1/pause?x=1"), w.Header().Get("Location"))
+
+	for _, tt := range []struct {
+		user, password string
+		status         int
+	}{
+		{service.DefaultUsername, "secret-password", http.StatusOK},
+		{"alice", "alice-password", http.StatusOK},
+		{service.DefaultUsername, "wrong", http.StatusUnauthorized},
+		{"admin", "secret-password", http.StatusUnauthorized},
+		{"alice", value, http.StatusForbidden},
+		{"alice", "pg_unknown", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(tt.user, tt.password)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tt.status, w.Code, "basic auth as %s:%s", tt.user, tt.password)
+	}
+
+}
+
+func TestAuthenticateAdminRoutes(t *testing.T) {
+	_, _, cleanup := setupTestDBAndEnv(t)
+	defer cleanup()
+	router := setupAuthRouter(t, "secret-password")
+	_, err := service.CreateUser("alice", "alice-password", false)
+	require.NoError(t, err)
+
+	form := url.Values{"username": {"alice"}, "password": {"alice-password"}}
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	cookies := w.Result().Cookies()
+
+	request := func(method, target, body string, login func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		login(req)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	session := func(req *http.Request) {
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+	}
+	basic := func(username, password string) func(*http.Request) {
+		return func(req *http.Request) { req.SetBasicAuth(username, password) }
+	}
+	admin := basic(service.DefaultUsername, "secret-password")
+
+	for _, login := range []func(*http.Request){session, basic("alice", "alice-password")} {
+		assert.Equal(t, http.StatusForbidden, request(http.MethodGet, "/backups/podgrab.db", "", login).Code)
+		assert.Equal(t, http.StatusForbidden, request(http.MethodPost, "/settings", "", login).Code)
+		assert.Equal(t, http.StatusOK, request(http.MethodGet, "/settings", "", login).Code)
+		assertAPIError(t, request(http.MethodGet, "/api/v1/webhooks", "", login), http.StatusForbidden, apiForbidden)
+	}
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/backups/podgrab.db", "", admin).Code)
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, "/settings", "", admin).Code)
+
+	w = request(http.MethodPost, "/api/v1/tokens", `{"name":"Root","scope":"admin"}`, session)
+	assertAPIError(t, w, http.StatusForbidden, apiForbidden)
+	w = request(http.MethodPost, "/api/v1/tokens", `{"name":"Phone","scope":"read"}`, session)
+	assert.Equal(t, http.StatusCreated, w.Code, "Users should still create their own tokens")
+	w = request(http.MethodPost, "/api/v1/tokens", `{"name":"Root","scope":"admin"}`, admin)
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestAuthenticateOpenWithoutPassword(t *testing.T) {
+	_, _, cleanup := setupTestDBAndEnv(t)
+	defer cleanup()
+	open := setupAuthRouter(t, "")
+
+	w := authRequest(open, http.MethodGet, "/", "")
+	assert.Equal(t, http.StatusOK, w.Code, "No password should leave the app open")
+	assert.Equal(t, service.DefaultUsername, w.Body.String())
+	assert.Equal(t, http.StatusUnauthorized, authRequest(open, http.MethodGet, "/", "pg_unknown").Code)
+}
+
+func TestLoginSession(t *testing.T) {
+	_, _, cleanup := setupTestDBAndEnv(t)
+	defer cleanup()
+	router := setupAuthRouter(t, "secret-password")
+	_, err := service.CreateUser("alice", "alice-password", false)
+	require.NoError(t, err)
+
+	form := url.Values{"username": {"alice"}, "password": {"alice-password"}, "next": {"/podcasts/1/pause"}}
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/podcasts/1/pause", w.Header().Get("Location"))
+
+	var session *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == sessionCookie {
+			session = cookie
+		}
+	}
+	require.NotNil(t, session)
+	assert.True(t, session.HttpOnly)
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(session)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "alice", w.Body.String())
+
+	req = httptest.NewRequest(http.MethodPost, "/logout", nil)
+	req.AddCookie(session)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(session)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "Logging out should end the session")
+}
+
+func TestSafeRedirect(t *testing.T) {
+	for next, want := range map[string]string{
+		"":                     "/",
+		"/":                    "/",
+		"/podcasts/1?x=1":      "/podcasts/1?x=1",
+		"//evil.example":       "/",
+		"/\\evil.example":      "/",
+		"https://evil.example": "/",
+	} {
+		assert.Equal(t, want, safeRedirect(next), "next %q", next)
+	}
+}
+
+func TestRssPassesOnFeedToken(t *testing.T) {
+	database, _, cleanup := setupTestDBAndEnv(t)
+	defer cleanup()
+
+	setting := db.CreateTestSetting(t, database)
+	setting.BaseURL = "http://podgrab.local"
+	podcast := db.CreateTestPodcast(t, database)
+	item := db.CreateTestPodcastItem(t, database, podcast.ID)
+
+	router := setupTestRouter()
+	router.GET("/podcasts/:id/rss", func(c *gin.Context) { c.Set("setting", setting) }, Authenticate(), GetRssForPodcastByID)
+
+	user, err := service.EnsureDefaultUser("secret-password")
+	require.NoError(t, err)
+	value, _, err := service.CreateAPIToken(user.ID, "Phone", db.TokenScopeFeeds, 0)
+	require.NoError(t, err)
+
+	w := authRequest(router, http.MethodGet, "/podcasts/"+podcast.ID+"/rss?token="+value, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "http://podgrab.local/podcastitems/"+item.ID+"/file?token="+value)
+
+	w = authRequest(router, http.MethodGet, "/podcasts/"+podcast.ID+"/rss", value)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "token=", "A bearer token should not be written into the feed")
+}
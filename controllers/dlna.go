@@ -0,0 +1,358 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/internal/logger"
+	"github.com/toozej/podgrab/model"
+	"github.com/toozej/podgrab/pkg/version"
+	"github.com/toozej/podgrab/service"
+)
+
+// soapEnvelopeStart and soapEnvelopeEnd wrap the body of every SOAP response.
+const (
+	soapEnvelopeStart = `<?xml version="1.0" encoding="utf-8"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`
+	soapEnvelopeEnd = `</s:Body></s:Envelope>`
+)
+
+// RegisterDLNARoutes adds the UPnP MediaServer under /dlna: the device description,
+// the ContentDirectory and ConnectionManager services with their event subscriptions,
+// and the files and images they list. Players on the LAN find it through service.AdvertiseDLNA and use it without
+// logging in.
+func RegisterDLNARoutes(group *gin.RouterGroup, server *service.DLNAServer) {
+	group.Use(func(c *gin.Context) {
+		c.Header("Server", service.DLNAServerHeader)
+		c.Next()
+	})
+	group.GET("/description.xml", func(c *gin.Context) {
+		c.XML(http.StatusOK, newUPnPDescription(server))
+	})
+	group.GET("/ContentDirectory.xml", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/xml; charset=utf-8", []byte(contentDirectorySCPD))
+	})
+	group.GET("/ConnectionManager.xml", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/xml; charset=utf-8", []byte(connectionManagerSCPD))
+	})
+	group.POST("/control/ContentDirectory", dlnaContentDirectory)
+	group.POST("/control/ConnectionManager", dlnaConnectionManager)
+	for name, serviceType := range map[string]string{
+		"ContentDirectory":  service.DLNAContentDirectoryType,
+		"ConnectionManager": service.DLNAConnectionManagerType,
+	} {
+		group.Handle("SUBSCRIBE", "/event/"+name, dlnaSubscribe(serviceType))
+		group.Handle("UNSUBSCRIBE", "/event/"+name, dlnaUnsubscribe)
+	}
+	for _, handle := range []func(string, ...gin.HandlerFunc) gin.IRoutes{group.GET, group.HEAD} {
+		handle("/media/:id", dlnaMedia)
+		handle("/images/podcasts/:id", dlnaPodcastImage)
+		handle("/images/episodes/:id", dlnaEpisodeImage)
+	}
+}
+
+// newUPnPDescription returns the device description of the media server.
+func newUPnPDescription(server *service.DLNAServer) model.UPnPDescription {
+	return model.UPnPDescription{
+		XmlnsDLNA:   "urn:schemas-dlna-org:device-1-0",
+		SpecVersion: model.UPnPSpecVersion{Major: 1, Minor: 0},
+		Device: model.UPnPDevice{
+			DeviceType:       service.DLNADeviceType,
+			FriendlyName:     server.Name,
+			Manufacturer:     "Podgrab",
+			ManufacturerURL:  "https://github.com/toozej/podgrab",
+			ModelDescription: "Podgrab podcast media server",
+			ModelName:        "Podgrab",
+			ModelNumber:      version.Version,
+			ModelURL:         "https://github.com/toozej/podgrab",
+			UDN:              "uuid:" + server.UUID,
+			DLNADoc:          "DMS-1.50",
+			Services: []model.UPnPService{
+				{
+					ServiceType: service.DLNAContentDirectoryType,
+					ServiceID:   "urn:upnp-org:serviceId:ContentDirectory",
+					SCPDURL:     "/dlna/ContentDirectory.xml",
+					ControlURL:  "/dlna/control/ContentDirectory",
+					EventSubURL: "/dlna/event/ContentDirectory",
+				},
+				{
+					ServiceType: service.DLNAConnectionManagerType,
+					ServiceID:   "urn:upnp-org:serviceId:ConnectionManager",
+					SCPDURL:     "/dlna/ConnectionManager.xml",
+					ControlURL:  "/dlna/control/ConnectionManager",
+					EventSubURL: "/dlna/event/ConnectionManager",
+				},
+			},
+		},
+	}
+}
+
+// dlnaSubscribe handles GENA subscriptions to the events of a service, and their
+// renewals, which carry a SID instead of a CALLBACK.
+func dlnaSubscribe(serviceType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sid := c.GetHeader("SID")
+		if sid != "" {
+			if c.GetHeader("CALLBACK") != "" || c.GetHeader("NT") != "" {
+				c.Status(http.StatusBadRequest)
+				return
+			}
+			if err := service.RenewDLNAEvents(sid, time.Now()); err != nil {
+				c.Status(http.StatusPreconditionFailed)
+				return
+			}
+		} else {
+			if c.GetHeader("NT") != "upnp:event" {
+				c.Status(http.StatusPreconditionFailed)
+				return
+			}
+			var err error
+			sid, err = service.SubscribeDLNAEvents(serviceType, c.GetHeader("CALLBACK"), net.ParseIP(c.RemoteIP()), time.Now())
+			if err != nil {
+				logger.Log.Debugw("subscribing to DLNA events", "error", err)
+				c.Status(http.StatusPreconditionFailed)
+				return
+			}
+		}
+		c.Header("SID", sid)
+		c.Header("TIMEOUT", "Second-"+strconv.Itoa(int(service.DLNAEventTimeout.Seconds())))
+		c.Status(http.StatusOK)
+	}
+}
+
+// dlnaUnsubscribe cancels a GENA subscription.
+func dlnaUnsubscribe(c *gin.Context) {
+	if err := service.UnsubscribeDLNAEvents(c.GetHeader("SID")); err != nil {
+		c.Status(http.StatusPreconditionFailed)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// dlnaContentDirectory handles the ContentDirectory actions players browse with.
+func dlnaContentDirectory(c *gin.Context) {
+	action, args, err := parseSOAPAction(c.Request.Body)
+	if err != nil {
+		soapFault(c, &service.DLNAError{Code: service.DLNAErrorInvalidAction, Description: "Invalid Action"})
+		return
+	}
+	switch action {
+	case "Browse":
+		dlnaBrowse(c, args)
+	case "GetSystemUpdateID":
+		updateID, err := service.DLNASystemUpdateID()
+		if err != nil {
+			soapFault(c, err)
+			return
+		}
+		soapRespond(c, service.DLNAContentDirectoryType, action, [][2]string{{"Id", strconv.FormatUint(uint64(updateID), 10)}})
+	case "GetSearchCapabilities":
+		soapRespond(c, service.DLNAContentDirectoryType, action, [][2]string{{"SearchCaps", ""}})
+	case "GetSortCapabilities":
+		soapRespond(c, service.DLNAContentDirectoryType, action, [][2]string{{"SortCaps", ""}})
+	default:
+		soapFault(c, &service.DLNAError{Code: service.DLNAErrorInvalidAction, Description: "Invalid Action"})
+	}
+}
+
+// dlnaBrowse answers a Browse with the DIDL-Lite of an object or its children.
+func dlnaBrowse(c *gin.Context, args map[string]string) {
+	invalidArgs := &service.DLNAError{Code: service.DLNAErrorInvalidArgs, Description: "Invalid Args"}
+	flag := args["BrowseFlag"]
+	if flag != "BrowseMetadata" && flag != "BrowseDirectChildren" {
+		soapFault(c, invalidArgs)
+		return
+	}
+	start, startErr := parseSOAPUint(args["StartingIndex"])
+	count, countErr := parseSOAPUint(args["RequestedCount"])
+	if startErr != nil || countErr != nil {
+		soapFault(c, invalidArgs)
+		return
+	}
+	didl, total, err := service.BrowseDLNA(args["ObjectID"], flag == "BrowseMetadata", start, count, "http://"+c.Request.Host)
+	if err != nil {
+		soapFault(c, err)
+		return
+	}
+	result, err := xml.Marshal(didl)
+	if err != nil {
+		soapFault(c, err)
+		return
+	}
+	updateID, err := service.DLNASystemUpdateID()
+	if err != nil {
+		soapFault(c, err)
+		return
+	}
+	soapRespond(c, service.DLNAContentDirectoryType, "Browse", [][2]string{
+		{"Result", string(result)},
+		{"NumberReturned", strconv.Itoa(len(didl.Containers) + len(didl.Items))},
+		{"TotalMatches", strconv.Itoa(total)},
+		{"UpdateID", strconv.FormatUint(uint64(updateID), 10)},
+	})
+}
+
+// dlnaConnectionManager handles the ConnectionManager actions. Podgrab only serves
+// files over HTTP, so there is just the default connection.
+func dlnaConnectionManager(c *gin.Context) {
+	action, _, err := parseSOAPAction(c.Request.Body)
+	if err != nil {
+		soapFault(c, &service.DLNAError{Code: service.DLNAErrorInvalidAction, Description: "Invalid Action"})
+		return
+	}
+	switch action {
+	case "GetProtocolInfo":
+		soapRespond(c, service.DLNAConnectionManagerType, action, [][2]string{
+			{"Source", service.DLNASourceProtocolInfo()},
+			{"Sink", ""},
+		})
+	case "GetCurrentConnectionIDs":
+		soapRespond(c, service.DLNAConnectionManagerType, action, [][2]string{{"ConnectionIDs", "0"}})
+	case "GetCurrentConnectionInfo":
+		soapRespond(c, service.DLNAConnectionManagerType, action, [][2]string{
+			{"RcsID", "-1"},
+			{"AVTransportID", "-1"},
+			{"ProtocolInfo", ""},
+			{"PeerConnectionManager", ""},
+			{"PeerConnectionID", "-1"},
+			{"Direction", "Output"},
+			{"Status", "OK"},
+		})
+	default:
+		soapFault(c, &service.DLNAError{Code: service.DLNAErrorInvalidAction, Description: "Invalid Action"})
+	}
+}
+
+// dlnaMedia serves the downloaded file of an episode with the headers DLNA renderers
+// expect. Episodes that are not downloaded are not listed, so they are not served.
+func dlnaMedia(c *gin.Context) {
+	var item db.PodcastItem
+	if err := db.GetPodcastItemByID(c.Param("id"), &item); err != nil || item.DownloadStatus != db.Downloaded {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if _, err := os.Stat(item.DownloadPath); err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	contentType := service.EpisodeMediaType(&item)
+	c.Header("Content-Type", contentType)
+	c.Header("transferMode.dlna.org", "Streaming")
+	c.Header("contentFeatures.dlna.org", service.DLNAContentFeatures(contentType))
+	c.File(item.DownloadPath)
+}
+
+// dlnaPodcastImage serves the cover of a podcast.
+func dlnaPodcastImage(c *gin.Context) {
+	var podcast db.Podcast
+	if err := db.GetPodcastByID(c.Param("id"), &podcast); err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	servePodcastImage(c, &podcast)
+}
+
+// dlnaEpisodeImage serves the image of an episode.
+func dlnaEpisodeImage(c *gin.Context) {
+	var item db.PodcastItem
+	if err := db.GetPodcastItemByID(c.Param("id"), &item); err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	servePodcastItemImage(c, &item)
+}
+
+// parseSOAPAction returns the action of a SOAP request body and its arguments.
+func parseSOAPAction(body io.Reader) (string, map[string]string, error) {
+	decoder := xml.NewDecoder(body)
+	var action string
+	args := make(map[string]string)
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			depth++
+			switch depth {
+			// Envelope, Body, the action and then its arguments.
+			case 3:
+				action = element.Name.Local
+			case 4:
+				var value string
+				if err := decoder.DecodeElement(&value, &element); err != nil {
+					return "", nil, err
+				}
+				args[element.Name.Local] = value
+				depth--
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+	if action == "" {
+		return "", nil, errors.New("SOAP request without an action")
+	}
+	return action, args, nil
+}
+
+// parseSOAPUint parses an unsigned integer argument, which may be left empty for 0.
+func parseSOAPUint(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	parsed, err := strconv.ParseUint(value, 10, 31)
+	return int(parsed), err
+}
+
+// soapRespond writes the response of an action, with its arguments in order.
+func soapRespond(c *gin.Context, serviceType, action string, args [][2]string) {
+	var body strings.Builder
+	body.WriteString(soapEnvelopeStart)
+	body.WriteString(`<u:` + action + `Response xmlns:u="` + serviceType + `">`)
+	for _, arg := range args {
+		body.WriteString("<" + arg[0] + ">")
+		if err := xml.EscapeText(&body, []byte(arg[1])); err != nil {
+			soapFault(c, err)
+			return
+		}
+		body.WriteString("</" + arg[0] + ">")
+	}
+	body.WriteString(`</u:` + action + `Response>`)
+	body.WriteString(soapEnvelopeEnd)
+	c.Data(http.StatusOK, `text/xml; charset="utf-8"`, []byte(body.String()))
+}
+
+// soapFault reports a failed action as a UPnP error. Errors other than DLNA ones are
+// logged and reported as a generic failure.
+func soapFault(c *gin.Context, err error) {
+	var dlnaErr *service.DLNAError
+	if !errors.As(err, &dlnaErr) {
+		logger.Log.Errorw("dlna request", "error", err, "path", c.FullPath())
+		dlnaErr = &service.DLNAError{Code: service.DLNAErrorActionFailed, Description: "Action Failed"}
+	}
+	var body strings.Builder
+	body.WriteString(soapEnvelopeStart)
+	body.WriteString(`<s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail>`)
+	body.WriteString(`<UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>` + strconv.Itoa(dlnaErr.Code) + `</errorCode><errorDescription>`)
+	if escapeErr := xml.EscapeText(&body, []byte(dlnaErr.Description)); escapeErr != nil {
+		logger.Log.Errorw("escaping UPnP error", "error", escapeErr)
+	}
+	body.WriteString(`</errorDescription></UPnPError></detail></s:Fault>`)
+	body.WriteString(soapEnvelopeEnd)
+	c.Data(http.StatusInternalServerError, `text/xml; charset="utf-8"`, []byte(body.String()))
+}
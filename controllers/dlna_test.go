@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/model"
+	"github.com/toozej/podgrab/service"
+)
+
+// soapRequest returns a SOAP request calling a ContentDirectory action.
+func soapRequest(action, args string) *http.Request {
+	body := `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>` +
+		`<u:` + action + ` xmlns:u="` + service.DLNAContentDirectoryType + `">` + args + `</u:` + action + `></s:Body></s:Envelope>`
+	req := httptest.NewRequest(http.MethodPost, "/dlna/control/ContentDirectory", strings.NewReader(body))
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPACTION", `"`+service.DLNAContentDirectoryType+"#"+action+`"`)
+	return req
+}
+
+// browseResponse is the Browse response inside a SOAP envelope.
+type browseResponse struct {
+	Body struct {
+		Browse struct {
+			Result         string
+			NumberReturned int
+			TotalMatches   int
+		} `xml:"BrowseResponse"`
+		Fault struct {
+			Code int `xml:"detail>UPnPError>errorCode"`
+		}
+	}
+}
+
+func TestDLNA(t *testing.T) {
+	database, _, cleanup := setupTestDBAndEnv(t)
+	defer cleanup()
+	router := setupTestRouter()
+	server := &service.DLNAServer{Name: "Living room", Port: 8200, UUID: "1c530393-3513-5f1b-a914-40b9ebcf2d96"}
+	RegisterDLNARoutes(router.Group("/dlna"), server)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dlna/description.xml", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var description model.UPnPDescription
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &description))
+	assert.Equal(t, "Living room", description.Device.FriendlyName)
+	assert.Equal(t, "uuid:"+server.UUID, description.Device.UDN)
+	for _, upnpService := range description.Device.Services {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, upnpService.SCPDURL, nil))
+		assert.Equal(t, http.StatusOK, w.Code, upnpService.SCPDURL)
+	}
+
+	podcast := db.CreateTestPodcast(t, database)
+	// Outside the data folder, which the legacy file route searches.
+	filePath := filepath.Join(t.TempDir(), "episode.mp3")
+	require.NoError(t, os.WriteFile(filePath, []byte("fake audio content"), 0o644))
+	local := db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{
+		DownloadPath:   filePath,
+		DownloadStatus: db.Downloaded,
+	})
+	remote := db.CreateTestPodcastItem(t, database, podcast.ID)
+
+	w = httptest.NewRecorder()
+	req := soapRequest("Browse", `<ObjectID>podcast/`+podcast.ID+`</ObjectID><BrowseFlag>BrowseDirectChildren</BrowseFlag>`+
+		`<Filter>*</Filter><StartingIndex>0</StartingIndex><RequestedCount>0</RequestedCount><SortCriteria></SortCriteria>`)
+	req.Host = "192.168.1.2:8200"
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response browseResponse
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 1, response.Body.Browse.NumberReturned)
+	assert.Equal(t, 1, response.Body.Browse.TotalMatches)
+	var didl model.DIDLLite
+	require.NoError(t, xml.Unmarshal([]byte(response.Body.Browse.Result), &didl), response.Body.Browse.Result)
+	require.Len(t, didl.Items, 1)
+	require.Len(t, didl.Items[0].Resources, 1)
+	assert.Equal(t, "http://192.168.1.2:8200/dlna/media/"+local.ID, didl.Items[0].Resources[0].URL)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, soapRequest("Browse", `<ObjectID>podcast/missing</ObjectID><BrowseFlag>BrowseMetadata</BrowseFlag>`))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	response = browseResponse{}
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, service.DLNAErrorNoSuchObject, response.Body.Fault.Code)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, soapRequest("Browse", `<ObjectID>0</ObjectID><BrowseFlag>BrowseEverything</BrowseFlag>`))
+	response = browseResponse{}
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, service.DLNAErrorInvalidArgs, response.Body.Fault.Code)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, soapRequest("DestroyObject", `<ObjectID>0</ObjectID>`))
+	response = browseResponse{}
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, service.DLNAErrorInvalidAction, response.Body.Fault.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dlna/media/"+local.ID, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "fake audio content", w.Body.String())
+	assert.Equal(t, "audio/mpeg", w.Header().Get("Content-Type"))
+	assert.Equal(t, "Streaming", w.Header().Get("transferMode.dlna.org"))
+	assert.Contains(t, w.Header().Get("contentFeatures.dlna.org"), "DLNA.ORG_OP=01")
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/dlna/media/"+local.ID, nil)
+	req.Header.Set("Range", "bytes=5-9")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPartialContent, w.Code, "Renderers seek with ranges")
+	assert.Equal(t, "audio", w.Body.String())
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/dlna/media/"+local.ID, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dlna/media/"+remote.ID, nil))
+	assert.Equal(t, http.StatusNotFound, w.Code, "Only downloaded episodes are served")
+}
+
+// TestDLNAEvents tests subscribing to the events of the DLNA services.
+func TestDLNAEvents(t *testing.T) {
+	_, _, cleanup := setupTestDBAndEnv(t)
+	defer cleanup()
+	router := setupTestRouter()
+	server := &service.DLNAServer{Name: "Living room", Port: 8200, UUID: "1c530393-3513-5f1b-a914-40b9ebcf2d96"}
+	RegisterDLNARoutes(router.Group("/dlna"), server)
+
+	type event struct {
+		header http.Header
+		body   string
+	}
+	events := make(chan event, 2)
+	player := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "NOTIFY", r.Method)
+		events <- event{header: r.Header, body: string(body)}
+	}))
+	defer player.Close()
+
+	request := func(method, path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "127.0.0.1:50000"
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	subscribe := map[string]string{"CALLBACK": "<" + player.URL + "/event>", "NT": "upnp:event", "TIMEOUT": "Second-300"}
+
+	w := request("SUBSCRIBE", "/dlna/event/ContentDirectory", subscribe)
+	require.Equal(t, http.StatusOK, w.Code)
+	sid := w.Header().Get("SID")
+	assert.True(t, strings.HasPrefix(sid, "uuid:"), sid)
+	assert.Equal(t, "Second-1800", w.Header().Get("TIMEOUT"))
+	received := <-events
+	assert.Equal(t, sid, received.header.Get("SID"))
+	assert.Equal(t, "upnp:propchange", received.header.Get("NTS"))
+	assert.Equal(t, "0", received.header.Get("SEQ"))
+	assert.Contains(t, received.body, "<SystemUpdateID>0</SystemUpdateID>")
+
+	w = request("SUBSCRIBE", "/dlna/event/ContentDirectory", map[string]string{"SID": sid})
+	assert.Equal(t, http.StatusOK, w.Code, "Should renew subscriptions")
+	assert.Equal(t, sid, w.Header().Get("SID"))
+	w = request("SUBSCRIBE", "/dlna/event/ContentDirectory", map[string]string{"SID": sid, "NT": "upnp:event"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = request("UNSUBSCRIBE", "/dlna/event/ContentDirectory", map[string]string{"SID": sid})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = request("SUBSCRIBE", "/dlna/event/ContentDirectory", map[string]string{"SID": sid})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code, "Should not renew cancelled subscriptions")
+	w = request("UNSUBSCRIBE", "/dlna/event/ContentDirectory", map[string]string{"SID": sid})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = request("SUBSCRIBE", "/dlna/event/ConnectionManager", subscribe)
+	require.Equal(t, http.StatusOK, w.Code)
+	received = <-events
+	assert.Contains(t, received.body, "http-get:*:audio/mpeg:")
+	assert.Contains(t, received.body, "<CurrentConnectionIDs>0</CurrentConnectionIDs>")
+
+	w = request("SUBSCRIBE", "/dlna/event/ContentDirectory", map[string]string{"CALLBACK": "<http://10.0.0.9/event>", "NT": "upnp:event"})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code, "Should only send events to the subscriber")
+	w = request("SUBSCRIBE", "/dlna/event/ContentDirectory", map[string]string{"CALLBACK": subscribe["CALLBACK"]})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+}
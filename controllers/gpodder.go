@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/internal/logger"
+	"github.com/toozej/podgrab/model"
+	"github.com/toozej/podgrab/service"
+)
+
+// RegisterGPodderRoutes adds the gpodder.net v2 sync API used by podcast apps such as
+// AntennaPod, gPodder and Kasts.
+func RegisterGPodderRoutes(group *gin.RouterGroup) {
+	group.POST("/auth/:username/login.json", gpodderLogin)
+	group.POST("/auth/:username/logout.json", gpodderLogout)
+	group.GET("/devices/:username", gpodderGetDevices)
+	group.POST("/devices/:username/:device", gpodderUpdateDevice)
+	group.GET("/subscriptions/:username/:device", gpodderGetSubscriptions)
+	group.POST("/subscriptions/:username/:device", gpodderUploadSubscriptions)
+	group.GET("/episodes/:username", gpodderGetEpisodeActions)
+	group.POST("/episodes/:username", gpodderUploadEpisodeActions)
+}
+
+// gpodderParam returns a path parameter without the format suffix gpodder URLs carry.
+func gpodderParam(c *gin.Context, name string) string {
+	return strings.TrimSuffix(c.Param(name), ".json")
+}
+
+// gpodderUser returns the user a request acts for when it matches the user name in the
+// path, and rejects the request otherwise.
+func gpodderUser(c *gin.Context) (*db.User, bool) {
+	user := currentUser(c)
+	if user.Username != gpodderParam(c, "username") {
+		apiError(c, http.StatusUnauthorized, apiUnauthorized, "User name does not match the credentials")
+		return nil, false
+	}
+	return user, true
+}
+
+// gpodderSince reads the since query parameter, a Unix timestamp.
+func gpodderSince(c *gin.Context) (time.Time, bool) {
+	value := c.DefaultQuery("since", "0")
+	since, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || since < 0 {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, "Invalid since timestamp: "+value)
+		return time.Time{}, false
+	}
+	if since == 0 {
+		return time.Time{}, true
+	}
+	return time.Unix(since, 0), true
+}
+
+// gpodderLogin starts a session for a client that sent its credentials.
+func gpodderLogin(c *gin.Context) {
+	user, ok := gpodderUser(c)
+	if !ok {
+		return
+	}
+	if value, err := c.Cookie(sessionCookie); err == nil && value != "" {
+		if _, err := service.AuthenticateSession(value, time.Now()); err == nil {
+			c.Status(http.StatusOK)
+			return
+		}
+	}
+	value, err := service.StartSession(user.ID, time.Now())
+	if err != nil {
+		logger.Log.Errorw("starting gpodder session", "error", err)
+		apiError(c, http.StatusInternalServerError, apiInternalError, "Could not start a session")
+		return
+	}
+	setSessionCookie(c, value, int(service.SessionDuration.Seconds()))
+	c.Status(http.StatusOK)
+}
+
+// gpodderLogout ends the session of a client.
+func gpodderLogout(c *gin.Context) {
+	if _, ok := gpodderUser(c); !ok {
+		return
+	}
+	if value, err := c.Cookie(sessionCookie); err == nil && value != "" {
+		if err := service.Logout(value); err != nil {
+			logger.Log.Errorw("ending session", "error", err)
+		}
+	}
+	setSessionCookie(c, "", -1)
+	c.Status(http.StatusOK)
+}
+
+// gpodderGetDevices lists the devices of a user.
+func gpodderGetDevices(c *gin.Context) {
+	user, ok := gpodderUser(c)
+	if !ok {
+		return
+	}
+	devices, err := service.GetGPodderDevices(user.ID)
+	if err != nil {
+		logger.Log.Errorw("getting gpodder devices", "error", err)
+		apiError(c, http.StatusInternalServerError, apiInternalError, "Internal error")
+		return
+	}
+	c.JSON(http.StatusOK, devices)
+}
+
+// gpodderUpdateDevice creates a device or changes its caption and type.
+func gpodderUpdateDevice(c *gin.Context) {
+	user, ok := gpodderUser(c)
+	if !ok {
+		return
+	}
+	var input model.GPodderDeviceUpdate
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+			return
+		}
+	}
+	if _, err := service.UpdateGPodderDevice(user.ID, gpodderParam(c, "device"), input); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// gpodderGetSubscriptions returns the podcasts added and removed since a timestamp.
+func gpodderGetSubscriptions(c *gin.Context) {
+	if _, ok := gpodderUser(c); !ok {
+		return
+	}
+	since, ok := gpodderSince(c)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	changes, err := service.GetSubscriptionChanges(since)
+	if err != nil {
+		logger.Log.Errorw("getting subscription changes", "error", err)
+		apiError(c, http.StatusInternalServerError, apiInternalError, "Internal error")
+		return
+	}
+	changes.Timestamp = now.Unix()
+	c.JSON(http.StatusOK, changes)
+}
+
+// gpodderUploadSubscriptions applies the podcasts a device added and removed.
+func gpodderUploadSubscriptions(c *gin.Context) {
+	user, ok := gpodderUser(c)
+	if !ok {
+		return
+	}
+	var input model.GPodderSubscriptionChanges
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	now := time.Now()
+	updateURLs, err := service.UpdateSubscriptions(user.ID, gpodderParam(c, "device"), input)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, model.GPodderUpdateResult{Timestamp: now.Unix(), UpdateURLs: updateURLs})
+}
+
+// gpodderGetEpisodeActions returns the episode actions uploaded since a timestamp.
+func gpodderGetEpisodeActions(c *gin.Context) {
+	user, ok := gpodderUser(c)
+	if !ok {
+		return
+	}
+	since, ok := gpodderSince(c)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	aggregated := c.Query("aggregated") == "true"
+	actions, err := service.GetEpisodeActions(user.ID, since, c.Query("podcast"), c.Query("device"), aggregated)
+	if err != nil {
+		logger.Log.Errorw("getting episode actions", "error", err)
+		apiError(c, http.StatusInternalServerError, apiInternalError, "Internal error")
+		return
+	}
+	c.JSON(http.StatusOK, model.GPodderEpisodeActions{Actions: actions, Timestamp: now.Unix()})
+}
+
+// gpodderUploadEpisodeActions stores and applies the episode actions of a device.
+func gpodderUploadEpisodeActions(c *gin.Context) {
+	user, ok := gpodderUser(c)
+	if !ok {
+		return
+	}
+	var input []model.GPodderEpisodeAction
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	now := time.Now()
+	if err := service.UploadEpisodeActions(user.ID, input, now); err != nil {
+		apiError(c, http.StatusBadRequest, apiInvalidRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, model.GPodderUpdateResult{Timestamp: now.Unix(), UpdateURLs: [][2]string{}})
+}
@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/model"
+	"github.com/toozej/podgrab/service"
+)
+
+// setupGPodderRouter returns a router serving the gpodder API behind authentication.
+func setupGPodderRouter(t *testing.T, password string) *gin.Engine {
+	t.Helper()
+	_, err := service.EnsureDefaultUser(password)
+	require.NoError(t, err)
+	router := setupTestRouter()
+	RegisterGPodderRoutes(router.Group("/api/2", Authenticate()))
+	return router
+}
+
+func TestGPodderLogin(t *testing.T) {
+	_, _, cleanup := setupTestDBAndEnv(t)
+	defer cleanup()
+	router := setupGPodderRouter(t, "admin-password")
+	username := service.DefaultUsername
+
+	w := userRequest(t, router, username, "wrong-password", http.MethodPost, "/api/2/auth/"+username+"/login.json", "", nil)
+	assertAPIError(t, w, http.StatusUnauthorized, apiUnauthorized)
+	w = userRequest(t, router, username, "admin-password", http.MethodPost, "/api/2/auth/someone/login.json", "", nil)
+	assertAPIError(t, w, http.StatusUnauthorized, apiUnauthorized)
+
+	w = userRequest(t, router, username, "admin-password", http.MethodPost, "/api/2/auth/"+username+"/login.json", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, sessionCookie, cookies[0].Name)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/2/devices/"+username+".json", nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, "Clients should go on with the session cookie")
+
+	req = httptest.NewRequest(http.MethodPost, "/api/2/auth/"+username+"/logout.json", nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, err := service.AuthenticateSession(cookies[0].Value, time.Now())
+	assert.ErrorIs(t, err, service.ErrInvalidSession)
+}
+
+func TestGPodderSync(t *testing.T) {
+	database, _, cleanup := setupTestDBAndEnv(t)
+	defer cleanup()
+	router := setupGPodderRouter(t, "admin-password")
+	username := service.DefaultUsername
+	sync := func(method, target, body string, out interface{}) *httptest.ResponseRecorder {
+		return userRequest(t, router, username, "admin-password", method, target, body, out)
+	}
+
+	podcast := db.CreateTestPodcast(t, database)
+	item := db.CreateTestPodcastItem(t, database, podcast.ID)
+
+	w := sync(http.MethodPost, "/api/2/devices/"+username+"/phone.json", `{"caption":"My phone","type":"mobile"}`, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = sync(http.MethodPost, "/api/2/devices/"+username+"/phone.json", `{"type":"toaster"}`, nil)
+	assertAPIError(t, w, http.StatusBadRequest, apiInvalidRequest)
+	var devices []model.GPodderDevice
+	sync(http.MethodGet, "/api/2/devices/"+username+".json", "", &devices)
+	require.Len(t, devices, 1)
+	assert.Equal(t, model.GPodderDevice{ID: "phone", Caption: "My phone", Type: "mobile", Subscriptions: 1}, devices[0])
+
+	var subscriptions model.GPodderSubscriptionChanges
+	w = sync(http.MethodGet, "/api/2/subscriptions/"+username+"/phone.json?since=0", "", &subscriptions)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{podcast.URL}, subscriptions.Add)
+	assert.NotZero(t, subscriptions.Timestamp)
+	w = sync(http.MethodGet, "/api/2/subscriptions/"+username+"/phone.json?since=yesterday", "", nil)
+	assertAPIError(t, w, http.StatusBadRequest, apiInvalidRequest)
+
+	var result model.GPodderUpdateResult
+	w = sync(http.MethodPost, "/api/2/subscriptions/"+username+"/phone.json", `{"add":[],"remove":["`+podcast.URL+`"]}`, &result)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, result.UpdateURLs)
+	sync(http.MethodGet, "/api/2/subscriptions/"+username+"/laptop.json?since="+strconv.FormatInt(subscriptions.Timestamp, 10), "", &subscriptions)
+	assert.Equal(t, []string{podcast.URL}, subscriptions.Remove, "Other devices should see the removal")
+
+	w = sync(http.MethodPost, "/api/2/episodes/"+username+".json",
+		`[{"podcast":"`+podcast.URL+`","episode":"`+item.FileURL+`","guid":"`+item.GUID+`","device":"phone","action":"play","started":0,"position":1700,"total":1800}]`, &result)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	admin, err := service.DefaultUser()
+	require.NoError(t, err)
+	state, err := service.GetPlaybackProgress(admin.ID, item.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1700, state.Position)
+	assert.True(t, state.IsPlayed, "Playing past the threshold should mark the episode played")
+
+	var actions model.GPodderEpisodeActions
+	sync(http.MethodGet, "/api/2/episodes/"+username+".json?since=0&device=phone", "", &actions)
+	require.Len(t, actions.Actions, 1)
+	assert.Equal(t, "play", actions.Actions[0].Action)
+	assert.NotEmpty(t, actions.Actions[0].Timestamp)
+
+	w = sync(http.MethodPost, "/api/2/episodes/"+username+".json", `[{"podcast":"`+podcast.URL+`","action":"play"}]`, nil)
+	assertAPIError(t, w, http.StatusBadRequest, apiInvalidRequest)
+	w = sync(http.MethodGet, "/api/2/episodes/someone.json", "", nil)
+	assertAPIError(t, w, http.StatusUnauthorized, apiUnauthorized)
+}
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/internal/logger"
+	"github.com/toozej/podgrab/model"
+	"github.com/toozej/podgrab/service"
+)
+
+// RegisterNextcloudLoginRoutes adds the Nextcloud login flow endpoints apps call before
+// they have credentials.
+func RegisterNextcloudLoginRoutes(group *gin.RouterGroup) {
+	group.POST("/login/v2", nextcloudStartLogin)
+	group.POST("/login/v2/poll", nextcloudPollLogin)
+}
+
+// RegisterNextcloudRoutes adds the login flow page and the Nextcloud gpodder sync API,
+// which podcast apps such as AntennaPod offer as "Nextcloud gpodder sync".
+func RegisterNextcloudRoutes(group *gin.RouterGroup) {
+	group.GET("/login/v2/flow/:token", nextcloudLoginPage)
+	group.POST("/login/v2/flow/:token", nextcloudGrantLogin)
+	group.GET("/apps/gpoddersync/subscriptions", nextcloudGetSubscriptions)
+	group.POST("/apps/gpoddersync/subscription_change/create", nextcloudUploadSubscriptions)
+	group.GET("/apps/gpoddersync/episode_action", nextcloudGetEpisodeActions)
+	group.POST("/apps/gpoddersync/episode_action/create", nextcloudUploadEpisodeActions)
+}
+
+// nextcloudStartLogin starts a login flow for an app.
+func nextcloudStartLogin(c *gin.Context) {
+	flow, err := service.StartNextcloudLogin(c.GetHeader("User-Agent"), time.Now())
+	if err != nil {
+		logger.Log.Errorw("starting Nextcloud login", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start the login"})
+		return
+	}
+	baseURL := getBaseURL(c)
+	c.JSON(http.StatusOK, model.NextcloudLoginFlow{
+		Poll:  model.NextcloudLoginPoll{Token: flow.PollToken, Endpoint: baseURL + "/index.php/login/v2/poll"},
+		Login: baseURL + "/index.php/login/v2/flow/" + flow.FlowToken,
+	})
+}
+
+// nextcloudPollLogin returns the credentials of a login flow once the user granted
+// access, and 404 until then.
+func nextcloudPollLogin(c *gin.Context) {
+	loginName, appPassword, err := service.PollNextcloudLogin(c.PostForm("token"), time.Now())
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, model.NextcloudLoginCredentials{
+		Server:      getBaseURL(c),
+		LoginName:   loginName,
+		AppPassword: appPassword,
+	})
+}
+
+// nextcloudLoginPage asks the user whether to let an app sync.
+func nextcloudLoginPage(c *gin.Context) {
+	flow, err := service.GetNextcloudLogin(c.Param("token"), time.Now())
+	if err != nil {
+		renderNextcloudLogin(c, http.StatusNotFound, "", false, "This login has expired. Start it again in the app.")
+		return
+	}
+	renderNextcloudLogin(c, http.StatusOK, flow.AppName, false, "")
+}
+
+// nextcloudGrantLogin gives the app of a login flow a sync token.
+func nextcloudGrantLogin(c *gin.Context) {
+	err := service.GrantNextcloudLogin(c.Param("token"), currentUser(c), time.Now())
+	if errors.Is(err, service.ErrLoginFlowNotFound) {
+		renderNextcloudLogin(c, http.StatusNotFound, "", false, "This login has expired. Start it again in the app.")
+		return
+	}
+	if err != nil {
+		logger.Log.Errorw("granting Nextcloud login", "error", err)
+		renderNextcloudLogin(c, http.StatusInternalServerError, "", false, "Could not create a token for the app.")
+		return
+	}
+	renderNextcloudLogin(c, http.StatusOK, "", true, "")
+}
+
+func renderNextcloudLogin(c *gin.Context, status int, appName string, granted bool, message string) {
+	setting, ok := c.MustGet("setting").(*db.Setting)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve settings"})
+		return
+	}
+	c.HTML(status, "nextcloudLogin.html", gin.H{
+		"title":    "Connect app",
+		"setting":  setting,
+		"appName":  appName,
+		"username": currentUser(c).Username,
+		"granted":  granted,
+		"error":    message,
+	})
+}
+
+// nextcloudGetSubscriptions returns the podcasts added and removed since a timestamp.
+func nextcloudGetSubscriptions(c *gin.Context) {
+	since, ok := gpodderSince(c)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	changes, err := service.GetSubscriptionChanges(since)
+	if err != nil {
+		logger.Log.Errorw("getting subscription changes", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+		return
+	}
+	changes.Timestamp = now.Unix()
+	c.JSON(http.StatusOK, changes)
+}
+
+// nextcloudUploadSubscriptions applies the podcasts an app added and removed.
+func nextcloudUploadSubscriptions(c *gin.Context) {
+	var input model.GPodderSubscriptionChanges
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now()
+	if _, err := service.UpdateSubscriptions(currentUser(c).ID, service.NextcloudSyncDevice, input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, model.NextcloudTimestamp{Timestamp: now.Unix()})
+}
+
+// nextcloudGetEpisodeActions returns the episode actions uploaded since a timestamp.
+func nextcloudGetEpisodeActions(c *gin.Context) {
+	since, ok := gpodderSince(c)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	actions, err := service.GetEpisodeActions(currentUser(c).ID, since, "", "", false)
+	if err != nil {
+		logger.Log.Errorw("getting episode actions", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+		return
+	}
+	c.JSON(http.StatusOK, model.GPodderEpisodeActions{Actions: actions, Timestamp: now.Unix()})
+}
+
+// nextcloudUploadEpisodeActions stores and applies the episode actions of an app.
+func nextcloudUploadEpisodeActions(c *gin.Context) {
+	var input []model.GPodderEpisodeAction
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now()
+	if err := service.UploadNextcloudEpisodeActions(currentUser(c).ID, input, now); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, model.NextcloudTimestamp{Timestamp: now.Unix()})
+}
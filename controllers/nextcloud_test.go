@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/model"
+	"github.com/toozej/podgrab/service"
+	"gorm.io/gorm"
+)
+
+// setupNextcloudRouter returns a router serving the Nextcloud login flow and sync API,
+// rendering the login flow page as just the app name.
+func setupNextcloudRouter(t *testing.T, database *gorm.DB, password string) *gin.Engine {
+	t.Helper()
+	_, err := service.EnsureDefaultUser(password)
+	require.NoError(t, err)
+	setting := db.CreateTestSetting(t, database)
+	setting.BaseURL = "http://podgrab.local"
+	router := setupTestRouter()
+	router.SetHTMLTemplate(template.Must(template.New("nextcloudLogin.html").Parse("{{ .appName }}")))
+	router.Use(func(c *gin.Context) { c.Set("setting", setting) })
+	RegisterNextcloudLoginRoutes(router.Group("/index.php"))
+	RegisterNextcloudRoutes(router.Group("/index.php", Authenticate()))
+	return router
+}
+
+// pollNextcloudLogin polls a login flow and decodes the credentials when given.
+func pollNextcloudLogin(t *testing.T, router *gin.Engine, token string, out interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/index.php/login/v2/poll", strings.NewReader(url.Values{"token": {token}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if out != nil && w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), out), w.Body.String())
+	}
+	return w
+}
+
+func TestNextcloudLoginFlow(t *testing.T) {
+	database, _, cleanup := setupTestDBAndEnv(t)
+	defer cleanup()
+	router := setupNextcloudRouter(t, database, "admin-password")
+
+	req := httptest.NewRequest(http.MethodPost, "/index.php/login/v2", nil)
+	req.Header.Set("User-Agent", "AntennaPod/3.4")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var flow model.NextcloudLoginFlow
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &flow), w.Body.String())
+	assert.Equal(t, "http://podgrab.local/index.php/login/v2/poll", flow.Poll.Endpoint)
+	loginURL, err := url.Parse(flow.Login)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusNotFound, pollNextcloudLogin(t, router, flow.Poll.Token, nil).Code, "Polling should wait for the user")
+
+	w = userRequest(t, router, service.DefaultUsername, "admin-password", http.MethodGet, loginURL.Path, "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "AntennaPod/3.4")
+	w = userRequest(t, router, service.DefaultUsername, "admin-password", http.MethodPost, loginURL.Path, "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var credentials model.NextcloudLoginCredentials
+	require.Equal(t, http.StatusOK, pollNextcloudLogin(t, router, flow.Poll.Token, &credentials).Code)
+	assert.Equal(t, "http://podgrab.local", credentials.Server)
+	assert.Equal(t, service.DefaultUsername, credentials.LoginName)
+	assert.True(t, service.IsAPITokenValue(credentials.AppPassword))
+	assert.Equal(t, http.StatusNotFound, pollNextcloudLogin(t, router, flow.Poll.Token, nil).Code, "Credentials should only be handed out once")
+	w = userRequest(t, router, service.DefaultUsername, "admin-password", http.MethodGet, loginURL.Path, "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = userRequest(t, router, credentials.LoginName, credentials.AppPassword, http.MethodGet, "/index.php/apps/gpoddersync/subscriptions", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code, "The app password should work for the sync API")
+	w = userRequest(t, router, credentials.LoginName, credentials.AppPassword, http.MethodGet, loginURL.Path, "", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code, "The app password should only work for the sync API")
+}
+
+func TestNextcloudSync(t *testing.T) {
+	database, _, cleanup := setupTestDBAndEnv(t)
+	defer cleanup()
+	router := setupNextcloudRouter(t, database, "admin-password")
+	sync := func(method, target, body string, out interface{}) *httptest.ResponseRecorder {
+		return userRequest(t, router, service.DefaultUsername, "admin-password", method, target, body, out)
+	}
+
+	podcast := db.CreateTestPodcast(t, database)
+	item := db.CreateTestPodcastItem(t, database, podcast.ID)
+
+	var subscriptions model.GPodderSubscriptionChanges
+	w := sync(http.MethodGet, "/index.php/apps/gpoddersync/subscriptions?since=0", "", &subscriptions)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{podcast.URL}, subscriptions.Add)
+
+	var result model.NextcloudTimestamp
+	w = sync(http.MethodPost, "/index.php/apps/gpoddersync/subscription_change/create", `{"add":[],"remove":["`+podcast.URL+`"]}`, &result)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotZero(t, result.Timestamp)
+	var paused db.Podcast
+	require.NoError(t, db.GetPodcastByID(podcast.ID, &paused))
+	assert.True(t, paused.IsPaused)
+
+	w = sync(http.MethodPost, "/index.php/apps/gpoddersync/episode_action/create",
+		`[{"podcast":"`+podcast.URL+`","episode":"`+item.FileURL+`","guid":"`+item.GUID+`","action":"PLAY","timestamp":"2024-01-15T10:30:00","started":0,"position":620,"total":1800}]`, &result)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	admin, err := service.DefaultUser()
+	require.NoError(t, err)
+	state, err := service.GetPlaybackProgress(admin.ID, item.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 620, state.Position, "Phone progress should come back into Podgrab")
+
+	var actions model.GPodderEpisodeActions
+	w = sync(http.MethodGet, "/index.php/apps/gpoddersync/episode_action?since=0", "", &actions)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, actions.Actions, 1)
+	assert.Equal(t, "play", actions.Actions[0].Action)
+	assert.Equal(t, service.NextcloudSyncDevice, actions.Actions[0].Device)
+	assert.Equal(t, "2024-01-15T10:30:00", actions.Actions[0].Timestamp)
+
+	w = sync(http.MethodPost, "/index.php/apps/gpoddersync/episode_action/create", `{"actions":[]}`, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,369 @@
+package controllers
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/model"
+	"github.com/toozej/podgrab/pkg/version"
+	"github.com/toozej/podgrab/service"
+)
+
+// apiRoute is an /api/v1 endpoint. The routes are registered and documented in the
+// OpenAPI spec from the same table, so the spec cannot drift from the router.
+type apiRoute struct {
+	handler gin.HandlerFunc
+	// query and body are zero values of the types bound from the query string and the
+	// request body, response the type of the success body.
+	query    interface{}
+	body     interface{}
+	response interface{}
+	method   string
+	path     string
+	tag      string
+	summary  string
+	status   int
+	// list marks responses that are an APIList of response.
+	list bool
+}
+
+// apiRoutes lists every /api/v1 endpoint.
+var apiRoutes = []apiRoute{
+	{method: http.MethodGet, path: "/podcasts", handler: apiListPodcasts, tag: "podcasts",
+		summary: "List podcasts", query: struct {
+			PodcastListQuery
+			model.Pagination
+		}{}, response: db.Podcast{}, list: true, status: http.StatusOK},
+	{method: http.MethodPost, path: "/podcasts", handler: apiAddPodcast, tag: "podcasts",
+		summary: "Subscribe to a feed", body: AddPodcastData{}, response: db.Podcast{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/podcasts/health", handler: apiFeedHealth, tag: "podcasts",
+		summary: "Report broken, stale and redirected feeds", query: FeedHealthQuery{},
+		response: service.FeedHealthReport{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/podcasts/:id", handler: apiGetPodcast, tag: "podcasts",
+		summary: "Get a podcast", response: db.Podcast{}, status: http.StatusOK},
+	{method: http.MethodPatch, path: "/podcasts/:id", handler: apiPatchPodcast, tag: "podcasts",
+		summary: "Change podcast options", body: PatchPodcast{}, response: db.Podcast{}, status: http.StatusOK},
+	{method: http.MethodDelete, path: "/podcasts/:id", handler: apiDeletePodcast, tag: "podcasts",
+		summary: "Unsubscribe from a podcast", query: DeletePodcastQuery{}, status: http.StatusNoContent},
+	{method: http.MethodDelete, path: "/podcasts/:id/files", handler: apiDeletePodcastFiles, tag: "podcasts",
+		summary: "Delete the downloaded episodes of a podcast", status: http.StatusNoContent},
+	{method: http.MethodPost, path: "/podcasts/:id/refresh", handler: apiRefreshPodcast, tag: "podcasts",
+		summary: "Start refreshing a feed", status: http.StatusAccepted},
+	{method: http.MethodPost, path: "/podcasts/:id/download", handler: apiDownloadPodcast, tag: "podcasts",
+		summary: "Queue every episode of a podcast for download", status: http.StatusAccepted},
+	{method: http.MethodPost, path: "/podcasts/:id/dedupe", handler: apiDedupePodcast, tag: "podcasts",
+		summary: "Merge duplicate episodes", response: MergedEpisodes{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/podcasts/:id/episodes", handler: apiListPodcastEpisodes, tag: "podcasts",
+		summary: "List the episodes of a podcast", query: model.EpisodesFilter{},
+		response: db.PodcastItem{}, list: true, status: http.StatusOK},
+	{method: http.MethodGet, path: "/podcasts/:id/history", handler: apiPodcastHistory, tag: "podcasts",
+		summary: "List metadata changes", response: []db.PodcastMetadataChange{}, status: http.StatusOK},
+	{method: http.MethodPut, path: "/podcasts/:id/credentials", handler: apiSetPodcastCredentials, tag: "podcasts",
+		summary: "Set the credentials of a private feed", body: PodcastCredentialsData{}, status: http.StatusNoContent},
+	{method: http.MethodDelete, path: "/podcasts/:id/credentials", handler: apiDeletePodcastCredentials, tag: "podcasts",
+		summary: "Remove the credentials of a private feed", status: http.StatusNoContent},
+	{method: http.MethodPut, path: "/podcasts/:id/tags/:tagID", handler: apiTagPodcast, tag: "podcasts",
+		summary: "Tag a podcast", status: http.StatusNoContent},
+	{method: http.MethodDelete, path: "/podcasts/:id/tags/:tagID", handler: apiUntagPodcast, tag: "podcasts",
+		summary: "Untag a podcast", status: http.StatusNoContent},
+
+	{method: http.MethodGet, path: "/episodes", handler: func(c *gin.Context) { apiListEpisodes(c) }, tag: "episodes",
+		summary: "List episodes", query: model.EpisodesFilter{}, response: db.PodcastItem{}, list: true, status: http.StatusOK},
+	{method: http.MethodGet, path: "/episodes/:id", handler: apiGetEpisode, tag: "episodes",
+		summary: "Get an episode", response: db.PodcastItem{}, status: http.StatusOK},
+	{method: http.MethodPatch, path: "/episodes/:id", handler: apiPatchEpisode, tag: "episodes",
+		summary: "Mark an episode played, bookmarked or queued", body: PatchEpisode{}, response: db.PodcastItem{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/episodes/:id/download", handler: apiDownloadEpisode, tag: "episodes",
+		summary: "Start downloading an episode", status: http.StatusAccepted},
+	{method: http.MethodDelete, path: "/episodes/:id/file", handler: apiDeleteEpisodeFile, tag: "episodes",
+		summary: "Delete the downloaded file of an episode", status: http.StatusNoContent},
+	{method: http.MethodGet, path: "/episodes/:id/progress", handler: apiGetProgress, tag: "episodes",
+		summary: "Get the current user's playback position", response: PlaybackProgress{}, status: http.StatusOK},
+	{method: http.MethodPut, path: "/episodes/:id/progress", handler: apiPutProgress, tag: "episodes",
+		summary: "Save the current user's playback position", body: PutProgressData{}, response: PlaybackProgress{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/queue", handler: apiQueue, tag: "episodes",
+		summary: "List the episodes in the current user's queue", response: []db.PodcastItem{}, status: http.StatusOK},
+
+	{method: http.MethodGet, path: "/tags", handler: apiListTags, tag: "tags",
+		summary: "List tags", query: model.Pagination{}, response: db.Tag{}, list: true, status: http.StatusOK},
+	{method: http.MethodPost, path: "/tags", handler: apiAddTag, tag: "tags",
+		summary: "Create a tag", body: AddTagData{}, response: db.Tag{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/tags/:id", handler: apiGetTag, tag: "tags",
+		summary: "Get a tag", response: db.Tag{}, status: http.StatusOK},
+	{method: http.MethodDelete, path: "/tags/:id", handler: apiDeleteTag, tag: "tags",
+		summary: "Delete a tag", status: http.StatusNoContent},
+
+	{method: http.MethodPost, path: "/refresh", handler: apiRefreshAll, tag: "system",
+		summary: "Start refreshing every feed", status: http.StatusAccepted},
+	{method: http.MethodGet, path: "/settings", handler: apiGetSettings, tag: "system",
+		summary: "Get the settings", response: SettingModel{}, status: http.StatusOK},
+	{method: http.MethodPut, path: "/settings", handler: apiUpdateSettings, tag: "system",
+		summary: "Replace the settings", body: SettingModel{}, response: SettingModel{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/version", handler: apiVersion, tag: "system",
+		summary: "Get the build information", response: version.Info{}, status: http.StatusOK},
+
+	{method: http.MethodGet, path: "/tokens", handler: apiListTokens, tag: "tokens",
+		summary: "List API tokens", response: []db.APIToken{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/tokens", handler: apiAddToken, tag: "tokens",
+		summary: "Create an API token", body: AddAPITokenData{}, response: CreatedAPIToken{}, status: http.StatusCreated},
+	{method: http.MethodDelete, path: "/tokens/:id", handler: apiRevokeToken, tag: "tokens",
+		summary: "Revoke an API token", status: http.StatusNoContent},
+
+	{method: http.MethodGet, path: "/me", handler: apiMe, tag: "users",
+		summary: "Get the current user", response: db.User{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/users", handler: apiListUsers, tag: "users",
+		summary: "List users", response: []db.User{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/users", handler: apiAddUser, tag: "users",
+		summary: "Create a user", body: AddUserData{}, response: db.User{}, status: http.StatusCreated},
+	{method: http.MethodPatch, path: "/users/:id", handler: apiPatchUser, tag: "users",
+		summary: "Change the password or admin flag of a user", body: PatchUser{}, response: db.User{}, status: http.StatusOK},
+	{method: http.MethodDelete, path: "/users/:id", handler: apiDeleteUser, tag: "users",
+		summary: "Delete a user and their listening state", status: http.StatusNoContent},
+
+	{method: http.MethodGet, path: "/webhooks", handler: apiListWebhooks, tag: "webhooks",
+		summary: "List webhooks", response: []db.Webhook{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/webhooks", handler: apiAddWebhook, tag: "webhooks",
+		summary: "Create a webhook", body: AddWebhookData{}, response: db.Webhook{}, status: http.StatusCreated},
+	{method: http.MethodPut, path: "/webhooks/:id", handler: apiUpdateWebhook, tag: "webhooks",
+		summary: "Replace the settings of a webhook", body: AddWebhookData{}, response: db.Webhook{}, status: http.StatusOK},
+	{method: http.MethodDelete, path: "/webhooks/:id", handler: apiDeleteWebhook, tag: "webhooks",
+		summary: "Delete a webhook and its delivery log", status: http.StatusNoContent},
+	{method: http.MethodGet, path: "/webhooks/:id/deliveries", handler: apiWebhookDeliveries, tag: "webhooks",
+		summary: "List the latest deliveries of a webhook", response: []db.WebhookDelivery{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/webhooks/:id/test", handler: apiTestWebhook, tag: "webhooks",
+		summary: "Send a test event to a webhook", response: db.WebhookDelivery{}, status: http.StatusOK},
+
+	{method: http.MethodGet, path: "/notifiers", handler: apiListNotifiers, tag: "notifiers",
+		summary: "List notifiers", response: []db.Notifier{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/notifiers", handler: apiAddNotifier, tag: "notifiers",
+		summary: "Create a notifier", body: AddNotifierData{}, response: db.Notifier{}, status: http.StatusCreated},
+	{method: http.MethodPut, path: "/notifiers/:id", handler: apiUpdateNotifier, tag: "notifiers",
+		summary: "Replace the settings of a notifier", body: AddNotifierData{}, response: db.Notifier{}, status: http.StatusOK},
+	{method: http.MethodDelete, path: "/notifiers/:id", handler: apiDeleteNotifier, tag: "notifiers",
+		summary: "Delete a notifier", status: http.StatusNoContent},
+	{method: http.MethodPost, path: "/notifiers/:id/test", handler: apiTestNotifier, tag: "notifiers",
+		summary: "Send an example message through a notifier", status: http.StatusNoContent},
+}
+
+// RegisterAPIRoutes registers the /api/v1 endpoints and the OpenAPI spec describing
+// them on a router group.
+func RegisterAPIRoutes(group *gin.RouterGroup) {
+	for _, route := range apiRoutes {
+		group.Handle(route.method, route.path, route.handler)
+	}
+	group.GET("/openapi.json", func(c *gin.Context) {
+		c.JSON(http.StatusOK, openAPISpec(group.BasePath()))
+	})
+}
+
+var (
+	specOnce sync.Once
+	spec     gin.H
+)
+
+// openAPISpec returns the OpenAPI 3 document of the API served under basePath.
+func openAPISpec(basePath string) gin.H {
+	specOnce.Do(func() {
+		schemas := &openAPISchemas{components: gin.H{}}
+		errorRef := schemas.schemaFor(reflect.TypeOf(APIError{}))
+		paths := gin.H{}
+		for _, route := range apiRoutes {
+			path, parameters := openAPIPath(route.path)
+			if route.query != nil {
+				parameters = append(parameters, schemas.queryParameters(reflect.TypeOf(route.query))...)
+			}
+			operation := gin.H{
+				"summary":     route.summary,
+				"tags":        []string{route.tag},
+				"operationId": route.operationID(),
+				"responses":   schemas.responses(&route, errorRef),
+			}
+			if len(parameters) > 0 {
+				operation["parameters"] = parameters
+			}
+			if route.body != nil {
+				operation["requestBody"] = gin.H{
+					"required": true,
+					"content":  gin.H{"application/json": gin.H{"schema": schemas.schemaFor(reflect.TypeOf(route.body))}},
+				}
+			}
+			item, ok := paths[path].(gin.H)
+			if !ok {
+				item = gin.H{}
+				paths[path] = item
+			}
+			item[strings.ToLower(route.method)] = operation
+		}
+		spec = gin.H{
+			"openapi": "3.0.3",
+			"info": gin.H{
+				"title":       "Podgrab API",
+				"version":     version.Version,
+				"description": "Failed requests return an APIError body. List endpoints are paginated with page and count.",
+			},
+			"servers": []gin.H{{"url": basePath}},
+			"paths":   paths,
+			"components": gin.H{
+				"schemas": schemas.components,
+				"securitySchemes": gin.H{
+					"basicAuth":     gin.H{"type": "http", "scheme": "basic"},
+					"bearerAuth":    gin.H{"type": "http", "scheme": "bearer", "description": "API token"},
+					"sessionCookie": gin.H{"type": "apiKey", "in": "cookie", "name": sessionCookie},
+				},
+			},
+			// Credentials are only required once an account has a password.
+			"security": []gin.H{{"bearerAuth": []string{}}, {"sessionCookie": []string{}}, {"basicAuth": []string{}}, {}},
+		}
+	})
+	return spec
+}
+
+// operationID returns the operation id of a route, e.g. "get-podcasts-id-episodes".
+func (route *apiRoute) operationID() string {
+	return strings.ToLower(route.method + strings.NewReplacer("/", "-", ":", "").Replace(route.path))
+}
+
+// openAPIPath converts a gin path to an OpenAPI one and returns its path parameters.
+func openAPIPath(path string) (string, []gin.H) {
+	segments := strings.Split(path, "/")
+	var parameters []gin.H
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			segments[i] = "{" + name + "}"
+			parameters = append(parameters, gin.H{
+				"name": name, "in": "path", "required": true, "schema": gin.H{"type": "string"},
+			})
+		}
+	}
+	return strings.Join(segments, "/"), parameters
+}
+
+// openAPISchemas builds JSON schemas from Go types, collecting named structs as components.
+type openAPISchemas struct {
+	components gin.H
+}
+
+// responses returns the responses of a route: its success body and the error envelope
+// for the failures it can return.
+func (schemas *openAPISchemas) responses(route *apiRoute, errorRef gin.H) gin.H {
+	success := gin.H{"description": http.StatusText(route.status)}
+	if route.response != nil {
+		schema := schemas.schemaFor(reflect.TypeOf(route.response))
+		if route.list {
+			schema = gin.H{
+				"type": "object",
+				"properties": gin.H{
+					"data":       gin.H{"type": "array", "items": schema},
+					"pagination": schemas.schemaFor(reflect.TypeOf(model.Pagination{})),
+				},
+			}
+		}
+		success["content"] = gin.H{"application/json": gin.H{"schema": schema}}
+	}
+	failure := func(status int) gin.H {
+		return gin.H{
+			"description": http.StatusText(status),
+			"content":     gin.H{"application/json": gin.H{"schema": errorRef}},
+		}
+	}
+	responses := gin.H{
+		"400": failure(http.StatusBadRequest),
+		"500": failure(http.StatusInternalServerError),
+	}
+	responses[strconv.Itoa(route.status)] = success
+	if strings.Contains(route.path, ":") {
+		responses["404"] = failure(http.StatusNotFound)
+	}
+	if route.method == http.MethodPost && route.status == http.StatusCreated {
+		responses["409"] = failure(http.StatusConflict)
+	}
+	return responses
+}
+
+// queryParameters documents the fields of a query struct bound from their form tags.
+func (schemas *openAPISchemas) queryParameters(t reflect.Type) []gin.H {
+	var parameters []gin.H
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			parameters = append(parameters, schemas.queryParameters(field.Type)...)
+			continue
+		}
+		name := strings.Split(field.Tag.Get("form"), ",")[0]
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+		parameters = append(parameters, gin.H{
+			"name": name, "in": "query", "schema": schemas.schemaFor(field.Type),
+		})
+	}
+	return parameters
+}
+
+// schemaFor returns the JSON schema of a type as encoding/json serializes it.
+func (schemas *openAPISchemas) schemaFor(t reflect.Type) gin.H {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return gin.H{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return gin.H{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return gin.H{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return gin.H{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return gin.H{"type": "number"}
+	case reflect.String:
+		return gin.H{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return gin.H{"type": "array", "items": schemas.schemaFor(t.Elem())}
+	case reflect.Map:
+		return gin.H{"type": "object", "additionalProperties": schemas.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return schemas.objectSchema(t)
+		}
+		if _, ok := schemas.components[t.Name()]; !ok {
+			// Reserve the name first so self-referencing types end in a $ref.
+			schemas.components[t.Name()] = gin.H{}
+			schemas.components[t.Name()] = schemas.objectSchema(t)
+		}
+		return gin.H{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return gin.H{}
+}
+
+// objectSchema returns the schema of a struct's JSON fields, inlining embedded structs.
+func (schemas *openAPISchemas) objectSchema(t reflect.Type) gin.H {
+	properties := gin.H{}
+	schemas.addProperties(t, properties)
+	return gin.H{"type": "object", "properties": properties}
+}
+
+func (schemas *openAPISchemas) addProperties(t reflect.Type, properties gin.H) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			schemas.addProperties(field.Type, properties)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = schemas.schemaFor(field.Type)
+	}
+}
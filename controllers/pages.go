@@ -32,6 +32,20 @@ type SettingModel struct {
 	InitialDownloadCount        int    `form:"initialDownloadCount" json:"initialDownloadCount" query:"initialDownloadCount"`
 	MaxDownloadConcurrency      int    `form:"maxDownloadConcurrency" json:"maxDownloadConcurrency" query:"maxDownloadConcurrency"`
 	MaxDownloadKeep             int    `form:"maxDownloadKeep" json:"maxDownloadKeep" query:"maxDownloadKeep"`
+	AutoPauseAfterFailures      int    `form:"autoPauseAfterFailures" json:"autoPauseAfterFailures" query:"autoPauseAfterFailures"`
+	StaleFeedDays               int    `form:"staleFeedDays" json:"staleFeedDays" query:"staleFeedDays"`
+	EnclosurePreference         string `form:"enclosurePreference" json:"enclosurePreference" query:"enclosurePreference"`
+	ProxyURL                    string `form:"proxyUrl" json:"proxyUrl" query:"proxyUrl"`
+	IPPreference                string `form:"ipPreference" json:"ipPreference" query:"ipPreference"`
+	ConnectTimeout              int    `form:"connectTimeout" json:"connectTimeout" query:"connectTimeout"`
+	ReadTimeout                 int    `form:"readTimeout" json:"readTimeout" query:"readTimeout"`
+	BandwidthLimit              int    `form:"bandwidthLimit" json:"bandwidthLimit" query:"bandwidthLimit"`
+	HostBandwidthLimits         string `form:"hostBandwidthLimits" json:"hostBandwidthLimits" query:"hostBandwidthLimits"`
+	DownloadSchedule            string `form:"downloadSchedule" json:"downloadSchedule" query:"downloadSchedule"`
+	EgressAllowlist             string `form:"egressAllowlist" json:"egressAllowlist" query:"egressAllowlist"`
+	MaxRedirects                int    `form:"maxRedirects" json:"maxRedirects" query:"maxRedirects"`
+	PlayedThreshold             int    `form:"playedThreshold" json:"playedThreshold" query:"playedThreshold"`
+	BlockPrivateNetworks        bool   `form:"blockPrivateNetworks" json:"blockPrivateNetworks" query:"blockPrivateNetworks"`
 	AutoDownload                bool   `form:"autoDownload" json:"autoDownload" query:"autoDownload"`
 	DownloadOnAdd               bool   `form:"downloadOnAdd" json:"downloadOnAdd" query:"downloadOnAdd"`
 	DarkMode                    bool   `form:"darkMode" json:"darkMode" query:"darkMode"`
@@ -39,6 +53,7 @@ type SettingModel struct {
 	GenerateNFOFile             bool   `form:"generateNFOFile" json:"generateNFOFile" query:"generateNFOFile"`
 	DontDownloadDeletedFromDisk bool   `form:"dontDownloadDeletedFromDisk" json:"dontDownloadDeletedFromDisk" query:"dontDownloadDeletedFromDisk"`
 	PassthroughPodcastGUID      bool   `form:"passthroughPodcastGuid" json:"passthroughPodcastGuid" query:"passthroughPodcastGuid"`
+	KeepRemovedUpstream         bool   `form:"keepRemovedUpstream" json:"keepRemovedUpstream" query:"keepRemovedUpstream"`
 }
 
 var searchOptions = map[string]string{
@@ -78,6 +93,9 @@ func PodcastPage(c *gin.Context) {
 		var podcast db.Podcast
 
 		if err := db.GetPodcastByID(searchByIDQuery.ID, &podcast); err == nil {
+			if err := service.ApplyEpisodeStates(currentUser(c).ID, podcast.PodcastItems); err != nil {
+				logger.Log.Errorw("applying episode states", "error", err)
+			}
 			var pagination model.Pagination
 			if c.ShouldBindQuery(&pagination) == nil {
 				var page, count int
@@ -207,6 +225,9 @@ func PlayerPage(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve settings"})
 		return
 	}
+	if err := service.ApplyEpisodeStates(currentUser(c).ID, items); err != nil {
+		logger.Log.Errorw("applying episode states", "error", err)
+	}
 
 	c.HTML(http.StatusOK, "player.html", gin.H{
 		"title":          title,
@@ -229,10 +250,18 @@ func SettingsPage(c *gin.Context) {
 	if err != nil {
 		logger.Log.Errorw("getting disk stats", "error", err)
 	}
+	loginRequired, err := service.LoginRequired()
+	if err != nil {
+		logger.Log.Errorw("checking whether login is required", "error", err)
+	}
 	c.HTML(http.StatusOK, "settings.html", gin.H{
-		"setting":   setting,
-		"title":     "Update your preferences",
-		"diskStats": diskStats,
+		"setting":        visibleSetting(c, setting),
+		"title":          "Update your preferences",
+		"diskStats":      diskStats,
+		"user":           currentUser(c),
+		"loginRequired":  loginRequired,
+		"webhookEvents":  service.WebhookEvents,
+		"notifierEvents": service.NotifierEvents,
 	})
 }
 
@@ -273,6 +302,25 @@ func BackupsPage(c *gin.Context) {
 	}
 }
 
+// FeedHealthPage handles the feed health page request.
+func FeedHealthPage(c *gin.Context) {
+	setting, ok := c.MustGet("setting").(*db.Setting)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve settings"})
+		return
+	}
+	report, err := service.GetFeedHealthReport(0)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
+	c.HTML(http.StatusOK, "feedHealth.html", gin.H{
+		"report":  report,
+		"title":   "Feed Health",
+		"setting": setting,
+	})
+}
+
 func getSortOptions() interface{} {
 	return []struct {
 		Label, Value string
@@ -306,7 +354,7 @@ func AllEpisodesPage(c *gin.Context) {
 	toReturn := gin.H{
 		"title":        "All Episodes",
 		"podcastItems": []db.PodcastItem{},
-		"setting":      setting,
+		"setting":      visibleSetting(c, setting),
 		"page":         filter.Page,
 		"count":        filter.Count,
 		"filter":       filter,
@@ -438,7 +486,7 @@ func AddNewPodcast(c *gin.Context) {
 	err := c.ShouldBind(&addPodcastData)
 
 	if err == nil {
-		_, err = service.AddPodcast(addPodcastData.URL)
+		_, err = service.AddPrivatePodcast(addPodcastData.URL, addPodcastData.credentials())
 		if err == nil {
 			go func() {
 				if refreshErr := service.RefreshEpisodes(); refreshErr != nil {
@@ -47,6 +47,11 @@ type SearchByIDQuery struct {
 	ID string `binding:"required" uri:"id" json:"id" form:"id"`
 }
 
+// FeedHealthQuery represents feed health query data.
+type FeedHealthQuery struct {
+	StaleDays int `form:"staleDays" json:"staleDays" query:"staleDays"`
+}
+
 // AddRemoveTagQuery represents add remove tag query data.
 type AddRemoveTagQuery struct {
 	ID    string `binding:"required" uri:"id" json:"id" form:"id"`
@@ -55,13 +60,119 @@ type AddRemoveTagQuery struct {
 
 // PatchPodcastItem represents patch podcast item data.
 type PatchPodcastItem struct {
-	Title    string `form:"title" json:"title" query:"title"`
-	IsPlayed bool   `json:"isPlayed" form:"isPlayed" query:"isPlayed"`
+	Title            string `form:"title" json:"title" query:"title"`
+	IsPlayed         bool   `json:"isPlayed" form:"isPlayed" query:"isPlayed"`
+	EnclosureChanged *bool  `json:"enclosureChanged" form:"enclosureChanged" query:"enclosureChanged"`
+}
+
+// PatchPodcast represents patch podcast data.
+type PatchPodcast struct {
+	EnclosureChangePolicy string `json:"enclosureChangePolicy" form:"enclosureChangePolicy" query:"enclosureChangePolicy"`
+	DedupeMode            string `json:"dedupeMode" form:"dedupeMode" query:"dedupeMode"`
+	// EnclosurePreference accepts "global" to fall back to the global setting.
+	EnclosurePreference string `json:"enclosurePreference" form:"enclosurePreference" query:"enclosurePreference"`
+	// Network overrides are replaced when present; empty values and "global" fall back
+	// to the global settings.
+	ProxyURL       *string `json:"proxyUrl" form:"proxyUrl" query:"proxyUrl"`
+	UserAgent      *string `json:"userAgent" form:"userAgent" query:"userAgent"`
+	ConnectTimeout *int    `json:"connectTimeout" form:"connectTimeout" query:"connectTimeout"`
+	ReadTimeout    *int    `json:"readTimeout" form:"readTimeout" query:"readTimeout"`
+	IPPreference   *string `json:"ipPreference" form:"ipPreference" query:"ipPreference"`
+	IsPaused       *bool   `json:"isPaused" form:"isPaused" query:"isPaused"`
+}
+
+// apply saves the changes of the patch to a podcast, which is updated to match.
+func (input *PatchPodcast) apply(podcast *db.Podcast) error {
+	if input.EnclosureChangePolicy != "" {
+		if err := service.SetPodcastEnclosureChangePolicy(podcast.ID, db.EnclosureChangePolicy(input.EnclosureChangePolicy)); err != nil {
+			return err
+		}
+	}
+	if input.DedupeMode != "" {
+		if err := service.SetPodcastDedupeMode(podcast.ID, db.DedupeMode(input.DedupeMode)); err != nil {
+			return err
+		}
+	}
+	if input.EnclosurePreference != "" {
+		preference := db.EnclosurePreference(input.EnclosurePreference)
+		if preference == "global" {
+			preference = ""
+		}
+		if err := service.SetPodcastEnclosurePreference(podcast.ID, preference); err != nil {
+			return err
+		}
+	}
+	if input.IsPaused != nil {
+		if err := service.TogglePodcastPause(podcast.ID, *input.IsPaused); err != nil {
+			return err
+		}
+	}
+	if input.hasNetwork() {
+		input.applyNetwork(podcast)
+		err := service.SetPodcastNetwork(podcast.ID, podcast.ProxyURL, podcast.UserAgent,
+			podcast.ConnectTimeout, podcast.ReadTimeout, podcast.IPPreference)
+		if err != nil {
+			return err
+		}
+	}
+	return db.GetPodcastByID(podcast.ID, podcast)
+}
+
+// hasNetwork reports whether the patch changes a network override.
+func (input *PatchPodcast) hasNetwork() bool {
+	return input.ProxyURL != nil || input.UserAgent != nil || input.ConnectTimeout != nil ||
+		input.ReadTimeout != nil || input.IPPreference != nil
+}
+
+// applyNetwork overlays the network overrides of the patch on a podcast.
+func (input *PatchPodcast) applyNetwork(podcast *db.Podcast) {
+	// Podcasts are returned with the proxy credentials left out; sending that URL
+	// back keeps them.
+	if input.ProxyURL != nil && strings.TrimSpace(*input.ProxyURL) != service.RedactURL(podcast.ProxyURL) {
+		podcast.ProxyURL = strings.TrimSpace(*input.ProxyURL)
+	}
+	if input.UserAgent != nil {
+		podcast.UserAgent = strings.TrimSpace(*input.UserAgent)
+	}
+	if input.ConnectTimeout != nil {
+		podcast.ConnectTimeout = *input.ConnectTimeout
+	}
+	if input.ReadTimeout != nil {
+		podcast.ReadTimeout = *input.ReadTimeout
+	}
+	if input.IPPreference != nil {
+		podcast.IPPreference = db.IPPreference(*input.IPPreference)
+		if podcast.IPPreference == "global" {
+			podcast.IPPreference = ""
+		}
+	}
 }
 
 // AddPodcastData represents add podcast data data.
 type AddPodcastData struct {
 	URL string `binding:"required" form:"url" json:"url"`
+
+	PodcastCredentialsData
+}
+
+// PodcastCredentialsData represents the credentials of a private feed.
+type PodcastCredentialsData struct {
+	Username string            `form:"username" json:"username"`
+	Password string            `form:"password" json:"password"`
+	Headers  map[string]string `form:"-" json:"headers"`
+	Cookies  string            `form:"cookies" json:"cookies"`
+	// Hosts are extra hosts, such as an episode CDN, that get the credentials too.
+	Hosts []string `form:"hosts" json:"hosts"`
+}
+
+func (data *PodcastCredentialsData) credentials() *db.FeedCredentials {
+	return &db.FeedCredentials{
+		Username: data.Username,
+		Password: data.Password,
+		Headers:  data.Headers,
+		Cookies:  data.Cookies,
+		Hosts:    data.Hosts,
+	}
 }
 
 // AddTagData represents add tag data data.
@@ -122,7 +233,10 @@ func GetPodcastByID(c *gin.Context) {
 		if !ok {
 			return fmt.Errorf("invalid entity type: expected *db.Podcast")
 		}
-		return db.GetPodcastByID(id, podcastEntity)
+		if err := db.GetPodcastByID(id, podcastEntity); err != nil {
+			return err
+		}
+		return service.ApplyEpisodeStates(currentUser(c).ID, podcastEntity.PodcastItems)
 	}, &podcast, "Podcast not found")
 }
 
@@ -141,6 +255,78 @@ func PausePodcastByID(c *gin.Context) {
 	}
 }
 
+// PatchPodcastByID handles the patch podcast by id request.
+func PatchPodcastByID(c *gin.Context) {
+	var searchByIDQuery SearchByIDQuery
+	if c.ShouldBindUri(&searchByIDQuery) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	var input PatchPodcast
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var podcast db.Podcast
+	if err := db.GetPodcastByID(searchByIDQuery.ID, &podcast); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Podcast not found"})
+		return
+	}
+	if err := input.apply(&podcast); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, podcast)
+}
+
+// SetPodcastCredentialsByID handles the set podcast credentials by id request.
+func SetPodcastCredentialsByID(c *gin.Context) {
+	var searchByIDQuery SearchByIDQuery
+	if c.ShouldBindUri(&searchByIDQuery) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	var input PodcastCredentialsData
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := service.SetPodcastCredentials(searchByIDQuery.ID, input.credentials()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+// DeletePodcastCredentialsByID handles the delete podcast credentials by id request.
+func DeletePodcastCredentialsByID(c *gin.Context) {
+	var searchByIDQuery SearchByIDQuery
+	if c.ShouldBindUri(&searchByIDQuery) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if err := service.SetPodcastCredentials(searchByIDQuery.ID, nil); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+// MergeDuplicateEpisodesByPodcastID handles the merge duplicate episodes by podcast id request.
+func MergeDuplicateEpisodesByPodcastID(c *gin.Context) {
+	var searchByIDQuery SearchByIDQuery
+	if c.ShouldBindUri(&searchByIDQuery) == nil {
+		merged, err := service.MergeDuplicatePodcastItems(searchByIDQuery.ID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"merged": merged})
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	}
+}
+
 // UnpausePodcastByID handles the unpause podcast by id request.
 func UnpausePodcastByID(c *gin.Context) {
 	var searchByIDQuery SearchByIDQuery
@@ -224,6 +410,9 @@ func GetPodcastItemsByPodcastID(c *gin.Context) {
 		var podcastItems []db.PodcastItem
 
 		err := db.GetAllPodcastItemsByPodcastID(searchByIDQuery.ID, &podcastItems)
+		if err == nil {
+			err = service.ApplyEpisodeStates(currentUser(c).ID, podcastItems)
+		}
 		logger.Log.Error(err)
 		c.JSON(200, podcastItems)
 	} else {
@@ -231,6 +420,41 @@ func GetPodcastItemsByPodcastID(c *gin.Context) {
 	}
 }
 
+// GetPodcastMetadataHistoryByID handles the get podcast metadata history by id request.
+func GetPodcastMetadataHistoryByID(c *gin.Context) {
+	var searchByIDQuery SearchByIDQuery
+
+	if c.ShouldBindUri(&searchByIDQuery) == nil {
+		var changes []db.PodcastMetadataChange
+
+		if err := db.GetPodcastMetadataChangesByPodcastID(searchByIDQuery.ID, &changes); err != nil {
+			logger.Log.Errorw("getting podcast metadata history", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get metadata history"})
+			return
+		}
+		c.JSON(200, changes)
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	}
+}
+
+// GetFeedHealth handles the get feed health request.
+func GetFeedHealth(c *gin.Context) {
+	var feedHealthQuery FeedHealthQuery
+
+	if c.ShouldBindQuery(&feedHealthQuery) == nil {
+		report, err := service.GetFeedHealthReport(feedHealthQuery.StaleDays)
+		if err != nil {
+			logger.Log.Errorw("getting feed health report", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get feed health"})
+			return
+		}
+		c.JSON(200, report)
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	}
+}
+
 // DownloadAllEpisodesByPodcastID handles the download all episodes by podcast id request.
 func DownloadAllEpisodesByPodcastID(c *gin.Context) {
 	var searchByIDQuery SearchByIDQuery
@@ -285,7 +509,11 @@ func GetAllPodcastItems(c *gin.Context) {
 		logger.Log.Error(err.Error())
 	}
 	filter.VerifyPaginationValues()
+	filter.UserID = currentUser(c).ID
 	if podcastItems, totalCount, err := db.GetPaginatedPodcastItemsNew(&filter); err == nil {
+		if err := service.ApplyEpisodeStates(filter.UserID, *podcastItems); err != nil {
+			logger.Log.Errorw("applying episode states", "error", err)
+		}
 		filter.SetCounts(totalCount)
 		toReturn := gin.H{
 			"podcastItems": podcastItems,
@@ -305,7 +533,13 @@ func GetPodcastItemByID(c *gin.Context) {
 		if !ok {
 			return fmt.Errorf("invalid entity type: expected *db.PodcastItem")
 		}
-		return db.GetPodcastItemByID(id, itemEntity)
+		if err := db.GetPodcastItemByID(id, itemEntity); err != nil {
+			return err
+		}
+		items := []db.PodcastItem{*itemEntity}
+		err := service.ApplyEpisodeStates(currentUser(c).ID, items)
+		*itemEntity = items[0]
+		return err
 	}, &podcast, "Episode not found")
 }
 
@@ -318,17 +552,23 @@ func GetPodcastItemImageByID(c *gin.Context) {
 
 		err := db.GetPodcastItemByID(searchByIDQuery.ID, &podcast)
 		if err == nil {
-			if _, err = os.Stat(podcast.LocalImage); os.IsNotExist(err) {
-				c.Redirect(302, podcast.Image)
-			} else {
-				c.File(podcast.LocalImage)
-			}
+			servePodcastItemImage(c, &podcast)
 		}
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 	}
 }
 
+// servePodcastItemImage serves the downloaded image of an episode, or redirects to the
+// original.
+func servePodcastItemImage(c *gin.Context, item *db.PodcastItem) {
+	if _, err := os.Stat(item.LocalImage); os.IsNotExist(err) {
+		c.Redirect(302, item.Image)
+	} else {
+		c.File(item.LocalImage)
+	}
+}
+
 // GetPodcastImageByID handles the get podcast image by id request.
 func GetPodcastImageByID(c *gin.Context) {
 	var searchByIDQuery SearchByIDQuery
@@ -338,18 +578,24 @@ func GetPodcastImageByID(c *gin.Context) {
 
 		err := db.GetPodcastByID(searchByIDQuery.ID, &podcast)
 		if err == nil {
-			localPath := service.GetPodcastLocalImagePath(podcast.Image, podcast.Title)
-			if _, err = os.Stat(localPath); os.IsNotExist(err) {
-				c.Redirect(302, podcast.Image)
-			} else {
-				c.File(localPath)
-			}
+			servePodcastImage(c, &podcast)
 		}
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 	}
 }
 
+// servePodcastImage serves the downloaded cover of a podcast, or redirects to the
+// original.
+func servePodcastImage(c *gin.Context, podcast *db.Podcast) {
+	localPath := service.GetPodcastLocalImagePath(podcast.Image, podcast.Title)
+	if _, err := os.Stat(localPath); os.IsNotExist(err) {
+		c.Redirect(302, podcast.Image)
+	} else {
+		c.File(localPath)
+	}
+}
+
 // GetPodcastItemFileByID handles the get podcast item file by id request.
 func GetPodcastItemFileByID(c *gin.Context) {
 	var searchByIDQuery SearchByIDQuery
@@ -362,54 +608,45 @@ func GetPodcastItemFileByID(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Episode not found"})
 			return
 		}
-
-		// Try the original DownloadPath first
-		filePath := item.DownloadPath
-		if _, err = os.Stat(filePath); os.IsNotExist(err) {
-			// File not found at stored path - try to find it
-			// This handles backward compatibility when folder naming conventions changed
-			filePath = findEpisodeFile(&item)
-		}
-
-		if filePath != "" {
-			if _, err = os.Stat(filePath); !os.IsNotExist(err) {
-				c.Header("Content-Description", "File Transfer")
-				c.Header("Content-Transfer-Encoding", "binary")
-				c.Header("Content-Disposition", "attachment; filename="+path.Base(filePath))
-				c.Header("Content-Type", GetFileContentType(filePath))
-				c.File(filePath)
-				return
-			}
-		}
-
-		// File not found locally - redirect to remote URL if available
-		if item.FileURL != "" {
-			c.Redirect(302, item.FileURL)
-			return
-		}
-
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		servePodcastItemFile(c, &item)
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 	}
 }
 
-// audioExtensions is a list of supported audio file extensions
-var audioExtensions = []string{".mp3", ".m4a", ".ogg", ".wav", ".flac", ".aac", ".wma"}
+// servePodcastItemFile serves the downloaded file of an episode, or redirects to the
+// remote file when it has not been downloaded.
+func servePodcastItemFile(c *gin.Context, item *db.PodcastItem) {
+	// Try the original DownloadPath first
+	filePath := item.DownloadPath
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		// File not found at stored path - try to find it
+		// This handles backward compatibility when folder naming conventions changed
+		filePath = findEpisodeFile(item)
+	}
 
-// isAudioFile checks if a filename has a supported audio extension
-func isAudioFile(name string) bool {
-	lowerName := strings.ToLower(name)
-	for _, ext := range audioExtensions {
-		if strings.HasSuffix(lowerName, ext) {
-			return true
+	if filePath != "" {
+		if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+			c.Header("Content-Description", "File Transfer")
+			c.Header("Content-Transfer-Encoding", "binary")
+			c.Header("Content-Disposition", "attachment; filename="+path.Base(filePath))
+			c.Header("Content-Type", GetFileContentType(filePath))
+			c.File(filePath)
+			return
 		}
 	}
-	return false
+
+	// File not found locally - redirect to remote URL if available
+	if item.FileURL != "" {
+		c.Redirect(302, item.FileURL)
+		return
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
 }
 
-// scanDirForAudio scans a directory for audio files and returns the first one found
-func scanDirForAudio(dirPath string) string {
+// scanDirForMedia scans a directory for audio or video files and returns the first one found
+func scanDirForMedia(dirPath string) string {
 	entries, err := os.ReadDir(dirPath)
 	if err != nil {
 		return ""
@@ -418,7 +655,7 @@ func scanDirForAudio(dirPath string) string {
 		if entry.IsDir() {
 			continue
 		}
-		if isAudioFile(entry.Name()) {
+		if service.IsMediaFile(entry.Name()) {
 			return filepath.Join(dirPath, entry.Name())
 		}
 	}
@@ -450,7 +687,7 @@ func findEpisodeFile(item *db.PodcastItem) string {
 
 		// Check if the directory exists
 		if dirInfo, err := os.Stat(podcastDir); err == nil && dirInfo.IsDir() {
-			if file := scanDirForAudio(podcastDir); file != "" {
+			if file := scanDirForMedia(podcastDir); file != "" {
 				return file
 			}
 		}
@@ -459,14 +696,14 @@ func findEpisodeFile(item *db.PodcastItem) string {
 		oldStyleDir := filepath.Join(dataPath, podcastName)
 		if oldStyleDir != podcastDir {
 			if dirInfo, err := os.Stat(oldStyleDir); err == nil && dirInfo.IsDir() {
-				if file := scanDirForAudio(oldStyleDir); file != "" {
+				if file := scanDirForMedia(oldStyleDir); file != "" {
 					return file
 				}
 			}
 		}
 	}
 
-	// Fallback: walk the entire assets directory looking for any audio file
+	// Fallback: walk the entire assets directory looking for any media file
 	// This is slower but handles edge cases
 	var foundPath string
 	//nolint:errcheck // Walk errors are handled per-file via walkErr; we continue searching despite errors
@@ -474,7 +711,7 @@ func findEpisodeFile(item *db.PodcastItem) string {
 		if walkErr != nil || info.IsDir() {
 			return nil
 		}
-		if isAudioFile(info.Name()) {
+		if service.IsMediaFile(info.Name()) {
 			foundPath = path
 			return filepath.SkipAll
 		}
@@ -484,7 +721,8 @@ func findEpisodeFile(item *db.PodcastItem) string {
 	return foundPath
 }
 
-// GetFileContentType handles the get file content type request.
+// GetFileContentType returns the MIME type of a served file. Media files are typed by
+// their extension since sniffing cannot tell audio-only MP4 from video; other files are sniffed.
 func GetFileContentType(filePath string) string {
 	file, err := os.Open(filePath) // #nosec G304 -- filePath is from database, managed by application
 	if err != nil {
@@ -495,6 +733,9 @@ func GetFileContentType(filePath string) string {
 			logger.Log.Errorw("closing file", "error", err)
 		}
 	}()
+	if mimeType := service.MediaTypeForPath(filePath); mimeType != "" {
+		return mimeType
+	}
 	buffer := make([]byte, 512)
 	if _, err := file.Read(buffer); err != nil {
 		return "application/octet-stream"
@@ -507,7 +748,7 @@ func MarkPodcastItemAsUnplayed(c *gin.Context) {
 	var searchByIDQuery SearchByIDQuery
 
 	if c.ShouldBindUri(&searchByIDQuery) == nil {
-		if err := service.SetPodcastItemPlayedStatus(searchByIDQuery.ID, false); err != nil {
+		if err := service.SetPodcastItemPlayedStatus(currentUser(c).ID, searchByIDQuery.ID, false); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -521,7 +762,7 @@ func MarkPodcastItemAsPlayed(c *gin.Context) {
 	var searchByIDQuery SearchByIDQuery
 
 	if c.ShouldBindUri(&searchByIDQuery) == nil {
-		if err := service.SetPodcastItemPlayedStatus(searchByIDQuery.ID, true); err != nil {
+		if err := service.SetPodcastItemPlayedStatus(currentUser(c).ID, searchByIDQuery.ID, true); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -535,7 +776,7 @@ func BookmarkPodcastItem(c *gin.Context) {
 	var searchByIDQuery SearchByIDQuery
 
 	if c.ShouldBindUri(&searchByIDQuery) == nil {
-		if err := service.SetPodcastItemBookmarkStatus(searchByIDQuery.ID, true); err != nil {
+		if err := service.SetPodcastItemBookmarkStatus(currentUser(c).ID, searchByIDQuery.ID, true); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -549,7 +790,7 @@ func UnbookmarkPodcastItem(c *gin.Context) {
 	var searchByIDQuery SearchByIDQuery
 
 	if c.ShouldBindUri(&searchByIDQuery) == nil {
-		if err := service.SetPodcastItemBookmarkStatus(searchByIDQuery.ID, false); err != nil {
+		if err := service.SetPodcastItemBookmarkStatus(currentUser(c).ID, searchByIDQuery.ID, false); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -578,6 +819,14 @@ func PatchPodcastItemByID(c *gin.Context) {
 			return
 		}
 
+		// Played is the current user's state, not a column of the episode.
+		if input.IsPlayed {
+			if err := service.SetPodcastItemPlayedStatus(currentUser(c).ID, podcast.ID, true); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			input.IsPlayed = false
+		}
 		db.DB.Model(&podcast).Updates(input)
 		c.JSON(200, podcast)
 	} else {
@@ -622,7 +871,7 @@ func AddPodcast(c *gin.Context) {
 	var addPodcastData AddPodcastData
 	err := c.ShouldBindJSON(&addPodcastData)
 	if err == nil {
-		pod, addErr := service.AddPodcast(addPodcastData.URL)
+		pod, addErr := service.AddPrivatePodcast(addPodcastData.URL, addPodcastData.credentials())
 		if addErr == nil {
 			go func() {
 				if refreshErr := service.RefreshEpisodes(); refreshErr != nil {
@@ -659,9 +908,11 @@ func GetTagByID(c *gin.Context) {
 	var searchByIDQuery SearchByIDQuery
 	if c.ShouldBindUri(&searchByIDQuery) == nil {
 		tag, err := db.GetTagByID(searchByIDQuery.ID)
-		if err == nil {
-			c.JSON(200, tag)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+			return
 		}
+		c.JSON(200, tag)
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 	}
@@ -682,6 +933,7 @@ func getBaseURL(c *gin.Context) string {
 func createRss(items []db.PodcastItem, title, description, image string, c *gin.Context) model.RssPodcastData {
 	rssItems := make([]model.RssItem, 0, len(items))
 	url := getBaseURL(c)
+	tokenQuery := feedTokenQuery(c)
 	setting := db.GetOrCreateSetting()
 	for i := range items {
 		itemGUID := items[i].ID
@@ -694,13 +946,13 @@ func createRss(items []db.PodcastItem, title, description, image string, c *gin.
 			Summary:     items[i].Summary,
 			Image: model.RssItemImage{
 				Text: items[i].Title,
-				Href: fmt.Sprintf("%s/podcastitems/%s/image", url, items[i].ID),
+				Href: fmt.Sprintf("%s/podcastitems/%s/image%s", url, items[i].ID, tokenQuery),
 			},
 			EpisodeType: items[i].EpisodeType,
 			Enclosure: model.RssItemEnclosure{
-				URL:    fmt.Sprintf("%s/podcastitems/%s/file", url, items[i].ID),
+				URL:    fmt.Sprintf("%s/podcastitems/%s/file%s", url, items[i].ID, tokenQuery),
 				Length: fmt.Sprint(items[i].FileSize),
-				Type:   "audio/mpeg",
+				Type:   service.EpisodeMediaType(&items[i]),
 			},
 			PubDate: items[i].PubDate.Format("Mon, 02 Jan 2006 15:04:05 -0700"),
 			GUID: model.RssItemGUID{
@@ -711,6 +963,15 @@ func createRss(items []db.PodcastItem, title, description, image string, c *gin.
 			Text:     items[i].Title,
 			Duration: fmt.Sprint(items[i].Duration),
 		}
+		if items[i].Season > 0 {
+			rssItem.Season = fmt.Sprint(items[i].Season)
+		}
+		if items[i].EpisodeNumber > 0 {
+			rssItem.Episode = fmt.Sprint(items[i].EpisodeNumber)
+		}
+		if items[i].Explicit {
+			rssItem.Explicit = "true"
+		}
 		rssItems = append(rssItems, rssItem)
 	}
 
@@ -738,6 +999,26 @@ func createRss(items []db.PodcastItem, title, description, image string, c *gin.
 	}
 }
 
+// addPodcastMetadataToRss copies the channel level metadata stored for a podcast into a generated feed.
+func addPodcastMetadataToRss(channel *model.RssChannel, podcast *db.Podcast) {
+	channel.Language = podcast.Language
+	channel.Copyright = podcast.Copyright
+	if podcast.Author != "" {
+		channel.Author = podcast.Author
+	}
+	if podcast.Explicit {
+		channel.Explicit = "true"
+	} else {
+		channel.Explicit = "false"
+	}
+	if podcast.Category != "" {
+		channel.Category = &model.RssCategory{Text: podcast.Category}
+	}
+	if podcast.OwnerName != "" || podcast.OwnerEmail != "" {
+		channel.Owner = &model.RssOwner{Name: podcast.OwnerName, Email: podcast.OwnerEmail}
+	}
+}
+
 // GetRssForPodcastByID handles the get rss for podcast by id request.
 func GetRssForPodcastByID(c *gin.Context) {
 	var searchByIDQuery SearchByIDQuery
@@ -755,7 +1036,9 @@ func GetRssForPodcastByID(c *gin.Context) {
 		title := podcast.Title
 
 		if err == nil {
-			c.XML(200, createRss(items, title, description, podcast.Image, c))
+			rss := createRss(items, title, description, podcast.Image, c)
+			addPodcastMetadataToRss(&rss.Channel, &podcast)
+			c.XML(200, rss)
 		}
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
@@ -803,10 +1086,11 @@ func GetRss(c *gin.Context) {
 func DeleteTagByID(c *gin.Context) {
 	var searchByIDQuery SearchByIDQuery
 	if c.ShouldBindUri(&searchByIDQuery) == nil {
-		err := service.DeleteTag(searchByIDQuery.ID)
-		if err == nil {
-			c.JSON(http.StatusNoContent, gin.H{})
+		if err := service.DeleteTag(searchByIDQuery.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
+		c.JSON(http.StatusNoContent, gin.H{})
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 	}
@@ -839,10 +1123,11 @@ func AddTagToPodcast(c *gin.Context) {
 	var addRemoveTagQuery AddRemoveTagQuery
 
 	if c.ShouldBindUri(&addRemoveTagQuery) == nil {
-		err := db.AddTagToPodcast(addRemoveTagQuery.ID, addRemoveTagQuery.TagID)
-		if err == nil {
-			c.JSON(200, gin.H{})
+		if err := db.AddTagToPodcast(addRemoveTagQuery.ID, addRemoveTagQuery.TagID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
+		c.JSON(200, gin.H{})
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 	}
@@ -853,10 +1138,11 @@ func RemoveTagFromPodcast(c *gin.Context) {
 	var addRemoveTagQuery AddRemoveTagQuery
 
 	if c.ShouldBindUri(&addRemoveTagQuery) == nil {
-		err := db.RemoveTagFromPodcast(addRemoveTagQuery.ID, addRemoveTagQuery.TagID)
-		if err == nil {
-			c.JSON(200, gin.H{})
+		if err := db.RemoveTagFromPodcast(addRemoveTagQuery.ID, addRemoveTagQuery.TagID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
+		c.JSON(200, gin.H{})
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 	}
@@ -868,28 +1154,47 @@ func UpdateSetting(c *gin.Context) {
 	err := c.ShouldBind(&settingModel)
 
 	if err == nil {
-		err = service.UpdateSettings(
-			settingModel.DownloadOnAdd,
-			settingModel.InitialDownloadCount,
-			settingModel.AutoDownload,
-			settingModel.FileNameFormat,
-			settingModel.PassthroughPodcastGUID,
-			settingModel.DarkMode,
-			settingModel.DownloadEpisodeImages,
-			settingModel.GenerateNFOFile,
-			settingModel.DontDownloadDeletedFromDisk,
-			settingModel.BaseURL,
-			settingModel.MaxDownloadConcurrency,
-			settingModel.MaxDownloadKeep,
-			settingModel.UserAgent,
-		)
-		if err == nil {
+		if err = settingModel.save(); err == nil {
 			c.JSON(200, gin.H{"message": "Success"})
 		} else {
-			c.JSON(http.StatusBadRequest, err)
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		}
 	} else {
 		logger.Log.Error(err.Error())
 		c.JSON(http.StatusBadRequest, err)
 	}
 }
+
+// save validates and stores the settings.
+func (settingModel *SettingModel) save() error {
+	return service.UpdateSettings(&db.Setting{
+		BaseURL:                     settingModel.BaseURL,
+		UserAgent:                   settingModel.UserAgent,
+		FileNameFormat:              settingModel.FileNameFormat,
+		InitialDownloadCount:        settingModel.InitialDownloadCount,
+		MaxDownloadConcurrency:      settingModel.MaxDownloadConcurrency,
+		MaxDownloadKeep:             settingModel.MaxDownloadKeep,
+		AutoPauseAfterFailures:      settingModel.AutoPauseAfterFailures,
+		StaleFeedDays:               settingModel.StaleFeedDays,
+		EnclosurePreference:         db.EnclosurePreference(settingModel.EnclosurePreference),
+		ProxyURL:                    settingModel.ProxyURL,
+		IPPreference:                db.IPPreference(settingModel.IPPreference),
+		ConnectTimeout:              settingModel.ConnectTimeout,
+		ReadTimeout:                 settingModel.ReadTimeout,
+		BandwidthLimit:              settingModel.BandwidthLimit,
+		HostBandwidthLimits:         settingModel.HostBandwidthLimits,
+		DownloadSchedule:            settingModel.DownloadSchedule,
+		EgressAllowlist:             settingModel.EgressAllowlist,
+		MaxRedirects:                settingModel.MaxRedirects,
+		PlayedThreshold:             settingModel.PlayedThreshold,
+		BlockPrivateNetworks:        settingModel.BlockPrivateNetworks,
+		AutoDownload:                settingModel.AutoDownload,
+		DownloadOnAdd:               settingModel.DownloadOnAdd,
+		DarkMode:                    settingModel.DarkMode,
+		DownloadEpisodeImages:       settingModel.DownloadEpisodeImages,
+		GenerateNFOFile:             settingModel.GenerateNFOFile,
+		DontDownloadDeletedFromDisk: settingModel.DontDownloadDeletedFromDisk,
+		PassthroughPodcastGUID:      settingModel.PassthroughPodcastGUID,
+		KeepRemovedUpstream:         settingModel.KeepRemovedUpstream,
+	})
+}
@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/internal/logger"
+	"github.com/toozej/podgrab/model"
+	"github.com/toozej/podgrab/pkg/version"
+	"github.com/toozej/podgrab/service"
+)
+
+// subsonicAPIVersion is the Subsonic API version Podgrab implements.
+const subsonicAPIVersion = "1.16.1"
+
+// subsonicHandlers are the Subsonic API calls Podgrab serves, all of them podcast ones.
+var subsonicHandlers = map[string]gin.HandlerFunc{
+	"ping":                      subsonicPing,
+	"getOpenSubsonicExtensions": subsonicGetExtensions,
+	"getPodcasts":               subsonicGetPodcasts,
+	"getNewestPodcasts":         subsonicGetNewestPodcasts,
+	"stream":                    subsonicStream,
+	"download":                  subsonicStream,
+	"getCoverArt":               subsonicGetCoverArt,
+	"createPodcastChannel":      subsonicCreatePodcastChannel,
+	"deletePodcastEpisode":      subsonicDeletePodcastEpisode,
+}
+
+// RegisterSubsonicRoutes adds the podcast calls of the Subsonic API used by players
+// such as DSub, Substreamer and play:Sub. Each call answers with and without the .view
+// suffix, to GET and POST.
+func RegisterSubsonicRoutes(group *gin.RouterGroup) {
+	group.Use(SubsonicAuthenticate())
+	for name, handler := range subsonicHandlers {
+		for _, route := range []string{"/" + name, "/" + name + ".view"} {
+			group.GET(route, handler)
+			group.POST(route, handler)
+		}
+	}
+}
+
+// SubsonicAuthenticate works out the user a Subsonic request acts for from its u, p and
+// apiKey parameters, which may come in the query or a form body.
+func SubsonicAuthenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := service.AuthenticateSubsonic(service.SubsonicCredentials{
+			Username: c.Request.FormValue("u"),
+			Password: c.Request.FormValue("p"),
+			Token:    c.Request.FormValue("t"),
+			Salt:     c.Request.FormValue("s"),
+			APIKey:   c.Request.FormValue("apiKey"),
+		}, time.Now())
+		if err != nil {
+			subsonicError(c, err)
+			c.Abort()
+			return
+		}
+		c.Set(userKey, user)
+		c.Next()
+	}
+}
+
+// subsonicRespond writes a Subsonic response in the format the client asked for: XML by
+// default, or JSON and JSONP.
+func subsonicRespond(c *gin.Context, response *model.SubsonicResponse) {
+	response.Xmlns = "http://subsonic.org/restapi"
+	if response.Status == "" {
+		response.Status = "ok"
+	}
+	response.Version = subsonicAPIVersion
+	response.Type = "podgrab"
+	response.ServerVersion = version.Version
+	response.OpenSubsonic = true
+	switch c.Request.FormValue("f") {
+	case "json":
+		c.JSON(http.StatusOK, gin.H{"subsonic-response": response})
+	case "jsonp":
+		c.JSONP(http.StatusOK, gin.H{"subsonic-response": response})
+	default:
+		c.XML(http.StatusOK, response)
+	}
+}
+
+// subsonicError reports a failed call. Subsonic errors are sent with status 200 and
+// their code in the body.
+func subsonicError(c *gin.Context, err error) {
+	var subsonicErr *service.SubsonicError
+	if !errors.As(err, &subsonicErr) {
+		logger.Log.Errorw("subsonic request", "error", err, "path", c.FullPath())
+		subsonicErr = &service.SubsonicError{Code: service.SubsonicErrorGeneric, Message: "Internal error"}
+	}
+	subsonicRespond(c, &model.SubsonicResponse{
+		Status: "failed",
+		Error:  &model.SubsonicError{Code: subsonicErr.Code, Message: subsonicErr.Message},
+	})
+}
+
+// subsonicRequiredParam returns a required parameter, reporting it when missing.
+func subsonicRequiredParam(c *gin.Context, name string) (string, bool) {
+	value := c.Request.FormValue(name)
+	if value == "" {
+		subsonicError(c, &service.SubsonicError{Code: service.SubsonicErrorMissingParameter, Message: "Required parameter is missing: " + name})
+		return "", false
+	}
+	return value, true
+}
+
+// subsonicPing answers the connection check clients make.
+func subsonicPing(c *gin.Context) {
+	subsonicRespond(c, &model.SubsonicResponse{})
+}
+
+// subsonicGetExtensions lists the OpenSubsonic extensions Podgrab supports.
+func subsonicGetExtensions(c *gin.Context) {
+	subsonicRespond(c, &model.SubsonicResponse{
+		OpenSubsonicExtensions: []model.SubsonicExtension{{Name: "apiKeyAuthentication", Versions: []int{1}}},
+	})
+}
+
+// subsonicGetPodcasts returns the podcasts, with their episodes unless
+// includeEpisodes=false.
+func subsonicGetPodcasts(c *gin.Context) {
+	includeEpisodes := c.Request.FormValue("includeEpisodes") != "false"
+	channels, err := service.GetSubsonicPodcasts(c.Request.FormValue("id"), includeEpisodes)
+	if err != nil {
+		subsonicError(c, err)
+		return
+	}
+	subsonicRespond(c, &model.SubsonicResponse{Podcasts: &model.SubsonicPodcasts{Channels: channels}})
+}
+
+// subsonicGetNewestPodcasts returns the most recently published episodes.
+func subsonicGetNewestPodcasts(c *gin.Context) {
+	count, err := strconv.Atoi(c.DefaultQuery("count", "20"))
+	if err != nil {
+		count = 20
+	}
+	episodes, err := service.GetNewestSubsonicEpisodes(count)
+	if err != nil {
+		subsonicError(c, err)
+		return
+	}
+	subsonicRespond(c, &model.SubsonicResponse{NewestPodcasts: &model.SubsonicNewestPodcasts{Episodes: episodes}})
+}
+
+// subsonicStream serves an episode's file, or redirects to the remote file when it has
+// not been downloaded.
+func subsonicStream(c *gin.Context) {
+	id, ok := subsonicRequiredParam(c, "id")
+	if !ok {
+		return
+	}
+	item, err := service.GetSubsonicPodcastItem(id)
+	if err != nil {
+		subsonicError(c, err)
+		return
+	}
+	servePodcastItemFile(c, item)
+}
+
+// subsonicGetCoverArt serves the image of a podcast or an episode.
+func subsonicGetCoverArt(c *gin.Context) {
+	id, ok := subsonicRequiredParam(c, "id")
+	if !ok {
+		return
+	}
+	var podcast db.Podcast
+	if err := db.GetPodcastByID(id, &podcast); err == nil {
+		servePodcastImage(c, &podcast)
+		return
+	}
+	item, err := service.GetSubsonicPodcastItem(id)
+	if err != nil {
+		subsonicError(c, err)
+		return
+	}
+	servePodcastItemImage(c, item)
+}
+
+// subsonicCreatePodcastChannel adds a podcast by its feed URL. Adding a podcast that is
+// already there succeeds.
+func subsonicCreatePodcastChannel(c *gin.Context) {
+	url, ok := subsonicRequiredParam(c, "url")
+	if !ok {
+		return
+	}
+	if podcast, err := service.AddPodcast(url); err != nil {
+		var exists *model.PodcastAlreadyExistsError
+		if !errors.As(err, &exists) {
+			subsonicError(c, &service.SubsonicError{Code: service.SubsonicErrorGeneric, Message: err.Error()})
+			return
+		}
+	} else {
+		go func() {
+			if refreshErr := service.RefreshPodcastByPodcastID(podcast.ID); refreshErr != nil {
+				logger.Log.Errorw("refreshing podcast", "error", refreshErr)
+			}
+		}()
+	}
+	subsonicRespond(c, &model.SubsonicResponse{})
+}
+
+// subsonicDeletePodcastEpisode deletes the downloaded file of an episode.
+func subsonicDeletePodcastEpisode(c *gin.Context) {
+	id, ok := subsonicRequiredParam(c, "id")
+	if !ok {
+		return
+	}
+	item, err := service.GetSubsonicPodcastItem(id)
+	if err != nil {
+		subsonicError(c, err)
+		return
+	}
+	if err := service.DeleteEpisodeFile(item.ID); err != nil {
+		subsonicError(c, err)
+		return
+	}
+	subsonicRespond(c, &model.SubsonicResponse{})
+}
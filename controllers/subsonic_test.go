@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/model"
+	"github.com/toozej/podgrab/service"
+)
+
+// subsonicRequest makes a Subsonic JSON request and decodes its response.
+func subsonicRequest(t *testing.T, router *gin.Engine, target string) model.SubsonicResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target+"&f=json", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, "Subsonic errors are sent with status 200")
+	var body struct {
+		Response model.SubsonicResponse `json:"subsonic-response"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body), w.Body.String())
+	return body.Response
+}
+
+func TestSubsonicAuthentication(t *testing.T) {
+	_, _, cleanup := setupTestDBAndEnv(t)
+	defer cleanup()
+	admin, err := service.EnsureDefaultUser("admin-password")
+	require.NoError(t, err)
+	syncToken, _, err := service.CreateAPIToken(admin.ID, "DSub", db.TokenScopeSync, 0)
+	require.NoError(t, err)
+	router := setupTestRouter()
+	RegisterSubsonicRoutes(router.Group("/rest"))
+
+	req := httptest.NewRequest(http.MethodGet, "/rest/ping.view?u=podgrab&p=admin-password&v=1.16.1&c=test", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var response model.SubsonicResponse
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &response), w.Body.String())
+	assert.Equal(t, "ok", response.Status, "Responses should be XML by default")
+
+	tests := []struct {
+		name   string
+		target string
+		code   int
+	}{
+		{"password", "/rest/ping?u=podgrab&p=admin-password", 0},
+		{"api key", "/rest/ping?apiKey=" + syncToken, 0},
+		{"wrong password", "/rest/ping?u=podgrab&p=wrong", service.SubsonicErrorWrongCredentials},
+		{"salted token", "/rest/ping?u=podgrab&t=26719a1196d2a940705a59634eb18eab&s=c19b2d", service.SubsonicErrorTokenAuth},
+		{"unknown api key", "/rest/ping?apiKey=pg_unknown", service.SubsonicErrorInvalidAPIKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := subsonicRequest(t, router, tt.target)
+			if tt.code == 0 {
+				assert.Equal(t, "ok", response.Status)
+				return
+			}
+			assert.Equal(t, "failed", response.Status)
+			require.NotNil(t, response.Error)
+			assert.Equal(t, tt.code, response.Error.Code)
+		})
+	}
+}
+
+func TestSubsonicPodcasts(t *testing.T) {
+	database, _, cleanup := setupTestDBAndEnv(t)
+	defer cleanup()
+	router := setupTestRouter()
+	RegisterSubsonicRoutes(router.Group("/rest"))
+
+	podcast := db.CreateTestPodcast(t, database)
+	remote := db.CreateTestPodcastItem(t, database, podcast.ID)
+	// Outside the data folder, which streaming searches for files gone missing.
+	filePath := filepath.Join(t.TempDir(), "episode.mp3")
+	require.NoError(t, os.WriteFile(filePath, []byte("fake audio content"), 0o644))
+	local := db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{
+		DownloadPath:   filePath,
+		DownloadStatus: db.Downloaded,
+	})
+
+	response := subsonicRequest(t, router, "/rest/getPodcasts.view?v=1.16.1")
+	require.NotNil(t, response.Podcasts)
+	require.Len(t, response.Podcasts.Channels, 1)
+	assert.Equal(t, podcast.ID, response.Podcasts.Channels[0].ID)
+	assert.Len(t, response.Podcasts.Channels[0].Episodes, 2)
+
+	response = subsonicRequest(t, router, "/rest/getPodcasts?includeEpisodes=false")
+	require.Len(t, response.Podcasts.Channels, 1)
+	assert.Empty(t, response.Podcasts.Channels[0].Episodes)
+
+	response = subsonicRequest(t, router, "/rest/getNewestPodcasts?count=1")
+	require.NotNil(t, response.NewestPodcasts)
+	assert.Len(t, response.NewestPodcasts.Episodes, 1)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/rest/stream?id="+local.ID, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "fake audio content", w.Body.String())
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/rest/download.view?id="+remote.ID, nil))
+	assert.Equal(t, http.StatusFound, w.Code, "Episodes not downloaded should redirect to the remote file")
+	assert.Equal(t, remote.FileURL, w.Header().Get("Location"))
+
+	response = subsonicRequest(t, router, "/rest/stream?id=missing")
+	require.NotNil(t, response.Error)
+	assert.Equal(t, service.SubsonicErrorNotFound, response.Error.Code)
+	response = subsonicRequest(t, router, "/rest/createPodcastChannel?v=1.16.1")
+	require.NotNil(t, response.Error)
+	assert.Equal(t, service.SubsonicErrorMissingParameter, response.Error.Code)
+
+	response = subsonicRequest(t, router, "/rest/deletePodcastEpisode?id="+local.ID)
+	assert.Equal(t, "ok", response.Status)
+	assert.NoFileExists(t, filePath)
+	var deleted db.PodcastItem
+	require.NoError(t, db.GetPodcastItemByID(local.ID, &deleted))
+	assert.Equal(t, db.Deleted, deleted.DownloadStatus)
+}
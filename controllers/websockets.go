@@ -2,11 +2,13 @@ package controllers
 
 import (
 	"encoding/json"
-	"net/http"
 	"sync"
+	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/toozej/podgrab/internal/logger"
+	"github.com/toozej/podgrab/service"
 )
 
 // EnqueuePayload represents enqueue payload data.
@@ -16,6 +18,13 @@ type EnqueuePayload struct {
 	TagIDs    []string `json:"tagIDs"`
 }
 
+// ProgressPayload represents progress payload data. Times are in seconds.
+type ProgressPayload struct {
+	ItemID   string `json:"itemID"`
+	Position int    `json:"position"`
+	Duration int    `json:"duration"`
+}
+
 var wsupgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
@@ -32,15 +41,18 @@ var broadcast = make(chan Message) // broadcast channel
 // Message represents message data.
 type Message struct {
 	Connection  *websocket.Conn `json:"-"`
+	UserID      string          `json:"-"`
 	Identifier  string          `json:"identifier"`
 	MessageType string          `json:"messageType"`
 	Payload     string          `json:"payload"`
 }
 
-// Wshandler handles the wshandler request.
-func Wshandler(w http.ResponseWriter, r *http.Request) {
+// Wshandler handles the wshandler request. Messages act for the user who opened the
+// connection.
+func Wshandler(c *gin.Context) {
+	userID := currentUser(c).ID
 	// nosemgrep: go.gorilla.security.audit.websocket-missing-origin-check.websocket-missing-origin-check
-	conn, err := wsupgrader.Upgrade(w, r, nil)
+	conn, err := wsupgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		logger.Log.Errorw("Failed to set websocket upgrade", "error", err)
 		return
@@ -68,6 +80,7 @@ func Wshandler(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 		mess.Connection = conn
+		mess.UserID = userID
 		connMutex.Lock()
 		allConnections[conn] = mess.Identifier
 		connMutex.Unlock()
@@ -116,6 +129,9 @@ func HandleWebsocketMessages() {
 			err := json.Unmarshal([]byte(msg.Payload), &payload)
 			if err == nil {
 				items := getItemsToPlay(payload.ItemIDs, payload.PodcastID, payload.TagIDs)
+				if err := service.ApplyEpisodeStates(msg.UserID, items); err != nil {
+					logger.Log.Errorw("applying episode states", "error", err)
+				}
 				var player *websocket.Conn
 				connMutex.RLock()
 				for connection, id := range activePlayers {
@@ -140,6 +156,28 @@ func HandleWebsocketMessages() {
 			} else {
 				logger.Log.Error(err.Error())
 			}
+		case "Progress":
+			var payload ProgressPayload
+			if err := json.Unmarshal([]byte(msg.Payload), &payload); err != nil {
+				logger.Log.Errorw("reading progress payload", "error", err)
+				continue
+			}
+			state, err := service.SavePlaybackProgress(msg.UserID, payload.ItemID, payload.Position, payload.Duration, time.Now())
+			if err != nil {
+				logger.Log.Errorw("saving playback progress", "error", err, "item", payload.ItemID)
+				continue
+			}
+			payloadStr, err := json.Marshal(newPlaybackProgress(state))
+			if err != nil {
+				continue
+			}
+			if err := msg.Connection.WriteJSON(Message{
+				Identifier:  msg.Identifier,
+				MessageType: "Progress",
+				Payload:     string(payloadStr),
+			}); err != nil {
+				logger.Log.Errorw("writing JSON to connection", "error", err)
+			}
 		case "Register":
 			var player *websocket.Conn
 			connMutex.RLock()
@@ -37,7 +37,7 @@ func Init() (*gorm.DB, error) {
 
 // Migrate Database
 func Migrate() {
-	if err := DB.AutoMigrate(&Podcast{}, &PodcastItem{}, &Setting{}, &Migration{}, &JobLock{}, &Tag{}); err != nil {
+	if err := DB.AutoMigrate(&Podcast{}, &PodcastItem{}, &Setting{}, &Migration{}, &JobLock{}, &Tag{}, &PodcastMetadataChange{}, &PodcastItemEnclosure{}, &APIToken{}, &User{}, &UserSession{}, &EpisodeState{}, &GPodderDevice{}, &SubscriptionChange{}, &EpisodeAction{}, &Webhook{}, &WebhookDelivery{}, &Notifier{}); err != nil {
 		panic(fmt.Sprintf("failed to auto-migrate database: %v", err))
 	}
 	RunMigrations()
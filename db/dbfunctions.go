@@ -82,14 +82,42 @@ func GetPaginatedPodcastItemsNew(queryModel *model.EpisodesFilter) (*[]PodcastIt
 	if queryModel.IsPlayed != nil {
 		isPlayed, err := strconv.ParseBool(*queryModel.IsPlayed)
 		if err == nil {
+			played := DB.Model(&EpisodeState{}).Select("podcast_item_id").Where("user_id=? AND is_played=?", queryModel.UserID, true)
 			if isPlayed {
-				query = query.Where("is_played=?", 1)
+				query = query.Where("id in (?)", played)
 			} else {
-				query = query.Where("is_played=?", 0)
+				query = query.Where("id not in (?)", played)
 			}
 		}
 	}
 
+	if queryModel.Explicit != nil {
+		explicit, err := strconv.ParseBool(*queryModel.Explicit)
+		if err == nil {
+			if explicit {
+				query = query.Where(DB.Where("explicit=?", 1).Or("podcast_id in (select id from podcasts where explicit=?)", 1))
+			} else {
+				query = query.Where("explicit=?", 0).Where("podcast_id not in (select id from podcasts where explicit=?)", 1)
+			}
+		}
+	}
+	if queryModel.RemovedUpstream != nil {
+		removedUpstream, err := strconv.ParseBool(*queryModel.RemovedUpstream)
+		if err == nil {
+			if removedUpstream {
+				query = query.Where("removed_upstream=?", 1)
+			} else {
+				query = query.Where("removed_upstream=?", 0)
+			}
+		}
+	}
+	if queryModel.Season != nil && *queryModel.Season != "nil" && *queryModel.Season != "" {
+		season, err := strconv.Atoi(*queryModel.Season)
+		if err == nil {
+			query = query.Where("season=?", season)
+		}
+	}
+
 	if queryModel.Q != "" {
 		query = query.Where("UPPER(title) like ?", "%"+strings.TrimSpace(strings.ToUpper(queryModel.Q))+"%")
 	}
@@ -105,7 +133,7 @@ func GetPaginatedPodcastItemsNew(queryModel *model.EpisodesFilter) (*[]PodcastIt
 	totalsQuery := query.Order(getSortOrder(queryModel.Sorting)).Find(&podcasts)
 	totalsQuery.Count(&total)
 
-	result := query.Limit(queryModel.Count).Offset((queryModel.Page - 1) * queryModel.Count).Order("pub_date desc").Find(&podcasts)
+	result := query.Limit(queryModel.Count).Offset(queryModel.Offset()).Order("pub_date desc").Find(&podcasts)
 	return &podcasts, total, result.Error
 }
 
@@ -156,6 +184,13 @@ func GetPodcastByID(id string, podcast *Podcast) error {
 	return result.Error
 }
 
+// GetExistingPodcastIDs get the ids among ids of podcasts that exist.
+func GetExistingPodcastIDs(ids []string) ([]string, error) {
+	existing := []string{}
+	result := DB.Model(&Podcast{}).Where("id IN ?", ids).Pluck("id", &existing)
+	return existing, result.Error
+}
+
 // GetPodcastItemByID get podcast item by id.
 func GetPodcastItemByID(id string, podcastItem *PodcastItem) error {
 	result := DB.Preload(clause.Associations).First(&podcastItem, "id=?", id)
@@ -164,6 +199,12 @@ func GetPodcastItemByID(id string, podcastItem *PodcastItem) error {
 
 // DeletePodcastItemByID delete podcast item by id.
 func DeletePodcastItemByID(id string) error {
+	if err := DB.Where("podcast_item_id = ?", id).Delete(&PodcastItemEnclosure{}).Error; err != nil {
+		return err
+	}
+	if err := DB.Where("podcast_item_id = ?", id).Delete(&EpisodeState{}).Error; err != nil {
+		return err
+	}
 	result := DB.Where("id=?", id).Delete(&PodcastItem{})
 	return result.Error
 }
@@ -171,10 +212,25 @@ func DeletePodcastItemByID(id string) error {
 // DeletePodcastByID delete podcast by id.
 func DeletePodcastByID(id string) error {
 	// Delete associated podcast items first
+	if err := DB.Where("podcast_item_id IN (?)", DB.Model(&PodcastItem{}).Select("id").Where("podcast_id = ?", id)).
+		Delete(&PodcastItemEnclosure{}).Error; err != nil {
+		return err
+	}
+	if err := DB.Where("podcast_item_id IN (?)", DB.Model(&PodcastItem{}).Select("id").Where("podcast_id = ?", id)).
+		Delete(&EpisodeState{}).Error; err != nil {
+		return err
+	}
 	if err := DB.Where("podcast_id = ?", id).Delete(&PodcastItem{}).Error; err != nil {
 		return err
 	}
 
+	if err := DB.Where("podcast_id = ?", id).Delete(&PodcastMetadataChange{}).Error; err != nil {
+		return err
+	}
+	if err := DB.Exec("DELETE FROM `notifier_podcasts` WHERE `podcast_id`=?", id).Error; err != nil {
+		return err
+	}
+
 	// Then delete the podcast
 	result := DB.Where("id=?", id).Delete(&Podcast{})
 	return result.Error
@@ -192,6 +248,20 @@ func GetAllPodcastItemsByPodcastID(podcastID string, podcastItems *[]PodcastItem
 	return result.Error
 }
 
+// GetDownloadedPodcastItemsByPodcastID gets the downloaded episodes of a podcast, newest first.
+func GetDownloadedPodcastItemsByPodcastID(podcastID string, podcastItems *[]PodcastItem) error {
+	result := DB.Where("podcast_id=? AND download_status=?", podcastID, Downloaded).Order("pub_date desc").Find(podcastItems)
+	return result.Error
+}
+
+// GetLastPodcastItemUpdate returns when an episode last changed, or the zero time when
+// there are none.
+func GetLastPodcastItemUpdate() (time.Time, error) {
+	var podcastItem PodcastItem
+	result := DB.Select("updated_at").Order("updated_at desc").Limit(1).Find(&podcastItem)
+	return podcastItem.UpdatedAt, result.Error
+}
+
 // GetAllPodcastItemsByPodcastIDs get all podcast items by podcast ids.
 func GetAllPodcastItemsByPodcastIDs(podcastIDs []string, podcastItems *[]PodcastItem) error {
 	result := DB.Preload(clause.Associations).Where("podcast_id in ?", podcastIDs).Order("pub_date desc").Find(&podcastItems)
@@ -229,12 +299,108 @@ func UpdateLastEpisodeDateForPodcast(podcastID string, lastEpisode time.Time) er
 	return result.Error
 }
 
+// UpdatePodcastURL update podcast feed url.
+func UpdatePodcastURL(podcastID, url string) error {
+	result := DB.Model(Podcast{}).Where("id=?", podcastID).Update("url", url)
+	return result.Error
+}
+
+// UpdatePodcastFeedHealth update the feed health columns of a podcast.
+func UpdatePodcastFeedHealth(podcast *Podcast) error {
+	tx := DB.Model(&Podcast{}).Where("id = ?", podcast.ID).
+		Select("LastFetchAttempt", "LastFetchSuccess", "LastHTTPStatus", "LastFetchError", "ConsecutiveFailures", "LastNewEpisode", "MovedTo").
+		Updates(podcast)
+	return tx.Error
+}
+
+// GetPodcastsWithFeedFailures get podcasts whose latest refreshes failed.
+func GetPodcastsWithFeedFailures(podcasts *[]Podcast) error {
+	result := DB.Where("consecutive_failures > 0").Order("consecutive_failures desc").Find(podcasts)
+	return result.Error
+}
+
+// GetStalePodcasts get podcasts without a new episode since the given date.
+func GetStalePodcasts(since time.Time, podcasts *[]Podcast) error {
+	result := DB.Where("COALESCE(last_new_episode, last_episode) < ?", since).Order("last_episode asc").Find(podcasts)
+	return result.Error
+}
+
+// GetRedirectedPodcasts get podcasts with a pending feed move or whose feed moved since the given date.
+func GetRedirectedPodcasts(since time.Time, podcasts *[]Podcast) error {
+	movedIDs := DB.Model(&PodcastMetadataChange{}).Select("podcast_id").Where("field = ? AND created_at > ?", "URL", since)
+	result := DB.Where("moved_to <> ''").Or("id IN (?)", movedIDs).Order("title").Find(podcasts)
+	return result.Error
+}
+
 // UpdatePodcastItemFileSize update podcast item file size.
 func UpdatePodcastItemFileSize(podcastItemID string, size int64) error {
 	result := DB.Model(PodcastItem{}).Where("id=?", podcastItemID).Update("file_size", size)
 	return result.Error
 }
 
+// UpdatePodcastItemFeedMetadata update podcast item season, episode number and explicit flag.
+func UpdatePodcastItemFeedMetadata(podcastItemID string, season, episodeNumber int, explicit bool) error {
+	result := DB.Model(PodcastItem{}).Where("id=?", podcastItemID).Updates(map[string]interface{}{
+		"season":         season,
+		"episode_number": episodeNumber,
+		"explicit":       explicit,
+	})
+	return result.Error
+}
+
+// UpdatePodcastItemDuration update the duration of a podcast item.
+func UpdatePodcastItemDuration(podcastItemID string, duration int) error {
+	result := DB.Model(PodcastItem{}).Where("id=?", podcastItemID).Update("duration", duration)
+	return result.Error
+}
+
+// UpdatePodcastItemGUID update the guid of a podcast item.
+func UpdatePodcastItemGUID(podcastItemID, guid string) error {
+	result := DB.Model(PodcastItem{}).Where("id=?", podcastItemID).Update("guid", guid)
+	return result.Error
+}
+
+// ReplacePodcastItemEnclosures replace the stored media versions of a podcast item.
+func ReplacePodcastItemEnclosures(podcastItemID string, enclosures []PodcastItemEnclosure) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("podcast_item_id = ?", podcastItemID).Delete(&PodcastItemEnclosure{}).Error; err != nil {
+			return err
+		}
+		for i := range enclosures {
+			enclosures[i].PodcastItemID = podcastItemID
+			if err := tx.Create(&enclosures[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UpdatePodcastItemEnclosure update the enclosure and download columns of a podcast item.
+func UpdatePodcastItemEnclosure(podcastItem *PodcastItem) error {
+	tx := DB.Model(&PodcastItem{}).Where("id = ?", podcastItem.ID).
+		Select("FileURL", "EnclosureLength", "EnclosureType", "PubDate", "EnclosureChanged", "EnclosureChangedDate",
+			"DownloadStatus", "DownloadPath", "DownloadDate", "PreviousDownloadPath").
+		Updates(podcastItem)
+	return tx.Error
+}
+
+// MarkPodcastItemsRemovedUpstream flags items of a podcast whose GUID is no longer in the feed.
+func MarkPodcastItemsRemovedUpstream(podcastID string, feedGUIDs []string, date time.Time) (int64, error) {
+	result := DB.Model(PodcastItem{}).
+		Where("podcast_id=? AND removed_upstream=? AND guid not in ?", podcastID, false, feedGUIDs).
+		Updates(map[string]interface{}{"removed_upstream": true, "removed_upstream_date": date})
+	return result.RowsAffected, result.Error
+}
+
+// RestorePodcastItemsUpstream clears the removed upstream flag of items that are back in the feed.
+func RestorePodcastItemsUpstream(podcastID string, feedGUIDs []string) (int64, error) {
+	result := DB.Model(PodcastItem{}).
+		Where("podcast_id=? AND removed_upstream=? AND guid in ?", podcastID, true, feedGUIDs).
+		Updates(map[string]interface{}{"removed_upstream": false, "removed_upstream_date": time.Time{}})
+	return result.RowsAffected, result.Error
+}
+
 // GetAllPodcastItemsWithoutImage get all podcast items without image.
 func GetAllPodcastItemsWithoutImage() (*[]PodcastItem, error) {
 	var podcastItems []PodcastItem
@@ -314,6 +480,42 @@ func ForceSetLastEpisodeDate(podcastID string) {
 	DB.Exec("update podcasts set last_episode = (select max(pi.pub_date) from podcast_items pi where pi.podcast_id = @id) where id = @id", sql.Named("id", podcastID))
 }
 
+// UpdatePodcastEnclosureChangePolicy update the enclosure change policy of a podcast.
+func UpdatePodcastEnclosureChangePolicy(podcastID string, policy EnclosureChangePolicy) error {
+	result := DB.Model(Podcast{}).Where("id=?", podcastID).Update("enclosure_change_policy", policy)
+	return result.Error
+}
+
+// UpdatePodcastDedupeMode update the dedupe mode of a podcast.
+func UpdatePodcastDedupeMode(podcastID string, mode DedupeMode) error {
+	result := DB.Model(Podcast{}).Where("id=?", podcastID).Update("dedupe_mode", mode)
+	return result.Error
+}
+
+// UpdatePodcastEnclosurePreference update the enclosure preference of a podcast.
+func UpdatePodcastEnclosurePreference(podcastID string, preference EnclosurePreference) error {
+	result := DB.Model(Podcast{}).Where("id=?", podcastID).Update("enclosure_preference", preference)
+	return result.Error
+}
+
+// UpdatePodcastNetwork update the network overrides of a podcast.
+func UpdatePodcastNetwork(podcastID, proxyURL, userAgent string, connectTimeout, readTimeout int, ipPreference IPPreference) error {
+	result := DB.Model(Podcast{}).Where("id=?", podcastID).Updates(map[string]interface{}{
+		"proxy_url":       proxyURL,
+		"user_agent":      userAgent,
+		"connect_timeout": connectTimeout,
+		"read_timeout":    readTimeout,
+		"ip_preference":   ipPreference,
+	})
+	return result.Error
+}
+
+// UpdatePodcastCredentials update the encrypted credentials of a podcast.
+func UpdatePodcastCredentials(podcastID, credentials string) error {
+	result := DB.Model(Podcast{}).Where("id=?", podcastID).Update("credentials", credentials)
+	return result.Error
+}
+
 // TogglePodcastPauseStatus toggle podcast pause status.
 func TogglePodcastPauseStatus(podcastID string, isPaused bool) error {
 	tx := DB.Debug().Exec("update podcasts set is_paused = @isPaused where id = @id", sql.Named("id", podcastID), sql.Named("isPaused", isPaused))
@@ -333,6 +535,12 @@ func GetPodcastItemByPodcastIDAndGUID(podcastID, guid string, podcastItem *Podca
 	return result.Error
 }
 
+// GetPodcastItemByPodcastIDAndFileURL get podcast item by podcast id and the URL of its media.
+func GetPodcastItemByPodcastIDAndFileURL(podcastID, fileURL string, podcastItem *PodcastItem) error {
+	result := DB.Preload(clause.Associations).Where(&PodcastItem{PodcastID: podcastID, FileURL: fileURL}).First(podcastItem)
+	return result.Error
+}
+
 // GetPodcastByTitleAndAuthor get podcast by title and author.
 func GetPodcastByTitleAndAuthor(title, author string, podcast *Podcast) error {
 	result := DB.Preload(clause.Associations).Where(&Podcast{Title: title, Author: author}).First(&podcast)
@@ -357,9 +565,17 @@ func UpdatePodcast(podcast *Podcast) error {
 	return tx.Error
 }
 
+// UpdatePodcastMetadata update the channel metadata columns of a podcast.
+func UpdatePodcastMetadata(podcast *Podcast) error {
+	tx := DB.Model(&Podcast{}).Where("id = ?", podcast.ID).
+		Select("Title", "Summary", "Author", "Image", "Category", "Language", "Explicit", "OwnerName", "OwnerEmail", "Copyright").
+		Updates(podcast)
+	return tx.Error
+}
+
 // UpdatePodcastItem update podcast item.
 func UpdatePodcastItem(podcastItem *PodcastItem) error {
-	tx := DB.Omit("Podcast").Save(&podcastItem)
+	tx := DB.Omit("Podcast", "Enclosures").Save(&podcastItem)
 	return tx.Error
 }
 
@@ -528,3 +744,485 @@ func UntagAllByTagID(tagID string) error {
 	tx := DB.Exec("DELETE FROM `podcast_tags` WHERE `tag_id`=?", tagID)
 	return tx.Error
 }
+
+// CreatePodcastMetadataChange create podcast metadata change.
+func CreatePodcastMetadataChange(change *PodcastMetadataChange) error {
+	tx := DB.Create(&change)
+	return tx.Error
+}
+
+// GetPodcastMetadataChangesByPodcastID get podcast metadata changes by podcast id, newest first.
+func GetPodcastMetadataChangesByPodcastID(podcastID string, changes *[]PodcastMetadataChange) error {
+	result := DB.Where(&PodcastMetadataChange{PodcastID: podcastID}).Order("created_at desc").Find(changes)
+	return result.Error
+}
+
+// CreateAPIToken create api token.
+func CreateAPIToken(token *APIToken) error {
+	tx := DB.Create(token)
+	return tx.Error
+}
+
+// GetAPITokensByUserID get the api tokens of a user, newest first.
+func GetAPITokensByUserID(userID string, tokens *[]APIToken) error {
+	result := DB.Where("user_id=?", userID).Order("created_at desc").Find(tokens)
+	return result.Error
+}
+
+// GetAPITokenByHash get api token by the hash of its value.
+func GetAPITokenByHash(hash string, token *APIToken) error {
+	result := DB.First(token, "token_hash=?", hash)
+	return result.Error
+}
+
+// DeleteAPITokenByID delete a user's api token by id.
+func DeleteAPITokenByID(id, userID string) error {
+	result := DB.Where("id=? AND user_id=?", id, userID).Delete(&APIToken{})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+// TouchAPIToken records that a token was used. The timestamp is updated at most once a
+// minute so busy tokens do not write on every request.
+func TouchAPIToken(id string, now time.Time) error {
+	result := DB.Model(&APIToken{}).
+		Where("id=? AND (last_used_at IS NULL OR last_used_at<?)", id, now.Add(-time.Minute)).
+		Update("last_used_at", now)
+	return result.Error
+}
+
+// CreateUser create user.
+func CreateUser(user *User) error {
+	tx := DB.Create(user)
+	return tx.Error
+}
+
+// UpdateUser update user.
+func UpdateUser(user *User) error {
+	tx := DB.Save(user)
+	return tx.Error
+}
+
+// GetAllUsers get all users ordered by username.
+func GetAllUsers(users *[]User) error {
+	result := DB.Order("username asc").Find(users)
+	return result.Error
+}
+
+// GetUserByID get user by id.
+func GetUserByID(id string, user *User) error {
+	result := DB.First(user, "id=?", id)
+	return result.Error
+}
+
+// GetUserByUsername get user by username.
+func GetUserByUsername(username string, user *User) error {
+	result := DB.First(user, "username=?", username)
+	return result.Error
+}
+
+// GetFirstAdminUser get the oldest admin user.
+func GetFirstAdminUser(user *User) error {
+	result := DB.Where("is_admin=?", true).Order("created_at asc").First(user)
+	return result.Error
+}
+
+// CountUsers count users, only those with a password when withPassword is set.
+func CountUsers(withPassword bool) (int64, error) {
+	var count int64
+	query := DB.Model(&User{})
+	if withPassword {
+		query = query.Where("password_hash<>?", "")
+	}
+	result := query.Count(&count)
+	return count, result.Error
+}
+
+// CountAdminUsers count admin users, only those with a password when withPassword is set.
+func CountAdminUsers(withPassword bool) (int64, error) {
+	var count int64
+	query := DB.Model(&User{}).Where("is_admin=?", true)
+	if withPassword {
+		query = query.Where("password_hash<>?", "")
+	}
+	result := query.Count(&count)
+	return count, result.Error
+}
+
+// DeleteUserByID delete a user with their sessions, tokens and listening state.
+func DeleteUserByID(id string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&UserSession{}, &APIToken{}, &EpisodeState{}, &GPodderDevice{}, &EpisodeAction{}} {
+			if err := tx.Where("user_id=?", id).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		result := tx.Where("id=?", id).Delete(&User{})
+		if result.Error == nil && result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return result.Error
+	})
+}
+
+// CreateUserSession create user session.
+func CreateUserSession(session *UserSession) error {
+	tx := DB.Create(session)
+	return tx.Error
+}
+
+// GetUserSessionByHash get user session by the hash of its cookie value.
+func GetUserSessionByHash(hash string, session *UserSession) error {
+	result := DB.First(session, "token_hash=?", hash)
+	return result.Error
+}
+
+// DeleteUserSessionByHash delete user session by the hash of its cookie value.
+func DeleteUserSessionByHash(hash string) error {
+	result := DB.Where("token_hash=?", hash).Delete(&UserSession{})
+	return result.Error
+}
+
+// DeleteUserSessionsByUserID delete every session of a user.
+func DeleteUserSessionsByUserID(userID string) error {
+	result := DB.Where("user_id=?", userID).Delete(&UserSession{})
+	return result.Error
+}
+
+// DeleteExpiredUserSessions delete sessions that expired before a time.
+func DeleteExpiredUserSessions(before time.Time) error {
+	result := DB.Where("expires_at<?", before).Delete(&UserSession{})
+	return result.Error
+}
+
+// GetEpisodeState get a user's state for an episode, or a new unsaved state when
+// there is none yet.
+func GetEpisodeState(userID, podcastItemID string, state *EpisodeState) error {
+	result := DB.Where(&EpisodeState{UserID: userID, PodcastItemID: podcastItemID}).FirstOrInit(state)
+	return result.Error
+}
+
+// SaveEpisodeState create or update an episode state.
+func SaveEpisodeState(state *EpisodeState) error {
+	tx := DB.Save(state)
+	return tx.Error
+}
+
+// GetEpisodeStatesByItemIDs get a user's states for some episodes.
+func GetEpisodeStatesByItemIDs(userID string, podcastItemIDs []string, states *[]EpisodeState) error {
+	result := DB.Where("user_id=? AND podcast_item_id in ?", userID, podcastItemIDs).Find(states)
+	return result.Error
+}
+
+// GetNextQueuePosition get the queue position after the last queued episode of a user.
+func GetNextQueuePosition(userID string) (int, error) {
+	var last int
+	result := DB.Model(&EpisodeState{}).Where("user_id=?", userID).Select("COALESCE(MAX(queue_position), 0)").Scan(&last)
+	return last + 1, result.Error
+}
+
+// GetQueuedPodcastItems get the episodes in a user's queue, in queue order.
+func GetQueuedPodcastItems(userID string, podcastItems *[]PodcastItem) error {
+	result := DB.Preload("Podcast").
+		Joins("JOIN episode_states ON episode_states.podcast_item_id = podcast_items.id").
+		Where("episode_states.user_id=? AND episode_states.queue_position>?", userID, 0).
+		Order("episode_states.queue_position asc").
+		Find(podcastItems)
+	return result.Error
+}
+
+// MergeEpisodeStates moves the listening state of a duplicate episode to the episode
+// kept in its place. Users with a state for both keep the furthest progress.
+func MergeEpisodeStates(fromItemID, toItemID string) error {
+	var states []EpisodeState
+	if err := DB.Where("podcast_item_id=?", fromItemID).Find(&states).Error; err != nil {
+		return err
+	}
+	for i := range states {
+		var kept EpisodeState
+		if err := GetEpisodeState(states[i].UserID, toItemID, &kept); err != nil {
+			return err
+		}
+		kept.IsPlayed = kept.IsPlayed || states[i].IsPlayed
+		if kept.BookmarkDate.IsZero() || (!states[i].BookmarkDate.IsZero() && states[i].BookmarkDate.Before(kept.BookmarkDate)) {
+			kept.BookmarkDate = states[i].BookmarkDate
+		}
+		kept.Position = max(kept.Position, states[i].Position)
+		if kept.QueuePosition == 0 {
+			kept.QueuePosition = states[i].QueuePosition
+		}
+		if err := SaveEpisodeState(&kept); err != nil {
+			return err
+		}
+	}
+	return DB.Where("podcast_item_id=?", fromItemID).Delete(&EpisodeState{}).Error
+}
+
+// AdoptLegacyEpisodeState copies the played and bookmark columns of the episodes, set
+// before user accounts existed, into a user's episode states.
+func AdoptLegacyEpisodeState(userID string) error {
+	var items []PodcastItem
+	if err := DB.Select("id", "is_played", "bookmark_date").Find(&items).Error; err != nil {
+		return err
+	}
+	for i := range items {
+		if !items[i].IsPlayed && items[i].BookmarkDate.IsZero() {
+			continue
+		}
+		state := EpisodeState{
+			UserID:        userID,
+			PodcastItemID: items[i].ID,
+			IsPlayed:      items[i].IsPlayed,
+			BookmarkDate:  items[i].BookmarkDate,
+		}
+		if err := DB.Create(&state).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AssignAPITokensToUser give tokens created before user accounts existed to a user.
+func AssignAPITokensToUser(userID string) error {
+	result := DB.Model(&APIToken{}).Where("user_id=? OR user_id IS NULL", "").Update("user_id", userID)
+	return result.Error
+}
+
+// GetEpisodeStatesUpdatedSince get a user's states whose playback position changed since a time.
+func GetEpisodeStatesUpdatedSince(userID string, since time.Time, states *[]EpisodeState) error {
+	result := DB.Where("user_id=? AND position_updated_at>=?", userID, since).Order("position_updated_at asc").Find(states)
+	return result.Error
+}
+
+// GetGPodderDevicesByUserID get the gpodder devices of a user.
+func GetGPodderDevicesByUserID(userID string, devices *[]GPodderDevice) error {
+	result := DB.Where("user_id=?", userID).Order("device_id asc").Find(devices)
+	return result.Error
+}
+
+// GetGPodderDevice get a gpodder device of a user, or a new one when it does not exist.
+func GetGPodderDevice(userID, deviceID string, device *GPodderDevice) error {
+	result := DB.Where(&GPodderDevice{UserID: userID, DeviceID: deviceID}).FirstOrInit(device)
+	return result.Error
+}
+
+// SaveGPodderDevice create or update a gpodder device.
+func SaveGPodderDevice(device *GPodderDevice) error {
+	tx := DB.Save(device)
+	return tx.Error
+}
+
+// CreateSubscriptionChange create subscription change.
+func CreateSubscriptionChange(change *SubscriptionChange) error {
+	tx := DB.Create(change)
+	return tx.Error
+}
+
+// GetSubscriptionChangesSince get the subscription changes since a time, oldest first.
+func GetSubscriptionChangesSince(since time.Time, changes *[]SubscriptionChange) error {
+	result := DB.Where("created_at>=?", since).Order("created_at asc").Find(changes)
+	return result.Error
+}
+
+// CreateEpisodeActions create episode actions.
+func CreateEpisodeActions(actions []EpisodeAction) error {
+	if len(actions) == 0 {
+		return nil
+	}
+	tx := DB.Create(&actions)
+	return tx.Error
+}
+
+// GetEpisodeActions get a user's episode actions uploaded since a time, oldest first,
+// optionally only those of a podcast or device.
+func GetEpisodeActions(userID string, since time.Time, podcastURL, device string, actions *[]EpisodeAction) error {
+	query := DB.Where("user_id=? AND created_at>=?", userID, since)
+	if podcastURL != "" {
+		query = query.Where("podcast_url=?", podcastURL)
+	}
+	if device != "" {
+		query = query.Where("device=?", device)
+	}
+	result := query.Order("created_at asc").Find(actions)
+	return result.Error
+}
+
+// CreateWebhook create webhook.
+func CreateWebhook(webhook *Webhook) error {
+	tx := DB.Create(webhook)
+	return tx.Error
+}
+
+// UpdateWebhook update webhook.
+func UpdateWebhook(webhook *Webhook) error {
+	tx := DB.Save(webhook)
+	return tx.Error
+}
+
+// GetAllWebhooks get all webhooks, oldest first.
+func GetAllWebhooks(webhooks *[]Webhook) error {
+	result := DB.Order("created_at asc").Find(webhooks)
+	return result.Error
+}
+
+// GetEnabledWebhooks get the webhooks that are enabled.
+func GetEnabledWebhooks(webhooks *[]Webhook) error {
+	result := DB.Where("enabled=?", true).Order("created_at asc").Find(webhooks)
+	return result.Error
+}
+
+// GetWebhookByID get webhook by id.
+func GetWebhookByID(id string, webhook *Webhook) error {
+	result := DB.First(webhook, "id=?", id)
+	return result.Error
+}
+
+// DeleteWebhookByID delete a webhook with its delivery log.
+func DeleteWebhookByID(id string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id=?", id).Delete(&Webhook{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("webhook_id=?", id).Delete(&WebhookDelivery{}).Error
+	})
+}
+
+// CreateWebhookDelivery create webhook delivery.
+func CreateWebhookDelivery(delivery *WebhookDelivery) error {
+	tx := DB.Create(delivery)
+	return tx.Error
+}
+
+// UpdateWebhookDelivery update webhook delivery.
+func UpdateWebhookDelivery(delivery *WebhookDelivery) error {
+	tx := DB.Save(delivery)
+	return tx.Error
+}
+
+// CloseUnfinishedWebhookDeliveries marks the deliveries without a result as failed.
+func CloseUnfinishedWebhookDeliveries(reason string, date time.Time) (int64, error) {
+	result := DB.Model(&WebhookDelivery{}).Where("completed_at IS NULL").
+		Updates(map[string]interface{}{"completed_at": date, "success": false, "error": reason})
+	return result.RowsAffected, result.Error
+}
+
+// GetWebhookDeliveries get the latest deliveries of a webhook, newest first.
+func GetWebhookDeliveries(webhookID string, limit int, deliveries *[]WebhookDelivery) error {
+	result := DB.Where("webhook_id=?", webhookID).Order("created_at desc").Limit(limit).Find(deliveries)
+	return result.Error
+}
+
+// PruneWebhookDeliveries deletes all but the newest keep deliveries of a webhook.
+func PruneWebhookDeliveries(webhookID string, keep int) error {
+	newest := DB.Model(&WebhookDelivery{}).Select("id").
+		Where("webhook_id=?", webhookID).Order("created_at desc").Limit(keep)
+	result := DB.Where("webhook_id=? AND id NOT IN (?)", webhookID, newest).Delete(&WebhookDelivery{})
+	return result.Error
+}
+
+// CreateNotifier create notifier.
+func CreateNotifier(notifier *Notifier) error {
+	tx := DB.Create(notifier)
+	return tx.Error
+}
+
+// UpdateNotifier update notifier.
+func UpdateNotifier(notifier *Notifier) error {
+	tx := DB.Save(notifier)
+	return tx.Error
+}
+
+// GetAllNotifiers get all notifiers, oldest first.
+func GetAllNotifiers(notifiers *[]Notifier) error {
+	result := DB.Order("created_at asc").Find(notifiers)
+	if result.Error != nil {
+		return result.Error
+	}
+	return loadNotifierPodcastIDs(*notifiers)
+}
+
+// GetEnabledNotifiers get the notifiers that are enabled.
+func GetEnabledNotifiers(notifiers *[]Notifier) error {
+	result := DB.Where("enabled=?", true).Order("created_at asc").Find(notifiers)
+	if result.Error != nil {
+		return result.Error
+	}
+	return loadNotifierPodcastIDs(*notifiers)
+}
+
+// GetNotifierByID get notifier by id.
+func GetNotifierByID(id string, notifier *Notifier) error {
+	result := DB.First(notifier, "id=?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	notifiers := []Notifier{*notifier}
+	if err := loadNotifierPodcastIDs(notifiers); err != nil {
+		return err
+	}
+	*notifier = notifiers[0]
+	return nil
+}
+
+// notifierPodcast is a row of the join table of notifiers and their opted in podcasts.
+type notifierPodcast struct {
+	NotifierID string
+	PodcastID  string
+}
+
+// loadNotifierPodcastIDs sets the PodcastIDs of notifiers.
+func loadNotifierPodcastIDs(notifiers []Notifier) error {
+	if len(notifiers) == 0 {
+		return nil
+	}
+	ids := make([]string, len(notifiers))
+	for i := range notifiers {
+		ids[i] = notifiers[i].ID
+		notifiers[i].PodcastIDs = []string{}
+	}
+	var rows []notifierPodcast
+	if err := DB.Table("notifier_podcasts").Where("notifier_id IN ?", ids).Order("podcast_id").Find(&rows).Error; err != nil {
+		return err
+	}
+	for _, row := range rows {
+		for i := range notifiers {
+			if notifiers[i].ID == row.NotifierID {
+				notifiers[i].PodcastIDs = append(notifiers[i].PodcastIDs, row.PodcastID)
+			}
+		}
+	}
+	return nil
+}
+
+// SetNotifierPodcasts replace the podcasts opted in to a notifier.
+func SetNotifierPodcasts(notifierID string, podcastIDs []string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM `notifier_podcasts` WHERE `notifier_id`=?", notifierID).Error; err != nil {
+			return err
+		}
+		for _, podcastID := range podcastIDs {
+			if err := tx.Exec("INSERT INTO `notifier_podcasts` (`notifier_id`,`podcast_id`) VALUES (?,?) ON CONFLICT DO NOTHING", notifierID, podcastID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteNotifierByID delete notifier by id.
+func DeleteNotifierByID(id string) error {
+	if err := DB.Exec("DELETE FROM `notifier_podcasts` WHERE `notifier_id`=?", id).Error; err != nil {
+		return err
+	}
+	result := DB.Where("id=?", id).Delete(&Notifier{})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
@@ -755,11 +755,12 @@ func TestGetPaginatedPodcastItemsNew(t *testing.T) {
 	podcast := CreateTestPodcast(t, database)
 
 	// Create various items
-	CreateTestPodcastItem(t, database, podcast.ID, &PodcastItem{
+	played := CreateTestPodcastItem(t, database, podcast.ID, &PodcastItem{
 		Title:          "Downloaded Episode",
 		DownloadStatus: Downloaded,
 		IsPlayed:       true,
 	})
+	require.NoError(t, SaveEpisodeState(&EpisodeState{UserID: "alice", PodcastItemID: played.ID, IsPlayed: true}))
 	CreateTestPodcastItem(t, database, podcast.ID, &PodcastItem{
 		Title:          "Unplayed Episode",
 		DownloadStatus: Downloaded,
@@ -805,6 +806,7 @@ func TestGetPaginatedPodcastItemsNew(t *testing.T) {
 					Count: 10,
 				},
 				IsPlayed: stringPtr("true"),
+				UserID:   "alice",
 			},
 			wantCount: 1,
 		},
@@ -816,13 +818,71 @@ func TestGetPaginatedPodcastItemsNew(t *testing.T) {
 					Count: 10,
 				},
 				IsPlayed: stringPtr("false"),
+				UserID:   "alice",
 			},
 			wantCount: 2,
 		},
+		{
+			name: "played_by_another_user",
+			filter: model.EpisodesFilter{
+				Pagination: model.Pagination{
+					Page:  1,
+					Count: 10,
+				},
+				IsPlayed: stringPtr("true"),
+				UserID:   "bob",
+			},
+			wantCount: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, total, err := GetPaginatedPodcastItemsNew(&tt.filter)
+
+			require.NoError(t, err, "Should get items")
+			assert.Len(t, *items, tt.wantCount, "Should return correct count")
+			assert.Equal(t, int64(tt.wantCount), total, "Should return correct total")
+		})
+	}
+}
+
+// TestGetPaginatedPodcastItemsNew_SeasonAndExplicit tests season and explicit filters.
+func TestGetPaginatedPodcastItemsNew_SeasonAndExplicit(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	cleanPodcast := CreateTestPodcast(t, database, &Podcast{URL: "https://example.com/clean.xml"})
+	explicitPodcast := CreateTestPodcast(t, database, &Podcast{URL: "https://example.com/explicit.xml"})
+	require.NoError(t, database.Model(explicitPodcast).Update("explicit", true).Error)
+
+	seasonOne := CreateTestPodcastItem(t, database, cleanPodcast.ID, &PodcastItem{Title: "S1"})
+	CreateTestPodcastItem(t, database, cleanPodcast.ID, &PodcastItem{Title: "S2"})
+	explicitItem := CreateTestPodcastItem(t, database, cleanPodcast.ID, &PodcastItem{Title: "Explicit Episode"})
+	CreateTestPodcastItem(t, database, explicitPodcast.ID, &PodcastItem{Title: "Explicit Show Episode"})
+
+	require.NoError(t, UpdatePodcastItemFeedMetadata(seasonOne.ID, 1, 4, false))
+	require.NoError(t, UpdatePodcastItemFeedMetadata(explicitItem.ID, 2, 1, true))
+
+	tests := []struct {
+		name      string
+		filter    model.EpisodesFilter
+		wantCount int
+	}{
+		{name: "season_one", filter: model.EpisodesFilter{Season: stringPtr("1")}, wantCount: 1},
+		{name: "season_two", filter: model.EpisodesFilter{Season: stringPtr("2")}, wantCount: 1},
+		{name: "season_nil", filter: model.EpisodesFilter{Season: stringPtr("nil")}, wantCount: 4},
+		{name: "hide_explicit", filter: model.EpisodesFilter{Explicit: stringPtr("false")}, wantCount: 2},
+		{name: "explicit_only", filter: model.EpisodesFilter{Explicit: stringPtr("true")}, wantCount: 2},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.Pagination = model.Pagination{Page: 1, Count: 10}
 			items, total, err := GetPaginatedPodcastItemsNew(&tt.filter)
 
 			require.NoError(t, err, "Should get items")
@@ -832,6 +892,58 @@ func TestGetPaginatedPodcastItemsNew(t *testing.T) {
 	}
 }
 
+// TestMarkPodcastItemsRemovedUpstream tests flagging and restoring items missing from the feed.
+func TestMarkPodcastItemsRemovedUpstream(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	podcast := CreateTestPodcast(t, database)
+	otherPodcast := CreateTestPodcast(t, database, &Podcast{URL: "https://example.com/other.xml"})
+	kept := CreateTestPodcastItem(t, database, podcast.ID, &PodcastItem{GUID: "kept"})
+	pulled := CreateTestPodcastItem(t, database, podcast.ID, &PodcastItem{GUID: "pulled"})
+	other := CreateTestPodcastItem(t, database, otherPodcast.ID, &PodcastItem{GUID: "other"})
+
+	removedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	count, err := MarkPodcastItemsRemovedUpstream(podcast.ID, []string{"kept"}, removedAt)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	load := func(id string) PodcastItem {
+		var retrieved PodcastItem
+		require.NoError(t, database.First(&retrieved, "id = ?", id).Error)
+		return retrieved
+	}
+	assert.True(t, load(pulled.ID).RemovedUpstream)
+	assert.True(t, removedAt.Equal(load(pulled.ID).RemovedUpstreamDate))
+	assert.False(t, load(kept.ID).RemovedUpstream)
+	assert.False(t, load(other.ID).RemovedUpstream, "Should not touch other podcasts")
+
+	count, err = MarkPodcastItemsRemovedUpstream(podcast.ID, []string{"kept"}, time.Now())
+	require.NoError(t, err)
+	assert.Zero(t, count, "Should keep the original removal date")
+
+	filter := model.EpisodesFilter{RemovedUpstream: stringPtr("true"), Pagination: model.Pagination{Page: 1, Count: 10}}
+	items, total, err := GetPaginatedPodcastItemsNew(&filter)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, pulled.ID, (*items)[0].ID)
+
+	filter = model.EpisodesFilter{RemovedUpstream: stringPtr("false"), Pagination: model.Pagination{Page: 1, Count: 10}}
+	_, total, err = GetPaginatedPodcastItemsNew(&filter)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+
+	count, err = RestorePodcastItemsUpstream(podcast.ID, []string{"kept", "pulled"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	assert.False(t, load(pulled.ID).RemovedUpstream)
+	assert.True(t, load(pulled.ID).RemovedUpstreamDate.IsZero())
+}
+
 // Helper function for string pointers
 func stringPtr(s string) *string {
 	return &s
@@ -860,6 +972,38 @@ func TestUpdatePodcastItemFileSize(t *testing.T) {
 	assert.Equal(t, int64(25000000), retrieved.FileSize, "Should update file size")
 }
 
+// TestPodcastMetadataChanges tests recording and listing podcast metadata changes.
+func TestPodcastMetadataChanges(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	podcast := CreateTestPodcast(t, database)
+	podcast.Title = "Renamed Podcast"
+	podcast.Image = "https://example.com/new.jpg"
+	require.NoError(t, UpdatePodcastMetadata(podcast))
+
+	var retrieved Podcast
+	database.First(&retrieved, "id = ?", podcast.ID)
+	assert.Equal(t, "Renamed Podcast", retrieved.Title)
+	assert.Equal(t, "https://example.com/new.jpg", retrieved.Image)
+
+	require.NoError(t, CreatePodcastMetadataChange(&PodcastMetadataChange{PodcastID: podcast.ID, Field: "Title", OldValue: "Old", NewValue: "Renamed Podcast"}))
+	require.NoError(t, CreatePodcastMetadataChange(&PodcastMetadataChange{PodcastID: "other", Field: "Title"}))
+
+	var changes []PodcastMetadataChange
+	require.NoError(t, GetPodcastMetadataChangesByPodcastID(podcast.ID, &changes))
+	require.Len(t, changes, 1)
+	assert.Equal(t, "Renamed Podcast", changes[0].NewValue)
+
+	require.NoError(t, DeletePodcastByID(podcast.ID))
+	require.NoError(t, GetPodcastMetadataChangesByPodcastID(podcast.ID, &changes))
+	assert.Empty(t, changes, "Should delete history with the podcast")
+}
+
 // TestGetAllPodcastItemsWithoutSize tests querying items without file size.
 func TestGetAllPodcastItemsWithoutSize(t *testing.T) {
 	database := SetupTestDB(t)
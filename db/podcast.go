@@ -2,7 +2,11 @@
 package db
 
 import (
+	"encoding/json"
+	"net/url"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // Podcast is
@@ -18,6 +22,18 @@ type Podcast struct {
 
 	URL string
 
+	Category string
+
+	Language string
+
+	Explicit bool `gorm:"default:false"`
+
+	OwnerName string
+
+	OwnerEmail string
+
+	Copyright string
+
 	LastEpisode *time.Time
 
 	PodcastItems []PodcastItem
@@ -33,6 +49,176 @@ type Podcast struct {
 	AllEpisodesSize         int64 `gorm:"-"`
 
 	IsPaused bool `gorm:"default:false"`
+
+	LastFetchAttempt *time.Time
+
+	LastFetchSuccess *time.Time
+
+	LastHTTPStatus int
+
+	LastFetchError string `gorm:"type:text"`
+
+	ConsecutiveFailures int `gorm:"default:0"`
+
+	LastNewEpisode *time.Time
+
+	MovedTo string
+
+	EnclosureChangePolicy EnclosureChangePolicy `gorm:"default:flag"`
+
+	DedupeMode DedupeMode `gorm:"default:guid"`
+
+	// EnclosurePreference overrides the global enclosure preference when set.
+	EnclosurePreference EnclosurePreference
+
+	// Credentials holds the encrypted FeedCredentials of a private feed. It is never
+	// serialized; HasCredentials tells clients whether there are any.
+	Credentials string `gorm:"type:text" json:"-"`
+
+	HasCredentials bool `gorm:"-"`
+
+	// Network overrides for this feed; empty or zero values use the global settings.
+	// ProxyURL "direct" bypasses the global proxy.
+	ProxyURL       string
+	UserAgent      string
+	ConnectTimeout int
+	ReadTimeout    int
+	IPPreference   IPPreference
+}
+
+// MarshalJSON serializes a podcast without the user and password of its proxy, which
+// every user can read.
+func (podcast Podcast) MarshalJSON() ([]byte, error) {
+	type plainPodcast Podcast
+	plain := plainPodcast(podcast)
+	if link, err := url.Parse(plain.ProxyURL); err == nil && link.User != nil {
+		link.User = nil
+		plain.ProxyURL = link.String()
+	}
+	return json.Marshal(plain)
+}
+
+// AfterFind flags podcasts with stored credentials.
+func (podcast *Podcast) AfterFind(*gorm.DB) error {
+	podcast.HasCredentials = podcast.Credentials != ""
+	return nil
+}
+
+// FeedCredentials are sent with every request for a private feed and its media.
+type FeedCredentials struct {
+	Username string            `json:"username,omitempty"`
+	Password string            `json:"password,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	// Cookies is a Cookie header value such as "session=abc; token=def".
+	Cookies string `json:"cookies,omitempty"`
+	// Hosts lists hosts besides the feed's own, such as the CDN serving the episodes,
+	// that get the credentials too. Entries are host names or host:port.
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+// IsEmpty reports whether no credential is set.
+func (credentials *FeedCredentials) IsEmpty() bool {
+	return credentials == nil ||
+		(credentials.Username == "" && credentials.Password == "" && len(credentials.Headers) == 0 && credentials.Cookies == "")
+}
+
+// IPPreference selects the address family tried first when connecting to a host.
+type IPPreference string
+
+const (
+	// IPPreferenceAuto lets the resolver order decide.
+	IPPreferenceAuto IPPreference = "auto"
+	// IPPreferenceIPv4 tries IPv4 addresses first.
+	IPPreferenceIPv4 IPPreference = "ipv4"
+	// IPPreferenceIPv6 tries IPv6 addresses first.
+	IPPreferenceIPv6 IPPreference = "ipv6"
+)
+
+// IsValid reports whether preference is a known IP preference.
+func (preference IPPreference) IsValid() bool {
+	switch preference {
+	case IPPreferenceAuto, IPPreferenceIPv4, IPPreferenceIPv6:
+		return true
+	}
+	return false
+}
+
+// EnclosurePreference decides which version of an episode's media is downloaded.
+type EnclosurePreference string
+
+// Enclosure preference constants.
+const (
+	// EnclosurePreferenceFeed downloads the feed's main enclosure.
+	EnclosurePreferenceFeed EnclosurePreference = "feed"
+	// EnclosurePreferenceSmallest downloads the smallest version.
+	EnclosurePreferenceSmallest EnclosurePreference = "smallest"
+	// EnclosurePreferenceHighestBitrate downloads the version with the highest bitrate.
+	EnclosurePreferenceHighestBitrate EnclosurePreference = "highest_bitrate"
+	// EnclosurePreferenceOpus downloads an Opus version when there is one.
+	EnclosurePreferenceOpus EnclosurePreference = "prefer_opus"
+	// EnclosurePreferenceAudioOnly downloads an audio version when the main enclosure is a video.
+	EnclosurePreferenceAudioOnly EnclosurePreference = "audio_only"
+)
+
+// IsValid returns true for the known enclosure preferences.
+func (preference EnclosurePreference) IsValid() bool {
+	switch preference {
+	case EnclosurePreferenceFeed, EnclosurePreferenceSmallest, EnclosurePreferenceHighestBitrate,
+		EnclosurePreferenceOpus, EnclosurePreferenceAudioOnly:
+		return true
+	default:
+		return false
+	}
+}
+
+// DedupeMode decides how a refresh recognizes episodes it already knows.
+type DedupeMode string
+
+// Dedupe mode constants.
+const (
+	// DedupeGUID matches episodes by GUID, falling back to the enclosure URL and
+	// the title and publish date for entries without a GUID.
+	DedupeGUID DedupeMode = "guid"
+	// DedupeEnclosure also matches episodes by enclosure URL when the GUID is unknown,
+	// for feeds that regenerate GUIDs.
+	DedupeEnclosure DedupeMode = "enclosure"
+	// DedupeTitleDate also matches episodes by title and publish date when the GUID is unknown.
+	DedupeTitleDate DedupeMode = "title_date"
+)
+
+// IsValid returns true for the known dedupe modes.
+func (mode DedupeMode) IsValid() bool {
+	switch mode {
+	case DedupeGUID, DedupeEnclosure, DedupeTitleDate:
+		return true
+	default:
+		return false
+	}
+}
+
+// EnclosureChangePolicy decides what a refresh does when the media file of a known episode changes.
+type EnclosureChangePolicy string
+
+// Enclosure change policy constants.
+const (
+	// EnclosureChangeIgnore only stores the new enclosure.
+	EnclosureChangeIgnore EnclosureChangePolicy = "ignore"
+	// EnclosureChangeFlag stores the new enclosure and flags the episode.
+	EnclosureChangeFlag EnclosureChangePolicy = "flag"
+	// EnclosureChangeReplace flags the episode and re-downloads it over the old file.
+	EnclosureChangeReplace EnclosureChangePolicy = "replace"
+	// EnclosureChangeKeepBoth flags the episode and re-downloads it next to the old file.
+	EnclosureChangeKeepBoth EnclosureChangePolicy = "keep_both"
+)
+
+// IsValid returns true for the known enclosure change policies.
+func (policy EnclosureChangePolicy) IsValid() bool {
+	switch policy {
+	case EnclosureChangeIgnore, EnclosureChangeFlag, EnclosureChangeReplace, EnclosureChangeKeepBoth:
+		return true
+	default:
+		return false
+	}
 }
 
 // PodcastItem is
@@ -54,7 +240,45 @@ type PodcastItem struct {
 	DownloadStatus DownloadStatus `gorm:"default:0"`
 	Duration       int
 	FileSize       int64
-	IsPlayed       bool `gorm:"default:false"`
+	Season         int
+	EpisodeNumber  int
+	Explicit       bool `gorm:"default:false"`
+	// IsPlayed and BookmarkDate are filled in from the EpisodeState of the user
+	// reading the episode. The columns keep the state from before user accounts.
+	IsPlayed bool `gorm:"default:false"`
+	// RemovedUpstream is set once the episode's GUID disappeared from the feed.
+	RemovedUpstream     bool `gorm:"default:false"`
+	RemovedUpstreamDate time.Time
+	// EnclosureLength is the media size announced by the feed.
+	EnclosureLength int64
+	// EnclosureType is the media MIME type announced by the feed.
+	EnclosureType string
+	// EnclosureChanged is set when the publisher replaced the media of the episode.
+	EnclosureChanged     bool `gorm:"default:false"`
+	EnclosureChangedDate time.Time
+	// PreviousDownloadPath keeps the old file when both versions are kept.
+	PreviousDownloadPath string
+	// Enclosures lists every version of the media when the feed offers more than one.
+	Enclosures []PodcastItemEnclosure
+	// PlaybackPosition is the reading user's position in seconds.
+	PlaybackPosition int `gorm:"-"`
+	// QueuePosition is the place of the episode in the reading user's queue, 0 when
+	// it is not queued.
+	QueuePosition int `gorm:"-"`
+}
+
+// PodcastItemEnclosure is one version of an episode's media.
+type PodcastItemEnclosure struct {
+	Base
+	PodcastItemID string `gorm:"index"`
+	URL           string
+	Type          string
+	Length        int64
+	// Bitrate is the announced bitrate in kbit/s.
+	Bitrate int
+	Codecs  string
+	// IsDefault marks the feed's main enclosure.
+	IsDefault bool `gorm:"default:false"`
 }
 
 // DownloadStatus represents the download state of a podcast episode.
@@ -88,6 +312,34 @@ type Setting struct {
 	AutoDownload                bool `gorm:"default:true"`
 	DownloadOnAdd               bool `gorm:"default:true"`
 	PassthroughPodcastGUID      bool `gorm:"default:false"`
+	AutoPauseAfterFailures      int  `gorm:"default:0"`
+	StaleFeedDays               int  `gorm:"default:90"`
+	KeepRemovedUpstream         bool `gorm:"default:true"`
+
+	// EnclosurePreference picks the media version to download when a feed offers several.
+	EnclosurePreference EnclosurePreference `gorm:"default:feed"`
+
+	// Network settings for every outbound request. Timeouts are in seconds.
+	ProxyURL       string
+	ConnectTimeout int          `gorm:"default:30"`
+	ReadTimeout    int          `gorm:"default:30"`
+	IPPreference   IPPreference `gorm:"default:auto"`
+
+	// BandwidthLimit caps the combined download rate in KiB/s, 0 meaning unlimited.
+	// HostBandwidthLimits and DownloadSchedule hold one rule per line.
+	BandwidthLimit      int    `gorm:"default:0"`
+	HostBandwidthLimits string `gorm:"type:text"`
+	DownloadSchedule    string `gorm:"type:text"`
+
+	// Egress policy: BlockPrivateNetworks refuses connections to internal addresses
+	// unless EgressAllowlist, one host, IP or CIDR per line, allows them.
+	BlockPrivateNetworks bool   `gorm:"default:false"`
+	EgressAllowlist      string `gorm:"type:text"`
+	MaxRedirects         int    `gorm:"default:10"`
+
+	// PlayedThreshold marks an episode played once playback passes this percentage,
+	// 0 turning it off.
+	PlayedThreshold int `gorm:"default:90"`
 }
 
 // Migration represents migration data.
@@ -113,6 +365,182 @@ type Tag struct {
 	Podcasts    []*Podcast `gorm:"many2many:podcast_tags;"`
 }
 
+// TokenScope limits what an API token may do.
+type TokenScope string
+
+const (
+	// TokenScopeFeeds allows only the RSS feeds and the episode files and images they link.
+	TokenScopeFeeds TokenScope = "feeds"
+	// TokenScopeRead allows every request that does not change anything.
+	TokenScopeRead TokenScope = "read"
+	// TokenScopeSync allows only the gpodder, Nextcloud and Subsonic APIs used by podcast apps.
+	TokenScopeSync TokenScope = "sync"
+	// TokenScopeAdmin allows everything.
+	TokenScopeAdmin TokenScope = "admin"
+)
+
+// IsValid reports whether scope is a known token scope.
+func (scope TokenScope) IsValid() bool {
+	switch scope {
+	case TokenScopeFeeds, TokenScopeRead, TokenScopeSync, TokenScopeAdmin:
+		return true
+	}
+	return false
+}
+
+// APIToken is a credential for scripts and podcast apps. Only the SHA-256 hash of the
+// token is stored; Prefix keeps its first characters so people can tell tokens apart.
+type APIToken struct {
+	Base
+	UserID     string `gorm:"index"`
+	Name       string
+	TokenHash  string `gorm:"uniqueIndex" json:"-"`
+	Prefix     string
+	Scope      TokenScope
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+}
+
+// User is an account. Subscriptions and downloads are shared, listening state is kept
+// per user in EpisodeState.
+type User struct {
+	Base
+	Username     string `gorm:"uniqueIndex"`
+	PasswordHash string `json:"-"`
+	IsAdmin      bool   `gorm:"default:false"`
+}
+
+// HasPassword reports whether the user can log in.
+func (user *User) HasPassword() bool {
+	return user.PasswordHash != ""
+}
+
+// UserSession is a login session. Like API tokens, only the hash of the cookie value
+// is stored.
+type UserSession struct {
+	Base
+	UserID    string `gorm:"index"`
+	TokenHash string `gorm:"uniqueIndex" json:"-"`
+	ExpiresAt time.Time
+}
+
+// EpisodeState is a user's listening state for an episode.
+type EpisodeState struct {
+	Base
+	UserID        string `gorm:"uniqueIndex:idx_episode_state_user_item"`
+	PodcastItemID string `gorm:"uniqueIndex:idx_episode_state_user_item;index"`
+	IsPlayed      bool   `gorm:"default:false"`
+	BookmarkDate  time.Time
+	// Position is the playback position in seconds, Duration the length the player
+	// reported and PositionUpdatedAt when the position was last saved.
+	Position          int
+	Duration          int
+	PositionUpdatedAt time.Time
+	// QueuePosition orders the user's queue, 0 when the episode is not queued.
+	QueuePosition int
+}
+
+// GPodderDevice is a device of a user syncing through the gpodder API.
+type GPodderDevice struct {
+	Base
+	UserID   string `gorm:"uniqueIndex:idx_gpodder_device_user_device"`
+	DeviceID string `gorm:"uniqueIndex:idx_gpodder_device_user_device"`
+	Caption  string
+	Type     string
+}
+
+// SubscriptionChange records a podcast added to or removed from the library, so sync
+// clients can fetch the changes since their last sync.
+type SubscriptionChange struct {
+	Base
+	URL     string `gorm:"index"`
+	Removed bool
+}
+
+// EpisodeAction is an episode action uploaded by a gpodder client. Started, Position
+// and Total are in seconds and only set for play actions.
+type EpisodeAction struct {
+	Base
+	UserID     string `gorm:"index"`
+	Device     string
+	PodcastURL string
+	EpisodeURL string
+	GUID       string
+	Action     string
+	Timestamp  time.Time
+	Started    int
+	Position   int
+	Total      int
+}
+
+// Webhook posts library events to a URL. Secret and Headers hold the encrypted HMAC
+// secret and the encrypted JSON of the custom headers; neither is serialized.
+type Webhook struct {
+	Base
+	Name string
+	URL  string
+	// Events is a comma separated list of the events sent, empty for every event.
+	Events  string
+	Secret  string `gorm:"type:text" json:"-"`
+	Headers string `gorm:"type:text" json:"-"`
+	Enabled bool
+	// HasSecret and HeaderNames tell clients what is set without revealing it.
+	HasSecret   bool     `gorm:"-"`
+	HeaderNames []string `gorm:"-"`
+}
+
+// AfterFind flags webhooks with a stored secret.
+func (webhook *Webhook) AfterFind(*gorm.DB) error {
+	webhook.HasSecret = webhook.Secret != ""
+	return nil
+}
+
+// Notifier sends push notifications or emails for library events. URL is the encrypted
+// notifier URL, which holds tokens and passwords, and is never serialized.
+type Notifier struct {
+	Base
+	Name string
+	URL  string `gorm:"type:text" json:"-"`
+	// Scheme is the notifier type from the URL, such as ntfy or mailto.
+	Scheme string
+	// Events is a comma separated list of the events sent, empty for every event.
+	Events string
+	// AllPodcasts sends notifications for every podcast rather than only those opted in.
+	AllPodcasts bool
+	// Podcasts are the podcasts opted in to the notifier, and PodcastIDs their IDs.
+	Podcasts   []*Podcast `gorm:"many2many:notifier_podcasts;" json:"-"`
+	PodcastIDs []string   `gorm:"-" json:"podcastIds"`
+	// TitleTemplate and BodyTemplate are text/template messages, empty for the default
+	// message of each event.
+	TitleTemplate string `gorm:"type:text"`
+	BodyTemplate  string `gorm:"type:text"`
+	Enabled       bool
+}
+
+// WebhookDelivery is the log entry of an event sent to a webhook. Attempts counts the
+// requests made so far, StatusCode and Error describe the last one.
+type WebhookDelivery struct {
+	Base
+	WebhookID  string `gorm:"index"`
+	Event      string
+	Payload    string `gorm:"type:text"`
+	Attempts   int
+	StatusCode int
+	Error      string
+	Success    bool
+	// CompletedAt is set once the delivery succeeded or ran out of retries.
+	CompletedAt *time.Time
+}
+
+// PodcastMetadataChange records a channel metadata value that changed during a feed refresh.
+type PodcastMetadataChange struct {
+	Base
+	PodcastID string `gorm:"index"`
+	Field     string
+	OldValue  string `gorm:"type:text"`
+	NewValue  string `gorm:"type:text"`
+}
+
 // IsLocked returns true if the job lock is currently active.
 func (lock *JobLock) IsLocked() bool {
 	return lock != nil && lock.Date != time.Time{}
@@ -34,6 +34,9 @@ func SetupTestDB(t *testing.T) *gorm.DB {
 		&Tag{},
 		&Migration{},
 		&JobLock{},
+		&PodcastMetadataChange{},
+		&PodcastItemEnclosure{},
+		&APIToken{}, &User{}, &UserSession{}, &EpisodeState{}, &GPodderDevice{}, &SubscriptionChange{}, &EpisodeAction{}, &Webhook{}, &WebhookDelivery{}, &Notifier{},
 	)
 	if err != nil {
 		t.Fatalf("Failed to run migrations: %v", err)
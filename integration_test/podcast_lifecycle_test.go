@@ -223,20 +223,23 @@ func TestPodcastLifecycle_PlayedStatus(t *testing.T) {
 	podcast := db.CreateTestPodcast(t, database)
 	episode := db.CreateTestPodcastItem(t, database, podcast.ID)
 
+	user, err := service.DefaultUser()
+	require.NoError(t, err)
+	items := []db.PodcastItem{*episode}
+
 	// Mark as played
-	err := service.SetPodcastItemPlayedStatus(episode.ID, true)
+	err = service.SetPodcastItemPlayedStatus(user.ID, episode.ID, true)
 	require.NoError(t, err, "Should mark as played")
 
-	var updated db.PodcastItem
-	database.First(&updated, "id = ?", episode.ID)
-	assert.True(t, updated.IsPlayed, "Should be marked as played")
+	require.NoError(t, service.ApplyEpisodeStates(user.ID, items))
+	assert.True(t, items[0].IsPlayed, "Should be marked as played")
 
 	// Mark as unplayed
-	err = service.SetPodcastItemPlayedStatus(episode.ID, false)
+	err = service.SetPodcastItemPlayedStatus(user.ID, episode.ID, false)
 	require.NoError(t, err, "Should mark as unplayed")
 
-	database.First(&updated, "id = ?", episode.ID)
-	assert.False(t, updated.IsPlayed, "Should be marked as unplayed")
+	require.NoError(t, service.ApplyEpisodeStates(user.ID, items))
+	assert.False(t, items[0].IsPlayed, "Should be marked as unplayed")
 }
 
 // TestPodcastLifecycle_BookmarkStatus tests episode bookmarking.
@@ -251,18 +254,21 @@ func TestPodcastLifecycle_BookmarkStatus(t *testing.T) {
 	podcast := db.CreateTestPodcast(t, database)
 	episode := db.CreateTestPodcastItem(t, database, podcast.ID)
 
+	user, err := service.DefaultUser()
+	require.NoError(t, err)
+	items := []db.PodcastItem{*episode}
+
 	// Bookmark episode
-	err := service.SetPodcastItemBookmarkStatus(episode.ID, true)
+	err = service.SetPodcastItemBookmarkStatus(user.ID, episode.ID, true)
 	require.NoError(t, err, "Should bookmark episode")
 
-	var updated db.PodcastItem
-	database.First(&updated, "id = ?", episode.ID)
-	assert.False(t, updated.BookmarkDate.IsZero(), "Should be bookmarked")
+	require.NoError(t, service.ApplyEpisodeStates(user.ID, items))
+	assert.False(t, items[0].BookmarkDate.IsZero(), "Should be bookmarked")
 
 	// Remove bookmark
-	err = service.SetPodcastItemBookmarkStatus(episode.ID, false)
+	err = service.SetPodcastItemBookmarkStatus(user.ID, episode.ID, false)
 	require.NoError(t, err, "Should remove bookmark")
 
-	database.First(&updated, "id = ?", episode.ID)
-	assert.True(t, updated.BookmarkDate.IsZero(), "Should not be bookmarked")
+	require.NoError(t, service.ApplyEpisodeStates(user.ID, items))
+	assert.True(t, items[0].BookmarkDate.IsZero(), "Should not be bookmarked")
 }
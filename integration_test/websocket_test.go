@@ -6,18 +6,19 @@ package integration_test
 import (
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/toozej/podgrab/controllers"
 	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/service"
 )
 
 // setupWebSocketServer creates a test WebSocket server.
@@ -35,10 +36,11 @@ func setupWebSocketServer(t *testing.T) *httptest.Server {
 	// Create test settings
 	db.CreateTestSetting(t, database)
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/ws", controllers.Wshandler)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/ws", controllers.Wshandler)
 
-	server := httptest.NewServer(mux)
+	server := httptest.NewServer(router)
 
 	// Start message handler in background
 	go controllers.HandleWebsocketMessages()
@@ -214,6 +216,46 @@ func TestWebSocket_EnqueueMessage(t *testing.T) {
 	}
 }
 
+// TestWebSocket_ProgressMessage tests saving playback progress over the websocket.
+func TestWebSocket_ProgressMessage(t *testing.T) {
+	server := setupWebSocketServer(t)
+	defer server.Close()
+
+	podcast := db.CreateTestPodcast(t, db.DB)
+	item := db.CreateTestPodcastItem(t, db.DB, podcast.ID, &db.PodcastItem{Duration: 1000})
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err, "Should connect to WebSocket")
+	defer conn.Close()
+
+	payloadJSON, err := json.Marshal(controllers.ProgressPayload{ItemID: item.ID, Position: 950})
+	require.NoError(t, err)
+	err = conn.WriteJSON(controllers.Message{
+		Identifier:  "test-player",
+		MessageType: "Progress",
+		Payload:     string(payloadJSON),
+	})
+	require.NoError(t, err, "Should send progress message")
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var response controllers.Message
+	for response.MessageType != "Progress" {
+		require.NoError(t, conn.ReadJSON(&response), "Should receive the stored progress")
+	}
+	var progress controllers.PlaybackProgress
+	require.NoError(t, json.Unmarshal([]byte(response.Payload), &progress))
+	assert.Equal(t, item.ID, progress.EpisodeID)
+	assert.Equal(t, 950, progress.Position)
+	assert.True(t, progress.IsPlayed, "Should be played past the default threshold")
+
+	user, err := service.DefaultUser()
+	require.NoError(t, err)
+	state, err := service.GetPlaybackProgress(user.ID, item.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 950, state.Position, "Should save the position for the connection's user")
+}
+
 // TestWebSocket_ConnectionPersistence tests connection stability.
 func TestWebSocket_ConnectionPersistence(t *testing.T) {
 	server := setupWebSocketServer(t)
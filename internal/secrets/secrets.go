@@ -0,0 +1,120 @@
+// Package secrets encrypts values stored at rest with a key kept outside the database.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// prefix marks encrypted values and the scheme used to produce them.
+const prefix = "enc:v1:"
+
+// keyFileName is the file in the config directory holding the generated key.
+const keyFileName = "secret.key"
+
+var (
+	keysMu sync.Mutex
+	keys   = make(map[string][]byte)
+)
+
+// Encrypt seals a value with AES-GCM. Empty values stay empty.
+func Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt.
+func Decrypt(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(value, prefix) {
+		return "", errors.New("value is not encrypted")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, prefix))
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("encrypted value is too short")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypting value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+func newGCM() (cipher.AEAD, error) {
+	key, err := loadKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// loadKey returns the key derived from ENCRYPTION_KEY, or else the key stored in the
+// config directory, generating it on first use.
+func loadKey() ([]byte, error) {
+	if secret := os.Getenv("ENCRYPTION_KEY"); secret != "" {
+		sum := sha256.Sum256([]byte(secret))
+		return sum[:], nil
+	}
+
+	keyPath := filepath.Join(os.Getenv("CONFIG"), keyFileName)
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	if key, ok := keys[keyPath]; ok {
+		return key, nil
+	}
+
+	encoded, err := os.ReadFile(keyPath) // #nosec G304 -- keyPath is built from the CONFIG env var
+	if os.IsNotExist(err) {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		encoded = []byte(hex.EncodeToString(key))
+		if err := os.WriteFile(keyPath, encoded, 0o600); err != nil {
+			return nil, fmt.Errorf("writing encryption key: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("reading encryption key: %w", err)
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("invalid encryption key file: " + keyPath)
+	}
+	keys[keyPath] = key
+	return key, nil
+}
@@ -35,6 +35,65 @@ const ValidRSSFeed = `<?xml version="1.0" encoding="UTF-8"?>
   </channel>
 </rss>`
 
+// ValidAtomFeed is a valid Atom 1.0 podcast feed with enclosure links.
+const ValidAtomFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xml:lang="en">
+  <id>urn:uuid:60a76c80-d399-11d9-b93c-0003939e0af6</id>
+  <title>Atom Test Podcast</title>
+  <subtitle>A podcast published as Atom</subtitle>
+  <updated>2024-01-22T10:00:00Z</updated>
+  <logo>https://example.com/atom-podcast.jpg</logo>
+  <author>
+    <name>Atom Author</name>
+    <email>atom@example.com</email>
+  </author>
+  <link rel="self" href="https://example.com/atom.xml"/>
+  <link href="https://example.com/atom"/>
+  <entry>
+    <id>atom-podcast-episode-1</id>
+    <title>Atom Episode 1</title>
+    <summary>The first Atom episode</summary>
+    <published>2024-01-15T10:00:00Z</published>
+    <updated>2024-01-15T10:00:00Z</updated>
+    <link rel="alternate" href="https://example.com/atom/1"/>
+    <link rel="enclosure" href="https://example.com/atom-episode1.mp3" length="25000000" type="audio/mpeg"/>
+  </entry>
+  <entry>
+    <id>atom-podcast-episode-2</id>
+    <title>Atom Episode 2</title>
+    <content type="html">&lt;p&gt;The second Atom episode&lt;/p&gt;</content>
+    <updated>2024-01-22T10:00:00Z</updated>
+    <link rel="enclosure" href="https://example.com/atom-episode2.mp3" length="30000000" type="audio/mpeg"/>
+  </entry>
+</feed>`
+
+// ValidJSONFeed is a valid JSON Feed 1.1 podcast feed with attachments.
+const ValidJSONFeed = `{
+  "version": "https://jsonfeed.org/version/1.1",
+  "title": "JSON Test Podcast",
+  "home_page_url": "https://example.com/json",
+  "feed_url": "https://example.com/feed.json",
+  "description": "A podcast published as JSON Feed",
+  "icon": "https://example.com/json-podcast.jpg",
+  "authors": [{"name": "JSON Author"}],
+  "items": [
+    {
+      "id": "json-podcast-episode-1",
+      "title": "JSON Episode 1",
+      "content_text": "The first JSON episode",
+      "date_published": "2024-01-15T10:00:00Z",
+      "attachments": [
+        {
+          "url": "https://example.com/json-episode1.mp3",
+          "mime_type": "audio/mpeg",
+          "size_in_bytes": 25000000,
+          "duration_in_seconds": 1800
+        }
+      ]
+    }
+  ]
+}`
+
 // InvalidXMLFeed is an invalid XML document for testing error handling.
 const InvalidXMLFeed = `<?xml version="1.0" encoding="UTF-8"?>
 <rss version="2.0">
@@ -73,6 +132,12 @@ const RSSFeedWithItunesExtensions = `<?xml version="1.0" encoding="UTF-8"?>
     </itunes:category>
     <itunes:explicit>no</itunes:explicit>
     <itunes:type>episodic</itunes:type>
+    <itunes:owner>
+      <itunes:name>Advanced Owner</itunes:name>
+      <itunes:email>owner@example.com</itunes:email>
+    </itunes:owner>
+    <language>en-us</language>
+    <copyright>2024 Advanced Test Author</copyright>
     <link>https://example.com/advanced</link>
     <item>
       <title>Episode 1: Advanced Features</title>
@@ -86,7 +151,7 @@ const RSSFeedWithItunesExtensions = `<?xml version="1.0" encoding="UTF-8"?>
       <itunes:season>1</itunes:season>
       <itunes:duration>00:45:00</itunes:duration>
       <itunes:image href="https://example.com/advanced-ep1.jpg"/>
-      <itunes:explicit>no</itunes:explicit>
+      <itunes:explicit>yes</itunes:explicit>
     </item>
   </channel>
 </rss>`
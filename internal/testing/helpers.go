@@ -37,6 +37,9 @@ func SetupTestDB(t *testing.T) *gorm.DB {
 		&db.Tag{},
 		&db.Migration{},
 		&db.JobLock{},
+		&db.PodcastMetadataChange{},
+		&db.PodcastItemEnclosure{},
+		&db.APIToken{}, &db.User{}, &db.UserSession{}, &db.EpisodeState{}, &db.GPodderDevice{}, &db.SubscriptionChange{}, &db.EpisodeAction{}, &db.Webhook{}, &db.WebhookDelivery{}, &db.Notifier{},
 	)
 	if err != nil {
 		t.Fatalf("Failed to run migrations: %v", err)
@@ -2,6 +2,7 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"fmt"
 	"html/template"
@@ -45,6 +46,13 @@ func run() int {
 		return 1
 	}
 	db.Migrate()
+	if _, err := service.EnsureDefaultUser(os.Getenv("PASSWORD")); err != nil {
+		logger.Log.Errorw("Failed to create the default user", "error", err)
+		return 1
+	}
+	if err := service.AbandonWebhookDeliveries(); err != nil {
+		logger.Log.Errorw("Failed to close unfinished webhook deliveries", "error", err)
+	}
 	r := gin.Default()
 
 	r.Use(setupSettings())
@@ -149,16 +157,6 @@ func run() int {
 
 	r.SetHTMLTemplate(tmpl)
 
-	pass := os.Getenv("PASSWORD")
-	var router *gin.RouterGroup
-	if pass != "" {
-		router = r.Group("/", gin.BasicAuth(gin.Accounts{
-			"podgrab": pass,
-		}))
-	} else {
-		router = &r.RouterGroup
-	}
-
 	dataPath := os.Getenv("DATA")
 	backupPath := path.Join(os.Getenv("CONFIG"), "backups")
 
@@ -168,17 +166,32 @@ func run() int {
 		return 1
 	}
 
-	router.StaticFS("/webassets", http.FS(webAssets))
+	// The login pages and the stylesheets they need are open to everyone.
+	r.StaticFS("/webassets", http.FS(webAssets))
+	r.GET("/login", controllers.LoginPage)
+	r.POST("/login", controllers.Login)
+	r.POST("/logout", controllers.Logout)
+	controllers.RegisterNextcloudLoginRoutes(r.Group("/index.php"))
+	// Subsonic clients authenticate with their own parameters.
+	controllers.RegisterSubsonicRoutes(r.Group("/rest"))
+
+	router := r.Group("/", controllers.Authenticate())
 	router.Static("/assets", dataPath)
 	router.Static(backupPath, backupPath)
 	router.POST("/podcasts", controllers.AddPodcast)
 	router.GET("/podcasts", controllers.GetAllPodcasts)
+	router.GET("/podcasts/health", controllers.GetFeedHealth)
 	router.GET("/podcasts/:id", controllers.GetPodcastByID)
 	router.GET("/podcasts/:id/image", controllers.GetPodcastImageByID)
 	router.DELETE("/podcasts/:id", controllers.DeletePodcastByID)
+	router.PATCH("/podcasts/:id", controllers.PatchPodcastByID)
+	router.PUT("/podcasts/:id/credentials", controllers.SetPodcastCredentialsByID)
+	router.DELETE("/podcasts/:id/credentials", controllers.DeletePodcastCredentialsByID)
 	router.GET("/podcasts/:id/items", controllers.GetPodcastItemsByPodcastID)
+	router.GET("/podcasts/:id/history", controllers.GetPodcastMetadataHistoryByID)
 	router.GET("/podcasts/:id/download", controllers.DownloadAllEpisodesByPodcastID)
 	router.GET("/podcasts/:id/refresh", controllers.RefreshEpisodesByPodcastID)
+	router.POST("/podcasts/:id/dedupe", controllers.MergeDuplicateEpisodesByPodcastID)
 	router.DELETE("/podcasts/:id/items", controllers.DeletePodcastEpisodesByID)
 	router.DELETE("/podcasts/:id/podcast", controllers.DeleteOnlyPodcastByID)
 	router.GET("/podcasts/:id/pause", controllers.PausePodcastByID)
@@ -205,6 +218,10 @@ func run() int {
 	router.POST("/podcasts/:id/tags/:tagID", controllers.AddTagToPodcast)
 	router.DELETE("/podcasts/:id/tags/:tagID", controllers.RemoveTagFromPodcast)
 
+	controllers.RegisterAPIRoutes(router.Group("/api/v1"))
+	controllers.RegisterGPodderRoutes(router.Group("/api/2"))
+	controllers.RegisterNextcloudRoutes(router.Group("/index.php"))
+
 	router.GET("/refreshAll", controllers.RefreshEpisodes)
 	router.GET("/add", controllers.AddPage)
 	router.GET("/search", controllers.Search)
@@ -215,6 +232,7 @@ func run() int {
 	router.GET("/settings", controllers.SettingsPage)
 	router.POST("/settings", controllers.UpdateSetting)
 	router.GET("/backups", controllers.BackupsPage)
+	router.GET("/feedHealth", controllers.FeedHealthPage)
 	router.POST("/opml", controllers.UploadOpml)
 	router.GET("/opml", controllers.GetOmpl)
 	router.GET("/player", controllers.PlayerPage)
@@ -228,13 +246,12 @@ func run() int {
 		c.Data(http.StatusOK, "application/json", data)
 	})
 
-	r.GET("/ws", func(c *gin.Context) {
-		controllers.Wshandler(c.Writer, c.Request)
-	})
+	router.GET("/ws", controllers.Wshandler)
 	go controllers.HandleWebsocketMessages()
 
 	go assetEnv()
 	go intiCron()
+	startDLNA()
 
 	if err := r.Run(); err != nil {
 		logger.Log.Errorw("Failed to start server", "error", err)
@@ -284,6 +301,41 @@ func intiCron() {
 	<-gocron.Start()
 }
 
+// startDLNA serves the DLNA media server on its own port and announces it on the LAN
+// when DLNA_ENABLED is set.
+func startDLNA() {
+	if enabled, _ := strconv.ParseBool(os.Getenv("DLNA_ENABLED")); !enabled {
+		return
+	}
+	port, err := strconv.Atoi(os.Getenv("DLNA_PORT"))
+	if err != nil || port <= 0 || port > 65535 {
+		port = 8200
+		if os.Getenv("DLNA_PORT") != "" {
+			logger.Log.Warnw("Invalid DLNA_PORT, using default", "error", err, "default", port)
+		}
+	}
+	name := os.Getenv("DLNA_NAME")
+	if name == "" {
+		name = "Podgrab"
+	}
+	server := service.NewDLNAServer(name, port)
+
+	engine := gin.New()
+	engine.Use(gin.Recovery())
+	controllers.RegisterDLNARoutes(engine.Group("/dlna"), server)
+	logger.Log.Infow("Starting the DLNA media server", "name", name, "port", port)
+	go func() {
+		if err := engine.Run(":" + strconv.Itoa(port)); err != nil {
+			logger.Log.Errorw("Failed to start the DLNA media server", "error", err)
+		}
+	}()
+	go func() {
+		if err := service.AdvertiseDLNA(context.Background(), server); err != nil {
+			logger.Log.Errorw("Failed to announce the DLNA media server", "error", err)
+		}
+	}()
+}
+
 func assetEnv() {
 	logger.Log.Infow("Configuration",
 		"config_dir", os.Getenv("CONFIG"),
@@ -0,0 +1,69 @@
+// Package model defines data structures for external API responses and RSS feeds.
+package model
+
+import "encoding/xml"
+
+// AtomFeed represents the root of an Atom 1.0 feed document.
+type AtomFeed struct {
+	XMLName  xml.Name     `xml:"feed"`
+	ID       string       `xml:"id"`
+	Title    string       `xml:"title"`
+	Subtitle string       `xml:"subtitle"`
+	Summary  string       `xml:"summary"`
+	Updated  string       `xml:"updated"`
+	Icon     string       `xml:"icon"`
+	Logo     string       `xml:"logo"`
+	Rights   string       `xml:"rights"`
+	Lang     string       `xml:"lang,attr"`
+	Explicit string       `xml:"explicit"`
+	Author   []AtomPerson `xml:"author"`
+	Link     []AtomLink   `xml:"link"`
+	Category []struct {
+		Term  string `xml:"term,attr"`
+		Label string `xml:"label,attr"`
+		Text  string `xml:"text,attr"`
+	} `xml:"category"`
+	Image struct {
+		Href string `xml:"href,attr"`
+	} `xml:"image"`
+	Entry []AtomEntry `xml:"entry"`
+}
+
+// AtomEntry represents a single Atom entry.
+type AtomEntry struct {
+	ID          string       `xml:"id"`
+	Title       string       `xml:"title"`
+	Summary     string       `xml:"summary"`
+	Content     string       `xml:"content"`
+	Published   string       `xml:"published"`
+	Updated     string       `xml:"updated"`
+	Duration    string       `xml:"duration"`
+	EpisodeType string       `xml:"episodeType"`
+	Episode     string       `xml:"episode"`
+	Season      string       `xml:"season"`
+	Explicit    string       `xml:"explicit"`
+	Author      []AtomPerson `xml:"author"`
+	Link        []AtomLink   `xml:"link"`
+	Image       struct {
+		Href string `xml:"href,attr"`
+	} `xml:"image"`
+	Thumbnail struct {
+		URL string `xml:"url,attr"`
+	} `xml:"thumbnail"`
+}
+
+// AtomLink represents an Atom link element.
+type AtomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+	Title  string `xml:"title,attr"`
+}
+
+// AtomPerson represents an Atom author or contributor.
+type AtomPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email"`
+	URI   string `xml:"uri"`
+}
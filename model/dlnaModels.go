@@ -0,0 +1,94 @@
+// Package model defines data structures for external API responses and RSS feeds.
+package model
+
+import "encoding/xml"
+
+// UPnPDescription represents the device description UPnP control points fetch after
+// discovering the media server.
+type UPnPDescription struct {
+	XMLName     xml.Name        `xml:"urn:schemas-upnp-org:device-1-0 root"`
+	XmlnsDLNA   string          `xml:"xmlns:dlna,attr"`
+	SpecVersion UPnPSpecVersion `xml:"specVersion"`
+	Device      UPnPDevice      `xml:"device"`
+}
+
+// UPnPSpecVersion represents the UPnP version a device implements.
+type UPnPSpecVersion struct {
+	Major int `xml:"major"`
+	Minor int `xml:"minor"`
+}
+
+// UPnPDevice represents a UPnP device and the services it offers.
+type UPnPDevice struct {
+	DeviceType       string        `xml:"deviceType"`
+	FriendlyName     string        `xml:"friendlyName"`
+	Manufacturer     string        `xml:"manufacturer"`
+	ManufacturerURL  string        `xml:"manufacturerURL"`
+	ModelDescription string        `xml:"modelDescription"`
+	ModelName        string        `xml:"modelName"`
+	ModelNumber      string        `xml:"modelNumber"`
+	ModelURL         string        `xml:"modelURL"`
+	UDN              string        `xml:"UDN"`
+	DLNADoc          string        `xml:"dlna:X_DLNADOC"`
+	Services         []UPnPService `xml:"serviceList>service"`
+}
+
+// UPnPService represents a service of a UPnP device and the URLs it answers at.
+type UPnPService struct {
+	ServiceType string `xml:"serviceType"`
+	ServiceID   string `xml:"serviceId"`
+	SCPDURL     string `xml:"SCPDURL"`
+	ControlURL  string `xml:"controlURL"`
+	EventSubURL string `xml:"eventSubURL"`
+}
+
+// DIDLLite represents the containers and items a ContentDirectory Browse returns.
+type DIDLLite struct {
+	XMLName    xml.Name        `xml:"DIDL-Lite"`
+	Xmlns      string          `xml:"xmlns,attr"`
+	XmlnsDC    string          `xml:"xmlns:dc,attr"`
+	XmlnsUPnP  string          `xml:"xmlns:upnp,attr"`
+	XmlnsDLNA  string          `xml:"xmlns:dlna,attr"`
+	Containers []DIDLContainer `xml:"container"`
+	Items      []DIDLItem      `xml:"item"`
+}
+
+// DIDLContainer represents a folder of a ContentDirectory.
+type DIDLContainer struct {
+	ID          string `xml:"id,attr"`
+	ParentID    string `xml:"parentID,attr"`
+	Restricted  int    `xml:"restricted,attr"`
+	Searchable  int    `xml:"searchable,attr"`
+	ChildCount  int    `xml:"childCount,attr"`
+	Title       string `xml:"dc:title"`
+	Description string `xml:"dc:description,omitempty"`
+	Creator     string `xml:"dc:creator,omitempty"`
+	Class       string `xml:"upnp:class"`
+	AlbumArtURI string `xml:"upnp:albumArtURI,omitempty"`
+}
+
+// DIDLItem represents a playable file of a ContentDirectory.
+type DIDLItem struct {
+	ID          string         `xml:"id,attr"`
+	ParentID    string         `xml:"parentID,attr"`
+	Restricted  int            `xml:"restricted,attr"`
+	Title       string         `xml:"dc:title"`
+	Creator     string         `xml:"dc:creator,omitempty"`
+	Date        string         `xml:"dc:date,omitempty"`
+	Description string         `xml:"dc:description,omitempty"`
+	Class       string         `xml:"upnp:class"`
+	Album       string         `xml:"upnp:album,omitempty"`
+	Artist      string         `xml:"upnp:artist,omitempty"`
+	Track       int            `xml:"upnp:originalTrackNumber,omitempty"`
+	AlbumArtURI string         `xml:"upnp:albumArtURI,omitempty"`
+	Resources   []DIDLResource `xml:"res"`
+}
+
+// DIDLResource represents a URL an item can be fetched from. Size is in bytes and
+// Duration is formatted H:MM:SS.
+type DIDLResource struct {
+	ProtocolInfo string `xml:"protocolInfo,attr"`
+	Size         int64  `xml:"size,attr,omitempty"`
+	Duration     string `xml:"duration,attr,omitempty"`
+	URL          string `xml:",chardata"`
+}
@@ -20,3 +20,13 @@ type TagAlreadyExistsError struct {
 func (e *TagAlreadyExistsError) Error() string {
 	return fmt.Sprintf("Tag with this label already exists : %s", e.Label)
 }
+
+// HTTPStatusError represents a response with a non successful HTTP status code.
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("HTTP error: %d %s", e.StatusCode, e.Status)
+}
@@ -0,0 +1,70 @@
+// Package model defines data structures for external API responses and RSS feeds.
+package model
+
+import "time"
+
+// FeedFormat identifies the syndication format a feed document was written in.
+type FeedFormat string
+
+const (
+	// FeedFormatRSS is an RSS 2.0 document.
+	FeedFormatRSS FeedFormat = "rss"
+	// FeedFormatAtom is an Atom 1.0 document.
+	FeedFormatAtom FeedFormat = "atom"
+	// FeedFormatJSON is a JSON Feed 1.0/1.1 document.
+	FeedFormatJSON FeedFormat = "json"
+)
+
+// Feed is the format independent representation of a podcast feed.
+// RSS, Atom and JSON Feed documents are all converted into this model
+// before podcasts and episodes are created from them.
+type Feed struct {
+	Format     FeedFormat
+	Title      string
+	Summary    string
+	Author     string
+	Image      string
+	Link       string
+	Language   string
+	Category   string
+	Explicit   string
+	OwnerName  string
+	OwnerEmail string
+	Copyright  string
+	// NewFeedURL is the location the publisher announced via itunes:new-feed-url.
+	NewFeedURL string
+	// RedirectURL is the final location when the feed answered with permanent redirects.
+	RedirectURL string
+	// StatusCode is the HTTP status code the feed was served with.
+	StatusCode int
+	Items      []FeedItem
+}
+
+// FeedItem is a single episode parsed from a feed.
+type FeedItem struct {
+	PubDate     time.Time
+	GUID        string
+	Title       string
+	Summary     string
+	Author      string
+	Image       string
+	Link        string
+	Duration    string
+	EpisodeType string
+	Episode     string
+	Season      string
+	Explicit    string
+	Enclosure   FeedEnclosure
+	// Alternates lists other versions of the media, such as other bitrates or codecs.
+	Alternates []FeedEnclosure
+}
+
+// FeedEnclosure is the media file attached to a feed item.
+type FeedEnclosure struct {
+	URL    string
+	Length string
+	Type   string
+	// Bitrate is the announced bitrate in kbit/s.
+	Bitrate string
+	Codecs  string
+}
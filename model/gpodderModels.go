@@ -22,3 +22,52 @@ type GPodcastTag struct {
 	Title string `json:"title"`
 	Usage int    `json:"usage"`
 }
+
+// GPodderDevice represents a device in the gpodder sync API.
+type GPodderDevice struct {
+	ID            string `json:"id"`
+	Caption       string `json:"caption"`
+	Type          string `json:"type"`
+	Subscriptions int    `json:"subscriptions"`
+}
+
+// GPodderDeviceUpdate represents the device fields a gpodder client changes.
+type GPodderDeviceUpdate struct {
+	Caption *string `json:"caption"`
+	Type    *string `json:"type"`
+}
+
+// GPodderSubscriptionChanges represents subscriptions added and removed since a
+// timestamp, or the changes a client uploads.
+type GPodderSubscriptionChanges struct {
+	Add       []string `json:"add"`
+	Remove    []string `json:"remove"`
+	Timestamp int64    `json:"timestamp,omitempty"`
+}
+
+// GPodderUpdateResult represents the response to uploaded changes. UpdateURLs pairs
+// each URL that was rewritten with the URL to use instead, empty when it was rejected.
+type GPodderUpdateResult struct {
+	Timestamp  int64       `json:"timestamp"`
+	UpdateURLs [][2]string `json:"update_urls"`
+}
+
+// GPodderEpisodeAction represents an episode action of the gpodder sync API. Started,
+// Position and Total are in seconds and belong to play actions.
+type GPodderEpisodeAction struct {
+	Podcast   string `json:"podcast"`
+	Episode   string `json:"episode"`
+	GUID      string `json:"guid,omitempty"`
+	Device    string `json:"device,omitempty"`
+	Action    string `json:"action"`
+	Timestamp string `json:"timestamp,omitempty"`
+	Started   *int   `json:"started,omitempty"`
+	Position  *int   `json:"position,omitempty"`
+	Total     *int   `json:"total,omitempty"`
+}
+
+// GPodderEpisodeActions represents episode actions since a timestamp.
+type GPodderEpisodeActions struct {
+	Actions   []GPodderEpisodeAction `json:"actions"`
+	Timestamp int64                  `json:"timestamp"`
+}
@@ -0,0 +1,28 @@
+// Package model defines data structures for external API responses and RSS feeds.
+package model
+
+// NextcloudLoginFlow represents the start of a Nextcloud login flow: the app polls the
+// endpoint with the token while the user opens the login URL in a browser.
+type NextcloudLoginFlow struct {
+	Poll  NextcloudLoginPoll `json:"poll"`
+	Login string             `json:"login"`
+}
+
+// NextcloudLoginPoll represents where an app polls for the result of a login flow.
+type NextcloudLoginPoll struct {
+	Token    string `json:"token"`
+	Endpoint string `json:"endpoint"`
+}
+
+// NextcloudLoginCredentials represents the result of a granted login flow.
+type NextcloudLoginCredentials struct {
+	Server      string `json:"server"`
+	LoginName   string `json:"loginName"`
+	AppPassword string `json:"appPassword"`
+}
+
+// NextcloudTimestamp represents the response to changes uploaded to the Nextcloud
+// gpodder sync API.
+type NextcloudTimestamp struct {
+	Timestamp int64 `json:"timestamp"`
+}
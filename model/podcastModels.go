@@ -34,10 +34,11 @@ type PodcastData struct {
 			Name  string `xml:"name"`
 			Email string `xml:"email"`
 		} `xml:"owner"`
-		Author    string `xml:"author"`
-		Copyright string `xml:"copyright"`
-		Explicit  string `xml:"explicit"`
-		Category  struct {
+		Author     string `xml:"author"`
+		Copyright  string `xml:"copyright"`
+		Explicit   string `xml:"explicit"`
+		NewFeedURL string `xml:"new-feed-url"`
+		Category   struct {
 			Text     string `xml:",chardata"`
 			AttrText string `xml:"text,attr"`
 			Category struct {
@@ -73,6 +74,8 @@ type PodcastData struct {
 			Author      string `xml:"author"`
 			Encoded     string `xml:"encoded"`
 			Episode     string `xml:"episode"`
+			Season      string `xml:"season"`
+			Explicit    string `xml:"explicit"`
 			Description string `xml:"description"`
 			Summary     string `xml:"summary"`
 			PubDate     string `xml:"pubDate"`
@@ -80,19 +83,43 @@ type PodcastData struct {
 			Title       string `xml:"title"`
 			Link        string `xml:"link"`
 			StitcherID  string `xml:"stitcherId"`
-			Content     []struct {
-				Text   string `xml:",chardata"`
-				URL    string `xml:"url,attr"`
-				Type   string `xml:"type,attr"`
-				Player struct {
-					Text string `xml:",chardata"`
-					URL  string `xml:"url,attr"`
-				} `xml:"player"`
-			} `xml:"content"`
+
+			Content []MediaContent `xml:"content"`
+			Group   struct {
+				Content []MediaContent `xml:"content"`
+			} `xml:"group"`
+			AlternateEnclosure []AlternateEnclosure `xml:"alternateEnclosure"`
 		} `xml:"item"`
 	} `xml:"channel"`
 }
 
+// MediaContent represents a media:content element of an item or media:group.
+type MediaContent struct {
+	Text     string `xml:",chardata"`
+	URL      string `xml:"url,attr"`
+	Type     string `xml:"type,attr"`
+	Medium   string `xml:"medium,attr"`
+	FileSize string `xml:"fileSize,attr"`
+	Bitrate  string `xml:"bitrate,attr"`
+	Player   struct {
+		Text string `xml:",chardata"`
+		URL  string `xml:"url,attr"`
+	} `xml:"player"`
+}
+
+// AlternateEnclosure represents a podcast:alternateEnclosure element.
+type AlternateEnclosure struct {
+	Type    string `xml:"type,attr"`
+	Length  string `xml:"length,attr"`
+	Bitrate string `xml:"bitrate,attr"`
+	Codecs  string `xml:"codecs,attr"`
+	Title   string `xml:"title,attr"`
+	Source  []struct {
+		URI         string `xml:"uri,attr"`
+		ContentType string `xml:"contentType,attr"`
+	} `xml:"source"`
+}
+
 // CommonSearchResultModel represents common search result model data.
 type CommonSearchResultModel struct {
 	URL          string   `json:"url"`
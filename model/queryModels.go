@@ -3,14 +3,46 @@ package model
 
 import "math"
 
-// Pagination represents pagination data.
+// Pagination represents pagination data. Only the page and count are read from
+// requests; the other fields are set from the results.
 type Pagination struct {
 	Page         int `uri:"page" query:"page" json:"page" form:"page" default:"1"`
 	Count        int `uri:"count" query:"count" json:"count" form:"count" default:"20"`
-	NextPage     int `uri:"nextPage" query:"nextPage" json:"nextPage" form:"nextPage"`
-	PreviousPage int `uri:"previousPage" query:"previousPage" json:"previousPage" form:"previousPage"`
-	TotalCount   int `uri:"totalCount" query:"totalCount" json:"totalCount" form:"totalCount"`
-	TotalPages   int `uri:"totalPages" query:"totalPages" json:"totalPages" form:"totalPages"`
+	NextPage     int `uri:"nextPage" query:"nextPage" json:"nextPage" form:"-"`
+	PreviousPage int `uri:"previousPage" query:"previousPage" json:"previousPage" form:"-"`
+	TotalCount   int `uri:"totalCount" query:"totalCount" json:"totalCount" form:"-"`
+	TotalPages   int `uri:"totalPages" query:"totalPages" json:"totalPages" form:"-"`
+}
+
+// SetDefaults sets the page and count left out of a request.
+func (pagination *Pagination) SetDefaults() {
+	if pagination.Count == 0 {
+		pagination.Count = 20
+	}
+	if pagination.Page == 0 {
+		pagination.Page = 1
+	}
+}
+
+// Offset returns the index of the first record on the page.
+func (pagination *Pagination) Offset() int {
+	return (pagination.Page - 1) * pagination.Count
+}
+
+// SetCounts calculates and sets pagination metadata based on total count.
+func (pagination *Pagination) SetCounts(totalCount int64) {
+	totalPages := int(math.Ceil(float64(totalCount) / float64(pagination.Count)))
+	nextPage, previousPage := 0, 0
+	if pagination.Page < totalPages {
+		nextPage = pagination.Page + 1
+	}
+	if pagination.Page > 1 {
+		previousPage = pagination.Page - 1
+	}
+	pagination.NextPage = nextPage
+	pagination.PreviousPage = previousPage
+	pagination.TotalCount = int(totalCount)
+	pagination.TotalPages = totalPages
 }
 
 // EpisodeSort represents episode sorting options.
@@ -27,43 +59,27 @@ const (
 	DurationDesc EpisodeSort = "duration_desc"
 )
 
-// EpisodesFilter represents episodes filter data.
+// EpisodesFilter represents episodes filter data. UserID is set by the server to the
+// user whose listening state IsPlayed refers to.
 type EpisodesFilter struct {
-	DownloadStatus *string     `uri:"downloadStatus" query:"downloadStatus" json:"downloadStatus" form:"downloadStatus"`
-	EpisodeType    *string     `uri:"episodeType" query:"episodeType" json:"episodeType" form:"episodeType"`
-	IsPlayed       *string     `uri:"isPlayed" query:"isPlayed" json:"isPlayed" form:"isPlayed"`
-	Sorting        EpisodeSort `uri:"sorting" query:"sorting" json:"sorting" form:"sorting"`
-	Q              string      `uri:"q" query:"q" json:"q" form:"q"`
-	TagIDs         []string    `uri:"tagIDs" query:"tagIds[]" json:"tagIDs" form:"tagIds[]"`
-	PodcastIDs     []string    `uri:"podcastIDs" query:"podcastIDs[]" json:"podcastIDs" form:"podcastIDs[]"`
+	DownloadStatus  *string     `uri:"downloadStatus" query:"downloadStatus" json:"downloadStatus" form:"downloadStatus"`
+	EpisodeType     *string     `uri:"episodeType" query:"episodeType" json:"episodeType" form:"episodeType"`
+	IsPlayed        *string     `uri:"isPlayed" query:"isPlayed" json:"isPlayed" form:"isPlayed"`
+	Explicit        *string     `uri:"explicit" query:"explicit" json:"explicit" form:"explicit"`
+	Season          *string     `uri:"season" query:"season" json:"season" form:"season"`
+	RemovedUpstream *string     `uri:"removedUpstream" query:"removedUpstream" json:"removedUpstream" form:"removedUpstream"`
+	Sorting         EpisodeSort `uri:"sorting" query:"sorting" json:"sorting" form:"sorting"`
+	Q               string      `uri:"q" query:"q" json:"q" form:"q"`
+	TagIDs          []string    `uri:"tagIDs" query:"tagIds[]" json:"tagIDs" form:"tagIds[]"`
+	PodcastIDs      []string    `uri:"podcastIDs" query:"podcastIDs[]" json:"podcastIDs" form:"podcastIDs[]"`
+	UserID          string      `json:"-" form:"-"`
 	Pagination
 }
 
 // VerifyPaginationValues sets default values for pagination parameters.
 func (filter *EpisodesFilter) VerifyPaginationValues() {
-	if filter.Count == 0 {
-		filter.Count = 20
-	}
-	if filter.Page == 0 {
-		filter.Page = 1
-	}
+	filter.SetDefaults()
 	if filter.Sorting == "" {
 		filter.Sorting = ReleaseDesc
 	}
 }
-
-// SetCounts calculates and sets pagination metadata based on total count.
-func (filter *EpisodesFilter) SetCounts(totalCount int64) {
-	totalPages := int(math.Ceil(float64(totalCount) / float64(filter.Count)))
-	nextPage, previousPage := 0, 0
-	if filter.Page < totalPages {
-		nextPage = filter.Page + 1
-	}
-	if filter.Page > 1 {
-		previousPage = filter.Page - 1
-	}
-	filter.NextPage = nextPage
-	filter.PreviousPage = previousPage
-	filter.TotalCount = int(totalCount)
-	filter.TotalPages = totalPages
-}
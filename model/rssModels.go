@@ -30,9 +30,24 @@ type RssChannel struct {
 	Type        string       `xml:"type"`
 	Summary     string       `xml:"summary"`
 	Author      string       `xml:"author"`
+	Copyright   string       `xml:"copyright,omitempty"`
+	Explicit    string       `xml:"explicit,omitempty"`
+	Category    *RssCategory `xml:"category,omitempty"`
+	Owner       *RssOwner    `xml:"owner,omitempty"`
 	Item        []RssItem    `xml:"item"`
 }
 
+// RssCategory represents rss category data.
+type RssCategory struct {
+	Text string `xml:"text,attr"`
+}
+
+// RssOwner represents rss owner data.
+type RssOwner struct {
+	Name  string `xml:"name,omitempty"`
+	Email string `xml:"email,omitempty"`
+}
+
 // RssItem represents rss item data.
 type RssItem struct {
 	Text        string           `xml:",chardata"`
@@ -49,7 +64,9 @@ type RssItem struct {
 	Duration    string           `xml:"duration"`
 	Enclosure   RssItemEnclosure `xml:"enclosure"`
 	Link        string           `xml:"link"`
-	Episode     string           `xml:"episode"`
+	Episode     string           `xml:"episode,omitempty"`
+	Season      string           `xml:"season,omitempty"`
+	Explicit    string           `xml:"explicit,omitempty"`
 }
 
 // RssItemEnclosure represents rss item enclosure data.
@@ -0,0 +1,79 @@
+// Package model defines data structures for external API responses and RSS feeds.
+package model
+
+import "encoding/xml"
+
+// SubsonicResponse represents the envelope of every Subsonic API response. Only the
+// element of the requested call is set.
+type SubsonicResponse struct {
+	XMLName                xml.Name                `xml:"subsonic-response" json:"-"`
+	Xmlns                  string                  `xml:"xmlns,attr" json:"-"`
+	Status                 string                  `xml:"status,attr" json:"status"`
+	Version                string                  `xml:"version,attr" json:"version"`
+	Type                   string                  `xml:"type,attr" json:"type"`
+	ServerVersion          string                  `xml:"serverVersion,attr" json:"serverVersion"`
+	OpenSubsonic           bool                    `xml:"openSubsonic,attr" json:"openSubsonic"`
+	Error                  *SubsonicError          `xml:"error,omitempty" json:"error,omitempty"`
+	Podcasts               *SubsonicPodcasts       `xml:"podcasts,omitempty" json:"podcasts,omitempty"`
+	NewestPodcasts         *SubsonicNewestPodcasts `xml:"newestPodcasts,omitempty" json:"newestPodcasts,omitempty"`
+	OpenSubsonicExtensions []SubsonicExtension     `xml:"openSubsonicExtensions,omitempty" json:"openSubsonicExtensions,omitempty"`
+}
+
+// SubsonicError represents a failed Subsonic API call.
+type SubsonicError struct {
+	Code    int    `xml:"code,attr" json:"code"`
+	Message string `xml:"message,attr" json:"message"`
+}
+
+// SubsonicPodcasts represents the podcasts of getPodcasts.
+type SubsonicPodcasts struct {
+	Channels []SubsonicChannel `xml:"channel" json:"channel"`
+}
+
+// SubsonicNewestPodcasts represents the episodes of getNewestPodcasts.
+type SubsonicNewestPodcasts struct {
+	Episodes []SubsonicEpisode `xml:"episode" json:"episode"`
+}
+
+// SubsonicChannel represents a podcast in the Subsonic API.
+type SubsonicChannel struct {
+	ID               string            `xml:"id,attr" json:"id"`
+	URL              string            `xml:"url,attr" json:"url"`
+	Title            string            `xml:"title,attr" json:"title"`
+	Description      string            `xml:"description,attr" json:"description"`
+	CoverArt         string            `xml:"coverArt,attr" json:"coverArt"`
+	OriginalImageURL string            `xml:"originalImageUrl,attr" json:"originalImageUrl"`
+	Status           string            `xml:"status,attr" json:"status"`
+	ErrorMessage     string            `xml:"errorMessage,attr,omitempty" json:"errorMessage,omitempty"`
+	Episodes         []SubsonicEpisode `xml:"episode" json:"episode,omitempty"`
+}
+
+// SubsonicEpisode represents a podcast episode in the Subsonic API. Size is in bytes
+// and Duration in seconds.
+type SubsonicEpisode struct {
+	ID          string `xml:"id,attr" json:"id"`
+	StreamID    string `xml:"streamId,attr" json:"streamId"`
+	ChannelID   string `xml:"channelId,attr" json:"channelId"`
+	Parent      string `xml:"parent,attr" json:"parent"`
+	IsDir       bool   `xml:"isDir,attr" json:"isDir"`
+	Title       string `xml:"title,attr" json:"title"`
+	Album       string `xml:"album,attr" json:"album"`
+	Artist      string `xml:"artist,attr" json:"artist"`
+	Year        int    `xml:"year,attr,omitempty" json:"year,omitempty"`
+	CoverArt    string `xml:"coverArt,attr" json:"coverArt"`
+	Size        int64  `xml:"size,attr" json:"size"`
+	ContentType string `xml:"contentType,attr" json:"contentType"`
+	Suffix      string `xml:"suffix,attr" json:"suffix"`
+	Duration    int    `xml:"duration,attr" json:"duration"`
+	IsVideo     bool   `xml:"isVideo,attr" json:"isVideo"`
+	Type        string `xml:"type,attr" json:"type"`
+	Description string `xml:"description,attr" json:"description"`
+	Status      string `xml:"status,attr" json:"status"`
+	PublishDate string `xml:"publishDate,attr" json:"publishDate"`
+}
+
+// SubsonicExtension represents an OpenSubsonic extension the server supports.
+type SubsonicExtension struct {
+	Name     string `xml:"name,attr" json:"name"`
+	Versions []int  `xml:"versions" json:"versions"`
+}
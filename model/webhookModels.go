@@ -0,0 +1,45 @@
+// Package model defines data structures for external API responses and RSS feeds.
+package model
+
+import "time"
+
+// WebhookPayload represents the JSON body of a webhook delivery.
+type WebhookPayload struct {
+	Event     string      `json:"event"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      WebhookData `json:"data"`
+}
+
+// WebhookData represents what an event is about. Only the fields of the event are set.
+type WebhookData struct {
+	Podcast *WebhookPodcast `json:"podcast,omitempty"`
+	Episode *WebhookEpisode `json:"episode,omitempty"`
+	// Error is the reason a download or feed refresh failed.
+	Error string `json:"error,omitempty"`
+	// StatusCode and Failures describe a broken feed.
+	StatusCode int `json:"statusCode,omitempty"`
+	Failures   int `json:"failures,omitempty"`
+	// Backup is the file name of a new backup.
+	Backup string `json:"backup,omitempty"`
+}
+
+// WebhookPodcast represents a podcast in a webhook payload.
+type WebhookPodcast struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	Image string `json:"image,omitempty"`
+}
+
+// WebhookEpisode represents an episode in a webhook payload. DownloadPath and FileSize
+// are only set once the episode is downloaded.
+type WebhookEpisode struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	GUID         string    `json:"guid"`
+	FileURL      string    `json:"fileUrl"`
+	PubDate      time.Time `json:"pubDate"`
+	Duration     int       `json:"duration"`
+	DownloadPath string    `json:"downloadPath,omitempty"`
+	FileSize     int64     `json:"fileSize,omitempty"`
+}
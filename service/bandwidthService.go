@@ -0,0 +1,355 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/toozej/podgrab/db"
+)
+
+// minBurst is the smallest number of bytes a token bucket holds, so slow limits still
+// read in reasonably sized chunks.
+const minBurst = 16 * 1024
+
+// limitRefresh is how often a running download looks up its limits again, so schedule
+// windows and changed settings apply to it. Buckets hold up to a second of traffic.
+const limitRefresh = time.Second
+
+// tokenBucket hands out bytes at a fixed rate, allowing bursts of up to one second.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(bytesPerSecond int) *tokenBucket {
+	bucket := &tokenBucket{}
+	bucket.setRate(bytesPerSecond)
+	return bucket
+}
+
+// setRate changes the rate, refilling the bucket when the rate changed.
+func (bucket *tokenBucket) setRate(bytesPerSecond int) {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+	if bucket.rate == float64(bytesPerSecond) {
+		return
+	}
+	bucket.rate = float64(bytesPerSecond)
+	bucket.burst = max(bucket.rate, minBurst)
+	bucket.tokens = bucket.burst
+	bucket.last = time.Now()
+}
+
+// take removes n bytes from the bucket and returns how long to wait until they are
+// available. Callers waiting in turn share the rate between them.
+func (bucket *tokenBucket) take(n int, now time.Time) time.Duration {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+	bucket.tokens = min(bucket.tokens+now.Sub(bucket.last).Seconds()*bucket.rate, bucket.burst)
+	bucket.last = now
+	bucket.tokens -= float64(n)
+	if bucket.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-bucket.tokens / bucket.rate * float64(time.Second))
+}
+
+// chunk returns the largest read that fits in the bucket.
+func (bucket *tokenBucket) chunk() int {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+	return int(bucket.burst)
+}
+
+// throttledReader limits reads to the rate of every bucket, looking up the buckets of
+// its host again every limitRefresh.
+type throttledReader struct {
+	reader  io.Reader
+	host    string
+	setting func() *db.Setting
+	buckets []*tokenBucket
+	checked time.Time
+}
+
+func (throttled *throttledReader) Read(buffer []byte) (int, error) {
+	if now := time.Now(); now.Sub(throttled.checked) >= limitRefresh {
+		throttled.buckets = bandwidthBuckets(throttled.host, throttled.setting(), now)
+		throttled.checked = now
+	}
+	for _, bucket := range throttled.buckets {
+		if chunk := bucket.chunk(); len(buffer) > chunk {
+			buffer = buffer[:chunk]
+		}
+	}
+	n, err := throttled.reader.Read(buffer)
+	if n > 0 {
+		now := time.Now()
+		var wait time.Duration
+		for _, bucket := range throttled.buckets {
+			wait = max(wait, bucket.take(n, now))
+		}
+		time.Sleep(wait)
+	}
+	return n, err
+}
+
+var (
+	bucketsMu sync.Mutex
+	// buckets holds the global bucket under "" and one bucket per capped host, shared
+	// by all downloads so the caps apply to their combined rate.
+	buckets = make(map[string]*tokenBucket)
+)
+
+// sharedBucket returns the bucket for a key at the given rate.
+func sharedBucket(key string, kibPerSecond int) *tokenBucket {
+	bucketsMu.Lock()
+	defer bucketsMu.Unlock()
+	bucket, ok := buckets[key]
+	if !ok {
+		bucket = newTokenBucket(kibPerSecond * 1024)
+		buckets[key] = bucket
+		return bucket
+	}
+	bucket.setRate(kibPerSecond * 1024)
+	return bucket
+}
+
+// throttle wraps a download body with the global and per-host bandwidth limits of the
+// settings, which it reads again while the download runs.
+func throttle(body io.Reader, host string, setting func() *db.Setting) io.Reader {
+	return &throttledReader{reader: body, host: host, setting: setting}
+}
+
+// bandwidthBuckets returns the buckets of the global and per-host limits in force for a
+// host at a time.
+func bandwidthBuckets(host string, setting *db.Setting, now time.Time) []*tokenBucket {
+	var limits []*tokenBucket
+	if limit := bandwidthLimit(setting, now); limit > 0 {
+		limits = append(limits, sharedBucket("", limit))
+	}
+	hostLimits, _ := parseHostLimits(setting.HostBandwidthLimits)
+	if hostKey, limit := hostLimit(hostLimits, host); limit > 0 {
+		limits = append(limits, sharedBucket(hostKey, limit))
+	}
+	return limits
+}
+
+// bandwidthLimit returns the global limit in KiB/s at a time, 0 meaning unlimited. The
+// download schedule rule in force can replace the limit from the settings.
+func bandwidthLimit(setting *db.Setting, now time.Time) int {
+	schedule, _ := ParseDownloadSchedule(setting.DownloadSchedule)
+	if rule := schedule.match(now); rule != nil && rule.hasLimit {
+		return rule.limit
+	}
+	return setting.BandwidthLimit
+}
+
+// DownloadWindowOpen reports whether scheduled downloads may run at a time. Downloads
+// always may when there is no download schedule.
+func DownloadWindowOpen(setting *db.Setting, now time.Time) bool {
+	schedule, _ := ParseDownloadSchedule(setting.DownloadSchedule)
+	return len(schedule) == 0 || schedule.match(now) != nil
+}
+
+// hostLimit returns the cap of a host and the host entry it matched. Entries match the
+// host and its subdomains; the longest entry wins.
+func hostLimit(limits map[string]int, host string) (string, int) {
+	host = strings.ToLower(host)
+	if hostname, _, found := strings.Cut(host, ":"); found && !strings.Contains(hostname, "]") {
+		host = hostname
+	}
+	var matched string
+	for entry := range limits {
+		if (host == entry || strings.HasSuffix(host, "."+entry)) && len(entry) > len(matched) {
+			matched = entry
+		}
+	}
+	if matched == "" {
+		return "", 0
+	}
+	return matched, limits[matched]
+}
+
+// parseHostLimits reads per-host caps given one per line as "host KiB/s".
+func parseHostLimits(text string) (map[string]int, error) {
+	limits := make(map[string]int)
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("host limit line %d: expected \"host KiB/s\"", line)
+		}
+		limit, err := strconv.Atoi(fields[1])
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("host limit line %d: invalid rate %q", line, fields[1])
+		}
+		limits[strings.ToLower(strings.TrimPrefix(fields[0], "*."))] = limit
+	}
+	return limits, scanner.Err()
+}
+
+// downloadSchedule lists the windows in which scheduled downloads run. The first rule
+// matching a time applies.
+type downloadSchedule []scheduleRule
+
+// scheduleRule is a window on some days, with an optional bandwidth limit replacing the
+// global one.
+type scheduleRule struct {
+	days [7]bool
+	// start and end are minutes since midnight; equal values cover the whole day and a
+	// window ending before it starts runs past midnight.
+	start, end int
+	limit      int
+	hasLimit   bool
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseDownloadSchedule reads download windows given one per line as
+// "[days] [HH:MM-HH:MM] [KiB/s|unlimited]", for example "mon-fri 01:00-06:00" or
+// "sat,sun unlimited". Days default to every day and times to the whole day.
+func ParseDownloadSchedule(text string) (downloadSchedule, error) {
+	var schedule downloadSchedule
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(strings.ToLower(scanner.Text()))
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		rule, err := parseScheduleRule(fields)
+		if err != nil {
+			return nil, fmt.Errorf("schedule line %d: %w", line, err)
+		}
+		schedule = append(schedule, rule)
+	}
+	return schedule, scanner.Err()
+}
+
+func parseScheduleRule(fields []string) (scheduleRule, error) {
+	var rule scheduleRule
+	var hasDays, hasTimes bool
+	for _, field := range fields {
+		switch {
+		case field == "unlimited" && !rule.hasLimit:
+			rule.hasLimit = true
+		case isDigits(field) && !rule.hasLimit:
+			limit, err := strconv.Atoi(field)
+			if err != nil || limit <= 0 {
+				return rule, fmt.Errorf("invalid rate %q", field)
+			}
+			rule.limit, rule.hasLimit = limit, true
+		case strings.Contains(field, ":") && !hasTimes:
+			start, end, found := strings.Cut(field, "-")
+			if !found {
+				return rule, fmt.Errorf("invalid window %q, expected HH:MM-HH:MM", field)
+			}
+			var err error
+			if rule.start, err = parseClock(start); err != nil {
+				return rule, err
+			}
+			if rule.end, err = parseClock(end); err != nil {
+				return rule, err
+			}
+			hasTimes = true
+		case !hasDays:
+			days, err := parseDays(field)
+			if err != nil {
+				return rule, err
+			}
+			rule.days, hasDays = days, true
+		default:
+			return rule, fmt.Errorf("unexpected %q", field)
+		}
+	}
+	if !hasDays {
+		rule.days = [7]bool{true, true, true, true, true, true, true}
+	}
+	return rule, nil
+}
+
+// parseDays reads "daily", "*", day names, ranges such as "mon-fri" and lists of both.
+func parseDays(field string) ([7]bool, error) {
+	var days [7]bool
+	if field == "daily" || field == "*" {
+		return [7]bool{true, true, true, true, true, true, true}, nil
+	}
+	for _, part := range strings.Split(field, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, ok := weekdays[from]
+		if !ok {
+			return days, fmt.Errorf("invalid day %q", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdays[to]; !ok {
+				return days, fmt.Errorf("invalid day %q", to)
+			}
+		}
+		for day := first; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseClock reads HH:MM as minutes since midnight; 24:00 stands for the end of the day.
+func parseClock(value string) (int, error) {
+	clock, err := time.Parse("15:04", value)
+	if err == nil {
+		return clock.Hour()*60 + clock.Minute(), nil
+	}
+	if value == "24:00" {
+		return 24 * 60, nil
+	}
+	return 0, fmt.Errorf("invalid time %q", value)
+}
+
+func isDigits(value string) bool {
+	return strings.Trim(value, "0123456789") == ""
+}
+
+// match returns the first rule in force at a time, or nil when the time is outside
+// every window.
+func (schedule downloadSchedule) match(now time.Time) *scheduleRule {
+	minute := now.Hour()*60 + now.Minute()
+	for i := range schedule {
+		if schedule[i].covers(now.Weekday(), minute) {
+			return &schedule[i]
+		}
+	}
+	return nil
+}
+
+// covers reports whether the rule is in force at a minute of a day. A window running
+// past midnight belongs to the day it starts on.
+func (rule *scheduleRule) covers(day time.Weekday, minute int) bool {
+	switch {
+	case rule.start == rule.end:
+		return rule.days[day]
+	case rule.start < rule.end:
+		return rule.days[day] && minute >= rule.start && minute < rule.end
+	case minute >= rule.start:
+		return rule.days[day]
+	case minute < rule.end:
+		return rule.days[(day+6)%7]
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toozej/podgrab/db"
+	testhelpers "github.com/toozej/podgrab/internal/testing"
+)
+
+// at returns a time in the week of 2024-01-01, a Monday.
+func at(day time.Weekday, clock string) time.Time {
+	parsed, _ := time.Parse("15:04", clock)
+	return time.Date(2024, 1, 1+int(day+6)%7, parsed.Hour(), parsed.Minute(), 0, 0, time.Local)
+}
+
+// TestDownloadSchedule tests download windows and the limits they set.
+func TestDownloadSchedule(t *testing.T) {
+	setting := &db.Setting{
+		BandwidthLimit:   500,
+		DownloadSchedule: "# weekends first\nsat,sun unlimited\ndaily 01:00-06:00\nmon-fri 22:00-01:00 200",
+	}
+	tests := []struct {
+		name  string
+		time  time.Time
+		open  bool
+		limit int
+	}{
+		{name: "weekend", time: at(time.Saturday, "15:00"), open: true, limit: 0},
+		{name: "night", time: at(time.Monday, "03:00"), open: true, limit: 500},
+		{name: "day", time: at(time.Monday, "12:00"), open: false, limit: 500},
+		{name: "evening", time: at(time.Friday, "23:30"), open: true, limit: 200},
+		{name: "past_midnight", time: at(time.Saturday, "00:30"), open: true, limit: 0},
+		{name: "past_midnight_weekday", time: at(time.Tuesday, "00:30"), open: true, limit: 200},
+		{name: "window_end", time: at(time.Wednesday, "06:00"), open: false, limit: 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.open, DownloadWindowOpen(setting, tt.time))
+			assert.Equal(t, tt.limit, bandwidthLimit(setting, tt.time))
+		})
+	}
+
+	assert.True(t, DownloadWindowOpen(&db.Setting{}, at(time.Monday, "12:00")), "Should always download without a schedule")
+
+	for _, invalid := range []string{"someday", "25:00-26:00", "01:00", "mon 0", "mon tue", "01:00-02:00 03:00-04:00"} {
+		_, err := ParseDownloadSchedule(invalid)
+		assert.Error(t, err, "schedule %q", invalid)
+	}
+}
+
+// TestHostLimit tests matching per-host caps.
+func TestHostLimit(t *testing.T) {
+	limits, err := parseHostLimits("cdn.example.com 100\n*.example.com 300\n\n# comment")
+	require.NoError(t, err)
+
+	tests := map[string]int{
+		"cdn.example.com":      100,
+		"eu.cdn.example.com":   100,
+		"media.example.com:80": 300,
+		"example.com":          300,
+		"example.org":          0,
+		"badexample.com":       0,
+	}
+	for host, want := range tests {
+		_, limit := hostLimit(limits, host)
+		assert.Equal(t, want, limit, "host %s", host)
+	}
+
+	_, err = parseHostLimits("cdn.example.com fast")
+	assert.Error(t, err)
+}
+
+// TestTokenBucket tests the waits handed out by a token bucket.
+func TestTokenBucket(t *testing.T) {
+	bucket := newTokenBucket(100 * 1024)
+	start := bucket.last
+
+	assert.Zero(t, bucket.take(100*1024, start), "Should allow a one second burst")
+	assert.Equal(t, 500*time.Millisecond, bucket.take(50*1024, start))
+	assert.Equal(t, time.Duration(0), bucket.take(0, start.Add(500*time.Millisecond)))
+	assert.Equal(t, time.Second, bucket.take(100*1024, start.Add(500*time.Millisecond)))
+	assert.Equal(t, 100*1024, bucket.chunk())
+	assert.Equal(t, minBurst, newTokenBucket(1024).chunk(), "Should read slow limits in larger chunks")
+}
+
+// TestThrottle_SettingsChange tests that running downloads pick up changed limits.
+func TestThrottle_SettingsChange(t *testing.T) {
+	setting := &db.Setting{}
+	body := throttle(bytes.NewReader(make([]byte, (256+72)*1024)), "cdn.example.com", func() *db.Setting { return setting })
+	throttled, ok := body.(*throttledReader)
+	require.True(t, ok)
+
+	buffer := make([]byte, 256*1024)
+	n, err := body.Read(buffer)
+	require.NoError(t, err)
+	assert.Equal(t, len(buffer), n, "Should not limit reads without limits")
+
+	setting.HostBandwidthLimits = "example.com 48"
+	throttled.checked = time.Now().Add(-limitRefresh)
+	started := time.Now()
+	for err == nil {
+		_, err = body.Read(buffer)
+	}
+	assert.GreaterOrEqual(t, time.Since(started), 400*time.Millisecond, "Should take about half a second past the burst")
+}
+
+// TestDownload_BandwidthLimit tests that downloads are throttled to the global limit.
+func TestDownload_BandwidthLimit(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	_, dataCleanup := testhelpers.SetupTestDataDir(t)
+	defer dataCleanup()
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	content := bytes.Repeat([]byte("a"), 96*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(content) // Test server - error handling not required
+	}))
+	defer server.Close()
+
+	setting := db.CreateTestSetting(t, database)
+	setting.BandwidthLimit = 64
+	require.NoError(t, db.UpdateSettings(setting))
+
+	started := time.Now()
+	filePath, err := Download(server.URL+"/episode.mp3", "Episode", "Throttled", "episode", "", nil)
+	require.NoError(t, err)
+	assert.FileExists(t, filePath)
+	assert.GreaterOrEqual(t, time.Since(started), 400*time.Millisecond, "Should take about half a second past the burst")
+}
+
+// TestDownloadMissingEpisodes_OutsideSchedule tests that episodes stay queued outside the download schedule.
+func TestDownloadMissingEpisodes_OutsideSchedule(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	_, dataCleanup := testhelpers.SetupTestDataDir(t)
+	defer dataCleanup()
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		_, _ = w.Write([]byte("audio")) // Test server - error handling not required
+	}))
+	defer server.Close()
+
+	tomorrow := strings.ToLower(time.Now().Add(24 * time.Hour).Weekday().String()[:3])
+	setting := db.CreateTestSetting(t, database)
+	setting.DownloadSchedule = tomorrow
+	require.NoError(t, db.UpdateSettings(setting))
+
+	podcast := db.CreateTestPodcast(t, database)
+	item := db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{
+		FileURL:        server.URL + "/episode.mp3",
+		DownloadStatus: db.NotDownloaded,
+	})
+
+	require.NoError(t, DownloadMissingEpisodes())
+
+	var stored db.PodcastItem
+	require.NoError(t, db.GetPodcastItemByID(item.ID, &stored))
+	assert.Equal(t, db.NotDownloaded, stored.DownloadStatus, "Should stay queued")
+	assert.Zero(t, requests)
+}
@@ -0,0 +1,157 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/internal/logger"
+	"github.com/toozej/podgrab/internal/secrets"
+)
+
+// SetPodcastCredentials stores the credentials of a private feed encrypted. Empty
+// credentials remove the stored ones.
+func SetPodcastCredentials(id string, credentials *db.FeedCredentials) error {
+	var podcast db.Podcast
+	err := db.GetPodcastByID(id, &podcast)
+	if err != nil {
+		return err
+	}
+	encrypted, err := encryptCredentials(credentials)
+	if err != nil {
+		return err
+	}
+	return db.UpdatePodcastCredentials(id, encrypted)
+}
+
+// encryptCredentials validates and encrypts credentials for storage.
+func encryptCredentials(credentials *db.FeedCredentials) (string, error) {
+	if credentials.IsEmpty() {
+		return "", nil
+	}
+	for name, value := range credentials.Headers {
+		if !validHeaderName(name) {
+			return "", fmt.Errorf("invalid header name: %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return "", fmt.Errorf("invalid value for header %q", name)
+		}
+	}
+	if strings.ContainsAny(credentials.Username+credentials.Password+credentials.Cookies, "\r\n") {
+		return "", fmt.Errorf("credentials must not contain line breaks")
+	}
+	hosts, err := credentialHosts(credentials.Hosts)
+	if err != nil {
+		return "", err
+	}
+	credentials.Hosts = hosts
+	data, err := json.Marshal(credentials)
+	if err != nil {
+		return "", err
+	}
+	return secrets.Encrypt(string(data))
+}
+
+// credentialHosts normalizes the extra hosts of a private feed to lower case without
+// duplicates. Each entry must be a bare host or host:port, not a URL.
+func credentialHosts(hosts []string) ([]string, error) {
+	var normalized []string
+	for _, host := range hosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host == "" {
+			continue
+		}
+		parsed, err := url.Parse("http://" + host)
+		if err != nil || parsed.Host != host || parsed.Hostname() == "" || strings.ContainsAny(host, "/@?# \t") {
+			return nil, fmt.Errorf("invalid credential host: %q", host)
+		}
+		if !slices.Contains(normalized, host) {
+			normalized = append(normalized, host)
+		}
+	}
+	return normalized, nil
+}
+
+// validHeaderName reports whether name is a valid HTTP header field name.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r > 0x7e || r <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// podcastCredentials returns the decrypted credentials of a podcast, or nil when it
+// has none.
+func podcastCredentials(podcast *db.Podcast) *db.FeedCredentials {
+	if podcast.Credentials == "" {
+		return nil
+	}
+	data, err := secrets.Decrypt(podcast.Credentials)
+	if err != nil {
+		logger.Log.Errorw("decrypting podcast credentials", "podcast", podcast.Title, "error", err)
+		return nil
+	}
+	var credentials db.FeedCredentials
+	if err := json.Unmarshal([]byte(data), &credentials); err != nil {
+		logger.Log.Errorw("reading podcast credentials", "podcast", podcast.Title, "error", err)
+		return nil
+	}
+	return &credentials
+}
+
+// applyCredentials adds the credentials of a private feed to a request. Requests only
+// get them for the feed's own host and the listed extra hosts, see
+// requestOptions.sendsCredentials.
+func applyCredentials(req *http.Request, credentials *db.FeedCredentials) {
+	if credentials.IsEmpty() {
+		return
+	}
+	if credentials.Username != "" || credentials.Password != "" {
+		req.SetBasicAuth(credentials.Username, credentials.Password)
+	}
+	for name, value := range credentials.Headers {
+		req.Header.Set(name, value)
+	}
+	if credentials.Cookies != "" {
+		req.Header.Set("Cookie", credentials.Cookies)
+	}
+}
+
+// removeCredentials drops the credentials from a request, such as one the HTTP client
+// copied from the previous request when following a redirect to another host.
+func removeCredentials(req *http.Request, credentials *db.FeedCredentials) {
+	req.Header.Del("Authorization")
+	req.Header.Del("Cookie")
+	for name := range credentials.Headers {
+		req.Header.Del(name)
+	}
+}
+
+// splitURLCredentials removes a user and password embedded in a feed URL and returns
+// them as basic auth credentials.
+func splitURLCredentials(rawURL string) (string, *db.FeedCredentials) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.User == nil {
+		return rawURL, nil
+	}
+	password, _ := parsed.User.Password()
+	credentials := &db.FeedCredentials{Username: parsed.User.Username(), Password: password}
+	parsed.User = nil
+	return parsed.String(), credentials
+}
+
+// RedactURL removes a user and password embedded in a URL so it can be logged or exported.
+func RedactURL(rawURL string) string {
+	redacted, _ := splitURLCredentials(rawURL)
+	return redacted
+}
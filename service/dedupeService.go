@@ -0,0 +1,229 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"crypto/sha1" // #nosec G505 -- used to fingerprint episodes, not for security
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/internal/logger"
+	"github.com/toozej/podgrab/model"
+)
+
+// syntheticGUIDPrefix marks GUIDs podgrab derived for feed entries without one.
+const syntheticGUIDPrefix = "podgrab:"
+
+// normalizeTitle lowercases a title and drops punctuation and repeated whitespace so
+// cosmetic edits do not change an episode's identity.
+func normalizeTitle(title string) string {
+	var builder strings.Builder
+	for _, word := range strings.Fields(strings.ToLower(title)) {
+		word = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, word)
+		if word == "" {
+			continue
+		}
+		if builder.Len() > 0 {
+			builder.WriteByte(' ')
+		}
+		builder.WriteString(word)
+	}
+	return builder.String()
+}
+
+// titleDateHash fingerprints an episode by its normalized title and publish day.
+func titleDateHash(title string, pubDate time.Time) string {
+	day := ""
+	if !pubDate.IsZero() {
+		day = pubDate.UTC().Format("2006-01-02")
+	}
+	sum := sha1.Sum([]byte(normalizeTitle(title) + "|" + day)) // #nosec G401 -- not used for security
+	return hex.EncodeToString(sum[:])
+}
+
+// feedItemGUID returns the GUID a feed entry is stored under. Entries without a GUID
+// use their enclosure URL, or a title and publish date hash when there is no enclosure.
+func feedItemGUID(obj *model.FeedItem) string {
+	if guid := strings.TrimSpace(obj.GUID); guid != "" {
+		return guid
+	}
+	if obj.Enclosure.URL != "" {
+		return obj.Enclosure.URL
+	}
+	return syntheticGUIDPrefix + titleDateHash(obj.Title, obj.PubDate)
+}
+
+// episodeIndex looks up stored episodes by each of their identities.
+type episodeIndex struct {
+	byGUID map[string]*db.PodcastItem
+	byURL  map[string]*db.PodcastItem
+	byHash map[string]*db.PodcastItem
+}
+
+// newEpisodeIndex indexes the stored episodes of a podcast.
+func newEpisodeIndex(items []db.PodcastItem) *episodeIndex {
+	index := &episodeIndex{
+		byGUID: make(map[string]*db.PodcastItem),
+		byURL:  make(map[string]*db.PodcastItem),
+		byHash: make(map[string]*db.PodcastItem),
+	}
+	for i := range items {
+		index.add(&items[i])
+	}
+	return index
+}
+
+// add registers an episode, keeping the first episode seen for each identity.
+func (index *episodeIndex) add(item *db.PodcastItem) {
+	if _, ok := index.byGUID[item.GUID]; !ok && item.GUID != "" {
+		index.byGUID[item.GUID] = item
+	}
+	if _, ok := index.byURL[item.FileURL]; !ok && item.FileURL != "" {
+		index.byURL[item.FileURL] = item
+	}
+	hash := titleDateHash(item.Title, item.PubDate)
+	if _, ok := index.byHash[hash]; !ok {
+		index.byHash[hash] = item
+	}
+}
+
+// match finds the stored episode for a feed entry. The GUID always wins; the fallback
+// identities are used for entries without a GUID and, depending on the mode, for
+// feeds whose GUIDs are not stable.
+func (index *episodeIndex) match(mode db.DedupeMode, obj *model.FeedItem, guidMissing bool) *db.PodcastItem {
+	if item, ok := index.byGUID[obj.GUID]; ok {
+		return item
+	}
+	byURL := guidMissing || mode == db.DedupeEnclosure
+	byHash := guidMissing || mode == db.DedupeEnclosure || mode == db.DedupeTitleDate
+	if byURL && obj.Enclosure.URL != "" {
+		if item, ok := index.byURL[obj.Enclosure.URL]; ok {
+			return item
+		}
+	}
+	if byHash {
+		if item, ok := index.byHash[titleDateHash(obj.Title, obj.PubDate)]; ok {
+			return item
+		}
+	}
+	return nil
+}
+
+// SetPodcastDedupeMode set how refreshes recognize known episodes of a podcast.
+func SetPodcastDedupeMode(id string, mode db.DedupeMode) error {
+	if !mode.IsValid() {
+		return fmt.Errorf("invalid dedupe mode: %q", mode)
+	}
+	var podcast db.Podcast
+	err := db.GetPodcastByID(id, &podcast)
+	if err != nil {
+		return err
+	}
+
+	return db.UpdatePodcastDedupeMode(id, mode)
+}
+
+// MergeDuplicatePodcastItems merges episodes of a podcast that a refresh would take for
+// the same episode under the podcast's dedupe mode. Episodes with different GUIDs that
+// are both still in the feed are left alone, as the next refresh would import the
+// merged one again. The oldest episode is kept and takes over the played state,
+// bookmark and downloaded file of its duplicates. It returns the number of episodes
+// merged away.
+func MergeDuplicatePodcastItems(podcastID string) (int, error) {
+	var podcast db.Podcast
+	if err := db.GetPodcastByID(podcastID, &podcast); err != nil {
+		return 0, err
+	}
+	var items []db.PodcastItem
+	if err := db.GetAllPodcastItemsByPodcastID(podcastID, &items); err != nil {
+		return 0, err
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].CreatedAt.Before(items[j].CreatedAt)
+	})
+
+	index := newEpisodeIndex(nil)
+	merged := 0
+	for i := range items {
+		item := &items[i]
+		obj := &model.FeedItem{
+			GUID:      item.GUID,
+			Title:     item.Title,
+			PubDate:   item.PubDate,
+			Enclosure: model.FeedEnclosure{URL: item.FileURL},
+		}
+		keeper := index.match(podcast.DedupeMode, obj, fallbackGUID(item))
+		if keeper == nil || (keeper.GUID != item.GUID && !keeper.RemovedUpstream && !item.RemovedUpstream) {
+			index.add(item)
+			continue
+		}
+		if err := mergePodcastItem(keeper, item); err != nil {
+			logger.Log.Errorw("merging duplicate episode", "episode", item.Title, "error", err)
+			continue
+		}
+		index.add(keeper)
+		merged++
+	}
+	if merged > 0 {
+		logger.Log.Infow("Merged duplicate episodes", "podcast", podcast.Title, "count", merged)
+	}
+	return merged, nil
+}
+
+// fallbackGUID reports whether a stored episode's GUID was derived by feedItemGUID
+// because its feed entry had none.
+func fallbackGUID(item *db.PodcastItem) bool {
+	return item.GUID == "" || item.GUID == item.FileURL || strings.HasPrefix(item.GUID, syntheticGUIDPrefix)
+}
+
+// mergePodcastItem folds a duplicate episode into the kept one and deletes the duplicate.
+func mergePodcastItem(keeper, duplicate *db.PodcastItem) error {
+	// Keep the GUID the feed still lists so the next refresh finds the kept episode.
+	if keeper.RemovedUpstream && !duplicate.RemovedUpstream {
+		keeper.GUID = duplicate.GUID
+		keeper.RemovedUpstream = false
+		keeper.RemovedUpstreamDate = time.Time{}
+	}
+	keeper.IsPlayed = keeper.IsPlayed || duplicate.IsPlayed
+	if keeper.BookmarkDate.IsZero() || (!duplicate.BookmarkDate.IsZero() && duplicate.BookmarkDate.Before(keeper.BookmarkDate)) {
+		keeper.BookmarkDate = duplicate.BookmarkDate
+	}
+
+	if duplicate.DownloadStatus == db.Downloaded && duplicate.DownloadPath != keeper.DownloadPath {
+		if keeper.DownloadStatus == db.Downloaded {
+			if err := DeleteFile(duplicate.DownloadPath); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		} else {
+			keeper.DownloadStatus = db.Downloaded
+			keeper.DownloadPath = duplicate.DownloadPath
+			keeper.DownloadDate = duplicate.DownloadDate
+			keeper.FileSize = duplicate.FileSize
+		}
+	}
+	if keeper.LocalImage == "" {
+		keeper.LocalImage = duplicate.LocalImage
+	} else if duplicate.LocalImage != "" && duplicate.LocalImage != keeper.LocalImage {
+		if err := DeleteFile(duplicate.LocalImage); err != nil && !os.IsNotExist(err) {
+			logger.Log.Errorw("deleting duplicate episode image", "error", err)
+		}
+	}
+
+	if err := db.UpdatePodcastItem(keeper); err != nil {
+		return err
+	}
+	if err := db.MergeEpisodeStates(duplicate.ID, keeper.ID); err != nil {
+		return err
+	}
+	return db.DeletePodcastItemByID(duplicate.ID)
+}
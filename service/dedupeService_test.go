@@ -0,0 +1,244 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toozej/podgrab/db"
+	testhelpers "github.com/toozej/podgrab/internal/testing"
+	"github.com/toozej/podgrab/model"
+)
+
+// TestFeedItemGUID tests the fallback identities of feed entries.
+func TestFeedItemGUID(t *testing.T) {
+	pubDate := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, "guid-1", feedItemGUID(&model.FeedItem{GUID: " guid-1 ", Enclosure: model.FeedEnclosure{URL: "https://example.com/a.mp3"}}))
+	assert.Equal(t, "https://example.com/a.mp3", feedItemGUID(&model.FeedItem{Enclosure: model.FeedEnclosure{URL: "https://example.com/a.mp3"}}))
+
+	hashed := feedItemGUID(&model.FeedItem{Title: "Episode 1: Intro", PubDate: pubDate})
+	assert.True(t, strings.HasPrefix(hashed, syntheticGUIDPrefix))
+	assert.Equal(t, hashed, feedItemGUID(&model.FeedItem{Title: "  episode 1 -  intro!", PubDate: pubDate.Add(time.Hour)}),
+		"Cosmetic title edits and times on the same day should keep the identity")
+	assert.NotEqual(t, hashed, feedItemGUID(&model.FeedItem{Title: "Episode 1: Intro", PubDate: pubDate.AddDate(0, 0, 1)}))
+}
+
+// TestAddPodcastItems_Dedupe tests refreshes of feeds without GUIDs or with unstable GUIDs.
+func TestAddPodcastItems_Dedupe(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	_, dataCleanup := testhelpers.SetupTestDataDir(t)
+	defer dataCleanup()
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	withGUIDs := func(first, second string) string {
+		feed := strings.Replace(testhelpers.ValidRSSFeed, "<guid>test-podcast-episode-1</guid>", first, 1)
+		return strings.Replace(feed, "<guid>test-podcast-episode-2</guid>", second, 1)
+	}
+	serve := func(t *testing.T, feed string) string {
+		t.Helper()
+		server := httptest.NewServer(testhelpers.CreateMockRSSHandler(feed))
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+	// Match the fixture metadata so refreshes only touch episodes.
+	subscribe := func(t *testing.T, feedURL string, mode db.DedupeMode) *db.Podcast {
+		t.Helper()
+		podcast := db.CreateTestPodcast(t, database, &db.Podcast{URL: feedURL, Summary: "A podcast for testing purposes", Image: "https://example.com/podcast-image.jpg"})
+		require.NoError(t, db.UpdatePodcastDedupeMode(podcast.ID, mode))
+		podcast.DedupeMode = mode
+		return podcast
+	}
+	episodes := func(t *testing.T, podcastID string) []db.PodcastItem {
+		t.Helper()
+		var items []db.PodcastItem
+		require.NoError(t, db.GetAllPodcastItemsByPodcastID(podcastID, &items))
+		return items
+	}
+
+	t.Run("missing_guids", func(t *testing.T) {
+		podcast := subscribe(t, serve(t, withGUIDs("", "")), db.DedupeGUID)
+
+		require.NoError(t, AddPodcastItems(podcast, false))
+		items := episodes(t, podcast.ID)
+		require.Len(t, items, 2, "Entries without GUIDs must not collapse into one episode")
+		assert.ElementsMatch(t, []string{"https://example.com/episode1.mp3", "https://example.com/episode2.mp3"},
+			[]string{items[0].GUID, items[1].GUID})
+
+		require.NoError(t, AddPodcastItems(podcast, false))
+		assert.Len(t, episodes(t, podcast.ID), 2)
+	})
+
+	t.Run("legacy_empty_guid", func(t *testing.T) {
+		podcast := subscribe(t, serve(t, withGUIDs("", "<guid>test-podcast-episode-2</guid>")), db.DedupeGUID)
+		legacy := db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{
+			FileURL: "https://example.com/episode1.mp3",
+			PubDate: time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+		})
+		require.NoError(t, db.UpdatePodcastItemGUID(legacy.ID, ""))
+
+		require.NoError(t, AddPodcastItems(podcast, false))
+		assert.Len(t, episodes(t, podcast.ID), 2)
+		var stored db.PodcastItem
+		require.NoError(t, db.GetPodcastItemByID(legacy.ID, &stored))
+		assert.Equal(t, "https://example.com/episode1.mp3", stored.GUID)
+	})
+
+	t.Run("unstable_guids", func(t *testing.T) {
+		firstBuild := serve(t, withGUIDs("<guid>build-1-a</guid>", "<guid>build-1-b</guid>"))
+		secondBuild := serve(t, withGUIDs("<guid>build-2-a</guid>", "<guid>build-2-b</guid>"))
+
+		for _, mode := range []db.DedupeMode{db.DedupeEnclosure, db.DedupeTitleDate} {
+			podcast := subscribe(t, firstBuild, mode)
+			require.NoError(t, AddPodcastItems(podcast, false))
+
+			podcast.URL = secondBuild
+			require.NoError(t, AddPodcastItems(podcast, false))
+
+			items := episodes(t, podcast.ID)
+			require.Len(t, items, 2, "mode %s should recognize regenerated GUIDs", mode)
+			assert.ElementsMatch(t, []string{"build-2-a", "build-2-b"}, []string{items[0].GUID, items[1].GUID})
+			for i := range items {
+				assert.False(t, items[i].RemovedUpstream)
+			}
+		}
+
+		podcast := subscribe(t, firstBuild, db.DedupeGUID)
+		require.NoError(t, AddPodcastItems(podcast, false))
+		podcast.URL = secondBuild
+		require.NoError(t, AddPodcastItems(podcast, false))
+		assert.Len(t, episodes(t, podcast.ID), 4, "GUID mode trusts the GUIDs")
+	})
+}
+
+// TestMergeDuplicatePodcastItems tests merging duplicate episodes with their files and played state.
+func TestMergeDuplicatePodcastItems(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	dataDir, dataCleanup := testhelpers.SetupTestDataDir(t)
+	defer dataCleanup()
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	pubDate := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	podcast := db.CreateTestPodcast(t, database)
+
+	keeper := db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{
+		Title: "Episode 1", FileURL: "https://example.com/episode1.mp3", PubDate: pubDate,
+	})
+	sameURL := db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{
+		Title: "Episode 1 (re-import)", FileURL: "https://example.com/episode1.mp3", PubDate: pubDate,
+		IsPlayed: true, DownloadStatus: db.Downloaded, DownloadPath: filepath.Join(dataDir, "episode1.mp3"),
+	})
+	sameTitle := db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{
+		Title: "episode 1", FileURL: "https://cdn.example.com/episode1.mp3?build=2", PubDate: pubDate.Add(time.Hour),
+		DownloadStatus: db.Downloaded, DownloadPath: filepath.Join(dataDir, "episode1-copy.mp3"),
+	})
+	other := db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{
+		Title: "Episode 2", FileURL: "https://example.com/episode2.mp3", PubDate: pubDate.AddDate(0, 0, 7),
+	})
+	require.NoError(t, os.WriteFile(sameURL.DownloadPath, []byte("audio"), 0o600))
+	require.NoError(t, os.WriteFile(sameTitle.DownloadPath, []byte("audio"), 0o600))
+	require.NoError(t, SetPodcastItemPlayedStatus("alice", sameURL.ID, true))
+	require.NoError(t, SetPodcastItemBookmarkStatus("alice", sameTitle.ID, true))
+	// The copies were left behind by a feed that regenerated its GUIDs.
+	require.NoError(t, db.UpdatePodcastDedupeMode(podcast.ID, db.DedupeEnclosure))
+	_, err := db.MarkPodcastItemsRemovedUpstream(podcast.ID, []string{keeper.GUID, other.GUID}, time.Now())
+	require.NoError(t, err)
+
+	merged, err := MergeDuplicatePodcastItems(podcast.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, merged)
+
+	var items []db.PodcastItem
+	require.NoError(t, db.GetAllPodcastItemsByPodcastID(podcast.ID, &items))
+	require.Len(t, items, 2)
+
+	var stored db.PodcastItem
+	require.NoError(t, db.GetPodcastItemByID(keeper.ID, &stored))
+	assert.True(t, stored.IsPlayed, "Played state should carry over")
+	states := []db.PodcastItem{stored}
+	require.NoError(t, ApplyEpisodeStates("alice", states))
+	assert.True(t, states[0].IsPlayed, "Each user's played state should carry over")
+	assert.False(t, states[0].BookmarkDate.IsZero(), "Each user's bookmark should carry over")
+	assert.Equal(t, db.Downloaded, stored.DownloadStatus)
+	assert.Equal(t, sameURL.DownloadPath, stored.DownloadPath, "The first downloaded file should be adopted")
+	assert.FileExists(t, sameURL.DownloadPath)
+	assert.NoFileExists(t, sameTitle.DownloadPath, "Extra copies should be deleted")
+
+	var untouched db.PodcastItem
+	assert.NoError(t, db.GetPodcastItemByID(other.ID, &untouched))
+
+	merged, err = MergeDuplicatePodcastItems(podcast.ID)
+	require.NoError(t, err)
+	assert.Zero(t, merged)
+}
+
+// TestMergeDuplicatePodcastItems_FeedGUIDs tests that merging follows the dedupe mode and
+// keeps episodes the feed lists under different GUIDs.
+func TestMergeDuplicatePodcastItems_FeedGUIDs(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	_, dataCleanup := testhelpers.SetupTestDataDir(t)
+	defer dataCleanup()
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	// Both entries share an enclosure but have their own GUIDs.
+	shared := strings.Replace(testhelpers.ValidRSSFeed, "https://example.com/episode2.mp3", "https://example.com/episode1.mp3", 1)
+	server := httptest.NewServer(testhelpers.CreateMockRSSHandler(shared))
+	defer server.Close()
+	podcast := db.CreateTestPodcast(t, database, &db.Podcast{URL: server.URL, Summary: "A podcast for testing purposes", Image: "https://example.com/podcast-image.jpg"})
+	episodes := func() []db.PodcastItem {
+		var items []db.PodcastItem
+		require.NoError(t, db.GetAllPodcastItemsByPodcastID(podcast.ID, &items))
+		return items
+	}
+
+	require.NoError(t, AddPodcastItems(podcast, false))
+	require.Len(t, episodes(), 2)
+
+	for _, mode := range []db.DedupeMode{db.DedupeGUID, db.DedupeEnclosure} {
+		require.NoError(t, db.UpdatePodcastDedupeMode(podcast.ID, mode))
+		merged, err := MergeDuplicatePodcastItems(podcast.ID)
+		require.NoError(t, err)
+		assert.Zero(t, merged, "mode %s should keep episodes whose GUIDs are both in the feed", mode)
+
+		require.NoError(t, AddPodcastItems(podcast, false))
+		assert.Len(t, episodes(), 2, "A refresh should not import anything again")
+	}
+
+	// Once the feed drops the second GUID, the episodes are duplicates.
+	start := strings.LastIndex(shared, "<item>")
+	end := strings.LastIndex(shared, "</item>") + len("</item>")
+	single := httptest.NewServer(testhelpers.CreateMockRSSHandler(shared[:start] + shared[end:]))
+	defer single.Close()
+	podcast.URL = single.URL
+	require.NoError(t, AddPodcastItems(podcast, false))
+
+	merged, err := MergeDuplicatePodcastItems(podcast.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, merged)
+	require.NoError(t, AddPodcastItems(podcast, false))
+	items := episodes()
+	require.Len(t, items, 1)
+	assert.Equal(t, "test-podcast-episode-1", items[0].GUID)
+	assert.False(t, items[0].RemovedUpstream)
+}
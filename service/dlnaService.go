@@ -0,0 +1,434 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	uuid "github.com/gofrs/uuid/v5"
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/model"
+	"gorm.io/gorm"
+)
+
+// UPnP error codes of the ContentDirectory.
+const (
+	DLNAErrorInvalidAction = 401
+	DLNAErrorInvalidArgs   = 402
+	DLNAErrorActionFailed  = 501
+	DLNAErrorNoSuchObject  = 701
+)
+
+// ContentDirectory object IDs of the fixed containers.
+const (
+	dlnaRootID     = "0"
+	dlnaPodcastsID = "podcasts"
+	dlnaTagsID     = "tags"
+)
+
+// dlnaFlags are the DLNA flags of served files: byte seeking, streaming transfer and
+// DLNA 1.5.
+const dlnaFlags = "DLNA.ORG_OP=01;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=01700000000000000000000000000000"
+
+// DLNAServer describes the UPnP MediaServer Podgrab announces on the LAN.
+type DLNAServer struct {
+	// Name is the name players list the server under.
+	Name string
+	// Port is the HTTP port of the device description, ContentDirectory and files.
+	Port int
+	// UUID identifies the server to players across restarts.
+	UUID string
+}
+
+// NewDLNAServer returns the media server of a name and port. Its UUID is derived from
+// the host name and server name, so players recognise it after a restart.
+func NewDLNAServer(name string, port int) *DLNAServer {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	return &DLNAServer{
+		Name: name,
+		Port: port,
+		UUID: uuid.NewV5(uuid.NamespaceURL, "podgrab-dlna://"+hostname+"/"+name).String(),
+	}
+}
+
+// DLNAError is a failed UPnP action, reported to control points with its code.
+type DLNAError struct {
+	Code        int
+	Description string
+}
+
+func (e *DLNAError) Error() string {
+	return e.Description
+}
+
+// DLNASystemUpdateID returns the ContentDirectory SystemUpdateID, which changes
+// whenever an episode does.
+func DLNASystemUpdateID() (uint32, error) {
+	updated, err := db.GetLastPodcastItemUpdate()
+	if err != nil || updated.IsZero() {
+		return 0, err
+	}
+	return uint32(updated.Unix()), nil // #nosec G115 -- wraps in 2106, any change still shows
+}
+
+// BrowseDLNA answers a ContentDirectory Browse of an object, or of its children from
+// start. A count of 0 returns every child. URLs of files and images start with
+// baseURL. It returns the matches and their total number.
+//
+// The root holds a Podcasts and a Tags container. Podcasts are listed with their
+// downloaded episodes, and only when they have some.
+func BrowseDLNA(objectID string, metadata bool, start, count int, baseURL string) (*model.DIDLLite, int, error) {
+	result := &model.DIDLLite{
+		Xmlns:     "urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/",
+		XmlnsDC:   "http://purl.org/dc/elements/1.1/",
+		XmlnsUPnP: "urn:schemas-upnp-org:metadata-1-0/upnp/",
+		XmlnsDLNA: "urn:schemas-dlna-org:metadata-1-0/",
+	}
+	browser := &dlnaBrowser{baseURL: strings.TrimSuffix(baseURL, "/")}
+	if metadata {
+		container, item, err := browser.object(objectID)
+		if err != nil {
+			return nil, 0, err
+		}
+		if container != nil {
+			result.Containers = append(result.Containers, *container)
+		} else {
+			result.Items = append(result.Items, *item)
+		}
+		return result, 1, nil
+	}
+	containers, items, err := browser.children(objectID)
+	if err != nil {
+		return nil, 0, err
+	}
+	total := len(containers) + len(items)
+	start = min(max(start, 0), total)
+	end := total
+	if count > 0 {
+		end = min(start+count, total)
+	}
+	// Children are either all containers or all items.
+	if len(containers) > 0 {
+		result.Containers = containers[start:end]
+	} else {
+		result.Items = items[start:end]
+	}
+	return result, total, nil
+}
+
+// dlnaBrowser builds ContentDirectory objects, loading the downloaded episode counts
+// once per Browse.
+type dlnaBrowser struct {
+	baseURL    string
+	downloaded map[string]int
+}
+
+// downloadedCounts returns the number of downloaded episodes of each podcast.
+func (browser *dlnaBrowser) downloadedCounts() (map[string]int, error) {
+	if browser.downloaded != nil {
+		return browser.downloaded, nil
+	}
+	stats, err := db.GetPodcastEpisodeStats()
+	if err != nil {
+		return nil, err
+	}
+	browser.downloaded = make(map[string]int)
+	for _, stat := range *stats {
+		if stat.DownloadStatus == db.Downloaded {
+			browser.downloaded[stat.PodcastID] = stat.Count
+		}
+	}
+	return browser.downloaded, nil
+}
+
+// object returns the container or item of an ID, looked up among the children of its
+// parent so both are described the same way.
+func (browser *dlnaBrowser) object(objectID string) (*model.DIDLContainer, *model.DIDLItem, error) {
+	if objectID == dlnaRootID {
+		containers, _, err := browser.children(dlnaRootID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &model.DIDLContainer{
+			ID:         dlnaRootID,
+			ParentID:   "-1",
+			Restricted: 1,
+			ChildCount: len(containers),
+			Title:      "Podgrab",
+			Class:      "object.container.storageFolder",
+		}, nil, nil
+	}
+	parentID, err := browser.parentID(objectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	containers, items, err := browser.children(parentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range containers {
+		if containers[i].ID == objectID {
+			return &containers[i], nil, nil
+		}
+	}
+	for i := range items {
+		if items[i].ID == objectID {
+			return nil, &items[i], nil
+		}
+	}
+	return nil, nil, dlnaNoSuchObject(objectID)
+}
+
+// parentID returns the ID of the container holding an object.
+func (browser *dlnaBrowser) parentID(objectID string) (string, error) {
+	parts := strings.Split(objectID, "/")
+	switch {
+	case objectID == dlnaPodcastsID || objectID == dlnaTagsID:
+		return dlnaRootID, nil
+	case len(parts) == 2 && parts[0] == "podcast":
+		return dlnaPodcastsID, nil
+	case len(parts) == 2 && parts[0] == "tag":
+		return dlnaTagsID, nil
+	case len(parts) == 4 && parts[0] == "tag" && parts[2] == "podcast":
+		return "tag/" + parts[1], nil
+	case len(parts) == 2 && parts[0] == "episode":
+		var item db.PodcastItem
+		if err := db.GetPodcastItemByID(parts[1], &item); err != nil {
+			return "", dlnaLookupError(err, objectID)
+		}
+		return "podcast/" + item.PodcastID, nil
+	}
+	return "", dlnaNoSuchObject(objectID)
+}
+
+// children returns the containers or items in a container.
+func (browser *dlnaBrowser) children(objectID string) ([]model.DIDLContainer, []model.DIDLItem, error) {
+	parts := strings.Split(objectID, "/")
+	switch {
+	case objectID == dlnaRootID:
+		return browser.rootContainers()
+	case objectID == dlnaPodcastsID:
+		var podcasts []db.Podcast
+		if err := db.GetAllPodcasts(&podcasts, "title"); err != nil {
+			return nil, nil, err
+		}
+		containers, err := browser.podcastContainers(podcasts, dlnaPodcastsID, "")
+		return containers, nil, err
+	case objectID == dlnaTagsID:
+		containers, err := browser.tagContainers()
+		return containers, nil, err
+	case len(parts) == 2 && parts[0] == "tag":
+		tag, err := db.GetTagByID(parts[1])
+		if err != nil {
+			return nil, nil, dlnaLookupError(err, objectID)
+		}
+		podcasts := make([]db.Podcast, 0, len(tag.Podcasts))
+		for _, podcast := range tag.Podcasts {
+			podcasts = append(podcasts, *podcast)
+		}
+		slices.SortFunc(podcasts, func(a, b db.Podcast) int { return cmp.Compare(a.Title, b.Title) })
+		containers, err := browser.podcastContainers(podcasts, objectID, objectID+"/")
+		return containers, nil, err
+	case len(parts) == 2 && parts[0] == "podcast",
+		len(parts) == 4 && parts[0] == "tag" && parts[2] == "podcast":
+		items, err := browser.episodeItems(parts[len(parts)-1], objectID)
+		return nil, items, err
+	case len(parts) == 2 && parts[0] == "episode":
+		if _, err := browser.parentID(objectID); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, nil
+	}
+	return nil, nil, dlnaNoSuchObject(objectID)
+}
+
+// rootContainers returns the Podcasts and Tags containers.
+func (browser *dlnaBrowser) rootContainers() ([]model.DIDLContainer, []model.DIDLItem, error) {
+	podcasts, _, err := browser.children(dlnaPodcastsID)
+	if err != nil {
+		return nil, nil, err
+	}
+	tags, _, err := browser.children(dlnaTagsID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []model.DIDLContainer{
+		newDLNAFolder(dlnaPodcastsID, dlnaRootID, "Podcasts", len(podcasts)),
+		newDLNAFolder(dlnaTagsID, dlnaRootID, "Tags", len(tags)),
+	}, nil, nil
+}
+
+// tagContainers returns a container for each tag with downloaded episodes, by label.
+func (browser *dlnaBrowser) tagContainers() ([]model.DIDLContainer, error) {
+	tags, err := db.GetAllTags("label")
+	if err != nil {
+		return nil, err
+	}
+	counts, err := browser.downloadedCounts()
+	if err != nil {
+		return nil, err
+	}
+	var containers []model.DIDLContainer
+	for _, tag := range *tags {
+		podcasts := 0
+		for _, podcast := range tag.Podcasts {
+			if counts[podcast.ID] > 0 {
+				podcasts++
+			}
+		}
+		if podcasts > 0 {
+			container := newDLNAFolder("tag/"+tag.ID, dlnaTagsID, tag.Label, podcasts)
+			container.Description = tag.Description
+			containers = append(containers, container)
+		}
+	}
+	return containers, nil
+}
+
+// podcastContainers returns a container for each podcast with downloaded episodes.
+// Their IDs start with prefix, which makes the podcasts of a tag their own objects.
+func (browser *dlnaBrowser) podcastContainers(podcasts []db.Podcast, parentID, prefix string) ([]model.DIDLContainer, error) {
+	counts, err := browser.downloadedCounts()
+	if err != nil {
+		return nil, err
+	}
+	var containers []model.DIDLContainer
+	for i := range podcasts {
+		podcast := &podcasts[i]
+		if counts[podcast.ID] == 0 {
+			continue
+		}
+		container := newDLNAFolder(prefix+"podcast/"+podcast.ID, parentID, podcast.Title, counts[podcast.ID])
+		container.Class = "object.container.album.musicAlbum"
+		container.Description = podcast.Summary
+		container.Creator = podcast.Author
+		if podcast.Image != "" {
+			container.AlbumArtURI = browser.baseURL + "/dlna/images/podcasts/" + podcast.ID
+		}
+		containers = append(containers, container)
+	}
+	return containers, nil
+}
+
+// episodeItems returns an item for each downloaded episode of a podcast, newest first.
+func (browser *dlnaBrowser) episodeItems(podcastID, parentID string) ([]model.DIDLItem, error) {
+	var podcast db.Podcast
+	if err := db.GetPodcastByID(podcastID, &podcast); err != nil {
+		return nil, dlnaLookupError(err, parentID)
+	}
+	var episodes []db.PodcastItem
+	if err := db.GetDownloadedPodcastItemsByPodcastID(podcastID, &episodes); err != nil {
+		return nil, err
+	}
+	items := make([]model.DIDLItem, 0, len(episodes))
+	for i := range episodes {
+		items = append(items, browser.episodeItem(&episodes[i], &podcast, parentID))
+	}
+	return items, nil
+}
+
+// episodeItem returns the item of a downloaded episode, with the podcast as its album.
+func (browser *dlnaBrowser) episodeItem(episode *db.PodcastItem, podcast *db.Podcast, parentID string) model.DIDLItem {
+	contentType := EpisodeMediaType(episode)
+	item := model.DIDLItem{
+		ID:          "episode/" + episode.ID,
+		ParentID:    parentID,
+		Restricted:  1,
+		Title:       episode.Title,
+		Creator:     podcast.Author,
+		Description: episode.Summary,
+		Class:       "object.item.audioItem.musicTrack",
+		Album:       podcast.Title,
+		Artist:      podcast.Author,
+		Track:       episode.EpisodeNumber,
+		Resources: []model.DIDLResource{{
+			ProtocolInfo: DLNAProtocolInfo(contentType),
+			Size:         episode.FileSize,
+			Duration:     formatDLNADuration(episode.Duration),
+			URL:          browser.baseURL + "/dlna/media/" + episode.ID,
+		}},
+	}
+	if IsVideoType(contentType) {
+		item.Class = "object.item.videoItem"
+	}
+	if !episode.PubDate.IsZero() {
+		item.Date = episode.PubDate.Format("2006-01-02")
+	}
+	switch {
+	case episode.Image != "" || episode.LocalImage != "":
+		item.AlbumArtURI = browser.baseURL + "/dlna/images/episodes/" + episode.ID
+	case podcast.Image != "":
+		item.AlbumArtURI = browser.baseURL + "/dlna/images/podcasts/" + podcast.ID
+	}
+	return item
+}
+
+// DLNAProtocolInfo returns the protocolInfo of a file served over HTTP.
+func DLNAProtocolInfo(contentType string) string {
+	return "http-get:*:" + contentType + ":" + DLNAContentFeatures(contentType)
+}
+
+// DLNAContentFeatures returns the DLNA features of a file, naming the MP3 profile for
+// MP3 files.
+func DLNAContentFeatures(contentType string) string {
+	if contentType == "audio/mpeg" {
+		return "DLNA.ORG_PN=MP3;" + dlnaFlags
+	}
+	return dlnaFlags
+}
+
+// DLNASourceProtocolInfo returns the protocolInfo of every media type Podgrab may serve,
+// as ConnectionManager lists them.
+func DLNASourceProtocolInfo() string {
+	var types []string
+	for _, mimeType := range mediaTypes {
+		types = append(types, mimeType)
+	}
+	slices.Sort(types)
+	types = slices.Compact(types)
+	protocols := make([]string, 0, len(types))
+	for _, mimeType := range types {
+		protocols = append(protocols, DLNAProtocolInfo(mimeType))
+	}
+	return strings.Join(protocols, ",")
+}
+
+// newDLNAFolder returns a plain container.
+func newDLNAFolder(id, parentID, title string, childCount int) model.DIDLContainer {
+	return model.DIDLContainer{
+		ID:         id,
+		ParentID:   parentID,
+		Restricted: 1,
+		ChildCount: childCount,
+		Title:      title,
+		Class:      "object.container.storageFolder",
+	}
+}
+
+// formatDLNADuration formats seconds as H:MM:SS, or returns "" when unknown.
+func formatDLNADuration(seconds int) string {
+	if seconds <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+// dlnaNoSuchObject reports an object ID that does not exist.
+func dlnaNoSuchObject(objectID string) error {
+	return &DLNAError{DLNAErrorNoSuchObject, "No such object: " + objectID}
+}
+
+// dlnaLookupError reports a record that was not found as a missing object.
+func dlnaLookupError(err error, objectID string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return dlnaNoSuchObject(objectID)
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toozej/podgrab/db"
+	testhelpers "github.com/toozej/podgrab/internal/testing"
+)
+
+// TestBrowseDLNA tests the ContentDirectory tree of podcasts, tags and downloaded
+// episodes.
+func TestBrowseDLNA(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	podcast := db.CreateTestPodcast(t, database, &db.Podcast{Title: "Listened"})
+	db.CreateTestPodcast(t, database, &db.Podcast{Title: "Nothing downloaded"})
+	downloaded := db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{
+		Title:          "Downloaded",
+		DownloadPath:   "/assets/Listened/downloaded.mp3",
+		DownloadStatus: db.Downloaded,
+		Duration:       3725,
+	})
+	db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{Title: "Not downloaded"})
+	tag := db.CreateTestTag(t, database, "News")
+	require.NoError(t, db.AddTagToPodcast(podcast.ID, tag.ID))
+	const baseURL = "http://192.168.1.2:8200/"
+
+	root, total, err := BrowseDLNA("0", false, 0, 0, baseURL)
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	require.Len(t, root.Containers, 2)
+	assert.Equal(t, "podcasts", root.Containers[0].ID)
+	assert.Equal(t, 1, root.Containers[0].ChildCount, "Podcasts without downloads should be left out")
+
+	podcasts, _, err := BrowseDLNA("podcasts", false, 0, 0, baseURL)
+	require.NoError(t, err)
+	require.Len(t, podcasts.Containers, 1)
+	assert.Equal(t, "podcast/"+podcast.ID, podcasts.Containers[0].ID)
+	assert.Equal(t, "http://192.168.1.2:8200/dlna/images/podcasts/"+podcast.ID, podcasts.Containers[0].AlbumArtURI)
+
+	episodes, total, err := BrowseDLNA("podcast/"+podcast.ID, false, 0, 0, baseURL)
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	require.Len(t, episodes.Items, 1)
+	item := episodes.Items[0]
+	assert.Equal(t, "episode/"+downloaded.ID, item.ID)
+	assert.Equal(t, "Listened", item.Album)
+	assert.Equal(t, "object.item.audioItem.musicTrack", item.Class)
+	require.Len(t, item.Resources, 1)
+	assert.Equal(t, "http://192.168.1.2:8200/dlna/media/"+downloaded.ID, item.Resources[0].URL)
+	assert.Equal(t, "1:02:05", item.Resources[0].Duration)
+	assert.Contains(t, item.Resources[0].ProtocolInfo, "http-get:*:audio/mpeg:DLNA.ORG_PN=MP3;")
+
+	tagged, _, err := BrowseDLNA("tag/"+tag.ID, false, 0, 0, baseURL)
+	require.NoError(t, err)
+	require.Len(t, tagged.Containers, 1)
+	assert.Equal(t, "tag/"+tag.ID+"/podcast/"+podcast.ID, tagged.Containers[0].ID)
+	episodes, _, err = BrowseDLNA(tagged.Containers[0].ID, false, 0, 0, baseURL)
+	require.NoError(t, err)
+	require.Len(t, episodes.Items, 1)
+	assert.Equal(t, tagged.Containers[0].ID, episodes.Items[0].ParentID)
+
+	metadata, total, err := BrowseDLNA("episode/"+downloaded.ID, true, 0, 0, baseURL)
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	require.Len(t, metadata.Items, 1)
+	assert.Equal(t, "podcast/"+podcast.ID, metadata.Items[0].ParentID)
+	metadata, _, err = BrowseDLNA("0", true, 0, 0, baseURL)
+	require.NoError(t, err)
+	require.Len(t, metadata.Containers, 1)
+	assert.Equal(t, "-1", metadata.Containers[0].ParentID)
+
+	page, total, err := BrowseDLNA("0", false, 1, 5, baseURL)
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	require.Len(t, page.Containers, 1)
+	assert.Equal(t, "tags", page.Containers[0].ID)
+
+	for _, objectID := range []string{"podcast/missing", "episode/missing", "tag/missing", "nonsense"} {
+		_, _, err := BrowseDLNA(objectID, true, 0, 0, baseURL)
+		var dlnaErr *DLNAError
+		require.True(t, errors.As(err, &dlnaErr), "%s: %v", objectID, err)
+		assert.Equal(t, DLNAErrorNoSuchObject, dlnaErr.Code)
+	}
+}
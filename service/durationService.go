@@ -0,0 +1,367 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/toozej/podgrab/internal/logger"
+)
+
+// errUnsupportedMedia is returned for media files whose duration cannot be read.
+var errUnsupportedMedia = errors.New("unsupported media format")
+
+// parseDuration parses an itunes:duration value into seconds. It accepts plain or
+// fractional seconds, MM:SS, HH:MM:SS and Go style durations such as 1h2m3s.
+func parseDuration(durationStr string) int {
+	value := strings.TrimSpace(durationStr)
+	if value == "" {
+		return 0
+	}
+
+	if strings.Contains(value, ":") {
+		parts := strings.Split(value, ":")
+		if len(parts) > 3 {
+			logger.Log.Warnw("parsing duration", "duration", durationStr)
+			return 0
+		}
+		total := 0.0
+		for i, part := range parts {
+			number, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil || number < 0 || (i > 0 && number >= 60) {
+				logger.Log.Warnw("parsing duration", "duration", durationStr)
+				return 0
+			}
+			total = total*60 + number
+		}
+		return int(math.Round(total))
+	}
+
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		return int(math.Round(seconds))
+	}
+	if parsed, err := time.ParseDuration(strings.ToLower(strings.ReplaceAll(value, " ", ""))); err == nil && parsed >= 0 {
+		return int(math.Round(parsed.Seconds()))
+	}
+	logger.Log.Warnw("parsing duration", "duration", durationStr)
+	return 0
+}
+
+// MediaDuration reads the playing time in seconds of a downloaded MP3 or MP4 file from
+// its headers.
+func MediaDuration(filePath string) (int, error) {
+	file, err := os.Open(filePath) // #nosec G304 -- filePath is a download path managed by the application
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Log.Errorw("closing file", "error", err)
+		}
+	}()
+
+	var seconds float64
+	switch MediaTypeForPath(filePath) {
+	case "audio/mpeg":
+		seconds, err = mp3Duration(file)
+	case "audio/mp4", "video/mp4", "video/x-m4v", "video/quicktime":
+		seconds, err = mp4Duration(file)
+	default:
+		return 0, errUnsupportedMedia
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int(math.Round(seconds)), nil
+}
+
+// mp3Frame is a parsed MPEG audio frame header.
+type mp3Frame struct {
+	version         int // 1, 2 or 25 for MPEG 2.5
+	layer           int
+	bitrate         int // bit/s
+	sampleRate      int
+	padding         int
+	mono            bool
+	samplesPerFrame int
+}
+
+var mp3Bitrates = map[[2]int][16]int{
+	{1, 1}: {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, -1},
+	{1, 2}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, -1},
+	{1, 3}: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, -1},
+	{2, 1}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, -1},
+	{2, 2}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, -1},
+	{2, 3}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, -1},
+}
+
+var mp3SampleRates = map[int][3]int{
+	1:  {44100, 48000, 32000},
+	2:  {22050, 24000, 16000},
+	25: {11025, 12000, 8000},
+}
+
+// parseMP3Frame parses a 4 byte MPEG audio frame header.
+func parseMP3Frame(header []byte) (mp3Frame, bool) {
+	if len(header) < 4 || header[0] != 0xFF || header[1]&0xE0 != 0xE0 {
+		return mp3Frame{}, false
+	}
+	var frame mp3Frame
+	switch (header[1] >> 3) & 0x03 {
+	case 0:
+		frame.version = 25
+	case 2:
+		frame.version = 2
+	case 3:
+		frame.version = 1
+	default:
+		return mp3Frame{}, false
+	}
+	frame.layer = 4 - int((header[1]>>1)&0x03)
+	if frame.layer == 4 {
+		return mp3Frame{}, false
+	}
+
+	tableVersion := frame.version
+	if tableVersion == 25 {
+		tableVersion = 2
+	}
+	bitrate := mp3Bitrates[[2]int{tableVersion, frame.layer}][header[2]>>4]
+	sampleIndex := (header[2] >> 2) & 0x03
+	if bitrate <= 0 || sampleIndex == 3 {
+		return mp3Frame{}, false
+	}
+	frame.bitrate = bitrate * 1000
+	frame.sampleRate = mp3SampleRates[frame.version][sampleIndex]
+	frame.padding = int((header[2] >> 1) & 0x01)
+	frame.mono = header[3]>>6 == 3
+
+	switch {
+	case frame.layer == 1:
+		frame.samplesPerFrame = 384
+	case frame.layer == 3 && frame.version != 1:
+		frame.samplesPerFrame = 576
+	default:
+		frame.samplesPerFrame = 1152
+	}
+	return frame, true
+}
+
+// size returns the length of the frame in bytes, header included.
+func (frame mp3Frame) size() int {
+	if frame.layer == 1 {
+		return (12*frame.bitrate/frame.sampleRate + frame.padding) * 4
+	}
+	return frame.samplesPerFrame/8*frame.bitrate/frame.sampleRate + frame.padding
+}
+
+// sideInfoSize returns the length of the Layer III side information after the header.
+func (frame mp3Frame) sideInfoSize() int {
+	switch {
+	case frame.version == 1 && frame.mono:
+		return 17
+	case frame.version == 1:
+		return 32
+	case frame.mono:
+		return 9
+	default:
+		return 17
+	}
+}
+
+// mp3Duration reads the duration of an MP3 stream from its Xing/Info or VBRI header,
+// or by adding up the frames when there is neither.
+func mp3Duration(reader io.Reader) (float64, error) {
+	buffered := bufio.NewReaderSize(reader, 64*1024)
+	if err := skipID3v2(buffered); err != nil {
+		return 0, err
+	}
+
+	frame, err := syncMP3Frame(buffered)
+	if err != nil {
+		return 0, err
+	}
+
+	// The first frame of a VBR file carries the frame count instead of audio.
+	first, _ := buffered.Peek(frame.size()) //nolint:errcheck // a short first frame simply has no VBR header
+	if frames := mp3HeaderFrameCount(first, frame); frames > 0 {
+		return float64(frames) * float64(frame.samplesPerFrame) / float64(frame.sampleRate), nil
+	}
+
+	var samples float64
+	for {
+		frameSize := frame.size()
+		if frameSize < 4 {
+			break
+		}
+		if _, err := buffered.Discard(frameSize); err != nil {
+			// A truncated last frame still plays.
+			samples += float64(frame.samplesPerFrame) / float64(frame.sampleRate)
+			break
+		}
+		samples += float64(frame.samplesPerFrame) / float64(frame.sampleRate)
+
+		header, err := buffered.Peek(4)
+		if err != nil {
+			break
+		}
+		next, ok := parseMP3Frame(header)
+		if !ok {
+			// Trailing ID3v1 or APE tags end the audio.
+			break
+		}
+		frame = next
+	}
+	return samples, nil
+}
+
+// skipID3v2 discards an ID3v2 tag at the start of the stream.
+func skipID3v2(reader *bufio.Reader) error {
+	header, err := reader.Peek(10)
+	if err != nil || !bytes.Equal(header[:3], []byte("ID3")) {
+		return nil
+	}
+	size := int(header[6]&0x7F)<<21 | int(header[7]&0x7F)<<14 | int(header[8]&0x7F)<<7 | int(header[9]&0x7F)
+	size += 10
+	if header[5]&0x10 != 0 {
+		size += 10
+	}
+	_, err = reader.Discard(size)
+	return err
+}
+
+// syncMP3Frame skips to the first of two consecutive valid frame headers.
+func syncMP3Frame(reader *bufio.Reader) (mp3Frame, error) {
+	const maxSkip = 1 << 20
+	for skipped := 0; skipped < maxSkip; skipped++ {
+		header, err := reader.Peek(4)
+		if err != nil {
+			return mp3Frame{}, errUnsupportedMedia
+		}
+		if frame, ok := parseMP3Frame(header); ok {
+			// Confirm the sync with the following header when it is buffered.
+			following, peekErr := reader.Peek(frame.size() + 4)
+			if peekErr != nil {
+				return frame, nil
+			}
+			if _, ok := parseMP3Frame(following[frame.size():]); ok {
+				return frame, nil
+			}
+		}
+		if _, err := reader.Discard(1); err != nil {
+			return mp3Frame{}, errUnsupportedMedia
+		}
+	}
+	return mp3Frame{}, errUnsupportedMedia
+}
+
+// mp3HeaderFrameCount returns the frame count of a Xing/Info or VBRI header in the
+// given first frame, or 0 when it has none.
+func mp3HeaderFrameCount(data []byte, frame mp3Frame) int {
+	xingOffset := 4 + frame.sideInfoSize()
+	if len(data) >= xingOffset+12 {
+		tag := string(data[xingOffset : xingOffset+4])
+		if tag == "Xing" || tag == "Info" {
+			flags := binary.BigEndian.Uint32(data[xingOffset+4:])
+			if flags&0x01 != 0 {
+				return int(binary.BigEndian.Uint32(data[xingOffset+8:]))
+			}
+			return 0
+		}
+	}
+	const vbriOffset = 4 + 32
+	if len(data) >= vbriOffset+18 && string(data[vbriOffset:vbriOffset+4]) == "VBRI" {
+		return int(binary.BigEndian.Uint32(data[vbriOffset+14:]))
+	}
+	return 0
+}
+
+// mp4Duration reads the duration of an MP4 or QuickTime file from its mvhd box.
+func mp4Duration(reader io.ReadSeeker) (float64, error) {
+	end, err := reader.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	moovStart, moovEnd, err := findMP4Box(reader, 0, end, "moov")
+	if err != nil {
+		return 0, err
+	}
+	mvhdStart, _, err := findMP4Box(reader, moovStart, moovEnd, "mvhd")
+	if err != nil {
+		return 0, err
+	}
+	if _, err := reader.Seek(mvhdStart, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	header := make([]byte, 32)
+	if _, err := io.ReadFull(reader, header[:1]); err != nil {
+		return 0, err
+	}
+	var timescale uint32
+	var duration uint64
+	if header[0] == 1 {
+		// version, flags, creation and modification times are 64 bit.
+		if _, err := io.ReadFull(reader, header[1:32]); err != nil {
+			return 0, err
+		}
+		timescale = binary.BigEndian.Uint32(header[20:])
+		duration = binary.BigEndian.Uint64(header[24:])
+	} else {
+		if _, err := io.ReadFull(reader, header[1:20]); err != nil {
+			return 0, err
+		}
+		timescale = binary.BigEndian.Uint32(header[12:])
+		duration = uint64(binary.BigEndian.Uint32(header[16:]))
+	}
+	if timescale == 0 {
+		return 0, errUnsupportedMedia
+	}
+	return float64(duration) / float64(timescale), nil
+}
+
+// findMP4Box returns the payload bounds of the first box of the given type between
+// start and end.
+func findMP4Box(reader io.ReadSeeker, start, end int64, boxType string) (payloadStart, payloadEnd int64, err error) {
+	header := make([]byte, 16)
+	for offset := start; offset+8 <= end; {
+		if _, err := reader.Seek(offset, io.SeekStart); err != nil {
+			return 0, 0, err
+		}
+		if _, err := io.ReadFull(reader, header[:8]); err != nil {
+			return 0, 0, err
+		}
+		size := int64(binary.BigEndian.Uint32(header))
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			size = end - offset
+		case 1:
+			if _, err := io.ReadFull(reader, header[8:16]); err != nil {
+				return 0, 0, err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:])) // #nosec G115 -- validated against end below
+			headerSize = 16
+		}
+		if size < headerSize || offset+size > end {
+			return 0, 0, errUnsupportedMedia
+		}
+		if string(header[4:8]) == boxType {
+			return offset + headerSize, offset + size, nil
+		}
+		offset += size
+	}
+	return 0, 0, errUnsupportedMedia
+}
@@ -0,0 +1,162 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toozej/podgrab/db"
+	testhelpers "github.com/toozej/podgrab/internal/testing"
+)
+
+// mp3FrameHeader is an MPEG-1 Layer III, 128 kbit/s, 44.1 kHz stereo frame header.
+var mp3FrameHeader = []byte{0xFF, 0xFB, 0x90, 0x00}
+
+// mp3FrameSize is the length of a frame with mp3FrameHeader.
+const mp3FrameSize = 417
+
+// testMP3 builds an MP3 stream with an ID3v2 tag, an optional first frame and audio frames.
+func testMP3(first []byte, frames int) []byte {
+	var buffer bytes.Buffer
+	buffer.Write([]byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 20})
+	buffer.Write(make([]byte, 20))
+	if first != nil {
+		buffer.Write(first)
+	}
+	frame := make([]byte, mp3FrameSize)
+	copy(frame, mp3FrameHeader)
+	for i := 0; i < frames; i++ {
+		buffer.Write(frame)
+	}
+	buffer.WriteString("TAG")
+	buffer.Write(make([]byte, 125))
+	return buffer.Bytes()
+}
+
+// vbrFrame builds a first frame carrying a VBR header with the given tag at offset.
+func vbrFrame(tag string, offset, countOffset int, frames uint32) []byte {
+	frame := make([]byte, mp3FrameSize)
+	copy(frame, mp3FrameHeader)
+	copy(frame[offset:], tag)
+	if tag == "Xing" {
+		binary.BigEndian.PutUint32(frame[offset+4:], 0x01)
+	}
+	binary.BigEndian.PutUint32(frame[offset+countOffset:], frames)
+	return frame
+}
+
+// testMP4 builds an MP4 file whose mvhd box has the given version, timescale and duration.
+func testMP4(version byte, timescale uint32, duration uint64) []byte {
+	box := func(boxType string, payload []byte) []byte {
+		header := make([]byte, 8)
+		binary.BigEndian.PutUint32(header, uint32(8+len(payload))) // #nosec G115 -- small test boxes
+		copy(header[4:], boxType)
+		return append(header, payload...)
+	}
+	var mvhd []byte
+	if version == 1 {
+		mvhd = make([]byte, 32)
+		binary.BigEndian.PutUint32(mvhd[20:], timescale)
+		binary.BigEndian.PutUint64(mvhd[24:], duration)
+	} else {
+		mvhd = make([]byte, 20)
+		binary.BigEndian.PutUint32(mvhd[12:], timescale)
+		binary.BigEndian.PutUint32(mvhd[16:], uint32(duration)) // #nosec G115 -- test durations fit
+	}
+	mvhd[0] = version
+	mvhd = append(mvhd, make([]byte, 80)...)
+
+	var file []byte
+	file = append(file, box("ftyp", []byte("isom\x00\x00\x02\x00isomiso2mp41"))...)
+	file = append(file, box("free", make([]byte, 16))...)
+	file = append(file, box("moov", append(box("udta", make([]byte, 8)), box("mvhd", mvhd)...))...)
+	file = append(file, box("mdat", make([]byte, 64))...)
+	return file
+}
+
+// TestParseDuration tests the itunes:duration formats.
+func TestParseDuration(t *testing.T) {
+	tests := map[string]int{
+		"":          0,
+		"3600":      3600,
+		" 90.4 ":    90,
+		"45:30":     2730,
+		"01:02:03":  3723,
+		"1:02:03.5": 3724,
+		"0:00:59":   59,
+		"1h2m3s":    3723,
+		"1:75":      0,
+		"1:2:3:4":   0,
+		"unknown":   0,
+		"-5":        0,
+	}
+	for value, want := range tests {
+		assert.Equal(t, want, parseDuration(value), "duration %q", value)
+	}
+}
+
+// TestMediaDuration tests reading the duration from MP3 and MP4 headers.
+func TestMediaDuration(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		file    string
+		content []byte
+		want    int
+	}{
+		{name: "mp3_frame_scan", file: "cbr.mp3", content: testMP3(nil, 1000), want: 26},
+		{name: "mp3_xing", file: "xing.mp3", content: testMP3(vbrFrame("Xing", 36, 8, 10000), 3), want: 261},
+		{name: "mp3_vbri", file: "vbri.mp3", content: testMP3(vbrFrame("VBRI", 36, 14, 5000), 3), want: 131},
+		{name: "mp4_mvhd", file: "episode.m4a", content: testMP4(0, 1000, 1234567), want: 1235},
+		{name: "mp4_mvhd_64bit", file: "episode.mp4", content: testMP4(1, 44100, 44100*5400), want: 5400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(dir, tt.file)
+			require.NoError(t, os.WriteFile(filePath, tt.content, 0o600))
+			duration, err := MediaDuration(filePath)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, duration)
+		})
+	}
+
+	notes := filepath.Join(dir, "notes.txt")
+	require.NoError(t, os.WriteFile(notes, []byte("text"), 0o600))
+	_, err := MediaDuration(notes)
+	assert.Error(t, err)
+
+	broken := filepath.Join(dir, "broken.mp4")
+	require.NoError(t, os.WriteFile(broken, []byte("not an mp4 file"), 0o600))
+	_, err = MediaDuration(broken)
+	assert.Error(t, err)
+}
+
+// TestSetPodcastItemAsDownloaded_MeasuresDuration tests that the measured duration replaces the feed one.
+func TestSetPodcastItemAsDownloaded_MeasuresDuration(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	dataDir, dataCleanup := testhelpers.SetupTestDataDir(t)
+	defer dataCleanup()
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	podcast := db.CreateTestPodcast(t, database)
+	item := db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{Duration: 999})
+	filePath := filepath.Join(dataDir, "episode.mp3")
+	require.NoError(t, os.WriteFile(filePath, testMP3(nil, 1000), 0o600))
+
+	require.NoError(t, SetPodcastItemAsDownloaded(item.ID, filePath))
+
+	var stored db.PodcastItem
+	require.NoError(t, db.GetPodcastItemByID(item.ID, &stored))
+	assert.Equal(t, 26, stored.Duration)
+	assert.Equal(t, db.Downloaded, stored.DownloadStatus)
+}
@@ -0,0 +1,231 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// ErrEgressBlocked is returned for requests the egress policy does not allow.
+var ErrEgressBlocked = errors.New("blocked by egress policy")
+
+// defaultMaxRedirects is the number of redirects followed when the settings leave it unset.
+const defaultMaxRedirects = 10
+
+// reservedNetworks are ranges beyond the loopback, private, link-local and multicast
+// ones that never hold public hosts.
+var reservedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",      // "this" network
+	"100.64.0.0/10",  // carrier-grade NAT
+	"192.0.0.0/24",   // IETF protocol assignments
+	"198.18.0.0/15",  // benchmarking
+	"240.0.0.0/4",    // reserved and broadcast
+	"64:ff9b:1::/48", // local-use IPv4/IPv6 translation
+	"fec0::/10",      // deprecated site-local
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// isInternalIP reports whether an address is loopback, private, link-local, multicast
+// or otherwise reserved rather than a public host.
+func isInternalIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// egressPolicy decides which addresses outbound requests may connect to.
+type egressPolicy struct {
+	blockInternal bool
+	// hosts are allowed names; entries starting with a dot allow the subdomains of a name.
+	hosts    []string
+	networks []*net.IPNet
+	// proxies holds the addresses of trusted proxies in use, which are dialed without
+	// checks.
+	proxies sync.Map
+}
+
+// newEgressPolicy returns the policy for the settings. The allowlist lists host names,
+// "*.domain" wildcards, IP addresses and CIDR ranges, one per line.
+func newEgressPolicy(blockInternal bool, allowlist string) (*egressPolicy, error) {
+	policy := &egressPolicy{blockInternal: blockInternal}
+	scanner := bufio.NewScanner(strings.NewReader(allowlist))
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			policy.networks = append(policy.networks, network)
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			policy.networks = append(policy.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		host := strings.TrimPrefix(entry, "*")
+		if strings.ContainsAny(host, " /:@") || strings.Trim(host, ".") == "" {
+			return nil, fmt.Errorf("egress allowlist line %d: invalid entry %q", line, entry)
+		}
+		policy.hosts = append(policy.hosts, host)
+	}
+	return policy, scanner.Err()
+}
+
+// allowsHost reports whether a host name is allowlisted, or nothing is blocked.
+func (policy *egressPolicy) allowsHost(host string) bool {
+	if !policy.blockInternal {
+		return true
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, entry := range policy.hosts {
+		if host == entry || (strings.HasPrefix(entry, ".") && strings.HasSuffix(host, entry)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIP returns an error when the policy blocks connecting to an address.
+func (policy *egressPolicy) checkIP(host string, ip net.IP) error {
+	if !policy.blockInternal {
+		return nil
+	}
+	for _, network := range policy.networks {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+	if isInternalIP(ip) {
+		if host == ip.String() {
+			return fmt.Errorf("%w: %s is an internal address", ErrEgressBlocked, ip)
+		}
+		return fmt.Errorf("%w: %s resolves to internal address %s", ErrEgressBlocked, host, ip)
+	}
+	return nil
+}
+
+// dialCheck returns the check for the addresses of a dialed host, or nil when the host
+// is allowed without looking at its addresses.
+func (policy *egressPolicy) dialCheck(address string) func(host string, ip net.IP) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil || policy.allowsHost(host) {
+		return nil
+	}
+	if _, isProxy := policy.proxies.Load(address); isProxy {
+		return nil
+	}
+	return policy.checkIP
+}
+
+// guardProxy wraps a proxy selection so proxied requests are checked against the
+// policy before they reach the proxy. Only trusted proxies, the ones admins set in the
+// settings or the environment, may be internal; others are checked like any host.
+// Names the local resolver cannot find are blocked unless allowlisted.
+func (policy *egressPolicy) guardProxy(proxy func(*http.Request) (*url.URL, error), trusted bool) func(*http.Request) (*url.URL, error) {
+	if proxy == nil || !policy.blockInternal {
+		return proxy
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		proxyURL, err := proxy(req)
+		if err != nil || proxyURL == nil {
+			return proxyURL, err
+		}
+		if trusted {
+			policy.proxies.Store(proxyAddress(proxyURL), true)
+		} else if err := policy.checkHost(req.Context(), proxyURL.Hostname()); err != nil {
+			return nil, err
+		}
+		if err := policy.checkHost(req.Context(), req.URL.Hostname()); err != nil {
+			return nil, err
+		}
+		return proxyURL, nil
+	}
+}
+
+// checkHost resolves a host that is not allowlisted and returns an error when the
+// policy blocks one of its addresses or the host cannot be resolved.
+func (policy *egressPolicy) checkHost(ctx context.Context, host string) error {
+	if policy.allowsHost(host) {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return policy.checkIP(host, ip)
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%w: cannot resolve %s: %w", ErrEgressBlocked, host, err)
+	}
+	for _, addr := range addrs {
+		if err := policy.checkIP(host, addr.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// proxyAddress returns the host and port the transport dials for a proxy.
+func proxyAddress(proxyURL *url.URL) string {
+	port := proxyURL.Port()
+	if port == "" {
+		switch proxyURL.Scheme {
+		case "https":
+			port = "443"
+		case "socks5", "socks5h":
+			port = "1080"
+		default:
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(proxyURL.Hostname(), port)
+}
+
+// allowedAddrs resolves a host and returns the addresses the check allows. It fails
+// with the check's error when none is allowed.
+func allowedAddrs(ctx context.Context, host string, check func(string, net.IP) error) ([]net.IPAddr, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || check == nil {
+		return addrs, err
+	}
+	allowed := addrs[:0]
+	var checkErr error
+	for _, addr := range addrs {
+		if err := check(host, addr.IP); err != nil {
+			checkErr = err
+			continue
+		}
+		allowed = append(allowed, addr)
+	}
+	if len(allowed) == 0 && checkErr != nil {
+		return nil, checkErr
+	}
+	return allowed, nil
+}
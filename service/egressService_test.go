@@ -0,0 +1,216 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toozej/podgrab/db"
+	testhelpers "github.com/toozej/podgrab/internal/testing"
+)
+
+// TestIsInternalIP tests the address ranges the egress policy blocks.
+func TestIsInternalIP(t *testing.T) {
+	internal := []string{
+		"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1",
+		"0.0.0.0", "255.255.255.255", "224.0.0.1", "::1", "fe80::1", "fd00::1", "::", "::ffff:127.0.0.1",
+	}
+	for _, address := range internal {
+		assert.True(t, isInternalIP(net.ParseIP(address)), "address %s", address)
+	}
+	for _, address := range []string{"93.184.216.34", "8.8.8.8", "2606:4700:4700::1111"} {
+		assert.False(t, isInternalIP(net.ParseIP(address)), "address %s", address)
+	}
+}
+
+// TestEgressPolicy tests the allowlist entries.
+func TestEgressPolicy(t *testing.T) {
+	policy, err := newEgressPolicy(true, "nas.lan\n*.home.arpa\n# comment\n192.168.1.0/24\n10.0.0.5")
+	require.NoError(t, err)
+
+	assert.True(t, policy.allowsHost("NAS.lan"))
+	assert.True(t, policy.allowsHost("feeds.home.arpa"))
+	assert.False(t, policy.allowsHost("home.arpa"))
+	assert.False(t, policy.allowsHost("other.lan"))
+
+	assert.NoError(t, policy.checkIP("printer", net.ParseIP("192.168.1.20")))
+	assert.NoError(t, policy.checkIP("box", net.ParseIP("10.0.0.5")))
+	assert.ErrorIs(t, policy.checkIP("box", net.ParseIP("10.0.0.6")), ErrEgressBlocked)
+	assert.ErrorIs(t, policy.checkIP("metadata", net.ParseIP("169.254.169.254")), ErrEgressBlocked)
+	assert.NoError(t, policy.checkIP("example.com", net.ParseIP("93.184.216.34")))
+
+	disabled, err := newEgressPolicy(false, "")
+	require.NoError(t, err)
+	assert.NoError(t, disabled.checkIP("localhost", net.ParseIP("127.0.0.1")))
+
+	for _, invalid := range []string{"host:8080", "user@host", "*", "http://host/feed"} {
+		_, err := newEgressPolicy(true, invalid)
+		assert.Error(t, err, "entry %q", invalid)
+	}
+}
+
+// TestEgressGuard tests that requests to internal addresses are blocked, also after redirects.
+func TestEgressGuard(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	_, dataCleanup := testhelpers.SetupTestDataDir(t)
+	defer dataCleanup()
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	feed := testhelpers.CreateMockRSSHandler(testhelpers.ValidRSSFeed)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+			return
+		}
+		feed.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	localhostURL := "http://localhost:" + serverURL.Port()
+
+	setting := db.CreateTestSetting(t, database)
+	setting.BlockPrivateNetworks = true
+	require.NoError(t, db.UpdateSettings(setting))
+
+	_, err = makeFeedQuery(server.URL+"/feed.xml", nil)
+	assert.ErrorIs(t, err, ErrEgressBlocked)
+	_, err = Download(server.URL+"/episode.mp3", "Episode", "Guarded", "episode", "", nil)
+	assert.ErrorIs(t, err, ErrEgressBlocked)
+
+	setting.EgressAllowlist = "localhost"
+	require.NoError(t, db.UpdateSettings(setting))
+
+	fetched, err := makeFeedQuery(localhostURL+"/feed.xml", nil)
+	require.NoError(t, err, "Should allow allowlisted hosts")
+	assert.Contains(t, string(fetched.body), "Test Podcast")
+
+	_, err = makeFeedQuery(localhostURL+"/redirect?to="+url.QueryEscape(server.URL+"/feed.xml"), nil)
+	assert.ErrorIs(t, err, ErrEgressBlocked, "Should check every redirect hop")
+
+	setting.EgressAllowlist = "127.0.0.0/8"
+	require.NoError(t, db.UpdateSettings(setting))
+	_, err = makeFeedQuery(server.URL+"/feed.xml", nil)
+	assert.NoError(t, err, "Should allow allowlisted ranges")
+}
+
+// TestEgressGuard_Proxy tests that proxied requests are checked before reaching the proxy.
+func TestEgressGuard_Proxy(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	var proxied atomic.Int32
+	feed := testhelpers.CreateMockRSSHandler(testhelpers.ValidRSSFeed)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Add(1)
+		feed.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+
+	setting := db.CreateTestSetting(t, database)
+	setting.BlockPrivateNetworks = true
+	setting.ProxyURL = proxy.URL
+	require.NoError(t, db.UpdateSettings(setting))
+
+	_, err := makeFeedQuery("http://169.254.169.254/latest/meta-data/", nil)
+	assert.ErrorIs(t, err, ErrEgressBlocked)
+	assert.Zero(t, proxied.Load(), "Should not send blocked requests to the proxy")
+
+	_, err = makeFeedQuery("http://feeds.invalid/feed.xml", nil)
+	assert.ErrorIs(t, err, ErrEgressBlocked, "Should block names the local resolver cannot find")
+	assert.Zero(t, proxied.Load())
+
+	setting.EgressAllowlist = "feeds.invalid"
+	require.NoError(t, db.UpdateSettings(setting))
+	_, err = makeFeedQuery("http://feeds.invalid/feed.xml", nil)
+	assert.NoError(t, err, "Should leave allowlisted names to the proxy")
+	assert.Equal(t, int32(1), proxied.Load())
+}
+
+// TestEgressGuard_PodcastProxy tests that podcast proxies are checked like any host,
+// unlike the proxy of the settings.
+func TestEgressGuard_PodcastProxy(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	var proxied atomic.Int32
+	feed := testhelpers.CreateMockRSSHandler(testhelpers.ValidRSSFeed)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Add(1)
+		feed.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+
+	setting := db.CreateTestSetting(t, database)
+	setting.BlockPrivateNetworks = true
+	require.NoError(t, db.UpdateSettings(setting))
+	podcast := db.CreateTestPodcast(t, database)
+	podcast.ProxyURL = proxy.URL
+
+	_, err := makeFeedQuery("http://93.184.216.34/feed.xml", podcastRequestOptions(podcast, false))
+	assert.ErrorIs(t, err, ErrEgressBlocked, "Should block internal podcast proxies")
+	podcast.ProxyURL = "http://169.254.169.254:80"
+	_, err = makeFeedQuery("http://93.184.216.34/feed.xml", podcastRequestOptions(podcast, false))
+	assert.ErrorIs(t, err, ErrEgressBlocked)
+	assert.Zero(t, proxied.Load())
+
+	podcast.ProxyURL = proxy.URL
+	setting.EgressAllowlist = "127.0.0.1"
+	require.NoError(t, db.UpdateSettings(setting))
+	_, err = makeFeedQuery("http://93.184.216.34/feed.xml", podcastRequestOptions(podcast, false))
+	assert.NoError(t, err, "Should allow allowlisted podcast proxies")
+	assert.Equal(t, int32(1), proxied.Load())
+
+	setting.EgressAllowlist = ""
+	setting.ProxyURL = proxy.URL
+	require.NoError(t, db.UpdateSettings(setting))
+	_, err = makeFeedQuery("http://93.184.216.34/feed.xml", podcastRequestOptions(podcast, false))
+	assert.NoError(t, err, "Should trust a podcast proxy that is the proxy of the settings")
+	assert.Equal(t, int32(2), proxied.Load())
+}
+
+// TestRedirectLimit tests that redirects stop at the configured limit.
+func TestRedirectLimit(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	}))
+	defer server.Close()
+
+	setting := db.CreateTestSetting(t, database)
+	setting.MaxRedirects = 3
+	require.NoError(t, db.UpdateSettings(setting))
+
+	_, err := makeFeedQuery(server.URL+"/start", nil)
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "stopped after 3 redirects"), err.Error())
+	assert.Equal(t, int32(3), requests.Load())
+}
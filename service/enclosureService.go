@@ -0,0 +1,186 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/internal/logger"
+	"github.com/toozej/podgrab/model"
+)
+
+// feedItemEnclosures converts the media versions of a feed entry into stored enclosures.
+// Entries with a single version return nil so only episodes with a choice store rows.
+func feedItemEnclosures(obj *model.FeedItem) []db.PodcastItemEnclosure {
+	if len(obj.Alternates) == 0 || obj.Enclosure.URL == "" {
+		return nil
+	}
+	enclosures := []db.PodcastItemEnclosure{toPodcastItemEnclosure(&obj.Enclosure, true)}
+	for i := range obj.Alternates {
+		enclosures = append(enclosures, toPodcastItemEnclosure(&obj.Alternates[i], false))
+	}
+	return enclosures
+}
+
+func toPodcastItemEnclosure(enclosure *model.FeedEnclosure, isDefault bool) db.PodcastItemEnclosure {
+	return db.PodcastItemEnclosure{
+		URL:       enclosure.URL,
+		Type:      enclosure.Type,
+		Length:    parseEnclosureLength(enclosure.Length),
+		Bitrate:   parseBitrate(enclosure.Bitrate),
+		Codecs:    enclosure.Codecs,
+		IsDefault: isDefault,
+	}
+}
+
+// parseBitrate parses a bitrate in kbit/s, returning 0 when it is missing or invalid.
+func parseBitrate(value string) int {
+	bitrate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || bitrate <= 0 {
+		return 0
+	}
+	return int(bitrate + 0.5)
+}
+
+// syncPodcastItemEnclosures stores the media versions the feed currently offers for a
+// known episode when they differ from the stored ones.
+func syncPodcastItemEnclosures(item *db.PodcastItem, enclosures []db.PodcastItemEnclosure) {
+	if sameEnclosureURLs(item.Enclosures, enclosures) {
+		return
+	}
+	if err := db.ReplacePodcastItemEnclosures(item.ID, enclosures); err != nil {
+		logger.Log.Errorw("storing podcast item enclosures", "error", err)
+		return
+	}
+	item.Enclosures = enclosures
+}
+
+func sameEnclosureURLs(stored, current []db.PodcastItemEnclosure) bool {
+	if len(stored) != len(current) {
+		return false
+	}
+	urls := make(map[string]bool, len(stored))
+	for i := range stored {
+		urls[stored[i].URL] = true
+	}
+	for i := range current {
+		if !urls[current[i].URL] {
+			return false
+		}
+	}
+	return true
+}
+
+// SetPodcastEnclosurePreference set which media version is downloaded for a podcast.
+// An empty preference falls back to the global setting.
+func SetPodcastEnclosurePreference(id string, preference db.EnclosurePreference) error {
+	if preference != "" && !preference.IsValid() {
+		return fmt.Errorf("invalid enclosure preference: %q", preference)
+	}
+	var podcast db.Podcast
+	err := db.GetPodcastByID(id, &podcast)
+	if err != nil {
+		return err
+	}
+
+	return db.UpdatePodcastEnclosurePreference(id, preference)
+}
+
+// SelectEnclosureURL returns the media URL to download for an episode, following the
+// podcast's enclosure preference or the global one when the podcast has none.
+func SelectEnclosureURL(item *db.PodcastItem, setting *db.Setting) string {
+	preference := item.Podcast.EnclosurePreference
+	if preference == "" {
+		preference = setting.EnclosurePreference
+	}
+
+	var candidates []*db.PodcastItemEnclosure
+	for i := range item.Enclosures {
+		candidates = append(candidates, &item.Enclosures[i])
+	}
+	if len(candidates) < 2 {
+		return item.FileURL
+	}
+
+	var chosen *db.PodcastItemEnclosure
+	switch preference {
+	case db.EnclosurePreferenceSmallest:
+		chosen = extremeEnclosure(candidates, enclosureLength, true)
+		if chosen == nil {
+			chosen = extremeEnclosure(candidates, enclosureBitrate, true)
+		}
+	case db.EnclosurePreferenceHighestBitrate:
+		chosen = extremeEnclosure(candidates, enclosureBitrate, false)
+		if chosen == nil {
+			chosen = extremeEnclosure(candidates, enclosureLength, false)
+		}
+	case db.EnclosurePreferenceOpus:
+		chosen = firstEnclosure(candidates, isOpusEnclosure)
+	case db.EnclosurePreferenceAudioOnly:
+		chosen = firstEnclosure(candidates, isAudioEnclosure)
+		if def := firstEnclosure(candidates, func(e *db.PodcastItemEnclosure) bool { return e.IsDefault }); def != nil && isAudioEnclosure(def) {
+			chosen = def
+		}
+	}
+	if chosen == nil {
+		return item.FileURL
+	}
+	return chosen.URL
+}
+
+// extremeEnclosure returns the candidate with the lowest or highest known metric, keeping
+// the earlier one on ties. Candidates without the metric are skipped; nil means none had it.
+func extremeEnclosure(candidates []*db.PodcastItemEnclosure, metric func(*db.PodcastItemEnclosure) int64, lowest bool) *db.PodcastItemEnclosure {
+	var best *db.PodcastItemEnclosure
+	for _, candidate := range candidates {
+		value := metric(candidate)
+		if value <= 0 {
+			continue
+		}
+		if best == nil || (lowest && value < metric(best)) || (!lowest && value > metric(best)) {
+			best = candidate
+		}
+	}
+	return best
+}
+
+func enclosureLength(enclosure *db.PodcastItemEnclosure) int64 {
+	return enclosure.Length
+}
+
+func enclosureBitrate(enclosure *db.PodcastItemEnclosure) int64 {
+	return int64(enclosure.Bitrate)
+}
+
+func firstEnclosure(candidates []*db.PodcastItemEnclosure, match func(*db.PodcastItemEnclosure) bool) *db.PodcastItemEnclosure {
+	for _, candidate := range candidates {
+		if match(candidate) {
+			return candidate
+		}
+	}
+	return nil
+}
+
+func isOpusEnclosure(enclosure *db.PodcastItemEnclosure) bool {
+	return strings.Contains(strings.ToLower(enclosure.Type+" "+enclosure.Codecs), "opus") ||
+		strings.EqualFold(path.Ext(enclosureFileName(enclosure.URL)), ".opus")
+}
+
+func isAudioEnclosure(enclosure *db.PodcastItemEnclosure) bool {
+	mimeType := strings.ToLower(enclosure.Type)
+	if mimeType == "" {
+		return !IsVideoType(MediaTypeForPath(enclosure.URL))
+	}
+	return strings.HasPrefix(mimeType, "audio/")
+}
+
+// enclosureFileName strips the query string so the extension of a media URL can be read.
+func enclosureFileName(link string) string {
+	if index := strings.IndexAny(link, "?#"); index >= 0 {
+		return link[:index]
+	}
+	return link
+}
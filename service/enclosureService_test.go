@@ -0,0 +1,99 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toozej/podgrab/db"
+	testhelpers "github.com/toozej/podgrab/internal/testing"
+	"github.com/toozej/podgrab/model"
+)
+
+// TestSelectEnclosureURL tests picking the media version to download.
+func TestSelectEnclosureURL(t *testing.T) {
+	item := db.PodcastItem{
+		FileURL: "https://example.com/ep.mp4",
+		Enclosures: []db.PodcastItemEnclosure{
+			{URL: "https://example.com/ep.mp4", Type: "video/mp4", Length: 90000000, IsDefault: true},
+			{URL: "https://example.com/ep-128.mp3", Type: "audio/mpeg", Length: 50000000, Bitrate: 128},
+			{URL: "https://example.com/ep-64.mp3", Type: "audio/mpeg", Length: 25000000, Bitrate: 64},
+			{URL: "https://example.com/ep.opus?token=1", Length: 15000000, Bitrate: 48},
+		},
+	}
+
+	tests := []struct {
+		global   db.EnclosurePreference
+		podcast  db.EnclosurePreference
+		expected string
+	}{
+		{global: db.EnclosurePreferenceFeed, expected: "https://example.com/ep.mp4"},
+		{global: db.EnclosurePreferenceSmallest, expected: "https://example.com/ep.opus?token=1"},
+		{global: db.EnclosurePreferenceHighestBitrate, expected: "https://example.com/ep-128.mp3"},
+		{global: db.EnclosurePreferenceOpus, expected: "https://example.com/ep.opus?token=1"},
+		{global: db.EnclosurePreferenceAudioOnly, expected: "https://example.com/ep-128.mp3"},
+		{global: db.EnclosurePreferenceSmallest, podcast: db.EnclosurePreferenceFeed, expected: "https://example.com/ep.mp4"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.global)+"/"+string(tt.podcast), func(t *testing.T) {
+			item.Podcast.EnclosurePreference = tt.podcast
+			assert.Equal(t, tt.expected, SelectEnclosureURL(&item, &db.Setting{EnclosurePreference: tt.global}))
+		})
+	}
+
+	single := db.PodcastItem{FileURL: "https://example.com/only.mp3"}
+	assert.Equal(t, "https://example.com/only.mp3", SelectEnclosureURL(&single, &db.Setting{EnclosurePreference: db.EnclosurePreferenceOpus}))
+}
+
+// TestAddPodcastItems_StoresEnclosures tests storing and refreshing the media versions of episodes.
+func TestAddPodcastItems_StoresEnclosures(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	_, dataCleanup := testhelpers.SetupTestDataDir(t)
+	defer dataCleanup()
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	podcast := db.CreateTestPodcast(t, database)
+	obj := model.FeedItem{
+		GUID:       "variants",
+		Enclosure:  model.FeedEnclosure{URL: "https://example.com/ep.mp3", Type: "audio/mpeg", Length: "2000"},
+		Alternates: []model.FeedEnclosure{{URL: "https://example.com/ep.opus", Type: "audio/opus", Bitrate: "48"}},
+	}
+	item := db.PodcastItem{PodcastID: podcast.ID, GUID: obj.GUID, FileURL: obj.Enclosure.URL, Enclosures: feedItemEnclosures(&obj)}
+	require.NoError(t, db.CreatePodcastItem(&item))
+
+	var stored db.PodcastItem
+	require.NoError(t, db.GetPodcastItemByID(item.ID, &stored))
+	require.Len(t, stored.Enclosures, 2)
+	assert.NotEqual(t, stored.Enclosures[0].ID, stored.Enclosures[1].ID)
+
+	obj.Alternates = append(obj.Alternates, model.FeedEnclosure{URL: "https://example.com/ep-64.mp3", Type: "audio/mpeg"})
+	syncPodcastItemEnclosures(&stored, feedItemEnclosures(&obj))
+
+	var refreshed db.PodcastItem
+	require.NoError(t, db.GetPodcastItemByID(item.ID, &refreshed))
+	require.Len(t, refreshed.Enclosures, 3)
+	assert.Equal(t, 48, findEnclosure(t, refreshed.Enclosures, "https://example.com/ep.opus").Bitrate)
+	assert.True(t, findEnclosure(t, refreshed.Enclosures, "https://example.com/ep.mp3").IsDefault)
+
+	require.NoError(t, db.DeletePodcastItemByID(item.ID))
+	var remaining int64
+	require.NoError(t, database.Model(&db.PodcastItemEnclosure{}).Count(&remaining).Error)
+	assert.Zero(t, remaining)
+}
+
+func findEnclosure(t *testing.T, enclosures []db.PodcastItemEnclosure, url string) db.PodcastItemEnclosure {
+	t.Helper()
+	for _, enclosure := range enclosures {
+		if enclosure.URL == url {
+			return enclosure
+		}
+	}
+	t.Fatalf("enclosure %s not found", url)
+	return db.PodcastItemEnclosure{}
+}
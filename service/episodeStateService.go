@@ -0,0 +1,130 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/toozej/podgrab/db"
+)
+
+// updateEpisodeState applies a change to a user's state for an episode and saves it.
+func updateEpisodeState(userID, podcastItemID string, change func(state *db.EpisodeState) error) error {
+	var podcastItem db.PodcastItem
+	if err := db.GetPodcastItemByID(podcastItemID, &podcastItem); err != nil {
+		return err
+	}
+	var state db.EpisodeState
+	if err := db.GetEpisodeState(userID, podcastItemID, &state); err != nil {
+		return err
+	}
+	if err := change(&state); err != nil {
+		return err
+	}
+	return db.SaveEpisodeState(&state)
+}
+
+// SetPodcastItemQueued adds an episode to the end of a user's queue or removes it.
+func SetPodcastItemQueued(userID, id string, queued bool) error {
+	return updateEpisodeState(userID, id, func(state *db.EpisodeState) error {
+		if !queued {
+			state.QueuePosition = 0
+			return nil
+		}
+		if state.QueuePosition > 0 {
+			return nil
+		}
+		next, err := db.GetNextQueuePosition(userID)
+		state.QueuePosition = next
+		return err
+	})
+}
+
+// GetPlaybackProgress returns a user's state for an episode, holding the playback
+// position.
+func GetPlaybackProgress(userID, id string) (*db.EpisodeState, error) {
+	var podcastItem db.PodcastItem
+	if err := db.GetPodcastItemByID(id, &podcastItem); err != nil {
+		return nil, err
+	}
+	var state db.EpisodeState
+	if err := db.GetEpisodeState(userID, id, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// SavePlaybackProgress stores a user's playback position in an episode, in seconds.
+// Without a duration from the player the one from the feed is used. Passing the
+// PlayedThreshold percentage of it marks the episode played.
+func SavePlaybackProgress(userID, id string, position, duration int, now time.Time) (*db.EpisodeState, error) {
+	if position < 0 || duration < 0 {
+		return nil, fmt.Errorf("invalid playback position %d of %d seconds", position, duration)
+	}
+	var podcastItem db.PodcastItem
+	if err := db.GetPodcastItemByID(id, &podcastItem); err != nil {
+		return nil, err
+	}
+	if duration == 0 {
+		duration = podcastItem.Duration
+	}
+	if duration > 0 {
+		position = min(position, duration)
+	}
+	threshold := db.GetOrCreateSetting().PlayedThreshold
+	var saved *db.EpisodeState
+	err := updateEpisodeState(userID, id, func(state *db.EpisodeState) error {
+		state.Position = position
+		state.Duration = duration
+		state.PositionUpdatedAt = now
+		if threshold > 0 && duration > 0 && position*100 >= duration*threshold {
+			state.IsPlayed = true
+		}
+		saved = state
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// GetQueue returns the episodes in a user's queue, in order.
+func GetQueue(userID string) ([]db.PodcastItem, error) {
+	items := []db.PodcastItem{}
+	if err := db.GetQueuedPodcastItems(userID, &items); err != nil {
+		return nil, err
+	}
+	return items, ApplyEpisodeStates(userID, items)
+}
+
+// ApplyEpisodeStates fills in the listening state of a user on episodes read from the
+// database, replacing the shared values of the columns.
+func ApplyEpisodeStates(userID string, items []db.PodcastItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(items))
+	for i := range items {
+		ids = append(ids, items[i].ID)
+	}
+	var states []db.EpisodeState
+	if err := db.GetEpisodeStatesByItemIDs(userID, ids, &states); err != nil {
+		return err
+	}
+	byItem := make(map[string]*db.EpisodeState, len(states))
+	for i := range states {
+		byItem[states[i].PodcastItemID] = &states[i]
+	}
+	for i := range items {
+		state, ok := byItem[items[i].ID]
+		if !ok {
+			state = &db.EpisodeState{}
+		}
+		items[i].IsPlayed = state.IsPlayed
+		items[i].BookmarkDate = state.BookmarkDate
+		items[i].PlaybackPosition = state.Position
+		items[i].QueuePosition = state.QueuePosition
+	}
+	return nil
+}
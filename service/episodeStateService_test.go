@@ -0,0 +1,93 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toozej/podgrab/db"
+	testhelpers "github.com/toozej/podgrab/internal/testing"
+)
+
+// TestSavePlaybackProgress tests storing positions and marking episodes played at the
+// threshold.
+func TestSavePlaybackProgress(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	setting := db.CreateTestSetting(t, database)
+	setting.PlayedThreshold = 90
+	require.NoError(t, db.UpdateSettings(setting))
+
+	podcast := db.CreateTestPodcast(t, database)
+	item := db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{Duration: 1000})
+
+	state, err := GetPlaybackProgress("alice", item.ID)
+	require.NoError(t, err)
+	assert.Zero(t, state.Position)
+	assert.True(t, state.PositionUpdatedAt.IsZero())
+
+	now := time.Now()
+	state, err = SavePlaybackProgress("alice", item.ID, 300, 0, now)
+	require.NoError(t, err)
+	assert.Equal(t, 300, state.Position)
+	assert.Equal(t, 1000, state.Duration, "Should fall back to the feed's duration")
+	assert.False(t, state.IsPlayed)
+
+	state, err = GetPlaybackProgress("alice", item.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 300, state.Position)
+	assert.WithinDuration(t, now, state.PositionUpdatedAt, time.Second)
+	state, err = GetPlaybackProgress("bob", item.ID)
+	require.NoError(t, err)
+	assert.Zero(t, state.Position, "Positions should be per user")
+
+	state, err = SavePlaybackProgress("alice", item.ID, 1150, 1200, now)
+	require.NoError(t, err)
+	assert.Equal(t, 1150, state.Position)
+	assert.Equal(t, 1200, state.Duration, "Should prefer the player's duration")
+	assert.True(t, state.IsPlayed, "Should be played past the threshold")
+
+	state, err = SavePlaybackProgress("alice", item.ID, 100, 1200, now)
+	require.NoError(t, err)
+	assert.True(t, state.IsPlayed, "Seeking back should not mark the episode unplayed")
+
+	state, err = SavePlaybackProgress("bob", item.ID, 5000, 1200, now)
+	require.NoError(t, err)
+	assert.Equal(t, 1200, state.Position, "Should not store a position past the end")
+
+	_, err = SavePlaybackProgress("alice", item.ID, -1, 0, now)
+	assert.Error(t, err)
+	_, err = SavePlaybackProgress("alice", "missing", 10, 0, now)
+	assert.Error(t, err)
+	_, err = GetPlaybackProgress("alice", "missing")
+	assert.Error(t, err)
+}
+
+// TestSavePlaybackProgressThresholdOff tests that a threshold of 0 never marks
+// episodes played.
+func TestSavePlaybackProgressThresholdOff(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	setting := db.CreateTestSetting(t, database)
+	setting.PlayedThreshold = 0
+	require.NoError(t, db.UpdateSettings(setting))
+
+	podcast := db.CreateTestPodcast(t, database)
+	item := db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{Duration: 1000})
+
+	state, err := SavePlaybackProgress("alice", item.ID, 1000, 0, time.Now())
+	require.NoError(t, err)
+	assert.False(t, state.IsPlayed)
+}
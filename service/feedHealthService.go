@@ -0,0 +1,114 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/internal/logger"
+	"github.com/toozej/podgrab/model"
+)
+
+// FeedHealthReport groups the podcasts whose feeds need attention.
+type FeedHealthReport struct {
+	Broken     []db.Podcast `json:"broken"`
+	Stale      []db.Podcast `json:"stale"`
+	Redirected []db.Podcast `json:"redirected"`
+	StaleDays  int          `json:"staleDays"`
+}
+
+// recordFeedHealth stores the outcome of a feed refresh on the podcast and pauses it
+// once the configured number of consecutive failures is reached.
+func recordFeedHealth(podcast *db.Podcast, statusCode int, fetchErr error, newEpisodes int) {
+	now := time.Now()
+	podcast.LastFetchAttempt = &now
+	podcast.LastHTTPStatus = statusCode
+	var statusErr *model.HTTPStatusError
+	if errors.As(fetchErr, &statusErr) {
+		podcast.LastHTTPStatus = statusErr.StatusCode
+	}
+
+	if fetchErr == nil {
+		podcast.LastFetchSuccess = &now
+		podcast.LastFetchError = ""
+		podcast.ConsecutiveFailures = 0
+		if newEpisodes > 0 {
+			podcast.LastNewEpisode = &now
+		}
+	} else {
+		podcast.LastFetchError = fetchErr.Error()
+		podcast.ConsecutiveFailures++
+	}
+
+	if err := db.UpdatePodcastFeedHealth(podcast); err != nil {
+		logger.Log.Errorw("updating podcast feed health", "error", err)
+		return
+	}
+
+	if fetchErr == nil {
+		return
+	}
+	if podcast.ConsecutiveFailures == 1 {
+		EmitWebhookEvent(WebhookFeedBroken, model.WebhookData{
+			Podcast:    webhookPodcast(podcast),
+			Error:      podcast.LastFetchError,
+			StatusCode: podcast.LastHTTPStatus,
+			Failures:   podcast.ConsecutiveFailures,
+		})
+		SendNotifications(&NotificationData{Event: WebhookFeedBroken, Podcast: podcast, Error: podcast.LastFetchError})
+	}
+	if podcast.IsPaused {
+		return
+	}
+	setting := db.GetOrCreateSetting()
+	if setting.AutoPauseAfterFailures <= 0 || podcast.ConsecutiveFailures < setting.AutoPauseAfterFailures {
+		return
+	}
+	if err := db.TogglePodcastPauseStatus(podcast.ID, true); err != nil {
+		logger.Log.Errorw("pausing failing podcast", "error", err)
+		return
+	}
+	podcast.IsPaused = true
+	change := db.PodcastMetadataChange{
+		PodcastID: podcast.ID,
+		Field:     "IsPaused",
+		OldValue:  strconv.FormatBool(false),
+		NewValue:  strconv.FormatBool(true),
+	}
+	if err := db.CreatePodcastMetadataChange(&change); err != nil {
+		logger.Log.Errorw("recording podcast metadata change", "error", err)
+	}
+	logger.Log.Warnw("Paused podcast after consecutive feed failures", "podcast", podcast.Title, "failures", podcast.ConsecutiveFailures)
+}
+
+// GetFeedHealthReport lists broken feeds, feeds without a new episode for staleDays days
+// and feeds that moved recently or announced a move that could not be applied.
+// When staleDays is not positive the StaleFeedDays setting is used.
+func GetFeedHealthReport(staleDays int) (FeedHealthReport, error) {
+	if staleDays <= 0 {
+		staleDays = db.GetOrCreateSetting().StaleFeedDays
+	}
+	if staleDays <= 0 {
+		staleDays = 90
+	}
+	report := FeedHealthReport{
+		Broken:     []db.Podcast{},
+		Stale:      []db.Podcast{},
+		Redirected: []db.Podcast{},
+		StaleDays:  staleDays,
+	}
+	since := time.Now().AddDate(0, 0, -staleDays)
+
+	if err := db.GetPodcastsWithFeedFailures(&report.Broken); err != nil {
+		return report, err
+	}
+	if err := db.GetStalePodcasts(since, &report.Stale); err != nil {
+		return report, err
+	}
+	if err := db.GetRedirectedPodcasts(since, &report.Redirected); err != nil {
+		return report, err
+	}
+	return report, nil
+}
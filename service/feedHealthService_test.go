@@ -0,0 +1,143 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toozej/podgrab/db"
+	testhelpers "github.com/toozej/podgrab/internal/testing"
+)
+
+// TestAddPodcastItems_RecordsFeedHealth tests that refreshes update the feed health fields.
+func TestAddPodcastItems_RecordsFeedHealth(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	_, dataCleanup := testhelpers.SetupTestDataDir(t)
+	defer dataCleanup()
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	setting := db.CreateTestSetting(t, database)
+	setting.AutoPauseAfterFailures = 2
+	require.NoError(t, db.UpdateSettings(setting))
+
+	healthy := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy {
+			http.NotFound(w, r)
+			return
+		}
+		testhelpers.CreateMockRSSHandler(testhelpers.ValidRSSFeed).ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	podcast := db.CreateTestPodcast(t, database, &db.Podcast{
+		URL:     server.URL,
+		Summary: "A podcast for testing purposes",
+		Image:   "https://example.com/podcast-image.jpg",
+	})
+
+	require.NoError(t, AddPodcastItems(podcast, false))
+	var stored db.Podcast
+	require.NoError(t, db.GetPodcastByID(podcast.ID, &stored))
+	require.NotNil(t, stored.LastFetchSuccess)
+	require.NotNil(t, stored.LastNewEpisode)
+	assert.Equal(t, http.StatusOK, stored.LastHTTPStatus)
+	assert.Zero(t, stored.ConsecutiveFailures)
+	assert.Empty(t, stored.LastFetchError)
+
+	healthy = false
+	require.Error(t, AddPodcastItems(podcast, false))
+	require.NoError(t, db.GetPodcastByID(podcast.ID, &stored))
+	assert.Equal(t, http.StatusNotFound, stored.LastHTTPStatus)
+	assert.Equal(t, 1, stored.ConsecutiveFailures)
+	assert.Contains(t, stored.LastFetchError, "404")
+	assert.False(t, stored.IsPaused)
+
+	require.Error(t, AddPodcastItems(podcast, false))
+	require.NoError(t, db.GetPodcastByID(podcast.ID, &stored))
+	assert.Equal(t, 2, stored.ConsecutiveFailures)
+	assert.True(t, stored.IsPaused, "Should pause after the configured number of failures")
+
+	var changes []db.PodcastMetadataChange
+	require.NoError(t, db.GetPodcastMetadataChangesByPodcastID(podcast.ID, &changes))
+	require.Len(t, changes, 1)
+	assert.Equal(t, "IsPaused", changes[0].Field)
+
+	healthy = true
+	podcast.IsPaused = stored.IsPaused
+	require.NoError(t, AddPodcastItems(podcast, false))
+	require.NoError(t, db.GetPodcastByID(podcast.ID, &stored))
+	assert.Zero(t, stored.ConsecutiveFailures, "Should reset failures after a successful refresh")
+	assert.Empty(t, stored.LastFetchError)
+}
+
+// TestGetFeedHealthReport tests grouping of broken, stale and redirected feeds.
+func TestGetFeedHealthReport(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	db.CreateTestSetting(t, database)
+
+	recent := time.Now().AddDate(0, 0, -1)
+	old := time.Now().AddDate(0, 0, -200)
+
+	healthy := db.CreateTestPodcast(t, database, &db.Podcast{Title: "Healthy", URL: "https://example.com/healthy.xml"})
+	healthy.LastEpisode = &recent
+	require.NoError(t, database.Save(healthy).Error)
+
+	broken := db.CreateTestPodcast(t, database, &db.Podcast{Title: "Broken", URL: "https://example.com/broken.xml"})
+	broken.LastEpisode = &recent
+	broken.ConsecutiveFailures = 4
+	require.NoError(t, database.Save(broken).Error)
+
+	stale := db.CreateTestPodcast(t, database, &db.Podcast{Title: "Stale", URL: "https://example.com/stale.xml"})
+	stale.LastEpisode = &old
+	require.NoError(t, database.Save(stale).Error)
+
+	blocked := db.CreateTestPodcast(t, database, &db.Podcast{Title: "Blocked Move", URL: "https://example.com/blocked.xml"})
+	blocked.LastEpisode = &recent
+	blocked.MovedTo = "https://example.com/healthy.xml"
+	require.NoError(t, database.Save(blocked).Error)
+
+	moved := db.CreateTestPodcast(t, database, &db.Podcast{Title: "Moved", URL: "https://new.example.com/moved.xml"})
+	moved.LastEpisode = &recent
+	require.NoError(t, database.Save(moved).Error)
+	require.NoError(t, db.CreatePodcastMetadataChange(&db.PodcastMetadataChange{
+		PodcastID: moved.ID,
+		Field:     "URL",
+		OldValue:  "https://example.com/moved.xml",
+		NewValue:  moved.URL,
+	}))
+
+	report, err := GetFeedHealthReport(0)
+	require.NoError(t, err)
+	assert.Equal(t, 90, report.StaleDays)
+
+	titles := func(podcasts []db.Podcast) []string {
+		result := []string{}
+		for i := range podcasts {
+			result = append(result, podcasts[i].Title)
+		}
+		return result
+	}
+	assert.Equal(t, []string{"Broken"}, titles(report.Broken))
+	assert.Equal(t, []string{"Stale"}, titles(report.Stale))
+	assert.ElementsMatch(t, []string{"Blocked Move", "Moved"}, titles(report.Redirected))
+
+	report, err = GetFeedHealthReport(365)
+	require.NoError(t, err)
+	assert.Empty(t, report.Stale)
+}
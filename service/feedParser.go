@@ -0,0 +1,371 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/toozej/podgrab/model"
+)
+
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// ParseFeed detects the format of a feed document and converts it into the common feed model.
+func ParseFeed(body []byte) (model.Feed, error) {
+	format, err := detectFeedFormat(body)
+	if err != nil {
+		return model.Feed{}, err
+	}
+
+	switch format {
+	case model.FeedFormatJSON:
+		var data model.JSONFeed
+		if err := json.Unmarshal(bytes.TrimPrefix(body, utf8BOM), &data); err != nil {
+			return model.Feed{}, err
+		}
+		return feedFromJSONFeed(&data), nil
+	case model.FeedFormatAtom:
+		var data model.AtomFeed
+		if err := xml.Unmarshal(body, &data); err != nil {
+			return model.Feed{}, err
+		}
+		return feedFromAtom(&data), nil
+	default:
+		var data model.PodcastData
+		if err := xml.Unmarshal(body, &data); err != nil {
+			return model.Feed{}, err
+		}
+		return feedFromRss(&data, body), nil
+	}
+}
+
+// detectFeedFormat inspects the document root to decide which parser should be used.
+func detectFeedFormat(body []byte) (model.FeedFormat, error) {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(body, utf8BOM))
+	if len(trimmed) == 0 {
+		return "", errors.New("empty feed document")
+	}
+	if trimmed[0] == '{' {
+		return model.FeedFormatJSON, nil
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(trimmed))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return "", errors.New("no root element found in feed document")
+			}
+			return "", err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			switch strings.ToLower(start.Name.Local) {
+			case "rss":
+				return model.FeedFormatRSS, nil
+			case "feed":
+				return model.FeedFormatAtom, nil
+			default:
+				return "", fmt.Errorf("unsupported feed format: <%s>", start.Name.Local)
+			}
+		}
+	}
+}
+
+func feedFromRss(data *model.PodcastData, body []byte) model.Feed {
+	channel := &data.Channel
+	feed := model.Feed{
+		Format:     model.FeedFormatRSS,
+		Title:      channel.Title,
+		Summary:    channel.Summary,
+		Author:     channel.Author,
+		Image:      channel.Image.URL,
+		Language:   channel.Language,
+		Category:   channel.Category.AttrText,
+		Explicit:   channel.Explicit,
+		OwnerName:  channel.Owner.Name,
+		OwnerEmail: channel.Owner.Email,
+		Copyright:  channel.Copyright,
+		NewFeedURL: strings.TrimSpace(channel.NewFeedURL),
+	}
+	if feed.Summary == "" {
+		feed.Summary = channel.Description
+	}
+	if feed.Image == "" {
+		feed.Image = getItunesImageURL(body)
+	}
+	for _, link := range channel.Link {
+		if link.Href == "" && strings.TrimSpace(link.Text) != "" {
+			feed.Link = strings.TrimSpace(link.Text)
+			break
+		}
+	}
+
+	feed.Items = make([]model.FeedItem, 0, len(channel.Item))
+	for i := range channel.Item {
+		obj := &channel.Item[i]
+		item := model.FeedItem{
+			GUID:        obj.GUID.Text,
+			Title:       obj.Title,
+			Summary:     extractSummary(obj.Summary, obj.Description),
+			Author:      obj.Author,
+			Image:       obj.Image.Href,
+			Link:        obj.Link,
+			Duration:    obj.Duration,
+			EpisodeType: obj.EpisodeType,
+			Episode:     obj.Episode,
+			Season:      obj.Season,
+			Explicit:    obj.Explicit,
+			PubDate:     parsePubDate(obj.PubDate),
+			Enclosure: model.FeedEnclosure{
+				URL:    obj.Enclosure.URL,
+				Length: obj.Enclosure.Length,
+				Type:   obj.Enclosure.Type,
+			},
+		}
+		contents := append(append([]model.MediaContent{}, obj.Content...), obj.Group.Content...)
+		item.Alternates = mediaAlternates(item.Enclosure.URL, contents, obj.AlternateEnclosure)
+		if item.Enclosure.URL == "" && len(item.Alternates) > 0 {
+			item.Enclosure, item.Alternates = item.Alternates[0], item.Alternates[1:]
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed
+}
+
+// mediaAlternates collects the media:content and podcast:alternateEnclosure versions
+// of an item, skipping images and the main enclosure.
+func mediaAlternates(mainURL string, contents []model.MediaContent, alternates []model.AlternateEnclosure) []model.FeedEnclosure {
+	seen := map[string]bool{mainURL: true}
+	var result []model.FeedEnclosure
+	add := func(enclosure model.FeedEnclosure, medium string) {
+		if enclosure.URL == "" || seen[enclosure.URL] || !isMediaEnclosure(enclosure.Type, medium) {
+			return
+		}
+		seen[enclosure.URL] = true
+		result = append(result, enclosure)
+	}
+
+	for _, content := range contents {
+		add(model.FeedEnclosure{
+			URL:     content.URL,
+			Length:  content.FileSize,
+			Type:    content.Type,
+			Bitrate: content.Bitrate,
+		}, content.Medium)
+	}
+	for _, alternate := range alternates {
+		for _, source := range alternate.Source {
+			if !strings.HasPrefix(source.URI, "http://") && !strings.HasPrefix(source.URI, "https://") {
+				continue
+			}
+			add(model.FeedEnclosure{
+				URL:     source.URI,
+				Length:  alternate.Length,
+				Type:    firstNonEmpty(source.ContentType, alternate.Type),
+				Bitrate: kbitFromBits(alternate.Bitrate),
+				Codecs:  alternate.Codecs,
+			}, "")
+			break
+		}
+	}
+	return result
+}
+
+// isMediaEnclosure reports whether a media:content medium or MIME type is audio or video.
+func isMediaEnclosure(mimeType, medium string) bool {
+	switch strings.ToLower(medium) {
+	case "audio", "video":
+		return true
+	case "":
+	default:
+		return false
+	}
+	mimeType = strings.ToLower(mimeType)
+	return !strings.HasPrefix(mimeType, "image/") && !strings.HasPrefix(mimeType, "text/")
+}
+
+// kbitFromBits converts the bits per second of podcast:alternateEnclosure to kbit/s.
+func kbitFromBits(bitrate string) string {
+	bits, err := strconv.ParseFloat(strings.TrimSpace(bitrate), 64)
+	if err != nil || bits <= 0 {
+		return ""
+	}
+	return strconv.Itoa(int(bits/1000 + 0.5))
+}
+
+func feedFromAtom(data *model.AtomFeed) model.Feed {
+	feed := model.Feed{
+		Format:    model.FeedFormatAtom,
+		Title:     strings.TrimSpace(data.Title),
+		Summary:   data.Subtitle,
+		Image:     data.Image.Href,
+		Link:      atomLink(data.Link, "alternate").Href,
+		Language:  data.Lang,
+		Explicit:  data.Explicit,
+		Copyright: data.Rights,
+	}
+	if feed.Summary == "" {
+		feed.Summary = data.Summary
+	}
+	if feed.Image == "" {
+		feed.Image = data.Logo
+	}
+	if feed.Image == "" {
+		feed.Image = data.Icon
+	}
+	if len(data.Author) > 0 {
+		feed.Author = data.Author[0].Name
+		feed.OwnerName = data.Author[0].Name
+		feed.OwnerEmail = data.Author[0].Email
+	}
+	if len(data.Category) > 0 {
+		feed.Category = firstNonEmpty(data.Category[0].Label, data.Category[0].Text, data.Category[0].Term)
+	}
+
+	feed.Items = make([]model.FeedItem, 0, len(data.Entry))
+	for i := range data.Entry {
+		entry := &data.Entry[i]
+		enclosure := atomLink(entry.Link, "enclosure")
+		item := model.FeedItem{
+			GUID:        entry.ID,
+			Title:       strings.TrimSpace(entry.Title),
+			Summary:     extractSummary(entry.Summary, entry.Content),
+			Image:       firstNonEmpty(entry.Image.Href, entry.Thumbnail.URL),
+			Link:        atomLink(entry.Link, "alternate").Href,
+			Duration:    entry.Duration,
+			EpisodeType: entry.EpisodeType,
+			Episode:     entry.Episode,
+			Season:      entry.Season,
+			Explicit:    entry.Explicit,
+			PubDate:     parsePubDate(firstNonEmpty(entry.Published, entry.Updated)),
+			Enclosure: model.FeedEnclosure{
+				URL:    enclosure.Href,
+				Length: enclosure.Length,
+				Type:   enclosure.Type,
+			},
+		}
+		if len(entry.Author) > 0 {
+			item.Author = entry.Author[0].Name
+		} else {
+			item.Author = feed.Author
+		}
+		for _, link := range entry.Link {
+			if link.Rel == "enclosure" && link.Href != enclosure.Href && isMediaEnclosure(link.Type, "") {
+				item.Alternates = append(item.Alternates, model.FeedEnclosure{URL: link.Href, Length: link.Length, Type: link.Type})
+			}
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed
+}
+
+// atomLink returns the first link with the given relation. Links without a rel
+// attribute are treated as "alternate" as required by RFC 4287.
+func atomLink(links []model.AtomLink, rel string) model.AtomLink {
+	for _, link := range links {
+		linkRel := link.Rel
+		if linkRel == "" {
+			linkRel = "alternate"
+		}
+		if linkRel == rel {
+			return link
+		}
+	}
+	return model.AtomLink{}
+}
+
+func feedFromJSONFeed(data *model.JSONFeed) model.Feed {
+	feed := model.Feed{
+		Format:   model.FeedFormatJSON,
+		Title:    data.Title,
+		Summary:  data.Description,
+		Image:    firstNonEmpty(data.Icon, data.Favicon),
+		Link:     data.HomePageURL,
+		Language: data.Language,
+	}
+	if author := jsonFeedAuthor(data.Authors, data.Author); author != nil {
+		feed.Author = author.Name
+		feed.OwnerName = author.Name
+	}
+
+	feed.Items = make([]model.FeedItem, 0, len(data.Items))
+	for i := range data.Items {
+		obj := &data.Items[i]
+		item := model.FeedItem{
+			GUID:    obj.ID,
+			Title:   obj.Title,
+			Summary: extractSummary(obj.Summary, firstNonEmpty(obj.ContentText, obj.ContentHTML)),
+			Image:   obj.Image,
+			Link:    obj.URL,
+			PubDate: parsePubDate(firstNonEmpty(obj.DatePublished, obj.DateModified)),
+		}
+		if author := jsonFeedAuthor(obj.Authors, obj.Author); author != nil {
+			item.Author = author.Name
+		} else {
+			item.Author = feed.Author
+		}
+		if attachment := jsonFeedMediaAttachment(obj.Attachments); attachment != nil {
+			item.Enclosure = model.FeedEnclosure{
+				URL:  attachment.URL,
+				Type: attachment.MimeType,
+			}
+			if attachment.SizeInBytes > 0 {
+				item.Enclosure.Length = strconv.FormatInt(attachment.SizeInBytes, 10)
+			}
+			if attachment.DurationInSeconds > 0 {
+				item.Duration = strconv.Itoa(int(attachment.DurationInSeconds))
+			}
+			for j := range obj.Attachments {
+				other := &obj.Attachments[j]
+				if other.URL == attachment.URL || !isMediaEnclosure(other.MimeType, "") {
+					continue
+				}
+				alternate := model.FeedEnclosure{URL: other.URL, Type: other.MimeType}
+				if other.SizeInBytes > 0 {
+					alternate.Length = strconv.FormatInt(other.SizeInBytes, 10)
+				}
+				item.Alternates = append(item.Alternates, alternate)
+			}
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed
+}
+
+// jsonFeedAuthor prefers the 1.1 authors array and falls back to the 1.0 author object.
+func jsonFeedAuthor(authors []model.JSONFeedAuthor, author *model.JSONFeedAuthor) *model.JSONFeedAuthor {
+	if len(authors) > 0 {
+		return &authors[0]
+	}
+	return author
+}
+
+// jsonFeedMediaAttachment returns the first audio or video attachment, or the
+// first attachment of any type when none declares a media MIME type.
+func jsonFeedMediaAttachment(attachments []model.JSONFeedAttachment) *model.JSONFeedAttachment {
+	for i := range attachments {
+		mimeType := strings.ToLower(attachments[i].MimeType)
+		if strings.HasPrefix(mimeType, "audio/") || strings.HasPrefix(mimeType, "video/") {
+			return &attachments[i]
+		}
+	}
+	if len(attachments) > 0 {
+		return &attachments[0]
+	}
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
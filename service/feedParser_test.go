@@ -0,0 +1,166 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	testhelpers "github.com/toozej/podgrab/internal/testing"
+	"github.com/toozej/podgrab/model"
+)
+
+// TestDetectFeedFormat tests feed format detection from the document root.
+func TestDetectFeedFormat(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantFormat model.FeedFormat
+		wantError  bool
+	}{
+		{name: "rss", body: testhelpers.ValidRSSFeed, wantFormat: model.FeedFormatRSS},
+		{name: "atom", body: testhelpers.ValidAtomFeed, wantFormat: model.FeedFormatAtom},
+		{name: "json_feed", body: testhelpers.ValidJSONFeed, wantFormat: model.FeedFormatJSON},
+		{name: "json_feed_with_bom", body: "\xef\xbb\xbf" + testhelpers.ValidJSONFeed, wantFormat: model.FeedFormatJSON},
+		{name: "unsupported_root", body: `<?xml version="1.0"?><html></html>`, wantError: true},
+		{name: "not_xml", body: "not valid xml", wantError: true},
+		{name: "empty", body: "   ", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := detectFeedFormat([]byte(tt.body))
+			if tt.wantError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantFormat, format)
+		})
+	}
+}
+
+// TestParseFeedRss tests conversion of RSS feeds into the common model.
+func TestParseFeedRss(t *testing.T) {
+	feed, err := ParseFeed([]byte(testhelpers.ValidRSSFeed))
+	require.NoError(t, err)
+
+	assert.Equal(t, model.FeedFormatRSS, feed.Format)
+	assert.Equal(t, "Test Podcast", feed.Title)
+	assert.Equal(t, "https://example.com/podcast-image.jpg", feed.Image, "Should fall back to itunes:image")
+	require.Len(t, feed.Items, 2)
+	assert.Equal(t, "test-podcast-episode-1", feed.Items[0].GUID)
+	assert.Equal(t, "https://example.com/episode1.mp3", feed.Items[0].Enclosure.URL)
+	assert.Equal(t, "1800", feed.Items[0].Duration)
+	assert.Equal(t, time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC), feed.Items[0].PubDate.UTC())
+	assert.Empty(t, feed.NewFeedURL)
+
+	moved := strings.Replace(testhelpers.ValidRSSFeed, "<link>https://example.com</link>",
+		"<link>https://example.com</link><itunes:new-feed-url> https://new.example.com/feed.xml </itunes:new-feed-url>", 1)
+	feed, err = ParseFeed([]byte(moved))
+	require.NoError(t, err)
+	assert.Equal(t, "https://new.example.com/feed.xml", feed.NewFeedURL)
+}
+
+// TestParseFeedAtom tests conversion of Atom feeds into the common model.
+func TestParseFeedAtom(t *testing.T) {
+	feed, err := ParseFeed([]byte(testhelpers.ValidAtomFeed))
+	require.NoError(t, err)
+
+	assert.Equal(t, model.FeedFormatAtom, feed.Format)
+	assert.Equal(t, "Atom Test Podcast", feed.Title)
+	assert.Equal(t, "A podcast published as Atom", feed.Summary)
+	assert.Equal(t, "Atom Author", feed.Author)
+	assert.Equal(t, "https://example.com/atom-podcast.jpg", feed.Image)
+	assert.Equal(t, "https://example.com/atom", feed.Link)
+	assert.Equal(t, "en", feed.Language)
+	require.Len(t, feed.Items, 2)
+
+	first := feed.Items[0]
+	assert.Equal(t, "atom-podcast-episode-1", first.GUID)
+	assert.Equal(t, "The first Atom episode", first.Summary)
+	assert.Equal(t, "https://example.com/atom/1", first.Link)
+	assert.Equal(t, "https://example.com/atom-episode1.mp3", first.Enclosure.URL)
+	assert.Equal(t, "25000000", first.Enclosure.Length)
+	assert.Equal(t, "Atom Author", first.Author, "Should inherit feed author")
+	assert.Equal(t, time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC), first.PubDate.UTC())
+
+	second := feed.Items[1]
+	assert.Equal(t, "The second Atom episode", second.Summary, "Should fall back to stripped content")
+	assert.Equal(t, time.Date(2024, 1, 22, 10, 0, 0, 0, time.UTC), second.PubDate.UTC(), "Should fall back to updated")
+}
+
+// TestParseFeedJSON tests conversion of JSON Feed documents into the common model.
+func TestParseFeedJSON(t *testing.T) {
+	feed, err := ParseFeed([]byte(testhelpers.ValidJSONFeed))
+	require.NoError(t, err)
+
+	assert.Equal(t, model.FeedFormatJSON, feed.Format)
+	assert.Equal(t, "JSON Test Podcast", feed.Title)
+	assert.Equal(t, "JSON Author", feed.Author)
+	assert.Equal(t, "https://example.com/json-podcast.jpg", feed.Image)
+	require.Len(t, feed.Items, 1)
+
+	item := feed.Items[0]
+	assert.Equal(t, "json-podcast-episode-1", item.GUID)
+	assert.Equal(t, "The first JSON episode", item.Summary)
+	assert.Equal(t, "https://example.com/json-episode1.mp3", item.Enclosure.URL)
+	assert.Equal(t, "audio/mpeg", item.Enclosure.Type)
+	assert.Equal(t, "25000000", item.Enclosure.Length)
+	assert.Equal(t, "1800", item.Duration)
+}
+
+// TestJSONFeedMediaAttachment tests attachment selection for JSON Feed items.
+func TestJSONFeedMediaAttachment(t *testing.T) {
+	attachments := []model.JSONFeedAttachment{
+		{URL: "https://example.com/transcript.txt", MimeType: "text/plain"},
+		{URL: "https://example.com/episode.mp3", MimeType: "audio/mpeg"},
+	}
+	assert.Equal(t, "https://example.com/episode.mp3", jsonFeedMediaAttachment(attachments).URL)
+	assert.Equal(t, "https://example.com/transcript.txt", jsonFeedMediaAttachment(attachments[:1]).URL)
+	assert.Nil(t, jsonFeedMediaAttachment(nil))
+}
+
+// TestParseFeedRssAlternates tests parsing of media:content and podcast:alternateEnclosure versions.
+func TestParseFeedRssAlternates(t *testing.T) {
+	body := `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:media="http://search.yahoo.com/mrss/" xmlns:podcast="https://podcastindex.org/namespace/1.0">
+  <channel>
+    <title>Variants</title>
+    <item>
+      <title>Main and variants</title>
+      <guid>variants-1</guid>
+      <enclosure url="https://example.com/ep1.mp3" length="50000000" type="audio/mpeg"/>
+      <media:content url="https://example.com/cover.jpg" medium="image" type="image/jpeg"/>
+      <media:group>
+        <media:content url="https://example.com/ep1.mp3" fileSize="50000000" type="audio/mpeg" bitrate="128"/>
+        <media:content url="https://example.com/ep1-64.mp3" fileSize="25000000" type="audio/mpeg" bitrate="64"/>
+      </media:group>
+      <podcast:alternateEnclosure type="audio/opus" length="15000000" bitrate="48000" codecs="opus">
+        <podcast:source uri="ipfs://QmExample"/>
+        <podcast:source uri="https://example.com/ep1.opus"/>
+      </podcast:alternateEnclosure>
+    </item>
+    <item>
+      <title>Only media content</title>
+      <guid>variants-2</guid>
+      <media:content url="https://example.com/ep2.m4a" type="audio/mp4" medium="audio"/>
+    </item>
+  </channel>
+</rss>`
+	feed, err := ParseFeed([]byte(body))
+	require.NoError(t, err)
+	require.Len(t, feed.Items, 2)
+
+	first := feed.Items[0]
+	assert.Equal(t, "https://example.com/ep1.mp3", first.Enclosure.URL)
+	require.Len(t, first.Alternates, 2, "Images and the main enclosure should be skipped")
+	assert.Equal(t, model.FeedEnclosure{URL: "https://example.com/ep1-64.mp3", Length: "25000000", Type: "audio/mpeg", Bitrate: "64"}, first.Alternates[0])
+	assert.Equal(t, model.FeedEnclosure{URL: "https://example.com/ep1.opus", Length: "15000000", Type: "audio/opus", Bitrate: "48", Codecs: "opus"}, first.Alternates[1])
+
+	second := feed.Items[1]
+	assert.Equal(t, "https://example.com/ep2.m4a", second.Enclosure.URL, "A media:content should stand in for a missing enclosure")
+	assert.Empty(t, second.Alternates)
+}
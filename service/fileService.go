@@ -22,16 +22,23 @@ import (
 	"github.com/toozej/podgrab/db"
 	"github.com/toozej/podgrab/internal/logger"
 	"github.com/toozej/podgrab/internal/sanitize"
+	"github.com/toozej/podgrab/model"
 )
 
-// Download download.
-func Download(link, episodeTitle, podcastName, episodePathName string) (string, error) {
+// Download download. The MIME type announced for the media picks the file extension
+// when the link has none; the request options carry the podcast's network settings and
+// the credentials of private feeds, nil uses the global settings.
+func Download(link, episodeTitle, podcastName, episodePathName, mimeType string, options *requestOptions) (string, error) {
 	if link == "" {
 		return "", errors.New("Download link empty")
 	}
 
 	// Calculate file path first
-	fileExtension := path.Ext(getFileName(link, episodeTitle, ".mp3"))
+	defaultExtension := MediaExtensionForType(mimeType)
+	if defaultExtension == "" {
+		defaultExtension = ".mp3"
+	}
+	fileExtension := path.Ext(getFileName(link, episodeTitle, defaultExtension))
 	finalPath := path.Join(
 		os.Getenv("DATA"),
 		cleanFileName(podcastName),
@@ -47,16 +54,21 @@ func Download(link, episodeTitle, podcastName, episodePathName string) (string,
 	}
 
 	// File doesn't exist, proceed with download
-	client := httpClient()
+	client, err := options.httpClient(0, nil)
+	if err != nil {
+		logger.Log.Errorw("Error creating client: "+RedactURL(link), err)
+		return "", err
+	}
 
-	req, err := getRequest(link)
+	req, err := options.newRequest(http.MethodGet, link)
 	if err != nil {
-		logger.Log.Errorw("Error creating request: "+link, err)
+		logger.Log.Errorw("Error creating request: "+RedactURL(link), err)
+		return "", err
 	}
 
 	resp, err := client.Do(req) // #nosec G704 -- URL comes from user-provided podcast RSS feeds
 	if err != nil {
-		logger.Log.Errorw("Error getting response: "+link, err)
+		logger.Log.Errorw("Error getting response: "+RedactURL(link), err)
 		return "", err
 	}
 
@@ -74,7 +86,7 @@ func Download(link, episodeTitle, podcastName, episodePathName string) (string,
 
 	file, err := os.Create(cleanPath) // #nosec G703 -- path is validated by validatePath and cleaned before use
 	if err != nil {
-		logger.Log.Errorw("Error creating file"+link, err)
+		logger.Log.Errorw("Error creating file"+RedactURL(link), err)
 		return "", err
 	}
 	defer func() {
@@ -82,14 +94,19 @@ func Download(link, episodeTitle, podcastName, episodePathName string) (string,
 			logger.Log.Errorw("Error closing response body", closeErr)
 		}
 	}()
-	_, erra := io.Copy(file, resp.Body)
+	body := throttle(resp.Body, resp.Request.URL.Host, db.GetOrCreateSetting)
+	_, erra := io.Copy(file, body)
 	defer func() {
 		if closeErr := file.Close(); closeErr != nil {
 			logger.Log.Errorw("Error closing file", closeErr)
 		}
 	}()
 	if erra != nil {
-		logger.Log.Errorw("Error saving file"+link, err)
+		logger.Log.Errorw("Error saving file"+RedactURL(link), err)
+		// Remove the partial file so the next attempt downloads it again.
+		if removeErr := os.Remove(cleanPath); removeErr != nil {
+			logger.Log.Errorw("removing partial download", "error", removeErr)
+		}
 		return "", erra
 	}
 	changeOwnership(finalPath)
@@ -133,20 +150,24 @@ func CreateNfoFile(podcast *db.Podcast) error {
 }
 
 // DownloadPodcastCoverImage download podcast cover image.
-func DownloadPodcastCoverImage(link, podcastName string) (string, error) {
+func DownloadPodcastCoverImage(link, podcastName string, options *requestOptions) (string, error) {
 	if link == "" {
 		return "", errors.New("Download link empty")
 	}
-	client := httpClient()
-	req, err := getRequest(link)
+	client, err := options.httpClient(0, nil)
 	if err != nil {
-		logger.Log.Errorw("Error creating request: "+link, err)
+		logger.Log.Errorw("Error creating client: "+RedactURL(link), err)
+		return "", err
+	}
+	req, err := options.newRequest(http.MethodGet, link)
+	if err != nil {
+		logger.Log.Errorw("Error creating request: "+RedactURL(link), err)
 		return "", err
 	}
 
 	resp, err := client.Do(req) // #nosec G704 -- URL comes from user-provided podcast RSS feeds
 	if err != nil {
-		logger.Log.Errorw("Error getting response: "+link, err)
+		logger.Log.Errorw("Error getting response: "+RedactURL(link), err)
 		return "", err
 	}
 
@@ -168,7 +189,7 @@ func DownloadPodcastCoverImage(link, podcastName string) (string, error) {
 
 	file, err := os.Create(cleanPath)
 	if err != nil {
-		logger.Log.Errorw("Error creating file"+link, err)
+		logger.Log.Errorw("Error creating file"+RedactURL(link), err)
 		return "", err
 	}
 	defer func() {
@@ -183,7 +204,7 @@ func DownloadPodcastCoverImage(link, podcastName string) (string, error) {
 		}
 	}()
 	if erra != nil {
-		logger.Log.Errorw("Error saving file"+link, err)
+		logger.Log.Errorw("Error saving file"+RedactURL(link), err)
 		return "", erra
 	}
 	changeOwnership(finalPath)
@@ -191,20 +212,24 @@ func DownloadPodcastCoverImage(link, podcastName string) (string, error) {
 }
 
 // DownloadImage download image.
-func DownloadImage(link, episodeID, podcastName string) (string, error) {
+func DownloadImage(link, episodeID, podcastName string, options *requestOptions) (string, error) {
 	if link == "" {
 		return "", errors.New("Download link empty")
 	}
-	client := httpClient()
-	req, err := getRequest(link)
+	client, err := options.httpClient(0, nil)
+	if err != nil {
+		logger.Log.Errorw("Error creating client: "+RedactURL(link), err)
+		return "", err
+	}
+	req, err := options.newRequest(http.MethodGet, link)
 	if err != nil {
-		logger.Log.Errorw("Error creating request: "+link, err)
+		logger.Log.Errorw("Error creating request: "+RedactURL(link), err)
 		return "", err
 	}
 
 	resp, err := client.Do(req) // #nosec G704 -- URL comes from user-provided podcast RSS feeds
 	if err != nil {
-		logger.Log.Errorw("Error getting response: "+link, err)
+		logger.Log.Errorw("Error getting response: "+RedactURL(link), err)
 		return "", err
 	}
 
@@ -226,7 +251,7 @@ func DownloadImage(link, episodeID, podcastName string) (string, error) {
 
 	file, err := os.Create(cleanPath)
 	if err != nil {
-		logger.Log.Errorw("Error creating file"+link, err)
+		logger.Log.Errorw("Error creating file"+RedactURL(link), err)
 		return "", err
 	}
 	defer func() {
@@ -241,7 +266,7 @@ func DownloadImage(link, episodeID, podcastName string) (string, error) {
 		}
 	}()
 	if erra != nil {
-		logger.Log.Errorw("Error saving file"+link, err)
+		logger.Log.Errorw("Error saving file"+RedactURL(link), err)
 		return "", erra
 	}
 	changeOwnership(finalPath)
@@ -321,7 +346,16 @@ func GetFileSizeFromURL(urlString string) (int64, error) {
 		return 0, err
 	}
 
-	resp, err := http.Head(urlString) // #nosec G107 -- URL validated by validateURL function above
+	options := globalRequestOptions()
+	client, err := options.httpClient(options.transport.connectTimeout+options.transport.readTimeout, nil)
+	if err != nil {
+		return 0, err
+	}
+	req, err := options.newRequest(http.MethodHead, urlString)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req) // #nosec G704 -- URL validated by validateURL and the egress policy
 	if err != nil {
 		return 0, err
 	}
@@ -347,6 +381,16 @@ func GetFileSizeFromURL(urlString string) (int64, error) {
 
 // CreateBackup create backup.
 func CreateBackup() (string, error) {
+	backupFileName, err := writeBackup()
+	if err == nil {
+		EmitWebhookEvent(WebhookBackupCreated, model.WebhookData{Backup: backupFileName})
+	}
+	return backupFileName, err
+}
+
+// writeBackup writes the database to a new tarball in the backups folder. The file is
+// complete once it returns.
+func writeBackup() (string, error) {
 	backupFileName := "podgrab_backup_" + time.Now().Format("2006.01.02_150405") + ".tar.gz"
 	folder := createConfigFolderIfNotExists("backups")
 	configPath := os.Getenv("CONFIG")
@@ -422,32 +466,6 @@ func addFileToTarWriter(filePath string, tarWriter *tar.Writer) error {
 
 	return nil
 }
-func httpClient() *http.Client {
-	client := http.Client{
-		CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
-			return nil
-		},
-	}
-
-	return &client
-}
-
-func getRequest(urlStr string) (*http.Request, error) {
-	req, err := http.NewRequest("GET", urlStr, http.NoBody)
-	if err != nil {
-		return nil, err
-	}
-
-	setting := db.GetOrCreateSetting()
-	if setting.UserAgent != "" {
-		req.Header.Add("User-Agent", setting.UserAgent)
-	} else {
-		req.Header.Add("User-Agent", "AppleCoreMedia/1.0.0.22B82 (iPhone; U; CPU OS 18_1 like Mac OS X; en_us)")
-	}
-	req.Header.Add("Accept", "*/*")
-
-	return req, nil
-}
 
 func createPreSanitizedPath(folderPath string) string {
 	if _, err := os.Stat(folderPath); os.IsNotExist(err) { // #nosec G703 -- folderPath comes from application-managed directory
@@ -359,7 +359,7 @@ func TestDownload(t *testing.T) {
 			defer server.Close()
 
 			// Download
-			filePath, err := Download(server.URL, tt.episodeTitle, tt.podcastName, tt.episodePathName)
+			filePath, err := Download(server.URL, tt.episodeTitle, tt.podcastName, tt.episodePathName, "", nil)
 
 			if tt.wantError {
 				assert.Error(t, err, "Expected error on failed download")
@@ -386,7 +386,7 @@ func TestDownload(t *testing.T) {
 
 // TestDownload_EmptyLink tests error handling for empty download link.
 func TestDownload_EmptyLink(t *testing.T) {
-	_, err := Download("", "Episode", "Podcast", "")
+	_, err := Download("", "Episode", "Podcast", "", "", nil)
 	assert.Error(t, err, "Should error on empty link")
 	assert.Contains(t, err.Error(), "empty", "Error should mention empty path")
 }
@@ -416,12 +416,12 @@ func TestDownload_ExistingFile(t *testing.T) {
 	defer server.Close()
 
 	// First download
-	filePath1, err := Download(server.URL, "Episode", "Podcast", "episode")
+	filePath1, err := Download(server.URL, "Episode", "Podcast", "episode", "", nil)
 	require.NoError(t, err)
 	assert.Equal(t, 1, callCount, "Should make HTTP request on first download")
 
 	// Second download (should skip because file exists)
-	filePath2, err := Download(server.URL, "Episode", "Podcast", "episode")
+	filePath2, err := Download(server.URL, "Episode", "Podcast", "episode", "", nil)
 	require.NoError(t, err)
 	assert.Equal(t, filePath1, filePath2, "Should return same path")
 	assert.Equal(t, 1, callCount, "Should not make HTTP request for existing file")
@@ -452,7 +452,7 @@ func TestDownloadPodcastCoverImage(t *testing.T) {
 	defer server.Close()
 
 	// Download image
-	imagePath, err := DownloadPodcastCoverImage(server.URL, "Test Podcast")
+	imagePath, err := DownloadPodcastCoverImage(server.URL, "Test Podcast", nil)
 	require.NoError(t, err, "Should download image without error")
 	assert.NotEmpty(t, imagePath, "Should return image path")
 	assert.FileExists(t, imagePath, "Should create image file")
@@ -465,7 +465,7 @@ func TestDownloadPodcastCoverImage(t *testing.T) {
 
 // TestDownloadPodcastCoverImage_EmptyLink tests error handling.
 func TestDownloadPodcastCoverImage_EmptyLink(t *testing.T) {
-	_, err := DownloadPodcastCoverImage("", "Podcast")
+	_, err := DownloadPodcastCoverImage("", "Podcast", nil)
 	assert.Error(t, err, "Should error on empty link")
 }
 
@@ -494,7 +494,7 @@ func TestDownloadImage(t *testing.T) {
 	defer server.Close()
 
 	// Download episode image
-	imagePath, err := DownloadImage(server.URL, "episode-id-123", "Test Podcast")
+	imagePath, err := DownloadImage(server.URL, "episode-id-123", "Test Podcast", nil)
 	require.NoError(t, err, "Should download image without error")
 	assert.NotEmpty(t, imagePath, "Should return image path")
 	assert.FileExists(t, imagePath, "Should create image file")
@@ -574,7 +574,8 @@ func TestDeletePodcastFolder(t *testing.T) {
 
 // TestHttpClient tests HTTP client configuration.
 func TestHttpClient(t *testing.T) {
-	client := httpClient()
+	client, err := (&requestOptions{}).httpClient(0, nil)
+	require.NoError(t, err, "Should create HTTP client without error")
 	require.NotNil(t, client, "Should create HTTP client")
 
 	// Verify it handles redirects
@@ -597,8 +598,9 @@ func TestGetRequest(t *testing.T) {
 	err := db.UpdateSettings(setting)
 	require.NoError(t, err, "Should update settings")
 
-	// Create request
-	req, err := getRequest("https://example.com/feed.xml")
+	// Create request with the global settings
+	var options *requestOptions
+	req, err := options.newRequest(http.MethodGet, "https://example.com/feed.xml")
 	require.NoError(t, err, "Should create request without error")
 	assert.NotNil(t, req, "Should return request")
 
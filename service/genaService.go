@@ -0,0 +1,183 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/gofrs/uuid/v5"
+	"github.com/toozej/podgrab/internal/logger"
+)
+
+// DLNAEventTimeout is how long an event subscription lasts unless it is renewed.
+const DLNAEventTimeout = 30 * time.Minute
+
+// dlnaNotifyTimeout bounds sending one event to a subscriber.
+const dlnaNotifyTimeout = 5 * time.Second
+
+// ErrDLNASubscription is returned for subscriptions that cannot be made, renewed or
+// cancelled, which UPnP answers with 412 Precondition Failed.
+var ErrDLNASubscription = errors.New("invalid or unknown event subscription")
+
+// dlnaSubscription is a control point subscribed to the events of a service.
+type dlnaSubscription struct {
+	callback *url.URL
+	expires  time.Time
+}
+
+// dlnaEventClient sends events. It does not follow redirects, which could lead away
+// from the subscriber.
+var dlnaEventClient = &http.Client{
+	Timeout: dlnaNotifyTimeout,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+var (
+	dlnaSubscriptionsMu sync.Mutex
+	dlnaSubscriptions   = make(map[string]*dlnaSubscription)
+	// dlnaEvents tracks the events being sent.
+	dlnaEvents sync.WaitGroup
+)
+
+// SubscribeDLNAEvents subscribes a control point to the events of a service and sends
+// it the current state variables in the background. The CALLBACK header lists the URLs
+// to send events to; only one on the address the subscription came from is used, so
+// subscriptions cannot point Podgrab at other hosts. It returns the subscription ID.
+func SubscribeDLNAEvents(serviceType, callbacks string, remoteIP net.IP, now time.Time) (string, error) {
+	callback := dlnaCallback(callbacks, remoteIP)
+	if callback == nil {
+		return "", fmt.Errorf("%w: no callback URL on %s", ErrDLNASubscription, remoteIP)
+	}
+	variables, err := dlnaEventVariables(serviceType)
+	if err != nil {
+		return "", err
+	}
+	sid := "uuid:" + uuid.Must(uuid.NewV4()).String()
+
+	dlnaSubscriptionsMu.Lock()
+	for id, subscription := range dlnaSubscriptions {
+		if now.After(subscription.expires) {
+			delete(dlnaSubscriptions, id)
+		}
+	}
+	dlnaSubscriptions[sid] = &dlnaSubscription{callback: callback, expires: now.Add(DLNAEventTimeout)}
+	dlnaSubscriptionsMu.Unlock()
+
+	dlnaEvents.Add(1)
+	go func() {
+		defer dlnaEvents.Done()
+		if err := sendDLNAEvent(callback, sid, variables); err != nil {
+			logger.Log.Warnw("sending DLNA event", "callback", callback.String(), "error", err)
+		}
+	}()
+	return sid, nil
+}
+
+// RenewDLNAEvents extends a subscription by DLNAEventTimeout.
+func RenewDLNAEvents(sid string, now time.Time) error {
+	dlnaSubscriptionsMu.Lock()
+	defer dlnaSubscriptionsMu.Unlock()
+	subscription, ok := dlnaSubscriptions[sid]
+	if !ok || now.After(subscription.expires) {
+		delete(dlnaSubscriptions, sid)
+		return ErrDLNASubscription
+	}
+	subscription.expires = now.Add(DLNAEventTimeout)
+	return nil
+}
+
+// UnsubscribeDLNAEvents cancels a subscription.
+func UnsubscribeDLNAEvents(sid string) error {
+	dlnaSubscriptionsMu.Lock()
+	defer dlnaSubscriptionsMu.Unlock()
+	if _, ok := dlnaSubscriptions[sid]; !ok {
+		return ErrDLNASubscription
+	}
+	delete(dlnaSubscriptions, sid)
+	return nil
+}
+
+// dlnaCallback returns the first http URL of a CALLBACK header, "<url1><url2>", whose
+// host is remoteIP.
+func dlnaCallback(callbacks string, remoteIP net.IP) *url.URL {
+	for _, part := range strings.Split(callbacks, ">") {
+		raw := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(part), "<"))
+		link, err := url.Parse(raw)
+		if err != nil || link.Scheme != "http" {
+			continue
+		}
+		if ip := net.ParseIP(link.Hostname()); ip != nil && ip.Equal(remoteIP) {
+			return link
+		}
+	}
+	return nil
+}
+
+// dlnaEventVariables returns the evented state variables of a service.
+func dlnaEventVariables(serviceType string) ([][2]string, error) {
+	switch serviceType {
+	case DLNAContentDirectoryType:
+		updateID, err := DLNASystemUpdateID()
+		if err != nil {
+			return nil, err
+		}
+		return [][2]string{{"SystemUpdateID", strconv.FormatUint(uint64(updateID), 10)}}, nil
+	case DLNAConnectionManagerType:
+		return [][2]string{
+			{"SourceProtocolInfo", DLNASourceProtocolInfo()},
+			{"SinkProtocolInfo", ""},
+			{"CurrentConnectionIDs", "0"},
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown service %s", ErrDLNASubscription, serviceType)
+}
+
+// sendDLNAEvent sends state variables to a subscriber as the initial GENA NOTIFY of its
+// subscription. Subscribers are players on the LAN, so the egress policy does not apply.
+func sendDLNAEvent(callback *url.URL, sid string, variables [][2]string) error {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0" encoding="utf-8"?><e:propertyset xmlns:e="urn:schemas-upnp-org:event-1-0">`)
+	for _, variable := range variables {
+		body.WriteString("<e:property><" + variable[0] + ">")
+		if err := xml.EscapeText(&body, []byte(variable[1])); err != nil {
+			return err
+		}
+		body.WriteString("</" + variable[0] + "></e:property>")
+	}
+	body.WriteString("</e:propertyset>")
+
+	req, err := http.NewRequestWithContext(context.Background(), "NOTIFY", callback.String(), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("NT", "upnp:event")
+	req.Header.Set("NTS", "upnp:propchange")
+	req.Header.Set("SID", sid)
+	req.Header.Set("SEQ", "0")
+	resp, err := dlnaEventClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			logger.Log.Errorw("closing DLNA event response", "error", closeErr)
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,472 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/internal/logger"
+	"github.com/toozej/podgrab/model"
+	"gorm.io/gorm"
+)
+
+// Episode actions of the gpodder sync API.
+const (
+	EpisodeActionDownload = "download"
+	EpisodeActionPlay     = "play"
+	EpisodeActionDelete   = "delete"
+	EpisodeActionNew      = "new"
+)
+
+// GPodderServerDevice is the device named in episode actions for playback in Podgrab
+// itself, such as the web player.
+const GPodderServerDevice = "podgrab"
+
+// gpodderTimeLayout is the timestamp format of episode actions, in UTC.
+const gpodderTimeLayout = "2006-01-02T15:04:05"
+
+// gpodderDeviceTypes are the device types the gpodder API knows.
+var gpodderDeviceTypes = map[string]bool{
+	"desktop": true,
+	"laptop":  true,
+	"mobile":  true,
+	"server":  true,
+	"other":   true,
+}
+
+// recordSubscriptionChange notes a podcast joining or leaving the library for sync
+// clients.
+func recordSubscriptionChange(url string, removed bool) {
+	if err := db.CreateSubscriptionChange(&db.SubscriptionChange{URL: url, Removed: removed}); err != nil {
+		logger.Log.Errorw("recording subscription change", "error", err, "url", url)
+	}
+}
+
+// GetGPodderDevices returns a user's sync devices. The library is shared, so every
+// device has every podcast subscribed.
+func GetGPodderDevices(userID string) ([]model.GPodderDevice, error) {
+	var devices []db.GPodderDevice
+	if err := db.GetGPodderDevicesByUserID(userID, &devices); err != nil {
+		return nil, err
+	}
+	urls, err := GetSubscriptionURLs()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]model.GPodderDevice, 0, len(devices))
+	for i := range devices {
+		result = append(result, model.GPodderDevice{
+			ID:            devices[i].DeviceID,
+			Caption:       devices[i].Caption,
+			Type:          devices[i].Type,
+			Subscriptions: len(urls),
+		})
+	}
+	return result, nil
+}
+
+// UpdateGPodderDevice creates a user's sync device or changes its caption and type.
+func UpdateGPodderDevice(userID, deviceID string, update model.GPodderDeviceUpdate) (*db.GPodderDevice, error) {
+	if strings.TrimSpace(deviceID) == "" {
+		return nil, fmt.Errorf("device ID is required")
+	}
+	if update.Type != nil && !gpodderDeviceTypes[*update.Type] {
+		return nil, fmt.Errorf("invalid device type: %q", *update.Type)
+	}
+	var device db.GPodderDevice
+	if err := db.GetGPodderDevice(userID, deviceID, &device); err != nil {
+		return nil, err
+	}
+	if update.Caption != nil {
+		device.Caption = *update.Caption
+	}
+	if update.Type != nil {
+		device.Type = *update.Type
+	}
+	if device.Type == "" {
+		device.Type = "other"
+	}
+	if err := db.SaveGPodderDevice(&device); err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// GetSubscriptionURLs returns the feed URLs of the podcasts in the library that are
+// not paused.
+func GetSubscriptionURLs() ([]string, error) {
+	var podcasts []db.Podcast
+	if err := db.GetAllPodcasts(&podcasts, ""); err != nil {
+		return nil, err
+	}
+	urls := make([]string, 0, len(podcasts))
+	for i := range podcasts {
+		if !podcasts[i].IsPaused {
+			urls = append(urls, podcasts[i].URL)
+		}
+	}
+	return urls, nil
+}
+
+// GetSubscriptionChanges returns the podcasts added to and removed from the library
+// since a time. A zero time returns every subscription as added.
+func GetSubscriptionChanges(since time.Time) (model.GPodderSubscriptionChanges, error) {
+	changes := model.GPodderSubscriptionChanges{Add: []string{}, Remove: []string{}}
+	if since.IsZero() {
+		urls, err := GetSubscriptionURLs()
+		changes.Add = urls
+		return changes, err
+	}
+	var recorded []db.SubscriptionChange
+	if err := db.GetSubscriptionChangesSince(since, &recorded); err != nil {
+		return changes, err
+	}
+	latest := map[string]bool{}
+	order := []string{}
+	for i := range recorded {
+		if _, ok := latest[recorded[i].URL]; !ok {
+			order = append(order, recorded[i].URL)
+		}
+		latest[recorded[i].URL] = recorded[i].Removed
+	}
+	for _, url := range order {
+		if latest[url] {
+			changes.Remove = append(changes.Remove, url)
+		} else {
+			changes.Add = append(changes.Add, url)
+		}
+	}
+	return changes, nil
+}
+
+// UpdateSubscriptions applies subscription changes uploaded by a device. Added feeds
+// join the library and get their episodes in the background, as fetching them takes a
+// while. Removed feeds are paused rather than deleted, since the library is shared. It
+// returns the URLs it rewrote or rejected.
+func UpdateSubscriptions(userID, deviceID string, changes model.GPodderSubscriptionChanges) ([][2]string, error) {
+	removed := map[string]bool{}
+	for _, url := range changes.Remove {
+		removed[strings.TrimSpace(url)] = true
+	}
+	for _, url := range changes.Add {
+		if removed[strings.TrimSpace(url)] {
+			return nil, fmt.Errorf("%s is both added and removed", url)
+		}
+	}
+	if _, err := UpdateGPodderDevice(userID, deviceID, model.GPodderDeviceUpdate{}); err != nil {
+		return nil, err
+	}
+
+	updateURLs := [][2]string{}
+	var toAdd []string
+	for _, original := range changes.Add {
+		url, ok := sanitizeSubscriptionURL(original)
+		if url != original {
+			updateURLs = append(updateURLs, [2]string{original, url})
+		}
+		if ok {
+			toAdd = append(toAdd, url)
+		}
+	}
+	for url := range removed {
+		var podcast db.Podcast
+		if err := db.GetPodcastByURL(url, &podcast); err != nil {
+			continue
+		}
+		if err := TogglePodcastPause(podcast.ID, true); err != nil {
+			return nil, err
+		}
+	}
+	var toCreate []string
+	for _, url := range toAdd {
+		var podcast db.Podcast
+		err := db.GetPodcastByURL(url, &podcast)
+		switch {
+		case err == nil && podcast.IsPaused:
+			if err := TogglePodcastPause(podcast.ID, false); err != nil {
+				return nil, err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			toCreate = append(toCreate, url)
+		case err != nil:
+			return nil, err
+		}
+	}
+	if len(toCreate) > 0 {
+		go func() {
+			for _, url := range toCreate {
+				podcast, err := AddPodcast(url)
+				if err != nil {
+					logger.Log.Errorw("adding podcast from sync", "error", err, "url", url, "device", deviceID)
+					continue
+				}
+				RefreshPodcast(&podcast)
+			}
+			if err := DownloadMissingEpisodes(); err != nil {
+				logger.Log.Errorw("downloading missing episodes", "error", err)
+			}
+		}()
+	}
+	return updateURLs, nil
+}
+
+// sanitizeSubscriptionURL trims a feed URL and reports whether it can be subscribed.
+// Rejected URLs come back empty.
+func sanitizeSubscriptionURL(original string) (string, bool) {
+	trimmed := strings.TrimSpace(original)
+	parsed, err := url.Parse(trimmed)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", false
+	}
+	return trimmed, true
+}
+
+// UploadEpisodeActions stores episode actions of a user and applies them to the
+// matching episodes: play saves the position, download queues the download and new
+// marks the episode unplayed. Delete is only passed on to other devices, as the files
+// are shared.
+func UploadEpisodeActions(userID string, actions []model.GPodderEpisodeAction, now time.Time) error {
+	records := make([]db.EpisodeAction, 0, len(actions))
+	for i := range actions {
+		record, err := newEpisodeAction(userID, &actions[i], now)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+	}
+	for i := range records {
+		if err := applyEpisodeAction(&records[i]); err != nil {
+			logger.Log.Errorw("applying episode action", "error", err, "action", records[i].Action, "episode", records[i].EpisodeURL)
+		}
+	}
+	return db.CreateEpisodeActions(records)
+}
+
+// newEpisodeAction checks an uploaded episode action and converts it for storage.
+func newEpisodeAction(userID string, action *model.GPodderEpisodeAction, now time.Time) (db.EpisodeAction, error) {
+	record := db.EpisodeAction{
+		UserID:     userID,
+		Device:     action.Device,
+		PodcastURL: strings.TrimSpace(action.Podcast),
+		EpisodeURL: strings.TrimSpace(action.Episode),
+		GUID:       action.GUID,
+		Action:     strings.ToLower(action.Action),
+		Timestamp:  now.UTC(),
+	}
+	if record.PodcastURL == "" || record.EpisodeURL == "" {
+		return record, fmt.Errorf("episode actions need a podcast and an episode")
+	}
+	switch record.Action {
+	case EpisodeActionDownload, EpisodeActionDelete, EpisodeActionNew:
+	case EpisodeActionPlay:
+		if action.Position == nil {
+			return record, fmt.Errorf("play action for %s needs a position", record.EpisodeURL)
+		}
+		record.Position = *action.Position
+		if action.Started != nil {
+			record.Started = *action.Started
+		}
+		if action.Total != nil {
+			record.Total = *action.Total
+		}
+		if record.Position < 0 || record.Started < 0 || record.Total < 0 {
+			return record, fmt.Errorf("play action for %s has a negative time", record.EpisodeURL)
+		}
+	default:
+		return record, fmt.Errorf("unknown episode action: %q", action.Action)
+	}
+	if action.Timestamp != "" {
+		timestamp, err := parseGPodderTime(action.Timestamp)
+		if err != nil {
+			return record, err
+		}
+		record.Timestamp = timestamp
+	}
+	return record, nil
+}
+
+// parseGPodderTime reads an episode action timestamp, in UTC unless it has a zone.
+func parseGPodderTime(value string) (time.Time, error) {
+	for _, layout := range []string{gpodderTimeLayout, "2006-01-02T15:04:05.999999999", time.RFC3339Nano} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp: %q", value)
+}
+
+// applyEpisodeAction changes the episode an action refers to, when it is in the library.
+func applyEpisodeAction(action *db.EpisodeAction) error {
+	item, err := findActionEpisode(action)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	switch action.Action {
+	case EpisodeActionPlay:
+		var state db.EpisodeState
+		if err := db.GetEpisodeState(action.UserID, item.ID, &state); err != nil {
+			return err
+		}
+		if action.Timestamp.Before(state.PositionUpdatedAt) {
+			return nil
+		}
+		_, err = SavePlaybackProgress(action.UserID, item.ID, action.Position, action.Total, action.Timestamp)
+		return err
+	case EpisodeActionDownload:
+		if item.DownloadStatus == db.Downloaded || item.DownloadStatus == db.Downloading {
+			return nil
+		}
+		return SetPodcastItemAsQueuedForDownload(item.ID)
+	case EpisodeActionNew:
+		return SetPodcastItemPlayedStatus(action.UserID, item.ID, false)
+	}
+	return nil
+}
+
+// findActionEpisode finds the episode of an action by its GUID, or else its media URL.
+func findActionEpisode(action *db.EpisodeAction) (*db.PodcastItem, error) {
+	var podcast db.Podcast
+	if err := db.GetPodcastByURL(action.PodcastURL, &podcast); err != nil {
+		return nil, err
+	}
+	var item db.PodcastItem
+	if action.GUID != "" {
+		if err := db.GetPodcastItemByPodcastIDAndGUID(podcast.ID, action.GUID, &item); err == nil {
+			return &item, nil
+		}
+	}
+	if err := db.GetPodcastItemByPodcastIDAndFileURL(podcast.ID, action.EpisodeURL, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetEpisodeActions returns a user's episode actions uploaded since a time, optionally
+// only those of a podcast or device. Positions saved by Podgrab's own player show up as
+// play actions of the GPodderServerDevice device. Aggregated keeps only the latest
+// action of each episode.
+func GetEpisodeActions(userID string, since time.Time, podcastURL, device string, aggregated bool) ([]model.GPodderEpisodeAction, error) {
+	var records []db.EpisodeAction
+	if err := db.GetEpisodeActions(userID, since, podcastURL, device, &records); err != nil {
+		return nil, err
+	}
+	if device == "" || device == GPodderServerDevice {
+		playback, err := serverPlaybackActions(userID, since, podcastURL)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, playback...)
+	}
+	if aggregated {
+		records = latestEpisodeActions(records)
+	}
+	actions := make([]model.GPodderEpisodeAction, 0, len(records))
+	for i := range records {
+		actions = append(actions, newGPodderEpisodeAction(&records[i]))
+	}
+	return actions, nil
+}
+
+// serverPlaybackActions turns positions saved since a time, other than those set by
+// uploaded play actions, into play actions.
+func serverPlaybackActions(userID string, since time.Time, podcastURL string) ([]db.EpisodeAction, error) {
+	var states []db.EpisodeState
+	if err := db.GetEpisodeStatesUpdatedSince(userID, since, &states); err != nil {
+		return nil, err
+	}
+	if len(states) == 0 {
+		return nil, nil
+	}
+	var uploaded []db.EpisodeAction
+	if err := db.GetEpisodeActions(userID, since, "", "", &uploaded); err != nil {
+		return nil, err
+	}
+	synced := map[string]bool{}
+	for i := range uploaded {
+		if uploaded[i].Action == EpisodeActionPlay {
+			synced[fmt.Sprint(uploaded[i].EpisodeURL, "|", uploaded[i].Position)] = true
+			if uploaded[i].GUID != "" {
+				synced[fmt.Sprint(uploaded[i].GUID, "|", uploaded[i].Position)] = true
+			}
+		}
+	}
+	ids := make([]string, 0, len(states))
+	for i := range states {
+		ids = append(ids, states[i].PodcastItemID)
+	}
+	items, err := GetAllPodcastItemsByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*db.PodcastItem, len(*items))
+	for i := range *items {
+		byID[(*items)[i].ID] = &(*items)[i]
+	}
+	var actions []db.EpisodeAction
+	for i := range states {
+		item, ok := byID[states[i].PodcastItemID]
+		if !ok || (podcastURL != "" && item.Podcast.URL != podcastURL) {
+			continue
+		}
+		if synced[fmt.Sprint(item.FileURL, "|", states[i].Position)] || (item.GUID != "" && synced[fmt.Sprint(item.GUID, "|", states[i].Position)]) {
+			continue
+		}
+		actions = append(actions, db.EpisodeAction{
+			Base:       db.Base{CreatedAt: states[i].PositionUpdatedAt},
+			UserID:     userID,
+			Device:     GPodderServerDevice,
+			PodcastURL: item.Podcast.URL,
+			EpisodeURL: item.FileURL,
+			GUID:       item.GUID,
+			Action:     EpisodeActionPlay,
+			Timestamp:  states[i].PositionUpdatedAt,
+			Position:   states[i].Position,
+			Total:      states[i].Duration,
+		})
+	}
+	return actions, nil
+}
+
+// latestEpisodeActions keeps the latest action of each episode, in upload order.
+func latestEpisodeActions(records []db.EpisodeAction) []db.EpisodeAction {
+	latest := map[string]int{}
+	for i := range records {
+		key := records[i].PodcastURL + "|" + records[i].EpisodeURL
+		if j, ok := latest[key]; !ok || !records[i].Timestamp.Before(records[j].Timestamp) {
+			latest[key] = i
+		}
+	}
+	result := make([]db.EpisodeAction, 0, len(latest))
+	for i := range records {
+		if latest[records[i].PodcastURL+"|"+records[i].EpisodeURL] == i {
+			result = append(result, records[i])
+		}
+	}
+	return result
+}
+
+// newGPodderEpisodeAction returns a stored episode action in the API format.
+func newGPodderEpisodeAction(record *db.EpisodeAction) model.GPodderEpisodeAction {
+	action := model.GPodderEpisodeAction{
+		Podcast:   record.PodcastURL,
+		Episode:   record.EpisodeURL,
+		GUID:      record.GUID,
+		Device:    record.Device,
+		Action:    record.Action,
+		Timestamp: record.Timestamp.UTC().Format(gpodderTimeLayout),
+	}
+	if record.Action == EpisodeActionPlay {
+		started, position, total := record.Started, record.Position, record.Total
+		action.Started = &started
+		action.Position = &position
+		action.Total = &total
+	}
+	return action
+}
@@ -0,0 +1,141 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toozej/podgrab/db"
+	testhelpers "github.com/toozej/podgrab/internal/testing"
+	"github.com/toozej/podgrab/model"
+)
+
+// TestGPodderSubscriptions tests that removing a subscription pauses the podcast and
+// that changes are reported since a time.
+func TestGPodderSubscriptions(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	podcast := db.CreateTestPodcast(t, database)
+	since := time.Now().Add(-time.Second)
+
+	all, err := GetSubscriptionChanges(time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{podcast.URL}, all.Add)
+	assert.Empty(t, all.Remove)
+
+	_, err = UpdateSubscriptions("alice", "phone", model.GPodderSubscriptionChanges{
+		Add:    []string{podcast.URL},
+		Remove: []string{podcast.URL},
+	})
+	assert.Error(t, err, "A feed cannot be added and removed at once")
+
+	updateURLs, err := UpdateSubscriptions("alice", "phone", model.GPodderSubscriptionChanges{
+		Add:    []string{"ftp://example.com/feed.xml"},
+		Remove: []string{podcast.URL},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, [][2]string{{"ftp://example.com/feed.xml", ""}}, updateURLs)
+
+	var paused db.Podcast
+	require.NoError(t, db.GetPodcastByID(podcast.ID, &paused))
+	assert.True(t, paused.IsPaused, "Removing a subscription should pause the podcast")
+	changes, err := GetSubscriptionChanges(since)
+	require.NoError(t, err)
+	assert.Equal(t, []string{podcast.URL}, changes.Remove)
+	assert.Empty(t, changes.Add)
+
+	_, err = UpdateSubscriptions("alice", "laptop", model.GPodderSubscriptionChanges{Add: []string{podcast.URL}})
+	require.NoError(t, err)
+	changes, err = GetSubscriptionChanges(since)
+	require.NoError(t, err)
+	assert.Equal(t, []string{podcast.URL}, changes.Add, "The latest change of a feed should win")
+	assert.Empty(t, changes.Remove)
+
+	devices, err := GetGPodderDevices("alice")
+	require.NoError(t, err)
+	require.Len(t, devices, 2, "Devices should be created when first used")
+	assert.Equal(t, "laptop", devices[0].ID)
+	assert.Equal(t, "other", devices[0].Type)
+	assert.Equal(t, 1, devices[0].Subscriptions)
+
+	kind := "fridge"
+	_, err = UpdateGPodderDevice("alice", "phone", model.GPodderDeviceUpdate{Type: &kind})
+	assert.Error(t, err)
+}
+
+// TestGPodderEpisodeActions tests that uploaded actions change the matching episodes
+// and are returned to other devices along with Podgrab's own playback.
+func TestGPodderEpisodeActions(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	podcast := db.CreateTestPodcast(t, database)
+	first := db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{FileURL: "https://example.com/first.mp3"})
+	second := db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{FileURL: "https://example.com/second.mp3"})
+	require.NoError(t, database.Model(second).Update("download_status", db.Deleted).Error)
+
+	now := time.Now().Truncate(time.Second)
+	position, total := 600, 1800
+	require.NoError(t, UploadEpisodeActions("alice", []model.GPodderEpisodeAction{
+		{Podcast: podcast.URL, Episode: "https://cdn.example.com/moved.mp3", GUID: first.GUID, Device: "phone", Action: "play", Position: &position, Total: &total},
+		{Podcast: podcast.URL, Episode: second.FileURL, Device: "phone", Action: "download"},
+		{Podcast: "https://example.com/unknown.xml", Episode: "https://example.com/unknown.mp3", Action: "delete"},
+	}, now))
+
+	state, err := GetPlaybackProgress("alice", first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 600, state.Position, "Play actions should be matched by GUID")
+	var queued db.PodcastItem
+	require.NoError(t, db.GetPodcastItemByID(second.ID, &queued))
+	assert.Equal(t, db.NotDownloaded, queued.DownloadStatus, "Download actions should queue the download")
+
+	older := 60
+	require.NoError(t, UploadEpisodeActions("alice", []model.GPodderEpisodeAction{
+		{Podcast: podcast.URL, Episode: first.FileURL, Action: "play", Position: &older, Timestamp: now.Add(-time.Hour).UTC().Format(gpodderTimeLayout)},
+	}, now))
+	state, err = GetPlaybackProgress("alice", first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 600, state.Position, "Older positions should not win")
+
+	assert.Error(t, UploadEpisodeActions("alice", []model.GPodderEpisodeAction{
+		{Podcast: podcast.URL, Episode: first.FileURL, Action: "play"},
+	}, now), "Play actions need a position")
+	assert.Error(t, UploadEpisodeActions("alice", []model.GPodderEpisodeAction{
+		{Podcast: podcast.URL, Episode: first.FileURL, Action: "skip"},
+	}, now))
+
+	_, err = SavePlaybackProgress("alice", second.ID, 300, 0, now.Add(time.Minute))
+	require.NoError(t, err)
+
+	actions, err := GetEpisodeActions("alice", now.Add(-time.Minute), "", "", false)
+	require.NoError(t, err)
+	require.Len(t, actions, 5, "Uploaded actions plus the web player's position")
+	last := actions[4]
+	assert.Equal(t, GPodderServerDevice, last.Device)
+	assert.Equal(t, second.FileURL, last.Episode)
+	require.NotNil(t, last.Position)
+	assert.Equal(t, 300, *last.Position)
+
+	actions, err = GetEpisodeActions("alice", now.Add(-time.Minute), podcast.URL, "phone", false)
+	require.NoError(t, err)
+	assert.Len(t, actions, 2)
+
+	actions, err = GetEpisodeActions("alice", now.Add(-time.Minute), podcast.URL, "", true)
+	require.NoError(t, err)
+	assert.Len(t, actions, 3, "Aggregated actions should keep one per episode")
+
+	actions, err = GetEpisodeActions("bob", time.Time{}, "", "", false)
+	require.NoError(t, err)
+	assert.Empty(t, actions)
+}
@@ -80,8 +80,14 @@ func getDefaultPodcastIndexSecret() string {
 // Query searches for podcasts using the Podcast Index API.
 func (service PodcastIndexService) Query(q string) []*model.CommonSearchResultModel {
 	key, secret := getPodcastIndexCredentials()
-	c := podcastindex.NewClient(key, secret)
 	var toReturn []*model.CommonSearchResultModel
+	options := globalRequestOptions()
+	client, err := options.httpClient(options.transport.connectTimeout+options.transport.readTimeout, nil)
+	if err != nil {
+		logger.Log.Errorw("creating Podcast Index client", "error", err)
+		return toReturn
+	}
+	c := podcastindex.NewClientWithConfig(key, secret, *podcastindex.DefaultConfig, client)
 	podcasts, err := c.Search(q)
 	if err != nil {
 		logger.Log.Fatal(err.Error())
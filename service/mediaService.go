@@ -0,0 +1,102 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"path"
+	"strings"
+
+	"github.com/toozej/podgrab/db"
+)
+
+// defaultMediaType is assumed for episodes whose media type cannot be told.
+const defaultMediaType = "audio/mpeg"
+
+// mediaTypes maps the extensions of the audio and video files podgrab handles to their MIME types.
+var mediaTypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+	".opus": "audio/ogg",
+	".wav":  "audio/wav",
+	".flac": "audio/flac",
+	".wma":  "audio/x-ms-wma",
+	".mp4":  "video/mp4",
+	".m4v":  "video/x-m4v",
+	".webm": "video/webm",
+	".mov":  "video/quicktime",
+	".mkv":  "video/x-matroska",
+}
+
+// mediaExtensions maps MIME types to the extension used for downloads without one.
+var mediaExtensions = map[string]string{
+	"audio/mpeg":       ".mp3",
+	"audio/mp3":        ".mp3",
+	"audio/mp4":        ".m4a",
+	"audio/x-m4a":      ".m4a",
+	"audio/aac":        ".aac",
+	"audio/ogg":        ".ogg",
+	"audio/opus":       ".opus",
+	"audio/wav":        ".wav",
+	"audio/x-wav":      ".wav",
+	"audio/flac":       ".flac",
+	"audio/x-ms-wma":   ".wma",
+	"video/mp4":        ".mp4",
+	"video/x-m4v":      ".m4v",
+	"video/webm":       ".webm",
+	"video/quicktime":  ".mov",
+	"video/x-matroska": ".mkv",
+}
+
+// MediaTypeForPath returns the MIME type of a media file or URL from its extension, or
+// an empty string when the extension is not a known media one.
+func MediaTypeForPath(name string) string {
+	return mediaTypes[strings.ToLower(path.Ext(enclosureFileName(name)))]
+}
+
+// MediaExtensionForType returns the file extension for a media MIME type, or an empty
+// string when the type is unknown.
+func MediaExtensionForType(mimeType string) string {
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+	if index := strings.IndexByte(mimeType, ';'); index >= 0 {
+		mimeType = strings.TrimSpace(mimeType[:index])
+	}
+	return mediaExtensions[mimeType]
+}
+
+// IsMediaFile reports whether a file name has a known audio or video extension.
+func IsMediaFile(name string) bool {
+	return MediaTypeForPath(name) != ""
+}
+
+// IsVideoType reports whether a MIME type is a video one.
+func IsVideoType(mimeType string) bool {
+	return strings.HasPrefix(strings.ToLower(mimeType), "video/")
+}
+
+// EpisodeMediaType returns the MIME type of an episode's media. The downloaded file is
+// trusted first, then the type announced by the feed, then the extension of the URL.
+func EpisodeMediaType(item *db.PodcastItem) string {
+	if mimeType := MediaTypeForPath(item.DownloadPath); mimeType != "" {
+		return mimeType
+	}
+	if item.EnclosureType != "" {
+		return item.EnclosureType
+	}
+	if mimeType := MediaTypeForPath(item.FileURL); mimeType != "" {
+		return mimeType
+	}
+	return defaultMediaType
+}
+
+// enclosureTypeForURL returns the announced MIME type of the media version an episode
+// is downloaded from.
+func enclosureTypeForURL(item *db.PodcastItem, link string) string {
+	for i := range item.Enclosures {
+		if item.Enclosures[i].URL == link && item.Enclosures[i].Type != "" {
+			return item.Enclosures[i].Type
+		}
+	}
+	return item.EnclosureType
+}
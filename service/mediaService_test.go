@@ -0,0 +1,67 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toozej/podgrab/db"
+	testhelpers "github.com/toozej/podgrab/internal/testing"
+)
+
+// TestMediaTypes tests the extension and MIME type mapping of audio and video media.
+func TestMediaTypes(t *testing.T) {
+	assert.Equal(t, "audio/mpeg", MediaTypeForPath("/data/show/episode.MP3"))
+	assert.Equal(t, "video/mp4", MediaTypeForPath("https://example.com/episode.mp4?token=abc"))
+	assert.Equal(t, "video/x-m4v", MediaTypeForPath("episode.m4v"))
+	assert.Equal(t, "video/webm", MediaTypeForPath("episode.webm"))
+	assert.Equal(t, "video/quicktime", MediaTypeForPath("episode.mov"))
+	assert.Empty(t, MediaTypeForPath("notes.txt"))
+
+	assert.Equal(t, ".mp4", MediaExtensionForType("video/mp4"))
+	assert.Equal(t, ".webm", MediaExtensionForType(" Video/WebM; codecs=vp9"))
+	assert.Empty(t, MediaExtensionForType("application/octet-stream"))
+
+	assert.True(t, IsMediaFile("episode.mov"))
+	assert.False(t, IsMediaFile("cover.jpg"))
+	assert.True(t, IsVideoType("video/webm"))
+	assert.False(t, IsVideoType("audio/mp4"))
+}
+
+// TestEpisodeMediaType tests how the served MIME type of an episode is chosen.
+func TestEpisodeMediaType(t *testing.T) {
+	tests := []struct {
+		name string
+		item db.PodcastItem
+		want string
+	}{
+		{name: "downloaded_file", item: db.PodcastItem{DownloadPath: "/data/show/episode.m4v", EnclosureType: "video/mp4"}, want: "video/x-m4v"},
+		{name: "announced_type", item: db.PodcastItem{FileURL: "https://example.com/media/42", EnclosureType: "video/webm"}, want: "video/webm"},
+		{name: "url_extension", item: db.PodcastItem{FileURL: "https://example.com/episode.mov"}, want: "video/quicktime"},
+		{name: "unknown", item: db.PodcastItem{FileURL: "https://example.com/media/42"}, want: "audio/mpeg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, EpisodeMediaType(&tt.item))
+		})
+	}
+}
+
+// TestDownload_VideoWithoutExtension tests that extensionless video links keep a video extension.
+func TestDownload_VideoWithoutExtension(t *testing.T) {
+	dataDir, cleanup := testhelpers.SetupTestDataDir(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("fake video content"))
+	}))
+	defer server.Close()
+
+	filePath, err := Download(server.URL+"/media/42", "Episode", "VideoPodcast", "episode", "video/mp4", nil)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dataDir, "VideoPodcast", "episode.mp4"), filepath.Clean(filePath))
+}
@@ -0,0 +1,386 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/toozej/podgrab/db"
+)
+
+// defaultUserAgent is sent when neither the settings nor the podcast set a User-Agent.
+const defaultUserAgent = "AppleCoreMedia/1.0.0.22B82 (iPhone; U; CPU OS 18_1 like Mac OS X; en_us)"
+
+// Network defaults used when the settings leave a timeout unset.
+const (
+	defaultConnectTimeout = 30 * time.Second
+	defaultReadTimeout    = 30 * time.Second
+)
+
+// requestOptions are the network settings and credentials applied to outbound requests.
+// A nil *requestOptions stands for the global settings.
+type requestOptions struct {
+	transport   transportOptions
+	userAgent   string
+	credentials *db.FeedCredentials
+	// credentialHost is the host of the feed. Credentials are sent to it and to the
+	// extra hosts listed in them.
+	credentialHost string
+	maxRedirects   int
+}
+
+// transportOptions are the settings that need their own connection pool.
+type transportOptions struct {
+	proxyURL       string
+	connectTimeout time.Duration
+	readTimeout    time.Duration
+	ipPreference   db.IPPreference
+	// blockInternal and egressAllowlist configure the egressPolicy.
+	blockInternal   bool
+	egressAllowlist string
+	// trustedProxy is set for the proxy of the settings, which may be an internal host.
+	// Podcast proxies are checked against the egress policy.
+	trustedProxy bool
+}
+
+var (
+	transportsMu sync.Mutex
+	transports   = make(map[transportOptions]*http.Transport)
+)
+
+// globalRequestOptions returns the request options from the global settings.
+func globalRequestOptions() *requestOptions {
+	setting := db.GetOrCreateSetting()
+	options := &requestOptions{
+		transport: transportOptions{
+			proxyURL:       setting.ProxyURL,
+			connectTimeout: secondsOr(setting.ConnectTimeout, defaultConnectTimeout),
+			readTimeout:    secondsOr(setting.ReadTimeout, defaultReadTimeout),
+			ipPreference:   setting.IPPreference,
+
+			blockInternal:   setting.BlockPrivateNetworks,
+			egressAllowlist: setting.EgressAllowlist,
+			trustedProxy:    true,
+		},
+		userAgent:    setting.UserAgent,
+		maxRedirects: setting.MaxRedirects,
+	}
+	if options.maxRedirects <= 0 {
+		options.maxRedirects = defaultMaxRedirects
+	}
+	if options.userAgent == "" {
+		options.userAgent = defaultUserAgent
+	}
+	return options
+}
+
+// podcastRequestOptions returns the global request options overridden by the network
+// settings of a podcast, with the podcast's credentials when withCredentials is set.
+func podcastRequestOptions(podcast *db.Podcast, withCredentials bool) *requestOptions {
+	options := globalRequestOptions()
+	if podcast.ProxyURL != "" && podcast.ProxyURL != options.transport.proxyURL {
+		options.transport.proxyURL = podcast.ProxyURL
+		options.transport.trustedProxy = false
+	}
+	if podcast.ConnectTimeout > 0 {
+		options.transport.connectTimeout = time.Duration(podcast.ConnectTimeout) * time.Second
+	}
+	if podcast.ReadTimeout > 0 {
+		options.transport.readTimeout = time.Duration(podcast.ReadTimeout) * time.Second
+	}
+	if podcast.IPPreference != "" {
+		options.transport.ipPreference = podcast.IPPreference
+	}
+	if podcast.UserAgent != "" {
+		options.userAgent = podcast.UserAgent
+	}
+	if withCredentials {
+		options.setCredentials(podcastCredentials(podcast), podcast.URL)
+	}
+	return options
+}
+
+// setCredentials sends credentials with requests to the host of a feed.
+func (options *requestOptions) setCredentials(credentials *db.FeedCredentials, feedURL string) {
+	options.credentials = credentials
+	options.credentialHost = ""
+	if parsed, err := url.Parse(feedURL); err == nil {
+		options.credentialHost = parsed.Host
+	}
+}
+
+// sendsCredentials reports whether a request to a URL gets the credentials: only
+// requests to the feed's host or to one of the extra hosts of the credentials do.
+func (options *requestOptions) sendsCredentials(link *url.URL) bool {
+	if options.credentials == nil {
+		return false
+	}
+	if options.credentialHost != "" && strings.EqualFold(link.Host, options.credentialHost) {
+		return true
+	}
+	for _, host := range options.credentials.Hosts {
+		if strings.EqualFold(link.Host, host) || strings.EqualFold(link.Hostname(), host) {
+			return true
+		}
+	}
+	return false
+}
+
+func secondsOr(seconds int, fallback time.Duration) time.Duration {
+	if seconds <= 0 {
+		return fallback
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// newRequest creates a request carrying the User-Agent and credentials.
+func (options *requestOptions) newRequest(method, link string) (*http.Request, error) {
+	if options == nil {
+		options = globalRequestOptions()
+	}
+	req, err := http.NewRequest(method, link, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", options.userAgent)
+	req.Header.Set("Accept", "*/*")
+	if options.sendsCredentials(req.URL) {
+		applyCredentials(req, options.credentials)
+	}
+	return req, nil
+}
+
+// httpClient returns a client using the proxy, timeouts, IP preference and egress
+// policy of the options. A zero timeout leaves the total request time unbounded; reads
+// still time out when the server stops sending. Redirects are followed up to the
+// configured limit and onRedirect, when set, sees every hop.
+func (options *requestOptions) httpClient(timeout time.Duration, onRedirect func(req *http.Request)) (*http.Client, error) {
+	if options == nil {
+		options = globalRequestOptions()
+	}
+	transport, err := sharedTransport(options.transport)
+	if err != nil {
+		return nil, err
+	}
+	maxRedirects := options.maxRedirects
+	if maxRedirects <= 0 {
+		maxRedirects = defaultMaxRedirects
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			if options.credentials != nil && !options.sendsCredentials(req.URL) {
+				removeCredentials(req, options.credentials)
+			}
+			if onRedirect != nil {
+				onRedirect(req)
+			}
+			return nil
+		},
+	}, nil
+}
+
+// adminHTTPClient returns a client for URLs set up by admins, such as webhooks and
+// notifiers. They usually call services on the local network, so the egress policy
+// does not apply; the proxy and timeouts do.
+func adminHTTPClient(timeout time.Duration) (*http.Client, error) {
+	options := globalRequestOptions()
+	options.transport.blockInternal = false
+	return options.httpClient(timeout, nil)
+}
+
+// sharedTransport returns the transport for a set of options, creating it once so
+// connections are reused across requests.
+func sharedTransport(options transportOptions) (*http.Transport, error) {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	if transport, ok := transports[options]; ok {
+		return transport, nil
+	}
+
+	base, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("unexpected default transport %T", http.DefaultTransport)
+	}
+	transport := base.Clone()
+	proxy, err := proxyFunc(options.proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := newEgressPolicy(options.blockInternal, options.egressAllowlist)
+	if err != nil {
+		return nil, err
+	}
+	transport.Proxy = policy.guardProxy(proxy, options.trustedProxy)
+	dialer := &net.Dialer{Timeout: options.connectTimeout, KeepAlive: 30 * time.Second}
+	transport.DialContext = dialContext(dialer, options.ipPreference, options.readTimeout, policy)
+	transport.TLSHandshakeTimeout = options.connectTimeout
+	transport.ResponseHeaderTimeout = options.readTimeout
+
+	transports[options] = transport
+	return transport, nil
+}
+
+// proxyFunc returns the proxy selection for a proxy setting. An empty setting uses the
+// HTTP_PROXY and HTTPS_PROXY environment variables and "direct" disables proxying.
+func proxyFunc(proxyURL string) (func(*http.Request) (*url.URL, error), error) {
+	switch proxyURL {
+	case "":
+		return http.ProxyFromEnvironment, nil
+	case ProxyDirect:
+		return nil, nil
+	}
+	if err := ValidateProxyURL(proxyURL); err != nil {
+		return nil, err
+	}
+	parsed, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	return http.ProxyURL(parsed), nil
+}
+
+// ProxyDirect is the proxy setting that bypasses any proxy.
+const ProxyDirect = "direct"
+
+// ValidateProxyURL checks that a proxy setting is empty, "direct" or an http, https or
+// socks5 URL with a host.
+func ValidateProxyURL(proxyURL string) error {
+	if proxyURL == "" || proxyURL == ProxyDirect {
+		return nil
+	}
+	parsed, err := url.Parse(proxyURL)
+	if err != nil {
+		return fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch parsed.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("unsupported proxy scheme: %q", parsed.Scheme)
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("proxy URL has no host: %q", RedactURL(proxyURL))
+	}
+	return nil
+}
+
+// dialContext dials the addresses of a host the egress policy allows in the order of
+// the IP preference and wraps connections so reads time out when the server stops
+// sending. Checking the resolved addresses at dial time covers every redirect hop.
+func dialContext(dialer *net.Dialer, preference db.IPPreference, readTimeout time.Duration, policy *egressPolicy) func(context.Context, string, string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dialPreferred(ctx, dialer, preference, policy.dialCheck(address), network, address)
+		if err != nil {
+			return nil, err
+		}
+		if readTimeout > 0 {
+			return &readTimeoutConn{Conn: conn, timeout: readTimeout}, nil
+		}
+		return conn, nil
+	}
+}
+
+// dialPreferred dials the IPv4 or IPv6 addresses of a host first, falling back to the
+// other family. Only the addresses passing the check, when there is one, are dialed.
+func dialPreferred(ctx context.Context, dialer *net.Dialer, preference db.IPPreference, check func(string, net.IP) error, network, address string) (net.Conn, error) {
+	if check == nil && preference != db.IPPreferenceIPv4 && preference != db.IPPreferenceIPv6 {
+		return dialer.DialContext(ctx, network, address)
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := allowedAddrs(ctx, host, check)
+	if err != nil {
+		return nil, err
+	}
+	preferred := make([]net.IPAddr, 0, len(addrs))
+	var others []net.IPAddr
+	for _, addr := range addrs {
+		if preference != db.IPPreferenceIPv4 && preference != db.IPPreferenceIPv6 ||
+			(addr.IP.To4() != nil) == (preference == db.IPPreferenceIPv4) {
+			preferred = append(preferred, addr)
+		} else {
+			others = append(others, addr)
+		}
+	}
+
+	var lastErr error
+	for _, addr := range append(preferred, others...) {
+		conn, dialErr := dialer.DialContext(ctx, network, net.JoinHostPort(addr.String(), port))
+		if dialErr == nil {
+			return conn, nil
+		}
+		lastErr = dialErr
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no addresses found for %s", host)
+	}
+	return nil, lastErr
+}
+
+// readTimeoutConn fails reads that wait longer than the timeout for data.
+type readTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (conn *readTimeoutConn) Read(buffer []byte) (int, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(conn.timeout)); err != nil {
+		return 0, err
+	}
+	return conn.Conn.Read(buffer)
+}
+
+// SetPodcastNetwork set the network overrides of a podcast. Empty values and zero
+// timeouts fall back to the global settings.
+func SetPodcastNetwork(id, proxyURL, userAgent string, connectTimeout, readTimeout int, ipPreference db.IPPreference) error {
+	if err := validateNetworkSettings(proxyURL, userAgent, connectTimeout, readTimeout); err != nil {
+		return err
+	}
+	if ipPreference != "" && !ipPreference.IsValid() {
+		return fmt.Errorf("invalid IP preference: %q", ipPreference)
+	}
+	var podcast db.Podcast
+	err := db.GetPodcastByID(id, &podcast)
+	if err != nil {
+		return err
+	}
+
+	return db.UpdatePodcastNetwork(id, proxyURL, userAgent, connectTimeout, readTimeout, ipPreference)
+}
+
+// validateNetworkSettings checks a proxy, User-Agent and timeouts in seconds before
+// they are stored.
+func validateNetworkSettings(proxyURL, userAgent string, connectTimeout, readTimeout int) error {
+	if err := ValidateProxyURL(proxyURL); err != nil {
+		return err
+	}
+	if strings.ContainsAny(userAgent, "\r\n") {
+		return errors.New("user agent must not contain line breaks")
+	}
+	if connectTimeout < 0 || connectTimeout > maxTimeoutSeconds {
+		return fmt.Errorf("invalid connect timeout: %d seconds", connectTimeout)
+	}
+	if readTimeout < 0 || readTimeout > maxTimeoutSeconds {
+		return fmt.Errorf("invalid read timeout: %d seconds", readTimeout)
+	}
+	return nil
+}
+
+// maxTimeoutSeconds bounds the connect and read timeouts.
+const maxTimeoutSeconds = 3600
@@ -0,0 +1,154 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/model"
+)
+
+// NextcloudLoginDuration is how long a Nextcloud login flow waits for the user to
+// grant access.
+const NextcloudLoginDuration = 20 * time.Minute
+
+// NextcloudSyncDevice is the device recorded for changes synced through the Nextcloud
+// API, which has no devices of its own.
+const NextcloudSyncDevice = "nextcloud"
+
+var (
+	// ErrLoginFlowNotFound is returned for login flows that do not exist or expired.
+	ErrLoginFlowNotFound = errors.New("login flow not found")
+	// ErrLoginFlowPending is returned while the user has not granted access yet.
+	ErrLoginFlowPending = errors.New("login flow not granted yet")
+)
+
+// NextcloudLoginFlow is a pending Nextcloud login, in which an app waits for the user to
+// grant it access in the browser.
+type NextcloudLoginFlow struct {
+	PollToken   string
+	FlowToken   string
+	AppName     string
+	ExpiresAt   time.Time
+	LoginName   string
+	AppPassword string
+	// granted is set once the user granted access, before the app password exists.
+	granted bool
+}
+
+// nextcloudLogins holds the pending login flows by poll and flow token. They only
+// live for minutes, so they are not stored.
+var nextcloudLogins = struct {
+	sync.Mutex
+	byPoll map[string]*NextcloudLoginFlow
+	byFlow map[string]*NextcloudLoginFlow
+}{
+	byPoll: map[string]*NextcloudLoginFlow{},
+	byFlow: map[string]*NextcloudLoginFlow{},
+}
+
+// StartNextcloudLogin starts a login flow for an app, named by its user agent.
+func StartNextcloudLogin(appName string, now time.Time) (*NextcloudLoginFlow, error) {
+	pollToken, err := randomSecret()
+	if err != nil {
+		return nil, err
+	}
+	flowToken, err := randomSecret()
+	if err != nil {
+		return nil, err
+	}
+	appName = strings.TrimSpace(appName)
+	if appName == "" {
+		appName = "Podcast app"
+	}
+	flow := &NextcloudLoginFlow{
+		PollToken: pollToken,
+		FlowToken: flowToken,
+		AppName:   appName,
+		ExpiresAt: now.Add(NextcloudLoginDuration),
+	}
+	nextcloudLogins.Lock()
+	defer nextcloudLogins.Unlock()
+	deleteExpiredNextcloudLogins(now)
+	nextcloudLogins.byPoll[pollToken] = flow
+	nextcloudLogins.byFlow[flowToken] = flow
+	return flow, nil
+}
+
+// GetNextcloudLogin returns the login flow shown to the user in the browser.
+func GetNextcloudLogin(flowToken string, now time.Time) (NextcloudLoginFlow, error) {
+	nextcloudLogins.Lock()
+	defer nextcloudLogins.Unlock()
+	flow, ok := nextcloudLogins.byFlow[flowToken]
+	if !ok || !now.Before(flow.ExpiresAt) || flow.granted {
+		return NextcloudLoginFlow{}, ErrLoginFlowNotFound
+	}
+	return *flow, nil
+}
+
+// GrantNextcloudLogin gives the app of a login flow a sync token of the user, which the
+// app picks up as its app password. A flow is granted once, so submitting the form
+// twice does not create two tokens.
+func GrantNextcloudLogin(flowToken string, user *db.User, now time.Time) error {
+	nextcloudLogins.Lock()
+	flow, ok := nextcloudLogins.byFlow[flowToken]
+	if !ok || !now.Before(flow.ExpiresAt) || flow.granted {
+		nextcloudLogins.Unlock()
+		return ErrLoginFlowNotFound
+	}
+	flow.granted = true
+	nextcloudLogins.Unlock()
+
+	value, _, err := CreateAPIToken(user.ID, flow.AppName, db.TokenScopeSync, 0)
+	nextcloudLogins.Lock()
+	defer nextcloudLogins.Unlock()
+	if err != nil {
+		flow.granted = false
+		return err
+	}
+	flow.LoginName = user.Username
+	flow.AppPassword = value
+	return nil
+}
+
+// PollNextcloudLogin returns the user name and app password of a granted login flow,
+// once, and ErrLoginFlowPending until the user grants access.
+func PollNextcloudLogin(pollToken string, now time.Time) (string, string, error) {
+	nextcloudLogins.Lock()
+	defer nextcloudLogins.Unlock()
+	flow, ok := nextcloudLogins.byPoll[pollToken]
+	if !ok || !now.Before(flow.ExpiresAt) {
+		return "", "", ErrLoginFlowNotFound
+	}
+	if flow.AppPassword == "" {
+		return "", "", ErrLoginFlowPending
+	}
+	delete(nextcloudLogins.byPoll, flow.PollToken)
+	delete(nextcloudLogins.byFlow, flow.FlowToken)
+	return flow.LoginName, flow.AppPassword, nil
+}
+
+// deleteExpiredNextcloudLogins forgets login flows past their expiry. The caller holds
+// the lock.
+func deleteExpiredNextcloudLogins(now time.Time) {
+	for pollToken, flow := range nextcloudLogins.byPoll {
+		if !now.Before(flow.ExpiresAt) {
+			delete(nextcloudLogins.byPoll, pollToken)
+			delete(nextcloudLogins.byFlow, flow.FlowToken)
+		}
+	}
+}
+
+// UploadNextcloudEpisodeActions stores and applies episode actions uploaded through the
+// Nextcloud API, recorded for the NextcloudSyncDevice device.
+func UploadNextcloudEpisodeActions(userID string, actions []model.GPodderEpisodeAction, now time.Time) error {
+	for i := range actions {
+		if actions[i].Device == "" {
+			actions[i].Device = NextcloudSyncDevice
+		}
+	}
+	return UploadEpisodeActions(userID, actions, now)
+}
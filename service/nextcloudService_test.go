@@ -0,0 +1,73 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toozej/podgrab/db"
+	testhelpers "github.com/toozej/podgrab/internal/testing"
+)
+
+// TestNextcloudLoginFlow tests granting a login flow once and that flows expire.
+func TestNextcloudLoginFlow(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	user, err := EnsureDefaultUser("admin-password")
+	require.NoError(t, err)
+	now := time.Now()
+
+	flow, err := StartNextcloudLogin(" ", now)
+	require.NoError(t, err)
+	assert.Equal(t, "Podcast app", flow.AppName)
+	_, _, err = PollNextcloudLogin(flow.PollToken, now)
+	assert.ErrorIs(t, err, ErrLoginFlowPending)
+	_, _, err = PollNextcloudLogin(flow.FlowToken, now)
+	assert.ErrorIs(t, err, ErrLoginFlowNotFound, "The flow token must not reveal the credentials")
+
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = GrantNextcloudLogin(flow.FlowToken, user, now)
+		}()
+	}
+	wg.Wait()
+	granted := 0
+	for _, err := range errs {
+		if err == nil {
+			granted++
+		} else {
+			assert.ErrorIs(t, err, ErrLoginFlowNotFound)
+		}
+	}
+	assert.Equal(t, 1, granted, "A flow should only be granted once")
+	tokens, err := GetAPITokens(user.ID)
+	require.NoError(t, err)
+	assert.Len(t, tokens, 1)
+
+	loginName, appPassword, err := PollNextcloudLogin(flow.PollToken, now)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultUsername, loginName)
+	token, err := AuthenticateAPIToken(appPassword, now)
+	require.NoError(t, err)
+	assert.Equal(t, db.TokenScopeSync, token.Scope)
+	assert.Equal(t, "Podcast app", token.Name)
+
+	expired, err := StartNextcloudLogin("AntennaPod", now)
+	require.NoError(t, err)
+	later := now.Add(NextcloudLoginDuration)
+	assert.ErrorIs(t, GrantNextcloudLogin(expired.FlowToken, user, later), ErrLoginFlowNotFound)
+	_, _, err = PollNextcloudLogin(expired.PollToken, later)
+	assert.ErrorIs(t, err, ErrLoginFlowNotFound)
+}
@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -31,15 +33,23 @@ func ParseOpml(content string) (model.OpmlModel, error) {
 	return response, err
 }
 
-// FetchURL is
-func FetchURL(url string) (model.PodcastData, []byte, error) {
-	body, err := makeQuery(url)
+// FetchURL fetches a feed and parses it into the common feed model.
+// RSS 2.0, Atom 1.0 and JSON Feed documents are supported.
+func FetchURL(url string) (model.Feed, []byte, error) {
+	return fetchFeed(url, nil)
+}
+
+// fetchFeed fetches a feed like FetchURL with the network settings and credentials of
+// a podcast.
+func fetchFeed(url string, options *requestOptions) (model.Feed, []byte, error) {
+	fetched, err := makeFeedQuery(url, options)
 	if err != nil {
-		return model.PodcastData{}, nil, err
+		return model.Feed{StatusCode: fetched.statusCode}, nil, err
 	}
-	var response model.PodcastData
-	err = xml.Unmarshal(body, &response)
-	return response, body, err
+	response, err := ParseFeed(fetched.body)
+	response.RedirectURL = fetched.movedTo
+	response.StatusCode = fetched.statusCode
+	return response, fetched.body, err
 }
 
 // GetPodcastByID get podcast by id.
@@ -173,7 +183,7 @@ func ExportOmpl(usePodgrabLink bool, baseURL string) ([]byte, error) {
 
 	outlines := make([]model.OpmlOutline, 0, len(*podcasts))
 	for i := range *podcasts {
-		xmlURL := (*podcasts)[i].URL
+		xmlURL := RedactURL((*podcasts)[i].URL)
 		if usePodgrabLink {
 			xmlURL = fmt.Sprintf("%s/podcasts/%s/rss", baseURL, (*podcasts)[i].ID)
 		}
@@ -230,31 +240,66 @@ func getItunesImageURL(body []byte) string {
 
 // AddPodcast add podcast.
 func AddPodcast(url string) (db.Podcast, error) {
+	return AddPrivatePodcast(url, nil)
+}
+
+// AddPrivatePodcast add a podcast whose feed and media need credentials. A user and
+// password embedded in the URL are moved into the stored credentials.
+func AddPrivatePodcast(url string, credentials *db.FeedCredentials) (db.Podcast, error) {
+	url, urlCredentials := splitURLCredentials(url)
+	if urlCredentials != nil && (credentials == nil || (credentials.Username == "" && credentials.Password == "")) {
+		if credentials != nil {
+			urlCredentials.Headers = credentials.Headers
+			urlCredentials.Cookies = credentials.Cookies
+		}
+		credentials = urlCredentials
+	}
+	encrypted, err := encryptCredentials(credentials)
+	if err != nil {
+		return db.Podcast{}, err
+	}
+
 	var podcast db.Podcast
-	err := db.GetPodcastByURL(url, &podcast)
+	err = db.GetPodcastByURL(url, &podcast)
 	setting := db.GetOrCreateSetting()
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		data, body, fetchErr := FetchURL(url)
+		options := globalRequestOptions()
+		options.setCredentials(credentials, url)
+		data, _, fetchErr := fetchFeed(url, options)
 		if fetchErr != nil {
 			logger.Log.Errorw("Error adding podcast", "error", fetchErr)
 			return db.Podcast{}, fetchErr
 		}
-
-		podcastItem := db.Podcast{
-			Title:   data.Channel.Title,
-			Summary: strip.StripTags(data.Channel.Summary),
-			Author:  data.Channel.Author,
-			Image:   data.Channel.Image.URL,
-			URL:     url,
+		if newURL := feedMoveTarget(url, &data); newURL != "" {
+			if existingErr := db.GetPodcastByURL(newURL, &podcast); existingErr == nil {
+				return podcast, &model.PodcastAlreadyExistsError{URL: newURL}
+			}
+			url = newURL
 		}
 
-		if podcastItem.Image == "" {
-			podcastItem.Image = getItunesImageURL(body)
+		podcastItem := db.Podcast{
+			Title:      data.Title,
+			Summary:    strip.StripTags(data.Summary),
+			Author:     data.Author,
+			Image:      data.Image,
+			URL:        url,
+			Category:   data.Category,
+			Language:   data.Language,
+			Explicit:   parseExplicit(data.Explicit),
+			OwnerName:  data.OwnerName,
+			OwnerEmail: data.OwnerEmail,
+			Copyright:  data.Copyright,
+			// Credentials are stored encrypted and never serialized.
+			Credentials: encrypted,
 		}
 
 		err = db.CreatePodcast(&podcastItem)
+		if err == nil {
+			recordSubscriptionChange(podcastItem.URL, false)
+			EmitWebhookEvent(WebhookPodcastAdded, model.WebhookData{Podcast: webhookPodcast(&podcastItem)})
+		}
 		go func() {
-			if _, dlErr := DownloadPodcastCoverImage(podcastItem.Image, podcastItem.Title); dlErr != nil {
+			if _, dlErr := DownloadPodcastCoverImage(podcastItem.Image, podcastItem.Title, nil); dlErr != nil {
 				logger.Log.Errorw("downloading podcast cover image", "error", dlErr)
 			}
 		}()
@@ -306,6 +351,12 @@ func parsePubDate(dateStr string) time.Time {
 		return pubDate
 	}
 
+	// RFC3339 is used by Atom and JSON Feed: "2006-01-02T15:04:05Z07:00"
+	pubDate, dateErr = time.Parse(time.RFC3339, toParse)
+	if dateErr == nil && !pubDate.Equal(time.Time{}) {
+		return pubDate
+	}
+
 	logger.Log.Warnw("Cannot format date", "date_string", dateStr)
 	return time.Time{}
 }
@@ -335,14 +386,23 @@ func determineDownloadStatus(setting *db.Setting, podcast *db.Podcast, newPodcas
 	return db.Deleted
 }
 
-// parseDuration safely parses a duration string to integer.
-func parseDuration(durationStr string) int {
-	duration, parseErr := strconv.Atoi(durationStr)
-	if parseErr != nil {
-		logger.Log.Errorw("parsing duration", "error", parseErr)
+// parseEpisodeNumber parses an itunes:episode or itunes:season value, returning 0 when absent or invalid.
+func parseEpisodeNumber(numberStr string) int {
+	number, parseErr := strconv.Atoi(strings.TrimSpace(numberStr))
+	if parseErr != nil || number < 0 {
 		return 0
 	}
-	return duration
+	return number
+}
+
+// parseExplicit interprets the values publishers use for itunes:explicit.
+func parseExplicit(explicitStr string) bool {
+	switch strings.ToLower(strings.TrimSpace(explicitStr)) {
+	case "yes", "true", "explicit":
+		return true
+	default:
+		return false
+	}
 }
 
 // extractSummary extracts summary from RSS item, falling back to description if needed.
@@ -356,42 +416,57 @@ func extractSummary(summary, description string) string {
 
 // AddPodcastItems add podcast items.
 func AddPodcastItems(podcast *db.Podcast, newPodcast bool) error {
-	data, _, err := FetchURL(podcast.URL)
+	data, _, err := fetchFeed(podcast.URL, podcastRequestOptions(podcast, true))
 	if err != nil {
+		recordFeedHealth(podcast, data.StatusCode, err, 0)
 		return err
 	}
+	applyFeedMove(podcast, &data)
+	if !newPodcast {
+		refreshPodcastMetadata(podcast, &data)
+	}
 	setting := db.GetOrCreateSetting()
 	limit := setting.InitialDownloadCount
 
-	// Extract all GUIDs for bulk lookup
+	// Give entries without a GUID a stable fallback identity
 	var allGuids []string
-	for i := 0; i < len(data.Channel.Item); i++ {
-		allGuids = append(allGuids, data.Channel.Item[i].GUID.Text)
+	guidMissing := make([]bool, len(data.Items))
+	for i := 0; i < len(data.Items); i++ {
+		guidMissing[i] = strings.TrimSpace(data.Items[i].GUID) == ""
+		data.Items[i].GUID = feedItemGUID(&data.Items[i])
+		allGuids = append(allGuids, data.Items[i].GUID)
 	}
 
-	// Build existing items map
-	existingItems, err := db.GetPodcastItemsByPodcastIDAndGUIDs(podcast.ID, allGuids)
-	keyMap := make(map[string]int)
-	for i := range *existingItems {
-		keyMap[(*existingItems)[i].GUID] = 1
+	// Index the episodes we already know
+	var existingItems []db.PodcastItem
+	if err := db.GetAllPodcastItemsByPodcastID(podcast.ID, &existingItems); err != nil {
+		return err
 	}
+	index := newEpisodeIndex(existingItems)
 
 	var latestDate = time.Time{}
 	var itemsAdded = make(map[string]string)
 
-	// Process each RSS item
-	for i := 0; i < len(data.Channel.Item); i++ {
-		obj := data.Channel.Item[i]
-		_, keyExists := keyMap[obj.GUID.Text]
-		if keyExists {
+	// Process each feed item
+	for i := 0; i < len(data.Items); i++ {
+		obj := &data.Items[i]
+		season := parseEpisodeNumber(obj.Season)
+		episodeNumber := parseEpisodeNumber(obj.Episode)
+		if existing := index.match(podcast.DedupeMode, obj, guidMissing[i]); existing != nil {
+			if existing.GUID != obj.GUID {
+				adoptFeedGUID(existing, obj.GUID)
+			}
+			backfillFeedMetadata(existing, season, episodeNumber, parseExplicit(obj.Explicit))
+			backfillDuration(existing, parseDuration(obj.Duration))
+			detectEnclosureChange(podcast, existing, obj)
+			syncPodcastItemEnclosures(existing, feedItemEnclosures(obj))
 			continue
 		}
 
 		// Parse item fields
 		duration := parseDuration(obj.Duration)
-		pubDate := parsePubDate(obj.PubDate)
+		pubDate := obj.PubDate
 		downloadStatus := determineDownloadStatus(setting, podcast, newPodcast, i, limit)
-		summary := extractSummary(obj.Summary, obj.Description)
 
 		// Track latest episode date
 		if latestDate.Before(pubDate) {
@@ -400,20 +475,31 @@ func AddPodcastItems(podcast *db.Podcast, newPodcast bool) error {
 
 		// Create podcast item
 		podcastItem := db.PodcastItem{
-			PodcastID:      podcast.ID,
-			Title:          obj.Title,
-			Summary:        summary,
-			EpisodeType:    obj.EpisodeType,
-			Duration:       duration,
-			PubDate:        pubDate,
-			FileURL:        obj.Enclosure.URL,
-			GUID:           obj.GUID.Text,
-			Image:          obj.Image.Href,
-			DownloadStatus: downloadStatus,
+			PodcastID:       podcast.ID,
+			Title:           obj.Title,
+			Summary:         obj.Summary,
+			EpisodeType:     obj.EpisodeType,
+			Duration:        duration,
+			PubDate:         pubDate,
+			FileURL:         obj.Enclosure.URL,
+			EnclosureLength: parseEnclosureLength(obj.Enclosure.Length),
+			EnclosureType:   obj.Enclosure.Type,
+			Enclosures:      feedItemEnclosures(obj),
+			GUID:            obj.GUID,
+			Image:           obj.Image,
+			Season:          season,
+			EpisodeNumber:   episodeNumber,
+			Explicit:        parseExplicit(obj.Explicit),
+			DownloadStatus:  downloadStatus,
 		}
 		if createErr := db.CreatePodcastItem(&podcastItem); createErr != nil {
 			logger.Log.Errorw("creating podcast item", "error", createErr)
+		} else if !newPodcast {
+			// The back catalog of a new podcast is announced by podcast.added instead.
+			podcastItem.Podcast = *podcast
+			emitEpisodeEvent(WebhookEpisodeDiscovered, &podcastItem, nil)
 		}
+		index.add(&podcastItem)
 		itemsAdded[podcastItem.ID] = podcastItem.FileURL
 	}
 
@@ -423,9 +509,306 @@ func AddPodcastItems(podcast *db.Podcast, newPodcast bool) error {
 			logger.Log.Errorw("updating last episode date", "error", updateErr)
 		}
 	}
+	trackRemovedUpstream(podcast, allGuids)
+	recordFeedHealth(podcast, data.StatusCode, nil, len(itemsAdded))
 	return err
 }
 
+// trackRemovedUpstream flags stored episodes whose GUID vanished from the feed and
+// clears the flag for episodes that came back. An empty feed is ignored so a broken
+// response never marks a whole podcast as removed.
+func trackRemovedUpstream(podcast *db.Podcast, feedGUIDs []string) {
+	if len(feedGUIDs) == 0 {
+		return
+	}
+	removed, err := db.MarkPodcastItemsRemovedUpstream(podcast.ID, feedGUIDs, time.Now())
+	if err != nil {
+		logger.Log.Errorw("marking episodes removed upstream", "error", err)
+	} else if removed > 0 {
+		logger.Log.Infow("Episodes removed from feed", "podcast", podcast.Title, "count", removed)
+	}
+	if _, err := db.RestorePodcastItemsUpstream(podcast.ID, feedGUIDs); err != nil {
+		logger.Log.Errorw("restoring episodes back in feed", "error", err)
+	}
+}
+
+// parseEnclosureLength parses the enclosure length attribute, returning 0 when it is missing or invalid.
+func parseEnclosureLength(value string) int64 {
+	length, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || length < 0 {
+		return 0
+	}
+	return length
+}
+
+// detectEnclosureChange compares a known episode with its feed entry. The stored enclosure
+// URL, length and publish date always follow the feed; when a previously known value
+// changed, the podcast's enclosure change policy decides what happens to the episode.
+func detectEnclosureChange(podcast *db.Podcast, item *db.PodcastItem, obj *model.FeedItem) {
+	fileURL := obj.Enclosure.URL
+	length := parseEnclosureLength(obj.Enclosure.Length)
+	pubDate := obj.PubDate
+
+	urlChanged := fileURL != "" && fileURL != item.FileURL
+	lengthChanged := length > 0 && length != item.EnclosureLength
+	pubDateChanged := !pubDate.IsZero() && !pubDate.Equal(item.PubDate)
+	typeChanged := obj.Enclosure.Type != "" && obj.Enclosure.Type != item.EnclosureType
+	if !urlChanged && !lengthChanged && !pubDateChanged && !typeChanged {
+		return
+	}
+
+	// A value that was never stored is backfilled without counting as a change.
+	changed := (urlChanged && item.FileURL != "") ||
+		(lengthChanged && item.EnclosureLength > 0) ||
+		(pubDateChanged && !item.PubDate.IsZero())
+
+	if urlChanged {
+		item.FileURL = fileURL
+	}
+	if lengthChanged {
+		item.EnclosureLength = length
+	}
+	if pubDateChanged {
+		item.PubDate = pubDate
+	}
+	if typeChanged {
+		item.EnclosureType = obj.Enclosure.Type
+	}
+
+	if changed {
+		logger.Log.Infow("Episode enclosure changed", "podcast", podcast.Title, "episode", item.Title, "policy", podcast.EnclosureChangePolicy)
+		applyEnclosureChangePolicy(podcast.EnclosureChangePolicy, item)
+	}
+	if err := db.UpdatePodcastItemEnclosure(item); err != nil {
+		logger.Log.Errorw("updating podcast item enclosure", "error", err)
+	}
+}
+
+// applyEnclosureChangePolicy flags a changed episode and queues the new media for
+// download when the policy asks for it.
+func applyEnclosureChangePolicy(policy db.EnclosureChangePolicy, item *db.PodcastItem) {
+	if policy == db.EnclosureChangeIgnore {
+		return
+	}
+	now := time.Now()
+	item.EnclosureChanged = true
+	item.EnclosureChangedDate = now
+
+	if item.DownloadStatus != db.Downloaded {
+		return
+	}
+	switch policy {
+	case db.EnclosureChangeReplace:
+		if err := DeleteFile(item.DownloadPath); err != nil && !os.IsNotExist(err) {
+			logger.Log.Errorw("deleting replaced episode file", "error", err)
+			return
+		}
+	case db.EnclosureChangeKeepBoth:
+		ext := filepath.Ext(item.DownloadPath)
+		previous := fmt.Sprintf("%s.%s%s", strings.TrimSuffix(item.DownloadPath, ext), now.Format("20060102150405"), ext)
+		err := os.Rename(item.DownloadPath, previous)
+		if err != nil && !os.IsNotExist(err) {
+			logger.Log.Errorw("keeping previous episode file", "error", err)
+			return
+		}
+		if err == nil {
+			item.PreviousDownloadPath = previous
+		}
+	default:
+		return
+	}
+	item.DownloadStatus = db.NotDownloaded
+	item.DownloadPath = ""
+	item.DownloadDate = time.Time{}
+}
+
+// adoptFeedGUID stores the GUID the feed currently uses for an episode that was
+// recognized by one of its fallback identities.
+func adoptFeedGUID(item *db.PodcastItem, guid string) {
+	if err := db.UpdatePodcastItemGUID(item.ID, guid); err != nil {
+		logger.Log.Errorw("updating podcast item guid", "error", err)
+		return
+	}
+	item.GUID = guid
+}
+
+// backfillFeedMetadata stores season, episode number and explicit flags on items
+// that were created before these fields were persisted.
+func backfillFeedMetadata(item *db.PodcastItem, season, episodeNumber int, explicit bool) {
+	if item.Season == season && item.EpisodeNumber == episodeNumber && item.Explicit == explicit {
+		return
+	}
+	if item.Season != 0 || item.EpisodeNumber != 0 {
+		return
+	}
+	if err := db.UpdatePodcastItemFeedMetadata(item.ID, season, episodeNumber, explicit); err != nil {
+		logger.Log.Errorw("backfilling podcast item metadata", "error", err)
+	}
+}
+
+// backfillDuration stores the feed duration of an episode that has none, such as
+// episodes whose HH:MM:SS duration could not be parsed before.
+func backfillDuration(item *db.PodcastItem, duration int) {
+	if item.Duration != 0 || duration <= 0 {
+		return
+	}
+	item.Duration = duration
+	if err := db.UpdatePodcastItemDuration(item.ID, duration); err != nil {
+		logger.Log.Errorw("backfilling podcast item duration", "error", err)
+	}
+}
+
+// feedMoveTarget returns the URL a feed has moved to, preferring the permanent redirect
+// observed while fetching over the itunes:new-feed-url announcement.
+func feedMoveTarget(currentURL string, data *model.Feed) string {
+	for _, candidate := range []string{data.RedirectURL, data.NewFeedURL} {
+		if candidate == "" || candidate == currentURL {
+			continue
+		}
+		parsed, err := url.Parse(candidate)
+		if err != nil || parsed.Host == "" || validateURL(candidate) != nil {
+			logger.Log.Warnw("Ignoring invalid feed move target", "url", RedactURL(currentURL), "target", RedactURL(candidate))
+			continue
+		}
+		return candidate
+	}
+	return ""
+}
+
+// applyFeedMove points the podcast at the location its feed moved to and records the
+// move in the metadata history. Episodes keep belonging to the same podcast and are
+// matched by GUID, so nothing is downloaded again. The move is skipped when another
+// subscription already uses the new URL and the target is kept in MovedTo instead.
+func applyFeedMove(podcast *db.Podcast, data *model.Feed) {
+	podcast.MovedTo = ""
+	newURL := feedMoveTarget(podcast.URL, data)
+	if newURL == "" {
+		return
+	}
+
+	var existing db.Podcast
+	err := db.GetPodcastByURL(newURL, &existing)
+	if err == nil {
+		logger.Log.Warnw("Feed moved to a URL that is already subscribed", "podcast", podcast.Title, "url", RedactURL(newURL), "existing_podcast_id", existing.ID)
+		podcast.MovedTo = newURL
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.Log.Errorw("checking moved feed url", "error", err)
+		return
+	}
+
+	if err := db.UpdatePodcastURL(podcast.ID, newURL); err != nil {
+		logger.Log.Errorw("updating podcast url", "error", err)
+		return
+	}
+	change := db.PodcastMetadataChange{
+		PodcastID: podcast.ID,
+		Field:     "URL",
+		OldValue:  podcast.URL,
+		NewValue:  newURL,
+	}
+	if err := db.CreatePodcastMetadataChange(&change); err != nil {
+		logger.Log.Errorw("recording podcast metadata change", "error", err)
+	}
+	logger.Log.Infow("Podcast feed moved", "podcast", podcast.Title, "from", RedactURL(podcast.URL), "to", RedactURL(newURL))
+	podcast.URL = newURL
+}
+
+// refreshPodcastMetadata compares the channel metadata of a freshly fetched feed with the
+// stored podcast, persists what changed and records every change in the history table.
+// A feed without a title or without any items is treated as broken and ignored, and an
+// empty value never overwrites a stored one.
+func refreshPodcastMetadata(podcast *db.Podcast, data *model.Feed) {
+	if strings.TrimSpace(data.Title) == "" || len(data.Items) == 0 {
+		logger.Log.Warnw("Ignoring metadata of feed without title or items", "podcast", podcast.Title, "url", RedactURL(podcast.URL))
+		return
+	}
+
+	previous := *podcast
+	fields := []struct {
+		name     string
+		current  *string
+		incoming string
+	}{
+		{"Title", &podcast.Title, data.Title},
+		{"Summary", &podcast.Summary, strip.StripTags(data.Summary)},
+		{"Author", &podcast.Author, data.Author},
+		{"Image", &podcast.Image, data.Image},
+		{"Category", &podcast.Category, data.Category},
+		{"Language", &podcast.Language, data.Language},
+		{"OwnerName", &podcast.OwnerName, data.OwnerName},
+		{"OwnerEmail", &podcast.OwnerEmail, data.OwnerEmail},
+		{"Copyright", &podcast.Copyright, data.Copyright},
+	}
+
+	var changes []db.PodcastMetadataChange
+	for _, field := range fields {
+		if strings.TrimSpace(field.incoming) == "" || field.incoming == *field.current {
+			continue
+		}
+		changes = append(changes, db.PodcastMetadataChange{
+			PodcastID: podcast.ID,
+			Field:     field.name,
+			OldValue:  *field.current,
+			NewValue:  field.incoming,
+		})
+		*field.current = field.incoming
+	}
+	if strings.TrimSpace(data.Explicit) != "" {
+		if explicit := parseExplicit(data.Explicit); explicit != podcast.Explicit {
+			changes = append(changes, db.PodcastMetadataChange{
+				PodcastID: podcast.ID,
+				Field:     "Explicit",
+				OldValue:  strconv.FormatBool(podcast.Explicit),
+				NewValue:  strconv.FormatBool(explicit),
+			})
+			podcast.Explicit = explicit
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	if err := db.UpdatePodcastMetadata(podcast); err != nil {
+		logger.Log.Errorw("updating podcast metadata", "error", err)
+		*podcast = previous
+		return
+	}
+	for i := range changes {
+		if err := db.CreatePodcastMetadataChange(&changes[i]); err != nil {
+			logger.Log.Errorw("recording podcast metadata change", "error", err)
+		}
+	}
+	logger.Log.Infow("Podcast metadata changed", "podcast", podcast.Title, "changes", len(changes))
+
+	if previous.Image == podcast.Image && previous.Title == podcast.Title {
+		return
+	}
+	refreshPodcastCoverImage(&previous, podcast)
+	if db.GetOrCreateSetting().GenerateNFOFile {
+		if err := CreateNfoFile(podcast); err != nil {
+			logger.Log.Errorw("creating NFO file", "error", err)
+		}
+	}
+}
+
+// refreshPodcastCoverImage replaces the locally stored cover after the image URL or the
+// podcast folder changed.
+func refreshPodcastCoverImage(previous, podcast *db.Podcast) {
+	if previous.Image != podcast.Image && previous.Image != "" {
+		oldPath := GetPodcastLocalImagePath(previous.Image, previous.Title)
+		if FileExists(oldPath) {
+			if err := DeleteFile(oldPath); err != nil {
+				logger.Log.Errorw("deleting old podcast cover image", "error", err)
+			}
+		}
+	}
+	if _, err := DownloadPodcastCoverImage(podcast.Image, podcast.Title, podcastRequestOptions(podcast, false)); err != nil {
+		logger.Log.Errorw("downloading podcast cover image", "error", err)
+	}
+}
+
 //lint:ignore U1000 kept for future use
 func updateSizeFromURL(itemURLMap map[string]string) {
 	for id, url := range itemURLMap {
@@ -503,7 +886,7 @@ func downloadImageLocally(podcastItemID string) error {
 		return err
 	}
 
-	path, err := DownloadImage(podcastItem.Image, podcastItem.ID, podcastItem.Podcast.Title)
+	path, err := DownloadImage(podcastItem.Image, podcastItem.ID, podcastItem.Podcast.Title, podcastRequestOptions(&podcastItem.Podcast, false))
 	if err != nil {
 		return err
 	}
@@ -513,19 +896,16 @@ func downloadImageLocally(podcastItemID string) error {
 	return db.UpdatePodcastItem(&podcastItem)
 }
 
-// SetPodcastItemBookmarkStatus set podcast item bookmark status.
-func SetPodcastItemBookmarkStatus(id string, bookmark bool) error {
-	var podcastItem db.PodcastItem
-	err := db.GetPodcastItemByID(id, &podcastItem)
-	if err != nil {
-		return err
-	}
-	if bookmark {
-		podcastItem.BookmarkDate = time.Now()
-	} else {
-		podcastItem.BookmarkDate = time.Time{}
-	}
-	return db.UpdatePodcastItem(&podcastItem)
+// SetPodcastItemBookmarkStatus set podcast item bookmark status for a user.
+func SetPodcastItemBookmarkStatus(userID, id string, bookmark bool) error {
+	return updateEpisodeState(userID, id, func(state *db.EpisodeState) error {
+		if bookmark {
+			state.BookmarkDate = time.Now()
+		} else {
+			state.BookmarkDate = time.Time{}
+		}
+		return nil
+	})
 }
 
 // SetPodcastItemAsDownloaded set podcast item as downloaded.
@@ -542,12 +922,24 @@ func SetPodcastItemAsDownloaded(id, location string) error {
 	if err == nil {
 		podcastItem.FileSize = size
 	}
+	// The media headers are more reliable than the duration announced by the feed.
+	if duration, durationErr := MediaDuration(location); durationErr == nil && duration > 0 {
+		if duration != podcastItem.Duration {
+			logger.Log.Debugw("Measured episode duration", "episode", podcastItem.Title, "feed", podcastItem.Duration, "media", duration)
+		}
+		podcastItem.Duration = duration
+	}
 
 	podcastItem.DownloadDate = time.Now()
 	podcastItem.DownloadPath = location
 	podcastItem.DownloadStatus = db.Downloaded
 
-	return db.UpdatePodcastItem(&podcastItem)
+	if err := db.UpdatePodcastItem(&podcastItem); err != nil {
+		return err
+	}
+	emitEpisodeEvent(WebhookEpisodeDownloaded, &podcastItem, nil)
+	SendNotifications(&NotificationData{Event: WebhookEpisodeDownloaded, Podcast: &podcastItem.Podcast, Episode: &podcastItem})
+	return nil
 }
 
 // SetPodcastItemAsNotDownloaded set podcast item as not downloaded.
@@ -564,15 +956,12 @@ func SetPodcastItemAsNotDownloaded(id string, downloadStatus db.DownloadStatus)
 	return db.UpdatePodcastItem(&podcastItem)
 }
 
-// SetPodcastItemPlayedStatus set podcast item played status.
-func SetPodcastItemPlayedStatus(id string, isPlayed bool) error {
-	var podcastItem db.PodcastItem
-	err := db.GetPodcastItemByID(id, &podcastItem)
-	if err != nil {
-		return err
-	}
-	podcastItem.IsPlayed = isPlayed
-	return db.UpdatePodcastItem(&podcastItem)
+// SetPodcastItemPlayedStatus set podcast item played status for a user.
+func SetPodcastItemPlayedStatus(userID, id string, isPlayed bool) error {
+	return updateEpisodeState(userID, id, func(state *db.EpisodeState) error {
+		state.IsPlayed = isPlayed
+		return nil
+	})
 }
 
 // SetAllEpisodesToDownload set all episodes to download.
@@ -602,13 +991,13 @@ var formatMap = map[string]interface{}{
 		if err != nil {
 			seq = 0
 		}
-		width := 0
-		if len(args) > 0 {
-			if w, err := strconv.Atoi(args[0]); err == nil {
-				width = w
-			}
-		}
-		return fmt.Sprintf("%0*d", width, seq)
+		return fmt.Sprintf("%0*d", formatWidth(args), seq)
+	},
+	"%Season%": func(item *db.PodcastItem, args ...string) string {
+		return fmt.Sprintf("%0*d", formatWidth(args), item.Season)
+	},
+	"%FeedEpisodeNumber%": func(item *db.PodcastItem, args ...string) string {
+		return fmt.Sprintf("%0*d", formatWidth(args), item.EpisodeNumber)
 	},
 	"%EpisodeDate%": func(item *db.PodcastItem, args ...string) string {
 		return item.PubDate.Format("2006-01-02")
@@ -627,6 +1016,16 @@ var formatMap = map[string]interface{}{
 	},
 }
 
+// formatWidth returns the minimum number of digits requested as a token argument, e.g. %Season:2%.
+func formatWidth(args []string) int {
+	if len(args) > 0 {
+		if w, err := strconv.Atoi(args[0]); err == nil {
+			return w
+		}
+	}
+	return 0
+}
+
 // FormatFileName formats a filename using the format string and podcast item data.
 func FormatFileName(item *db.PodcastItem, formatString string) string {
 	var matchedTokens = formatRe.FindAllStringIndex(formatString, -1)
@@ -665,8 +1064,12 @@ func DownloadMissingEpisodes() error {
 		logger.Log.Debugw("Job is locked", "job_name", jobName)
 		return nil
 	}
-	db.Lock(jobName, 120)
 	setting := db.GetOrCreateSetting()
+	if !DownloadWindowOpen(setting, time.Now()) {
+		logger.Log.Debugw("Outside the download schedule, leaving episodes queued")
+		return nil
+	}
+	db.Lock(jobName, 120)
 
 	data, err := db.GetAllPodcastItemsToBeDownloaded()
 
@@ -685,9 +1088,11 @@ func DownloadMissingEpisodes() error {
 				return
 			}
 			podcastFileName := FormatFileName(&item, setting.FileNameFormat)
-			url, dlErr := Download(item.FileURL, item.Title, item.Podcast.Title, podcastFileName)
+			link := SelectEnclosureURL(&item, &setting)
+			url, dlErr := Download(link, item.Title, item.Podcast.Title, podcastFileName, enclosureTypeForURL(&item, link), podcastRequestOptions(&item.Podcast, true))
 			if dlErr != nil {
 				logger.Log.Errorw("downloading episode", "error", dlErr)
+				emitEpisodeEvent(WebhookEpisodeDownloadFailed, &item, dlErr)
 				return
 			}
 			if err := SetPodcastItemAsDownloaded(item.ID, url); err != nil {
@@ -730,6 +1135,7 @@ func CheckMissingFiles() error {
 }
 
 // ClearEpisodeFiles clears old episode files based on MaxDownloadKeep setting.
+// Episodes removed from the feed upstream are kept when KeepRemovedUpstream is enabled.
 func ClearEpisodeFiles() error {
 	setting := db.GetOrCreateSetting()
 	maxDownloadKeep := setting.MaxDownloadKeep
@@ -751,6 +1157,9 @@ func ClearEpisodeFiles() error {
 		}
 		downloadedCount := 0
 		for j := range episodes {
+			if episodes[j].RemovedUpstream && setting.KeepRemovedUpstream {
+				continue
+			}
 			if episodes[j].DownloadStatus == db.Downloaded {
 				if downloadedCount >= maxDownloadKeep {
 					if err := DeleteEpisodeFile(episodes[j].ID); err != nil {
@@ -780,6 +1189,8 @@ func DeleteEpisodeFile(podcastItemID string) error {
 		return err
 	}
 
+	deletePreviousEpisodeFile(&podcastItem)
+
 	if podcastItem.LocalImage != "" {
 		go func() {
 			if err := DeleteFile(podcastItem.LocalImage); err != nil {
@@ -791,6 +1202,21 @@ func DeleteEpisodeFile(podcastItemID string) error {
 	return SetPodcastItemAsNotDownloaded(podcastItem.ID, db.Deleted)
 }
 
+// deletePreviousEpisodeFile removes the file kept from before the episode's enclosure changed.
+func deletePreviousEpisodeFile(podcastItem *db.PodcastItem) {
+	if podcastItem.PreviousDownloadPath == "" {
+		return
+	}
+	if err := DeleteFile(podcastItem.PreviousDownloadPath); err != nil && !os.IsNotExist(err) {
+		logger.Log.Errorw("deleting previous episode file", "error", err)
+		return
+	}
+	podcastItem.PreviousDownloadPath = ""
+	if err := db.UpdatePodcastItemEnclosure(podcastItem); err != nil {
+		logger.Log.Errorw("clearing previous episode file", "error", err)
+	}
+}
+
 // DownloadSingleEpisode download single episode.
 func DownloadSingleEpisode(podcastItemID string) error {
 	var podcastItem db.PodcastItem
@@ -806,10 +1232,12 @@ func DownloadSingleEpisode(podcastItemID string) error {
 	}
 
 	podcastFileName := FormatFileName(&podcastItem, setting.FileNameFormat)
-	url, dlErr := Download(podcastItem.FileURL, podcastItem.Title, podcastItem.Podcast.Title, podcastFileName)
+	link := SelectEnclosureURL(&podcastItem, setting)
+	url, dlErr := Download(link, podcastItem.Title, podcastItem.Podcast.Title, podcastFileName, enclosureTypeForURL(&podcastItem, link), podcastRequestOptions(&podcastItem.Podcast, true))
 
 	if dlErr != nil {
 		logger.Log.Error(dlErr.Error())
+		emitEpisodeEvent(WebhookEpisodeDownloadFailed, &podcastItem, dlErr)
 		return dlErr
 	}
 	err = SetPodcastItemAsDownloaded(podcastItem.ID, url)
@@ -891,6 +1319,7 @@ func DeletePodcastEpisodes(id string) error {
 		if delErr := DeleteFile(podcastItems[i].DownloadPath); delErr != nil {
 			logger.Log.Errorw("deleting file", "error", delErr)
 		}
+		deletePreviousEpisodeFile(&podcastItems[i])
 		if podcastItems[i].LocalImage != "" {
 			if delErr := DeleteFile(podcastItems[i].LocalImage); delErr != nil {
 				logger.Log.Errorw("deleting file", "error", delErr)
@@ -942,6 +1371,8 @@ func DeletePodcast(id string, deleteFiles bool) error {
 	if err != nil {
 		return err
 	}
+	recordSubscriptionChange(podcast.URL, true)
+	EmitWebhookEvent(WebhookPodcastRemoved, model.WebhookData{Podcast: webhookPodcast(&podcast)})
 	return nil
 }
 
@@ -958,28 +1389,47 @@ func DeleteTag(id string) error {
 }
 
 func makeQuery(url string) ([]byte, error) {
-	logger.Log.Debugw("Making query", "url", url)
+	fetched, err := makeFeedQuery(url, nil)
+	return fetched.body, err
+}
 
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
+// feedResponse describes the outcome of a request made by makeFeedQuery.
+type feedResponse struct {
+	body       []byte
+	statusCode int
+	// movedTo is the final URL when every redirect followed was permanent (301 or 308).
+	movedTo string
+}
 
-	req, err := http.NewRequest("GET", url, http.NoBody)
+// makeFeedQuery performs the request like makeQuery and additionally reports the HTTP
+// status code and whether the document permanently moved. Nil options use the global
+// network settings.
+func makeFeedQuery(url string, options *requestOptions) (feedResponse, error) {
+	logger.Log.Debugw("Making query", "url", RedactURL(url))
+	if options == nil {
+		options = globalRequestOptions()
+	}
+
+	permanent := true
+	client, err := options.httpClient(options.transport.connectTimeout+options.transport.readTimeout,
+		func(req *http.Request) {
+			if req.Response == nil ||
+				(req.Response.StatusCode != http.StatusMovedPermanently && req.Response.StatusCode != http.StatusPermanentRedirect) {
+				permanent = false
+			}
+		})
 	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
+		return feedResponse{}, fmt.Errorf("error creating client: %w", err)
 	}
 
-	setting := db.GetOrCreateSetting()
-	if setting.UserAgent != "" {
-		req.Header.Set("User-Agent", setting.UserAgent)
-	} else {
-		req.Header.Set("User-Agent", "AppleCoreMedia/1.0.0.22B82 (iPhone; U; CPU OS 18_1 like Mac OS X; en_us)")
+	req, err := options.newRequest(http.MethodGet, url)
+	if err != nil {
+		return feedResponse{}, fmt.Errorf("error creating request: %w", err)
 	}
-	req.Header.Set("Accept", "*/*")
 
 	resp, err := client.Do(req) // #nosec G704 // lgtm[go/request-forgery] -- URL is a user-provided podcast RSS feed URL, SSRF is by design
 	if err != nil {
-		return nil, fmt.Errorf("error making request: %w", err)
+		return feedResponse{}, fmt.Errorf("error making request: %w", err)
 	}
 
 	defer func() {
@@ -989,20 +1439,25 @@ func makeQuery(url string) ([]byte, error) {
 	}()
 	logger.Log.Debugw("Received response", "status", resp.Status)
 
+	fetched := feedResponse{statusCode: resp.StatusCode}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("HTTP error: %d %s", resp.StatusCode, resp.Status)
+		return fetched, &model.HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	body, readErr := io.ReadAll(resp.Body)
 	if readErr != nil {
-		return nil, fmt.Errorf("error reading response: %w", readErr)
+		return fetched, fmt.Errorf("error reading response: %w", readErr)
 	}
 
 	if len(body) == 0 {
-		return nil, errors.New("empty response from server")
+		return fetched, errors.New("empty response from server")
 	}
 
-	return body, nil
+	fetched.body = body
+	if permanent && resp.Request.URL.String() != url {
+		fetched.movedTo = resp.Request.URL.String()
+	}
+	return fetched, nil
 }
 
 // GetSearchFromGpodder get search from gpodder.
@@ -1044,39 +1499,46 @@ func GetSearchFromPodcastIndex(pod *podcastindex.Podcast) *model.CommonSearchRes
 	return p
 }
 
-// UpdateSettings update settings.
-func UpdateSettings(
-	downloadOnAdd bool,
-	initialDownloadCount int,
-	autoDownload bool,
-	fileNameFormat string,
-	passthroughPodcastGUID bool,
-	darkMode bool,
-	downloadEpisodeImages bool,
-	generateNFOFile bool,
-	dontDownloadDeletedFromDisk bool,
-	baseURL string,
-	maxDownloadConcurrency int,
-	maxDownloadKeep int,
-	userAgent string,
-) error {
-	setting := db.GetOrCreateSetting()
-
-	setting.AutoDownload = autoDownload
-	setting.DownloadOnAdd = downloadOnAdd
-	setting.InitialDownloadCount = initialDownloadCount
-	setting.FileNameFormat = fileNameFormat
-	setting.PassthroughPodcastGUID = passthroughPodcastGUID
-	setting.DarkMode = darkMode
-	setting.DownloadEpisodeImages = downloadEpisodeImages
-	setting.GenerateNFOFile = generateNFOFile
-	setting.DontDownloadDeletedFromDisk = dontDownloadDeletedFromDisk
-	setting.BaseURL = baseURL
-	setting.MaxDownloadConcurrency = maxDownloadConcurrency
-	setting.MaxDownloadKeep = maxDownloadKeep
-	setting.UserAgent = userAgent
+// UpdateSettings validates and stores the settings, keeping the ID of the stored ones.
+// An empty enclosure or IP preference stands for the default.
+func UpdateSettings(update *db.Setting) error {
+	setting := *update
+	if setting.EnclosurePreference == "" {
+		setting.EnclosurePreference = db.EnclosurePreferenceFeed
+	}
+	if !setting.EnclosurePreference.IsValid() {
+		return fmt.Errorf("invalid enclosure preference: %q", setting.EnclosurePreference)
+	}
+	if err := validateNetworkSettings(setting.ProxyURL, setting.UserAgent, setting.ConnectTimeout, setting.ReadTimeout); err != nil {
+		return err
+	}
+	if setting.IPPreference == "" {
+		setting.IPPreference = db.IPPreferenceAuto
+	}
+	if !setting.IPPreference.IsValid() {
+		return fmt.Errorf("invalid IP preference: %q", setting.IPPreference)
+	}
+	if setting.BandwidthLimit < 0 {
+		return fmt.Errorf("invalid bandwidth limit: %d KiB/s", setting.BandwidthLimit)
+	}
+	if _, err := parseHostLimits(setting.HostBandwidthLimits); err != nil {
+		return err
+	}
+	if _, err := ParseDownloadSchedule(setting.DownloadSchedule); err != nil {
+		return err
+	}
+	if _, err := newEgressPolicy(setting.BlockPrivateNetworks, setting.EgressAllowlist); err != nil {
+		return err
+	}
+	if setting.MaxRedirects < 0 || setting.MaxRedirects > 50 {
+		return fmt.Errorf("invalid redirect limit: %d", setting.MaxRedirects)
+	}
+	if setting.PlayedThreshold < 0 || setting.PlayedThreshold > 100 {
+		return fmt.Errorf("invalid played threshold: %d%%", setting.PlayedThreshold)
+	}
+	setting.Base = db.GetOrCreateSetting().Base
 
-	return db.UpdateSettings(setting)
+	return db.UpdateSettings(&setting)
 }
 
 // UnlockMissedJobs unlock missed jobs.
@@ -1109,5 +1571,25 @@ func TogglePodcastPause(id string, isPaused bool) error {
 		return err
 	}
 
-	return db.TogglePodcastPauseStatus(id, isPaused)
+	if err := db.TogglePodcastPauseStatus(id, isPaused); err != nil {
+		return err
+	}
+	if podcast.IsPaused != isPaused {
+		recordSubscriptionChange(podcast.URL, isPaused)
+	}
+	return nil
+}
+
+// SetPodcastEnclosureChangePolicy set what refreshes do when the media of a known episode changes.
+func SetPodcastEnclosureChangePolicy(id string, policy db.EnclosureChangePolicy) error {
+	if !policy.IsValid() {
+		return fmt.Errorf("invalid enclosure change policy: %q", policy)
+	}
+	var podcast db.Podcast
+	err := db.GetPodcastByID(id, &podcast)
+	if err != nil {
+		return err
+	}
+
+	return db.UpdatePodcastEnclosureChangePolicy(id, policy)
 }
@@ -5,6 +5,9 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -138,6 +141,22 @@ func TestFetchURL(t *testing.T) {
 			wantError:     false,
 			wantItemCount: 1,
 		},
+		{
+			name:          "atom_feed",
+			feedContent:   testhelpers.ValidAtomFeed,
+			statusCode:    http.StatusOK,
+			wantError:     false,
+			wantTitle:     "Atom Test Podcast",
+			wantItemCount: 2,
+		},
+		{
+			name:          "json_feed",
+			feedContent:   testhelpers.ValidJSONFeed,
+			statusCode:    http.StatusOK,
+			wantError:     false,
+			wantTitle:     "JSON Test Podcast",
+			wantItemCount: 1,
+		},
 		{
 			name:        "http_error",
 			feedContent: "",
@@ -168,10 +187,10 @@ func TestFetchURL(t *testing.T) {
 			assert.NotNil(t, body, "Should return body bytes")
 
 			if tt.wantTitle != "" {
-				assert.Equal(t, tt.wantTitle, data.Channel.Title, "Should parse title correctly")
+				assert.Equal(t, tt.wantTitle, data.Title, "Should parse title correctly")
 			}
 
-			assert.Equal(t, tt.wantItemCount, len(data.Channel.Item), "Should parse correct number of items")
+			assert.Equal(t, tt.wantItemCount, len(data.Items), "Should parse correct number of items")
 		})
 	}
 }
@@ -331,6 +350,19 @@ func TestFormatFileName(t *testing.T) {
 			wantContains:   []string{"MyPodcast", "Episode"},
 			wantNotContain: []string{},
 		},
+		{
+			name:         "feed_season_and_episode",
+			formatString: "S%Season:2%E%FeedEpisodeNumber:3%-%EpisodeTitle%",
+			item: &db.PodcastItem{
+				Title:         "Episode",
+				PubDate:       pubDate,
+				Season:        2,
+				EpisodeNumber: 7,
+				Podcast:       db.Podcast{Title: "Podcast"},
+			},
+			wantContains:   []string{"S02E007", "Episode"},
+			wantNotContain: []string{},
+		},
 		{
 			name:         "literal_percent",
 			formatString: "100%%-%EpisodeTitle%",
@@ -369,24 +401,39 @@ func TestUpdateSettings(t *testing.T) {
 	defer func() { db.DB = originalDB }()
 
 	// Create initial settings
-	db.CreateTestSetting(t, database)
+	initial := db.CreateTestSetting(t, database)
 
 	// Update settings
-	err := UpdateSettings(
-		false,                          // downloadOnAdd
-		10,                             // initialDownloadCount
-		false,                          // autoDownload
-		"%EpisodeDate%-%EpisodeTitle%", // fileNameFormat
-		false,                          // passthroughPodcastGuid
-		true,                           // darkMode
-		true,                           // downloadEpisodeImages
-		false,                          // generateNFOFile
-		true,                           // dontDownloadDeletedFromDisk
-		"http://test.local",            // baseURL
-		10,                             // maxDownloadConcurrency
-		5,                              // maxDownloadKeep
-		"TestAgent/1.0",                // userAgent
-	)
+	err := UpdateSettings(&db.Setting{
+		DownloadOnAdd:               false,
+		InitialDownloadCount:        10,
+		AutoDownload:                false,
+		FileNameFormat:              "%EpisodeDate%-%EpisodeTitle%",
+		PassthroughPodcastGUID:      false,
+		DarkMode:                    true,
+		DownloadEpisodeImages:       true,
+		GenerateNFOFile:             false,
+		DontDownloadDeletedFromDisk: true,
+		BaseURL:                     "http://test.local",
+		MaxDownloadConcurrency:      10,
+		MaxDownloadKeep:             5,
+		UserAgent:                   "TestAgent/1.0",
+		AutoPauseAfterFailures:      3,
+		StaleFeedDays:               30,
+		KeepRemovedUpstream:         false,
+		EnclosurePreference:         db.EnclosurePreferenceOpus,
+		ProxyURL:                    "socks5://proxy.local:1080",
+		ConnectTimeout:              10,
+		ReadTimeout:                 60,
+		IPPreference:                db.IPPreferenceIPv4,
+		BandwidthLimit:              512,
+		HostBandwidthLimits:         "cdn.example.com 128",
+		DownloadSchedule:            "sat,sun unlimited",
+		BlockPrivateNetworks:        true,
+		EgressAllowlist:             "nas.lan\n10.0.0.0/8",
+		MaxRedirects:                5,
+		PlayedThreshold:             80,
+	})
 
 	require.NoError(t, err, "Should update settings without error")
 
@@ -401,9 +448,29 @@ func TestUpdateSettings(t *testing.T) {
 	assert.Equal(t, "http://test.local", setting.BaseURL, "BaseURL should be updated")
 	assert.Equal(t, 10, setting.MaxDownloadConcurrency, "MaxDownloadConcurrency should be updated")
 	assert.Equal(t, "TestAgent/1.0", setting.UserAgent, "UserAgent should be updated")
+	assert.Equal(t, 3, setting.AutoPauseAfterFailures, "AutoPauseAfterFailures should be updated")
+	assert.Equal(t, 30, setting.StaleFeedDays, "StaleFeedDays should be updated")
+	assert.False(t, setting.KeepRemovedUpstream, "KeepRemovedUpstream should be updated")
+	assert.Equal(t, db.EnclosurePreferenceOpus, setting.EnclosurePreference, "EnclosurePreference should be updated")
+	assert.Equal(t, "socks5://proxy.local:1080", setting.ProxyURL, "ProxyURL should be updated")
+	assert.Equal(t, 10, setting.ConnectTimeout, "ConnectTimeout should be updated")
+	assert.Equal(t, 60, setting.ReadTimeout, "ReadTimeout should be updated")
+	assert.Equal(t, db.IPPreferenceIPv4, setting.IPPreference, "IPPreference should be updated")
+	assert.Equal(t, 512, setting.BandwidthLimit, "BandwidthLimit should be updated")
+	assert.Equal(t, "cdn.example.com 128", setting.HostBandwidthLimits, "HostBandwidthLimits should be updated")
+	assert.Equal(t, "sat,sun unlimited", setting.DownloadSchedule, "DownloadSchedule should be updated")
+	assert.True(t, setting.BlockPrivateNetworks, "BlockPrivateNetworks should be updated")
+	assert.Equal(t, "nas.lan\n10.0.0.0/8", setting.EgressAllowlist, "EgressAllowlist should be updated")
+	assert.Equal(t, 5, setting.MaxRedirects, "MaxRedirects should be updated")
+	assert.Equal(t, 80, setting.PlayedThreshold, "PlayedThreshold should be updated")
+	assert.Equal(t, initial.ID, setting.ID, "Should update the stored settings")
+
+	assert.Error(t, UpdateSettings(&db.Setting{EnclosurePreference: "loudest"}), "Should reject unknown preferences")
+	assert.Error(t, UpdateSettings(&db.Setting{PlayedThreshold: 101}), "Should reject invalid values")
+	assert.Equal(t, 80, db.GetOrCreateSetting().PlayedThreshold, "Invalid settings should not be stored")
 }
 
-// TestSetPodcastItemPlayedStatus tests marking episodes as played/unplayed.
+// TestSetPodcastItemPlayedStatus tests marking episodes as played/unplayed for one user.
 func TestSetPodcastItemPlayedStatus(t *testing.T) {
 	database := testhelpers.SetupTestDB(t)
 	defer testhelpers.TeardownTestDB(t, database)
@@ -420,26 +487,28 @@ func TestSetPodcastItemPlayedStatus(t *testing.T) {
 	})
 
 	// Mark as played
-	err := SetPodcastItemPlayedStatus(item.ID, true)
+	err := SetPodcastItemPlayedStatus("alice", item.ID, true)
 	require.NoError(t, err, "Should mark as played without error")
 
 	// Verify
-	var updated db.PodcastItem
-	err = database.First(&updated, "id = ?", item.ID).Error
-	require.NoError(t, err)
-	assert.True(t, updated.IsPlayed, "Should be marked as played")
+	items := []db.PodcastItem{*item}
+	require.NoError(t, ApplyEpisodeStates("alice", items))
+	assert.True(t, items[0].IsPlayed, "Should be marked as played")
+	require.NoError(t, ApplyEpisodeStates("bob", items))
+	assert.False(t, items[0].IsPlayed, "Other users should not see it played")
 
 	// Mark as unplayed
-	err = SetPodcastItemPlayedStatus(item.ID, false)
+	err = SetPodcastItemPlayedStatus("alice", item.ID, false)
 	require.NoError(t, err, "Should mark as unplayed without error")
 
 	// Verify
-	err = database.First(&updated, "id = ?", item.ID).Error
-	require.NoError(t, err)
-	assert.False(t, updated.IsPlayed, "Should be marked as unplayed")
+	require.NoError(t, ApplyEpisodeStates("alice", items))
+	assert.False(t, items[0].IsPlayed, "Should be marked as unplayed")
+
+	assert.Error(t, SetPodcastItemPlayedStatus("alice", "missing", true), "Should fail for unknown episodes")
 }
 
-// TestSetPodcastItemBookmarkStatus tests bookmarking episodes.
+// TestSetPodcastItemBookmarkStatus tests bookmarking episodes for one user.
 func TestSetPodcastItemBookmarkStatus(t *testing.T) {
 	database := testhelpers.SetupTestDB(t)
 	defer testhelpers.TeardownTestDB(t, database)
@@ -454,23 +523,23 @@ func TestSetPodcastItemBookmarkStatus(t *testing.T) {
 	item := db.CreateTestPodcastItem(t, database, podcast.ID)
 
 	// Set bookmark
-	err := SetPodcastItemBookmarkStatus(item.ID, true)
+	err := SetPodcastItemBookmarkStatus("alice", item.ID, true)
 	require.NoError(t, err, "Should set bookmark without error")
 
 	// Verify
-	var updated db.PodcastItem
-	err = database.First(&updated, "id = ?", item.ID).Error
-	require.NoError(t, err)
-	assert.False(t, updated.BookmarkDate.IsZero(), "Should have bookmark date")
+	items := []db.PodcastItem{*item}
+	require.NoError(t, ApplyEpisodeStates("alice", items))
+	assert.False(t, items[0].BookmarkDate.IsZero(), "Should have bookmark date")
+	require.NoError(t, ApplyEpisodeStates("bob", items))
+	assert.True(t, items[0].BookmarkDate.IsZero(), "Other users should not see the bookmark")
 
 	// Clear bookmark
-	err = SetPodcastItemBookmarkStatus(item.ID, false)
+	err = SetPodcastItemBookmarkStatus("alice", item.ID, false)
 	require.NoError(t, err, "Should clear bookmark without error")
 
 	// Verify
-	err = database.First(&updated, "id = ?", item.ID).Error
-	require.NoError(t, err)
-	assert.True(t, updated.BookmarkDate.IsZero(), "Should clear bookmark date")
+	require.NoError(t, ApplyEpisodeStates("alice", items))
+	assert.True(t, items[0].BookmarkDate.IsZero(), "Should clear bookmark date")
 }
 
 // TestSetPodcastItemAsQueuedForDownload tests queueing episodes for download.
@@ -628,6 +697,120 @@ func TestMakeQuery_NetworkError(t *testing.T) {
 	assert.Error(t, err, "Should error on network failure")
 }
 
+// TestMakeFeedQuery_Redirects tests detection of permanent feed redirects.
+func TestMakeFeedQuery_Redirects(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	mux := http.NewServeMux()
+	mux.Handle("/feed", testhelpers.CreateMockRSSHandler(testhelpers.ValidRSSFeed))
+	mux.Handle("/moved", http.RedirectHandler("/feed", http.StatusMovedPermanently))
+	mux.Handle("/moved-308", http.RedirectHandler("/feed", http.StatusPermanentRedirect))
+	mux.Handle("/temporary", http.RedirectHandler("/feed", http.StatusFound))
+	mux.Handle("/moved-then-temporary", http.RedirectHandler("/temporary", http.StatusMovedPermanently))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		path        string
+		wantMovedTo string
+	}{
+		{name: "no_redirect", path: "/feed", wantMovedTo: ""},
+		{name: "moved_permanently", path: "/moved", wantMovedTo: server.URL + "/feed"},
+		{name: "permanent_redirect", path: "/moved-308", wantMovedTo: server.URL + "/feed"},
+		{name: "temporary_redirect", path: "/temporary", wantMovedTo: ""},
+		{name: "mixed_redirects", path: "/moved-then-temporary", wantMovedTo: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetched, err := makeFeedQuery(server.URL+tt.path, nil)
+			require.NoError(t, err)
+			assert.NotEmpty(t, fetched.body)
+			assert.Equal(t, http.StatusOK, fetched.statusCode)
+			assert.Equal(t, tt.wantMovedTo, fetched.movedTo)
+		})
+	}
+}
+
+// TestAddPodcastItems_FeedMoved tests that moved feeds update the stored URL without duplicating episodes.
+func TestAddPodcastItems_FeedMoved(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	_, dataCleanup := testhelpers.SetupTestDataDir(t)
+	defer dataCleanup()
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	announcedFeed := strings.Replace(testhelpers.ValidRSSFeed, "<link>https://example.com</link>",
+		"<link>https://example.com</link>\n    <itunes:new-feed-url>https://new-host.example.com/feed.xml</itunes:new-feed-url>", 1)
+
+	mux := http.NewServeMux()
+	mux.Handle("/feed", testhelpers.CreateMockRSSHandler(testhelpers.ValidRSSFeed))
+	mux.Handle("/old", http.RedirectHandler("/feed", http.StatusMovedPermanently))
+	mux.Handle("/announced", testhelpers.CreateMockRSSHandler(announcedFeed))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Match the fixture metadata so only the feed move is recorded.
+	unchanged := func(feedURL string) *db.Podcast {
+		return &db.Podcast{URL: feedURL, Summary: "A podcast for testing purposes", Image: "https://example.com/podcast-image.jpg"}
+	}
+
+	t.Run("permanent_redirect", func(t *testing.T) {
+		podcast := db.CreateTestPodcast(t, database, unchanged(server.URL+"/old"))
+		existing := db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{GUID: "test-podcast-episode-1", DownloadStatus: db.Downloaded})
+
+		require.NoError(t, AddPodcastItems(podcast, false))
+		assert.Equal(t, server.URL+"/feed", podcast.URL)
+
+		var stored db.Podcast
+		require.NoError(t, db.GetPodcastByID(podcast.ID, &stored))
+		assert.Equal(t, server.URL+"/feed", stored.URL)
+
+		var changes []db.PodcastMetadataChange
+		require.NoError(t, db.GetPodcastMetadataChangesByPodcastID(podcast.ID, &changes))
+		require.Len(t, changes, 1)
+		assert.Equal(t, "URL", changes[0].Field)
+		assert.Equal(t, server.URL+"/old", changes[0].OldValue)
+		assert.Equal(t, server.URL+"/feed", changes[0].NewValue)
+
+		var items []db.PodcastItem
+		require.NoError(t, db.GetAllPodcastItemsByPodcastID(podcast.ID, &items))
+		assert.Len(t, items, 2, "Should only add the episode that was missing")
+		var kept db.PodcastItem
+		require.NoError(t, db.GetPodcastItemByID(existing.ID, &kept))
+		assert.Equal(t, db.Downloaded, kept.DownloadStatus)
+	})
+
+	t.Run("new_feed_url_already_subscribed", func(t *testing.T) {
+		db.CreateTestPodcast(t, database, &db.Podcast{URL: "https://new-host.example.com/feed.xml"})
+		podcast := db.CreateTestPodcast(t, database, unchanged(server.URL+"/announced"))
+
+		require.NoError(t, AddPodcastItems(podcast, false))
+
+		var stored db.Podcast
+		require.NoError(t, db.GetPodcastByID(podcast.ID, &stored))
+		assert.Equal(t, server.URL+"/announced", stored.URL, "Should not move onto an existing subscription")
+		assert.Equal(t, "https://new-host.example.com/feed.xml", stored.MovedTo)
+	})
+
+	t.Run("add_podcast_redirecting_to_existing", func(t *testing.T) {
+		_, err := AddPodcast(server.URL + "/old")
+		var existsErr *model.PodcastAlreadyExistsError
+		require.ErrorAs(t, err, &existsErr)
+		assert.Equal(t, server.URL+"/feed", existsErr.URL)
+	})
+}
+
 // TestExportOmpl tests OPML export functionality.
 func TestExportOmpl(t *testing.T) {
 	database := testhelpers.SetupTestDB(t)
@@ -866,3 +1049,330 @@ func TestGetTagsByIds(t *testing.T) {
 	require.NotNil(t, tags, "Should return tags")
 	assert.Len(t, *tags, 2, "Should return both tags")
 }
+
+// TestParseEpisodeNumber tests parsing of itunes:episode and itunes:season values.
+func TestParseEpisodeNumber(t *testing.T) {
+	assert.Equal(t, 12, parseEpisodeNumber("12"))
+	assert.Equal(t, 3, parseEpisodeNumber(" 3 "))
+	assert.Equal(t, 0, parseEpisodeNumber(""))
+	assert.Equal(t, 0, parseEpisodeNumber("abc"))
+	assert.Equal(t, 0, parseEpisodeNumber("-1"))
+}
+
+// TestParseExplicit tests the accepted itunes:explicit values.
+func TestParseExplicit(t *testing.T) {
+	for _, value := range []string{"yes", "Yes", "true", "explicit"} {
+		assert.True(t, parseExplicit(value), value)
+	}
+	for _, value := range []string{"no", "false", "clean", ""} {
+		assert.False(t, parseExplicit(value), value)
+	}
+}
+
+// TestAddPodcastItems_PersistsFeedMetadata tests that channel and episode metadata is stored.
+func TestAddPodcastItems_PersistsFeedMetadata(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	_, dataCleanup := testhelpers.SetupTestDataDir(t)
+	defer dataCleanup()
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	server := httptest.NewServer(testhelpers.CreateMockRSSHandler(testhelpers.RSSFeedWithItunesExtensions))
+	defer server.Close()
+
+	podcast, err := AddPodcast(server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "Technology", podcast.Category)
+	assert.Equal(t, "en-us", podcast.Language)
+	assert.Equal(t, "Advanced Owner", podcast.OwnerName)
+	assert.Equal(t, "owner@example.com", podcast.OwnerEmail)
+	assert.Equal(t, "2024 Advanced Test Author", podcast.Copyright)
+	assert.False(t, podcast.Explicit)
+
+	require.NoError(t, AddPodcastItems(&podcast, true))
+
+	var items []db.PodcastItem
+	require.NoError(t, db.GetAllPodcastItemsByPodcastID(podcast.ID, &items))
+	require.Len(t, items, 1)
+	assert.Equal(t, 1, items[0].Season)
+	assert.Equal(t, 1, items[0].EpisodeNumber)
+	assert.True(t, items[0].Explicit)
+	assert.Equal(t, 2700, items[0].Duration, "HH:MM:SS durations should be parsed")
+
+	// Episodes stored before HH:MM:SS durations were parsed get them on refresh.
+	require.NoError(t, db.UpdatePodcastItemDuration(items[0].ID, 0))
+	require.NoError(t, AddPodcastItems(&podcast, false))
+	var stored db.PodcastItem
+	require.NoError(t, db.GetPodcastItemByID(items[0].ID, &stored))
+	assert.Equal(t, 2700, stored.Duration)
+}
+
+// TestRefreshPodcastMetadata tests that channel metadata changes are persisted and recorded.
+func TestRefreshPodcastMetadata(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	_, dataCleanup := testhelpers.SetupTestDataDir(t)
+	defer dataCleanup()
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	imageServer := httptest.NewServer(testhelpers.CreateMockFileHandler("new cover"))
+	defer imageServer.Close()
+
+	items := []model.FeedItem{{GUID: "episode-1", Title: "Episode 1"}}
+
+	t.Run("records_changes_and_refetches_cover", func(t *testing.T) {
+		podcast := db.Podcast{Title: "Rebrand Show", Author: "Old Author", Image: "https://example.com/old.jpg", Language: "en"}
+		require.NoError(t, db.CreatePodcast(&podcast))
+
+		oldCover := GetPodcastLocalImagePath(podcast.Image, podcast.Title)
+		require.NoError(t, os.WriteFile(oldCover, []byte("old cover"), 0o600))
+
+		refreshPodcastMetadata(&podcast, &model.Feed{
+			Title:    "Rebrand Show",
+			Author:   "New Author",
+			Image:    imageServer.URL + "/cover.jpg",
+			Language: "en",
+			Explicit: "yes",
+			Items:    items,
+		})
+
+		var stored db.Podcast
+		require.NoError(t, db.GetPodcastByID(podcast.ID, &stored))
+		assert.Equal(t, "New Author", stored.Author)
+		assert.Equal(t, imageServer.URL+"/cover.jpg", stored.Image)
+		assert.True(t, stored.Explicit)
+
+		var changes []db.PodcastMetadataChange
+		require.NoError(t, db.GetPodcastMetadataChangesByPodcastID(podcast.ID, &changes))
+		require.Len(t, changes, 3)
+		fields := make(map[string]db.PodcastMetadataChange)
+		for _, change := range changes {
+			fields[change.Field] = change
+		}
+		assert.Equal(t, "Old Author", fields["Author"].OldValue)
+		assert.Equal(t, "New Author", fields["Author"].NewValue)
+		assert.Equal(t, "https://example.com/old.jpg", fields["Image"].OldValue)
+		assert.Equal(t, "true", fields["Explicit"].NewValue)
+
+		newCover := GetPodcastLocalImagePath(stored.Image, stored.Title)
+		assert.Equal(t, oldCover, newCover)
+		content, err := os.ReadFile(newCover)
+		require.NoError(t, err)
+		assert.Equal(t, "new cover", string(content))
+	})
+
+	t.Run("ignores_feed_without_items", func(t *testing.T) {
+		podcast := db.Podcast{Title: "Stable Show", Author: "Author"}
+		require.NoError(t, db.CreatePodcast(&podcast))
+
+		refreshPodcastMetadata(&podcast, &model.Feed{Title: "Error Page", Author: "Someone"})
+
+		var stored db.Podcast
+		require.NoError(t, db.GetPodcastByID(podcast.ID, &stored))
+		assert.Equal(t, "Stable Show", stored.Title)
+		assert.Equal(t, "Author", stored.Author)
+
+		var changes []db.PodcastMetadataChange
+		require.NoError(t, db.GetPodcastMetadataChangesByPodcastID(podcast.ID, &changes))
+		assert.Empty(t, changes)
+	})
+
+	t.Run("keeps_values_missing_from_feed", func(t *testing.T) {
+		podcast := db.Podcast{Title: "Sparse Show", Author: "Author", Summary: "Summary", Copyright: "2024"}
+		require.NoError(t, db.CreatePodcast(&podcast))
+
+		refreshPodcastMetadata(&podcast, &model.Feed{Title: "Sparse Show", Items: items})
+
+		var stored db.Podcast
+		require.NoError(t, db.GetPodcastByID(podcast.ID, &stored))
+		assert.Equal(t, "Author", stored.Author)
+		assert.Equal(t, "Summary", stored.Summary)
+		assert.Equal(t, "2024", stored.Copyright)
+
+		var changes []db.PodcastMetadataChange
+		require.NoError(t, db.GetPodcastMetadataChangesByPodcastID(podcast.ID, &changes))
+		assert.Empty(t, changes)
+	})
+}
+
+// TestAddPodcastItems_RemovedUpstream tests that episodes missing from the feed are flagged and kept.
+func TestAddPodcastItems_RemovedUpstream(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	dataDir, dataCleanup := testhelpers.SetupTestDataDir(t)
+	defer dataCleanup()
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	setting := db.CreateTestSetting(t, database)
+	setting.MaxDownloadKeep = 1
+	setting.KeepRemovedUpstream = true
+	require.NoError(t, db.UpdateSettings(setting))
+
+	server := httptest.NewServer(testhelpers.CreateMockRSSHandler(testhelpers.ValidRSSFeed))
+	defer server.Close()
+
+	podcast := db.CreateTestPodcast(t, database, &db.Podcast{
+		URL:     server.URL,
+		Summary: "A podcast for testing purposes",
+		Image:   "https://example.com/podcast-image.jpg",
+	})
+
+	pulledPath := filepath.Join(dataDir, "pulled.mp3")
+	require.NoError(t, os.WriteFile(pulledPath, []byte("pulled"), 0o600))
+	pulled := db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{
+		GUID:           "pulled-episode",
+		PubDate:        time.Date(2024, 2, 1, 10, 0, 0, 0, time.UTC),
+		DownloadStatus: db.Downloaded,
+		DownloadPath:   pulledPath,
+	})
+
+	require.NoError(t, AddPodcastItems(podcast, false))
+
+	var stored db.PodcastItem
+	require.NoError(t, db.GetPodcastItemByID(pulled.ID, &stored))
+	assert.True(t, stored.RemovedUpstream)
+	assert.False(t, stored.RemovedUpstreamDate.IsZero())
+
+	var items []db.PodcastItem
+	require.NoError(t, db.GetAllPodcastItemsByPodcastID(podcast.ID, &items))
+	for i := range items {
+		if items[i].ID != pulled.ID {
+			assert.False(t, items[i].RemovedUpstream, "Episodes still in the feed should not be flagged")
+		}
+	}
+
+	require.NoError(t, ClearEpisodeFiles())
+	assert.FileExists(t, pulledPath, "Episodes removed upstream should survive retention cleanup")
+
+	setting.KeepRemovedUpstream = false
+	require.NoError(t, db.UpdateSettings(setting))
+	require.NoError(t, ClearEpisodeFiles())
+	require.NoError(t, db.GetPodcastItemByID(pulled.ID, &stored))
+	assert.Equal(t, db.Downloaded, stored.DownloadStatus, "Newest downloaded episode is within the keep limit")
+}
+
+// TestDetectEnclosureChange tests how refreshes react to re-published episodes.
+func TestDetectEnclosureChange(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	dataDir, dataCleanup := testhelpers.SetupTestDataDir(t)
+	defer dataCleanup()
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	pubDate := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	republished := model.FeedItem{
+		PubDate:   pubDate,
+		Enclosure: model.FeedEnclosure{URL: "https://example.com/episode-v2.mp3", Length: "2000"},
+	}
+
+	setup := func(t *testing.T, policy db.EnclosureChangePolicy, downloaded bool) (*db.Podcast, *db.PodcastItem) {
+		t.Helper()
+		podcast := db.CreateTestPodcast(t, database)
+		require.NoError(t, db.UpdatePodcastEnclosureChangePolicy(podcast.ID, policy))
+		podcast.EnclosureChangePolicy = policy
+		item := db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{PubDate: pubDate})
+		item.EnclosureLength = 1000
+		if downloaded {
+			item.DownloadPath = filepath.Join(dataDir, item.ID+".mp3")
+			require.NoError(t, os.WriteFile(item.DownloadPath, []byte("old"), 0o600))
+			item.DownloadStatus = db.Downloaded
+		}
+		require.NoError(t, db.UpdatePodcastItem(item))
+		return podcast, item
+	}
+	load := func(t *testing.T, id string) db.PodcastItem {
+		t.Helper()
+		var stored db.PodcastItem
+		require.NoError(t, db.GetPodcastItemByID(id, &stored))
+		return stored
+	}
+
+	t.Run("backfills_missing_length", func(t *testing.T) {
+		podcast, item := setup(t, db.EnclosureChangeFlag, false)
+		item.EnclosureLength = 0
+		require.NoError(t, db.UpdatePodcastItem(item))
+
+		detectEnclosureChange(podcast, item, &model.FeedItem{
+			PubDate:   pubDate,
+			Enclosure: model.FeedEnclosure{URL: item.FileURL, Length: "1500"},
+		})
+
+		stored := load(t, item.ID)
+		assert.Equal(t, int64(1500), stored.EnclosureLength)
+		assert.False(t, stored.EnclosureChanged)
+	})
+
+	t.Run("ignore", func(t *testing.T) {
+		podcast, item := setup(t, db.EnclosureChangeIgnore, true)
+		detectEnclosureChange(podcast, item, &republished)
+
+		stored := load(t, item.ID)
+		assert.Equal(t, "https://example.com/episode-v2.mp3", stored.FileURL)
+		assert.Equal(t, int64(2000), stored.EnclosureLength)
+		assert.False(t, stored.EnclosureChanged)
+		assert.Equal(t, db.Downloaded, stored.DownloadStatus)
+	})
+
+	t.Run("flag", func(t *testing.T) {
+		podcast, item := setup(t, db.EnclosureChangeFlag, true)
+		detectEnclosureChange(podcast, item, &republished)
+
+		stored := load(t, item.ID)
+		assert.Equal(t, "https://example.com/episode-v2.mp3", stored.FileURL)
+		assert.True(t, stored.EnclosureChanged)
+		assert.False(t, stored.EnclosureChangedDate.IsZero())
+		assert.Equal(t, db.Downloaded, stored.DownloadStatus)
+		assert.FileExists(t, stored.DownloadPath)
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		podcast, item := setup(t, db.EnclosureChangeReplace, true)
+		oldPath := item.DownloadPath
+		detectEnclosureChange(podcast, item, &republished)
+
+		stored := load(t, item.ID)
+		assert.True(t, stored.EnclosureChanged)
+		assert.Equal(t, db.NotDownloaded, stored.DownloadStatus)
+		assert.Empty(t, stored.DownloadPath)
+		assert.NoFileExists(t, oldPath)
+	})
+
+	t.Run("keep_both", func(t *testing.T) {
+		podcast, item := setup(t, db.EnclosureChangeKeepBoth, true)
+		oldPath := item.DownloadPath
+		detectEnclosureChange(podcast, item, &republished)
+
+		stored := load(t, item.ID)
+		assert.True(t, stored.EnclosureChanged)
+		assert.Equal(t, db.NotDownloaded, stored.DownloadStatus)
+		assert.NoFileExists(t, oldPath)
+		require.NotEmpty(t, stored.PreviousDownloadPath)
+		assert.FileExists(t, stored.PreviousDownloadPath)
+
+		require.NoError(t, DeleteEpisodeFile(item.ID))
+		assert.NoFileExists(t, stored.PreviousDownloadPath)
+		assert.Empty(t, load(t, item.ID).PreviousDownloadPath)
+	})
+
+	t.Run("invalid_policy", func(t *testing.T) {
+		podcast := db.CreateTestPodcast(t, database)
+		assert.Error(t, SetPodcastEnclosureChangePolicy(podcast.ID, "sometimes"))
+		assert.NoError(t, SetPodcastEnclosureChangePolicy(podcast.ID, db.EnclosureChangeKeepBoth))
+	})
+}
@@ -0,0 +1,309 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/toozej/podgrab/internal/logger"
+	"github.com/toozej/podgrab/pkg/version"
+	"golang.org/x/net/ipv4"
+)
+
+// SSDP timings: how long players may cache an announcement, the longest a search
+// response is delayed to spread the replies of many devices, and how often the
+// search loop checks for shutdown.
+const (
+	ssdpMaxAge       = 30 * time.Minute
+	ssdpMaxSearchMX  = 5
+	ssdpReadDeadline = time.Second
+)
+
+// ssdpAddress is the multicast group UPnP devices announce themselves on.
+var ssdpAddress = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+
+// DLNADescriptionPath is the path of the device description the SSDP LOCATION points to.
+const DLNADescriptionPath = "/dlna/description.xml"
+
+// UPnP device and service types of the media server.
+const (
+	DLNADeviceType            = "urn:schemas-upnp-org:device:MediaServer:1"
+	DLNAContentDirectoryType  = "urn:schemas-upnp-org:service:ContentDirectory:1"
+	DLNAConnectionManagerType = "urn:schemas-upnp-org:service:ConnectionManager:1"
+)
+
+// SSDP notification subtypes.
+const (
+	ssdpAlive  = "ssdp:alive"
+	ssdpByeBye = "ssdp:byebye"
+)
+
+// DLNAServerHeader is the SERVER header of SSDP messages and HTTP responses.
+var DLNAServerHeader = runtime.GOOS + "/" + runtime.GOARCH + " UPnP/1.0 DLNADOC/1.50 Podgrab/" + version.Version
+
+// AdvertiseDLNA announces the media server on every multicast interface and answers
+// searches for it until ctx is done, when it says goodbye.
+func AdvertiseDLNA(ctx context.Context, server *DLNAServer) error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, ssdpAddress)
+	if err != nil {
+		return fmt.Errorf("listening for SSDP: %w", err)
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			logger.Log.Errorw("closing SSDP socket", "error", err)
+		}
+	}()
+	advertiser := &ssdpAdvertiser{server: server, conn: ipv4.NewPacketConn(conn)}
+	for _, ifi := range ssdpInterfaces() {
+		// Joining the interface ListenMulticastUDP already joined fails harmlessly.
+		if err := advertiser.conn.JoinGroup(&ifi, &net.UDPAddr{IP: ssdpAddress.IP}); err != nil {
+			logger.Log.Debugw("joining SSDP group", "interface", ifi.Name, "error", err)
+		}
+	}
+	if err := advertiser.conn.SetMulticastTTL(2); err != nil {
+		logger.Log.Debugw("setting SSDP TTL", "error", err)
+	}
+
+	go advertiser.serveSearches(ctx)
+	ticker := time.NewTicker(ssdpMaxAge / 2)
+	defer ticker.Stop()
+	for {
+		advertiser.notify(ssdpAlive)
+		select {
+		case <-ctx.Done():
+			advertiser.notify(ssdpByeBye)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// ssdpAdvertiser sends the SSDP messages of a media server over one socket.
+type ssdpAdvertiser struct {
+	server *DLNAServer
+	// mu guards the multicast interface of conn between setting it and sending.
+	mu   sync.Mutex
+	conn *ipv4.PacketConn
+}
+
+// serveSearches answers M-SEARCH requests until ctx is done.
+func (advertiser *ssdpAdvertiser) serveSearches(ctx context.Context) {
+	buffer := make([]byte, 2048)
+	for ctx.Err() == nil {
+		if err := advertiser.conn.SetReadDeadline(time.Now().Add(ssdpReadDeadline)); err != nil {
+			logger.Log.Errorw("setting SSDP read deadline", "error", err)
+			return
+		}
+		n, _, from, err := advertiser.conn.ReadFrom(buffer)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			logger.Log.Errorw("reading SSDP", "error", err)
+			return
+		}
+		remote, ok := from.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		targets, delay, ok := parseSSDPSearch(buffer[:n], advertiser.server.UUID)
+		if !ok || len(targets) == 0 {
+			continue
+		}
+		go advertiser.respond(ctx, remote, targets, delay)
+	}
+}
+
+// respond sends a search response for each matching target after a delay.
+func (advertiser *ssdpAdvertiser) respond(ctx context.Context, remote *net.UDPAddr, targets []string, delay time.Duration) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(delay):
+	}
+	ip, err := localIPFor(remote)
+	if err != nil {
+		logger.Log.Debugw("finding the address for an SSDP search", "remote", remote, "error", err)
+		return
+	}
+	location := dlnaLocation(ip, advertiser.server.Port)
+	for _, target := range targets {
+		message := ssdpSearchResponse(target, advertiser.server.UUID, location, time.Now())
+		if _, err := advertiser.conn.WriteTo(message, nil, remote); err != nil {
+			logger.Log.Debugw("answering SSDP search", "remote", remote, "error", err)
+			return
+		}
+	}
+}
+
+// notify multicasts an alive or byebye for every target on every interface, twice as
+// UDP may drop one.
+func (advertiser *ssdpAdvertiser) notify(nts string) {
+	advertiser.mu.Lock()
+	defer advertiser.mu.Unlock()
+	for _, ifi := range ssdpInterfaces() {
+		ip := interfaceIPv4(&ifi)
+		if ip == nil {
+			continue
+		}
+		if err := advertiser.conn.SetMulticastInterface(&ifi); err != nil {
+			logger.Log.Debugw("selecting SSDP interface", "interface", ifi.Name, "error", err)
+			continue
+		}
+		location := dlnaLocation(ip, advertiser.server.Port)
+		for range 2 {
+			for _, target := range ssdpTargets(advertiser.server.UUID) {
+				message := ssdpNotify(nts, target, advertiser.server.UUID, location)
+				if _, err := advertiser.conn.WriteTo(message, nil, ssdpAddress); err != nil {
+					logger.Log.Debugw("sending SSDP notify", "interface", ifi.Name, "error", err)
+				}
+			}
+		}
+	}
+}
+
+// ssdpTargets returns the notification types a media server announces.
+func ssdpTargets(deviceUUID string) []string {
+	return []string{
+		"upnp:rootdevice",
+		"uuid:" + deviceUUID,
+		DLNADeviceType,
+		DLNAContentDirectoryType,
+		DLNAConnectionManagerType,
+	}
+}
+
+// ssdpUSN returns the unique service name of a target.
+func ssdpUSN(target, deviceUUID string) string {
+	if target == "uuid:"+deviceUUID {
+		return target
+	}
+	return "uuid:" + deviceUUID + "::" + target
+}
+
+// parseSSDPSearch returns the targets of the media server an M-SEARCH request asks
+// for, and a random delay within its MX. ok is false for other messages.
+func parseSSDPSearch(message []byte, deviceUUID string) (targets []string, delay time.Duration, ok bool) {
+	request, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(message)))
+	if err != nil || request.Method != "M-SEARCH" || request.Header.Get("MAN") != `"ssdp:discover"` {
+		return nil, 0, false
+	}
+	searchTarget := request.Header.Get("ST")
+	for _, target := range ssdpTargets(deviceUUID) {
+		if searchTarget == "ssdp:all" || searchTarget == target {
+			targets = append(targets, target)
+		}
+	}
+	mx, err := strconv.Atoi(request.Header.Get("MX"))
+	if err == nil && mx > 0 {
+		delay = rand.N(time.Duration(min(mx, ssdpMaxSearchMX)) * time.Second) // #nosec G404 -- spreads replies, not a secret
+	}
+	return targets, delay, true
+}
+
+// ssdpSearchResponse returns the unicast answer to a search for a target.
+func ssdpSearchResponse(target, deviceUUID, location string, now time.Time) []byte {
+	var message strings.Builder
+	message.WriteString("HTTP/1.1 200 OK\r\n")
+	writeSSDPHeaders(&message, [][2]string{
+		{"CACHE-CONTROL", "max-age=" + strconv.Itoa(int(ssdpMaxAge.Seconds()))},
+		{"DATE", now.UTC().Format(http.TimeFormat)},
+		{"EXT", ""},
+		{"LOCATION", location},
+		{"SERVER", DLNAServerHeader},
+		{"ST", target},
+		{"USN", ssdpUSN(target, deviceUUID)},
+	})
+	return []byte(message.String())
+}
+
+// ssdpNotify returns the multicast announcement of a target.
+func ssdpNotify(nts, target, deviceUUID, location string) []byte {
+	var message strings.Builder
+	message.WriteString("NOTIFY * HTTP/1.1\r\n")
+	headers := [][2]string{
+		{"HOST", ssdpAddress.String()},
+		{"NT", target},
+		{"NTS", nts},
+		{"USN", ssdpUSN(target, deviceUUID)},
+	}
+	if nts == ssdpAlive {
+		headers = append(headers,
+			[2]string{"CACHE-CONTROL", "max-age=" + strconv.Itoa(int(ssdpMaxAge.Seconds()))},
+			[2]string{"LOCATION", location},
+			[2]string{"SERVER", DLNAServerHeader})
+	}
+	writeSSDPHeaders(&message, headers)
+	return []byte(message.String())
+}
+
+// writeSSDPHeaders writes headers in order and the blank line ending the message.
+func writeSSDPHeaders(message *strings.Builder, headers [][2]string) {
+	for _, header := range headers {
+		fmt.Fprintf(message, "%s: %s\r\n", header[0], header[1])
+	}
+	message.WriteString("\r\n")
+}
+
+// dlnaLocation returns the device description URL at an address.
+func dlnaLocation(ip net.IP, port int) string {
+	return "http://" + net.JoinHostPort(ip.String(), strconv.Itoa(port)) + DLNADescriptionPath
+}
+
+// ssdpInterfaces returns the interfaces SSDP is announced on: those up, with
+// multicast, and not loopback.
+func ssdpInterfaces() []net.Interface {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		logger.Log.Errorw("listing network interfaces", "error", err)
+		return nil
+	}
+	var result []net.Interface
+	for _, ifi := range interfaces {
+		if ifi.Flags&net.FlagUp != 0 && ifi.Flags&net.FlagMulticast != 0 && ifi.Flags&net.FlagLoopback == 0 {
+			result = append(result, ifi)
+		}
+	}
+	return result
+}
+
+// interfaceIPv4 returns the first IPv4 address of an interface, or nil.
+func interfaceIPv4(ifi *net.Interface) net.IP {
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return ipNet.IP.To4()
+		}
+	}
+	return nil
+}
+
+// localIPFor returns the local address packets to a remote address leave from. No
+// packet is sent.
+func localIPFor(remote *net.UDPAddr) (net.IP, error) {
+	conn, err := net.DialUDP("udp4", nil, remote)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			logger.Log.Debugw("closing UDP socket", "error", err)
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
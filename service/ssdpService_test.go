@@ -0,0 +1,68 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseSSDPSearch tests which searches the media server answers.
+func TestParseSSDPSearch(t *testing.T) {
+	const deviceUUID = "1c530393-3513-5f1b-a914-40b9ebcf2d96"
+	search := func(target, mx string) string {
+		return "M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: " + mx + "\r\nST: " + target + "\r\n\r\n"
+	}
+
+	tests := []struct {
+		name    string
+		message string
+		targets []string
+		ok      bool
+	}{
+		{"all", search("ssdp:all", "1"), ssdpTargets(deviceUUID), true},
+		{"media server", search(DLNADeviceType, "1"), []string{DLNADeviceType}, true},
+		{"this device", search("uuid:"+deviceUUID, "1"), []string{"uuid:" + deviceUUID}, true},
+		{"renderers", search("urn:schemas-upnp-org:device:MediaRenderer:1", "1"), nil, true},
+		{"notify", "NOTIFY * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nNT: upnp:rootdevice\r\nNTS: ssdp:alive\r\n\r\n", nil, false},
+		{"garbage", "not ssdp", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, delay, ok := parseSSDPSearch([]byte(tt.message), deviceUUID)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.targets, targets)
+			assert.Less(t, delay, time.Second)
+		})
+	}
+
+	_, delay, _ := parseSSDPSearch([]byte(search("ssdp:all", "120")), deviceUUID)
+	assert.Less(t, delay, ssdpMaxSearchMX*time.Second, "Long MX values should be capped")
+}
+
+// TestSSDPMessages tests the announcements and search responses sent.
+func TestSSDPMessages(t *testing.T) {
+	const deviceUUID = "1c530393-3513-5f1b-a914-40b9ebcf2d96"
+	location := dlnaLocation(net.IPv4(192, 168, 1, 2), 8200)
+	assert.Equal(t, "http://192.168.1.2:8200/dlna/description.xml", location)
+
+	alive := string(ssdpNotify(ssdpAlive, "upnp:rootdevice", deviceUUID, location))
+	assert.True(t, strings.HasPrefix(alive, "NOTIFY * HTTP/1.1\r\n"))
+	assert.Contains(t, alive, "NTS: ssdp:alive\r\n")
+	assert.Contains(t, alive, "USN: uuid:"+deviceUUID+"::upnp:rootdevice\r\n")
+	assert.Contains(t, alive, "LOCATION: "+location+"\r\n")
+	assert.True(t, strings.HasSuffix(alive, "\r\n\r\n"))
+
+	byebye := string(ssdpNotify(ssdpByeBye, "uuid:"+deviceUUID, deviceUUID, location))
+	assert.Contains(t, byebye, "USN: uuid:"+deviceUUID+"\r\n")
+	assert.NotContains(t, byebye, "LOCATION", "Goodbyes have no location")
+
+	response := string(ssdpSearchResponse(DLNADeviceType, deviceUUID, location, time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)))
+	assert.True(t, strings.HasPrefix(response, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, response, "ST: "+DLNADeviceType+"\r\n")
+	assert.Contains(t, response, "DATE: Mon, 15 Jan 2024 10:30:00 GMT\r\n")
+	assert.Contains(t, response, "CACHE-CONTROL: max-age=1800\r\n")
+}
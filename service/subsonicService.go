@@ -0,0 +1,256 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"encoding/hex"
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/model"
+	"gorm.io/gorm"
+)
+
+// Subsonic API error codes.
+const (
+	SubsonicErrorGeneric          = 0
+	SubsonicErrorMissingParameter = 10
+	SubsonicErrorWrongCredentials = 40
+	SubsonicErrorTokenAuth        = 41
+	SubsonicErrorConflictingAuth  = 43
+	SubsonicErrorInvalidAPIKey    = 44
+	SubsonicErrorNotAuthorized    = 50
+	SubsonicErrorNotFound         = 70
+)
+
+// maxSubsonicNewestCount caps the episodes getNewestPodcasts returns.
+const maxSubsonicNewestCount = 500
+
+// SubsonicError is a failed Subsonic API call, reported to clients with its code.
+type SubsonicError struct {
+	Code    int
+	Message string
+}
+
+func (e *SubsonicError) Error() string {
+	return e.Message
+}
+
+// SubsonicCredentials are the authentication parameters of a Subsonic request.
+type SubsonicCredentials struct {
+	Username string
+	Password string
+	Token    string
+	Salt     string
+	APIKey   string
+}
+
+// AuthenticateSubsonic returns the user a Subsonic request acts for. The password may
+// be an account password, hex encoded after "enc:", or an API token with the sync or
+// admin scope, as may the OpenSubsonic API key. Salted token authentication needs the
+// plain password, which Podgrab does not keep. Until an account has a password,
+// requests act for the default user.
+//
+// This runs instead of the Authenticate middleware, and account passwords arrive in
+// plain text with every request without any limit on wrong guesses, so API keys are
+// the recommended login.
+func AuthenticateSubsonic(credentials SubsonicCredentials, now time.Time) (*db.User, error) {
+	if credentials.APIKey != "" {
+		if credentials.Username != "" {
+			return nil, &SubsonicError{SubsonicErrorConflictingAuth, "Multiple conflicting authentication mechanisms provided"}
+		}
+		user, err := subsonicTokenUser(credentials.APIKey, now)
+		if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrTokenExpired) {
+			return nil, &SubsonicError{SubsonicErrorInvalidAPIKey, "Invalid API key"}
+		}
+		return user, err
+	}
+	password := credentials.Password
+	if hexPassword, ok := strings.CutPrefix(password, "enc:"); ok {
+		decoded, err := hex.DecodeString(hexPassword)
+		if err != nil {
+			return nil, &SubsonicError{SubsonicErrorWrongCredentials, "Wrong username or password"}
+		}
+		password = string(decoded)
+	}
+	if IsAPITokenValue(password) {
+		user, err := subsonicTokenUser(password, now)
+		if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrTokenExpired) ||
+			(err == nil && credentials.Username != "" && user.Username != credentials.Username) {
+			return nil, &SubsonicError{SubsonicErrorWrongCredentials, "Wrong username or password"}
+		}
+		return user, err
+	}
+	if password != "" {
+		if user, err := AuthenticatePassword(credentials.Username, password); err == nil {
+			return user, nil
+		}
+	}
+	required, err := LoginRequired()
+	if err != nil {
+		return nil, err
+	}
+	if !required {
+		return DefaultUser()
+	}
+	switch {
+	case password != "":
+		return nil, &SubsonicError{SubsonicErrorWrongCredentials, "Wrong username or password"}
+	case credentials.Token != "":
+		return nil, &SubsonicError{SubsonicErrorTokenAuth, "Token authentication is not supported, use the password or an API key"}
+	}
+	return nil, &SubsonicError{SubsonicErrorMissingParameter, "Required parameter is missing: u and p, or apiKey"}
+}
+
+// subsonicTokenUser returns the user of an API token allowed to use the Subsonic API.
+func subsonicTokenUser(value string, now time.Time) (*db.User, error) {
+	token, err := AuthenticateAPIToken(value, now)
+	if err != nil {
+		return nil, err
+	}
+	if token.Scope != db.TokenScopeSync && token.Scope != db.TokenScopeAdmin {
+		return nil, &SubsonicError{SubsonicErrorNotAuthorized, "API token scope " + string(token.Scope) + " does not allow the Subsonic API"}
+	}
+	return UserForAPIToken(token)
+}
+
+// GetSubsonicPodcasts returns every podcast, or the one with an ID, with their
+// episodes newest first when includeEpisodes is set.
+func GetSubsonicPodcasts(id string, includeEpisodes bool) ([]model.SubsonicChannel, error) {
+	var podcasts []db.Podcast
+	if id != "" {
+		var podcast db.Podcast
+		if err := db.GetPodcastByID(id, &podcast); err != nil {
+			return nil, subsonicLookupError(err, "Podcast not found")
+		}
+		podcasts = append(podcasts, podcast)
+	} else if err := db.GetAllPodcasts(&podcasts, "title"); err != nil {
+		return nil, err
+	}
+	channels := make([]model.SubsonicChannel, 0, len(podcasts))
+	for i := range podcasts {
+		channel := newSubsonicChannel(&podcasts[i])
+		if includeEpisodes {
+			var items []db.PodcastItem
+			if err := db.GetAllPodcastItemsByPodcastID(podcasts[i].ID, &items); err != nil {
+				return nil, err
+			}
+			channel.Episodes = make([]model.SubsonicEpisode, 0, len(items))
+			for j := range items {
+				channel.Episodes = append(channel.Episodes, newSubsonicEpisode(&items[j], &podcasts[i]))
+			}
+		}
+		channels = append(channels, channel)
+	}
+	return channels, nil
+}
+
+// GetNewestSubsonicEpisodes returns the most recently published episodes.
+func GetNewestSubsonicEpisodes(count int) ([]model.SubsonicEpisode, error) {
+	if count <= 0 {
+		count = 20
+	}
+	filter := model.EpisodesFilter{
+		Sorting:    model.ReleaseDesc,
+		Pagination: model.Pagination{Page: 1, Count: min(count, maxSubsonicNewestCount)},
+	}
+	items, _, err := db.GetPaginatedPodcastItemsNew(&filter)
+	if err != nil {
+		return nil, err
+	}
+	episodes := make([]model.SubsonicEpisode, 0, len(*items))
+	for i := range *items {
+		item := &(*items)[i]
+		episodes = append(episodes, newSubsonicEpisode(item, &item.Podcast))
+	}
+	return episodes, nil
+}
+
+// GetSubsonicPodcastItem returns the episode of a Subsonic ID.
+func GetSubsonicPodcastItem(id string) (*db.PodcastItem, error) {
+	var item db.PodcastItem
+	if err := db.GetPodcastItemByID(id, &item); err != nil {
+		return nil, subsonicLookupError(err, "Episode not found")
+	}
+	return &item, nil
+}
+
+// subsonicLookupError reports a record that was not found with the Subsonic not found
+// code.
+func subsonicLookupError(err error, message string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &SubsonicError{SubsonicErrorNotFound, message}
+	}
+	return err
+}
+
+// newSubsonicChannel returns a podcast in the Subsonic format, in error while its feed
+// fails to refresh.
+func newSubsonicChannel(podcast *db.Podcast) model.SubsonicChannel {
+	channel := model.SubsonicChannel{
+		ID:               podcast.ID,
+		URL:              podcast.URL,
+		Title:            podcast.Title,
+		Description:      podcast.Summary,
+		CoverArt:         podcast.ID,
+		OriginalImageURL: podcast.Image,
+		Status:           "completed",
+	}
+	if podcast.ConsecutiveFailures > 0 {
+		channel.Status = "error"
+		channel.ErrorMessage = podcast.LastFetchError
+	}
+	return channel
+}
+
+// newSubsonicEpisode returns an episode in the Subsonic format. Episodes can be
+// streamed whether downloaded or not, as the stream falls back to the remote file.
+func newSubsonicEpisode(item *db.PodcastItem, podcast *db.Podcast) model.SubsonicEpisode {
+	contentType := EpisodeMediaType(item)
+	suffix := MediaExtensionForType(contentType)
+	if suffix == "" {
+		suffix = path.Ext(item.FileURL)
+	}
+	coverArt := item.ID
+	if item.Image == "" && item.LocalImage == "" {
+		coverArt = podcast.ID
+	}
+	episode := model.SubsonicEpisode{
+		ID:          item.ID,
+		StreamID:    item.ID,
+		ChannelID:   item.PodcastID,
+		Parent:      item.PodcastID,
+		Title:       item.Title,
+		Album:       podcast.Title,
+		Artist:      podcast.Author,
+		CoverArt:    coverArt,
+		Size:        item.FileSize,
+		ContentType: contentType,
+		Suffix:      strings.TrimPrefix(suffix, "."),
+		Duration:    item.Duration,
+		IsVideo:     IsVideoType(contentType),
+		Type:        "podcast",
+		Description: item.Summary,
+		Status:      subsonicEpisodeStatus(item.DownloadStatus),
+	}
+	if !item.PubDate.IsZero() {
+		episode.Year = item.PubDate.Year()
+		episode.PublishDate = item.PubDate.UTC().Format(time.RFC3339)
+	}
+	return episode
+}
+
+// subsonicEpisodeStatus returns the Subsonic status of an episode's download.
+func subsonicEpisodeStatus(status db.DownloadStatus) string {
+	switch status {
+	case db.Downloaded:
+		return "completed"
+	case db.Downloading:
+		return "downloading"
+	case db.Deleted:
+		return "deleted"
+	}
+	return "new"
+}
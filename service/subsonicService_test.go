@@ -0,0 +1,125 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toozej/podgrab/db"
+	testhelpers "github.com/toozej/podgrab/internal/testing"
+)
+
+// subsonicErrorCode returns the Subsonic code of an error, or -1 for other errors.
+func subsonicErrorCode(err error) int {
+	var subsonicErr *SubsonicError
+	if errors.As(err, &subsonicErr) {
+		return subsonicErr.Code
+	}
+	return -1
+}
+
+// TestAuthenticateSubsonic tests the password, token and API key forms of Subsonic
+// authentication.
+func TestAuthenticateSubsonic(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	now := time.Now()
+	user, err := AuthenticateSubsonic(SubsonicCredentials{}, now)
+	require.NoError(t, err, "Requests should act for the default user until it has a password")
+	assert.Equal(t, DefaultUsername, user.Username)
+
+	password := "admin-password"
+	admin, err := UpdateUser(user.ID, &password, nil)
+	require.NoError(t, err)
+	syncToken, _, err := CreateAPIToken(admin.ID, "Phone", db.TokenScopeSync, 0)
+	require.NoError(t, err)
+	feedsToken, _, err := CreateAPIToken(admin.ID, "Feeds", db.TokenScopeFeeds, 0)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		credentials SubsonicCredentials
+		code        int
+	}{
+		{"password", SubsonicCredentials{Username: DefaultUsername, Password: "admin-password"}, 0},
+		{"encoded password", SubsonicCredentials{Username: DefaultUsername, Password: "enc:" + hex.EncodeToString([]byte("admin-password"))}, 0},
+		{"token as password", SubsonicCredentials{Username: DefaultUsername, Password: syncToken}, 0},
+		{"api key", SubsonicCredentials{APIKey: syncToken}, 0},
+		{"wrong password", SubsonicCredentials{Username: DefaultUsername, Password: "wrong"}, SubsonicErrorWrongCredentials},
+		{"bad encoding", SubsonicCredentials{Username: DefaultUsername, Password: "enc:zz"}, SubsonicErrorWrongCredentials},
+		{"token of another user", SubsonicCredentials{Username: "alice", Password: syncToken}, SubsonicErrorWrongCredentials},
+		{"salted token", SubsonicCredentials{Username: DefaultUsername, Token: "26719a1196d2a940705a59634eb18eab", Salt: "c19b2d"}, SubsonicErrorTokenAuth},
+		{"missing credentials", SubsonicCredentials{}, SubsonicErrorMissingParameter},
+		{"api key with username", SubsonicCredentials{Username: DefaultUsername, APIKey: syncToken}, SubsonicErrorConflictingAuth},
+		{"unknown api key", SubsonicCredentials{APIKey: "pg_unknown"}, SubsonicErrorInvalidAPIKey},
+		{"narrow scope", SubsonicCredentials{APIKey: feedsToken}, SubsonicErrorNotAuthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := AuthenticateSubsonic(tt.credentials, now)
+			if tt.code == 0 {
+				require.NoError(t, err)
+				assert.Equal(t, admin.ID, user.ID)
+				return
+			}
+			assert.Equal(t, tt.code, subsonicErrorCode(err), "%v", err)
+		})
+	}
+}
+
+// TestGetSubsonicPodcasts tests how podcasts and episodes are shown to Subsonic clients.
+func TestGetSubsonicPodcasts(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	podcast := db.CreateTestPodcast(t, database)
+	item := db.CreateTestPodcastItem(t, database, podcast.ID)
+	require.NoError(t, database.Model(item).Updates(map[string]interface{}{
+		"download_status": db.Downloaded,
+		"image":           "",
+	}).Error)
+	require.NoError(t, database.Model(podcast).Updates(map[string]interface{}{
+		"consecutive_failures": 2,
+		"last_fetch_error":     "feed returned 404",
+	}).Error)
+
+	channels, err := GetSubsonicPodcasts("", true)
+	require.NoError(t, err)
+	require.Len(t, channels, 1)
+	assert.Equal(t, "error", channels[0].Status)
+	assert.Equal(t, "feed returned 404", channels[0].ErrorMessage)
+	require.Len(t, channels[0].Episodes, 1)
+	episode := channels[0].Episodes[0]
+	assert.Equal(t, item.ID, episode.StreamID)
+	assert.Equal(t, podcast.ID, episode.ChannelID)
+	assert.Equal(t, podcast.ID, episode.CoverArt, "Episodes without an image should use the podcast's")
+	assert.Equal(t, "completed", episode.Status)
+	assert.Equal(t, "mp3", episode.Suffix)
+	assert.Equal(t, 1800, episode.Duration)
+
+	channels, err = GetSubsonicPodcasts(podcast.ID, false)
+	require.NoError(t, err)
+	require.Len(t, channels, 1)
+	assert.Empty(t, channels[0].Episodes)
+
+	_, err = GetSubsonicPodcasts("missing", true)
+	assert.Equal(t, SubsonicErrorNotFound, subsonicErrorCode(err))
+
+	episodes, err := GetNewestSubsonicEpisodes(0)
+	require.NoError(t, err)
+	require.Len(t, episodes, 1)
+	assert.Equal(t, podcast.Title, episodes[0].Album)
+}
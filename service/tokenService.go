@@ -0,0 +1,123 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/internal/logger"
+)
+
+// tokenPrefix starts every API token, so leaked tokens are easy to search for.
+const tokenPrefix = "pg_"
+
+// maxTokenExpiryDays is the longest expiry a token can be created with.
+const maxTokenExpiryDays = 3650
+
+var (
+	// ErrInvalidToken is returned for tokens that do not exist or were revoked.
+	ErrInvalidToken = errors.New("invalid API token")
+	// ErrTokenExpired is returned for tokens past their expiry.
+	ErrTokenExpired = errors.New("API token expired")
+	// ErrAdminScope is returned when a user who is not an admin asks for an admin token.
+	ErrAdminScope = errors.New("only admins can create admin tokens")
+)
+
+// CreateAPIToken creates a token for a user with a scope, expiring after a number of
+// days or never when expiresInDays is 0. It returns the token value, which is not
+// stored and cannot be shown again.
+func CreateAPIToken(userID, name string, scope db.TokenScope, expiresInDays int) (string, *db.APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, fmt.Errorf("token name is required")
+	}
+	if !scope.IsValid() {
+		return "", nil, fmt.Errorf("invalid token scope: %q", scope)
+	}
+	if scope == db.TokenScopeAdmin {
+		user, err := UserForAPIToken(&db.APIToken{UserID: userID})
+		if err != nil || !user.IsAdmin {
+			return "", nil, ErrAdminScope
+		}
+	}
+	if expiresInDays < 0 || expiresInDays > maxTokenExpiryDays {
+		return "", nil, fmt.Errorf("token expiry must be between 0 and %d days", maxTokenExpiryDays)
+	}
+	secret, err := randomSecret()
+	if err != nil {
+		return "", nil, err
+	}
+	value := tokenPrefix + secret
+	token := &db.APIToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: hashToken(value),
+		Prefix:    value[:len(tokenPrefix)+6],
+		Scope:     scope,
+	}
+	if expiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, expiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+	if err := db.CreateAPIToken(token); err != nil {
+		return "", nil, err
+	}
+	return value, token, nil
+}
+
+// IsAPITokenValue reports whether a credential is an API token rather than a password,
+// for clients that can only send tokens as a basic auth password.
+func IsAPITokenValue(value string) bool {
+	return strings.HasPrefix(value, tokenPrefix)
+}
+
+// AuthenticateAPIToken returns the token matching a value and records its use.
+func AuthenticateAPIToken(value string, now time.Time) (*db.APIToken, error) {
+	if !strings.HasPrefix(value, tokenPrefix) {
+		return nil, ErrInvalidToken
+	}
+	var token db.APIToken
+	if err := db.GetAPITokenByHash(hashToken(value), &token); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if token.ExpiresAt != nil && !now.Before(*token.ExpiresAt) {
+		return nil, ErrTokenExpired
+	}
+	if err := db.TouchAPIToken(token.ID, now); err != nil {
+		logger.Log.Errorw("recording API token use", "error", err, "token", token.Prefix)
+	}
+	return &token, nil
+}
+
+// GetAPITokens returns the tokens of a user, newest first.
+func GetAPITokens(userID string) ([]db.APIToken, error) {
+	tokens := []db.APIToken{}
+	err := db.GetAPITokensByUserID(userID, &tokens)
+	return tokens, err
+}
+
+// RevokeAPIToken deletes a token of a user.
+func RevokeAPIToken(id, userID string) error {
+	return db.DeleteAPITokenByID(id, userID)
+}
+
+// randomSecret returns 32 random bytes encoded for URLs and cookies.
+func randomSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+func hashToken(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,116 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toozej/podgrab/db"
+	testhelpers "github.com/toozej/podgrab/internal/testing"
+)
+
+// TestAPITokens tests creating, authenticating and revoking API tokens.
+func TestAPITokens(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	value, token, err := CreateAPIToken("alice", "  Phone  ", db.TokenScopeFeeds, 0)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(value, tokenPrefix))
+	assert.Equal(t, "Phone", token.Name)
+	assert.Nil(t, token.ExpiresAt)
+	assert.True(t, strings.HasPrefix(value, token.Prefix))
+	assert.Equal(t, "alice", token.UserID)
+
+	var stored db.APIToken
+	require.NoError(t, database.First(&stored, "id = ?", token.ID).Error)
+	assert.NotContains(t, stored.TokenHash, value, "Should only store a hash of the token")
+	assert.Nil(t, stored.LastUsedAt)
+
+	now := time.Now()
+	authenticated, err := AuthenticateAPIToken(value, now)
+	require.NoError(t, err)
+	assert.Equal(t, token.ID, authenticated.ID)
+	assert.Equal(t, db.TokenScopeFeeds, authenticated.Scope)
+	require.NoError(t, database.First(&stored, "id = ?", token.ID).Error)
+	require.NotNil(t, stored.LastUsedAt)
+	assert.WithinDuration(t, now, *stored.LastUsedAt, time.Second)
+
+	_, err = AuthenticateAPIToken(value+"x", now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = AuthenticateAPIToken(strings.TrimPrefix(value, tokenPrefix), now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	tokens, err := GetAPITokens("alice")
+	require.NoError(t, err)
+	assert.Len(t, tokens, 1)
+	tokens, err = GetAPITokens("bob")
+	require.NoError(t, err)
+	assert.Empty(t, tokens, "Users should only see their own tokens")
+
+	assert.Error(t, RevokeAPIToken(token.ID, "bob"), "Users should only revoke their own tokens")
+	require.NoError(t, RevokeAPIToken(token.ID, "alice"))
+	_, err = AuthenticateAPIToken(value, now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.Error(t, RevokeAPIToken(token.ID, "alice"))
+}
+
+// TestAPITokenExpiry tests that tokens stop working once they expire.
+func TestAPITokenExpiry(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	value, token, err := CreateAPIToken("alice", "CI", db.TokenScopeRead, 30)
+	require.NoError(t, err)
+	require.NotNil(t, token.ExpiresAt)
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, 30), *token.ExpiresAt, time.Minute)
+
+	_, err = AuthenticateAPIToken(value, time.Now().AddDate(0, 0, 29))
+	assert.NoError(t, err)
+	_, err = AuthenticateAPIToken(value, time.Now().AddDate(0, 0, 31))
+	assert.ErrorIs(t, err, ErrTokenExpired)
+}
+
+// TestCreateAPITokenValidation tests the token options that are rejected.
+func TestCreateAPITokenValidation(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	tests := []struct {
+		name          string
+		tokenName     string
+		scope         db.TokenScope
+		expiresInDays int
+	}{
+		{name: "blank name", tokenName: " ", scope: db.TokenScopeRead},
+		{name: "unknown scope", tokenName: "CI", scope: "write"},
+		{name: "negative expiry", tokenName: "CI", scope: db.TokenScopeRead, expiresInDays: -1},
+		{name: "expiry too long", tokenName: "CI", scope: db.TokenScopeRead, expiresInDays: maxTokenExpiryDays + 1},
+		{name: "admin scope for a user who is not an admin", tokenName: "CI", scope: db.TokenScopeAdmin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := CreateAPIToken("alice", tt.tokenName, tt.scope, tt.expiresInDays)
+			assert.Error(t, err)
+		})
+	}
+
+	var count int64
+	database.Model(&db.APIToken{}).Count(&count)
+	assert.Zero(t, count)
+}
@@ -0,0 +1,299 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/internal/logger"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// DefaultUsername is the name of the account created on first start, matching the
+// user name basic auth used before accounts existed.
+const DefaultUsername = "podgrab"
+
+// SessionDuration is how long a login session lasts.
+const SessionDuration = 30 * 24 * time.Hour
+
+// minPasswordLength is the shortest password accepted for accounts.
+const minPasswordLength = 8
+
+var (
+	// ErrInvalidCredentials is returned when a user name and password do not match.
+	ErrInvalidCredentials = errors.New("invalid user name or password")
+	// ErrInvalidSession is returned for sessions that do not exist or expired.
+	ErrInvalidSession = errors.New("invalid or expired session")
+	// ErrUserExists is returned when creating a user with a name that is taken.
+	ErrUserExists = errors.New("user already exists")
+	// ErrLastAdmin is returned when a change would leave no admin who can log in.
+	ErrLastAdmin = errors.New("at least one admin with a password is required")
+	// ErrWrongPassword is returned when the current password given to change it is wrong.
+	ErrWrongPassword = errors.New("the current password is wrong")
+)
+
+// dummyPasswordHash is compared against when a user does not exist, so logins take as
+// long for unknown users as for wrong passwords.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("podgrab-dummy-password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// EnsureDefaultUser creates the first admin account when there are no accounts yet,
+// with the password of the PASSWORD environment variable. The played and bookmark
+// state recorded before accounts existed, and existing API tokens, move to it.
+func EnsureDefaultUser(password string) (*db.User, error) {
+	var user db.User
+	count, err := db.CountUsers(false)
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		err = db.GetFirstAdminUser(&user)
+		return &user, err
+	}
+	user = db.User{Username: DefaultUsername, IsAdmin: true}
+	if password != "" {
+		if user.PasswordHash, err = hashPassword(password); err != nil {
+			return nil, err
+		}
+	}
+	if err := db.CreateUser(&user); err != nil {
+		return nil, err
+	}
+	if err := db.AdoptLegacyEpisodeState(user.ID); err != nil {
+		logger.Log.Errorw("moving listening state to the default user", "error", err)
+	}
+	if err := db.AssignAPITokensToUser(user.ID); err != nil {
+		logger.Log.Errorw("moving API tokens to the default user", "error", err)
+	}
+	logger.Log.Infow("Created the default user", "username", user.Username, "password", user.HasPassword())
+	return &user, nil
+}
+
+// DefaultUser returns the account requests act as while login is not required.
+func DefaultUser() (*db.User, error) {
+	return EnsureDefaultUser("")
+}
+
+// LoginRequired reports whether requests must log in, which is the case once any
+// account has a password.
+func LoginRequired() (bool, error) {
+	count, err := db.CountUsers(true)
+	return count > 0, err
+}
+
+// GetAllUsers returns every account ordered by user name.
+func GetAllUsers() ([]db.User, error) {
+	users := []db.User{}
+	err := db.GetAllUsers(&users)
+	return users, err
+}
+
+// CreateUser adds an account. Other accounts can only be added once an admin can log
+// in, or nobody could reach the app afterwards.
+func CreateUser(username, password string, isAdmin bool) (*db.User, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, fmt.Errorf("user name is required")
+	}
+	if err := validatePassword(password); err != nil {
+		return nil, err
+	}
+	if !isAdmin {
+		admins, err := db.CountAdminUsers(true)
+		if err != nil {
+			return nil, err
+		}
+		if admins == 0 {
+			return nil, ErrLastAdmin
+		}
+	}
+	var existing db.User
+	if err := db.GetUserByUsername(username, &existing); err == nil {
+		return nil, ErrUserExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	user := &db.User{Username: username, PasswordHash: hash, IsAdmin: isAdmin}
+	if err := db.CreateUser(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// UpdateUser changes the password or admin flag of an account. Changing the password
+// ends the account's sessions, so it has to log in again.
+func UpdateUser(id string, password *string, isAdmin *bool) (*db.User, error) {
+	var user db.User
+	if err := db.GetUserByID(id, &user); err != nil {
+		return nil, err
+	}
+	if password != nil {
+		if err := validatePassword(*password); err != nil {
+			return nil, err
+		}
+		hash, err := hashPassword(*password)
+		if err != nil {
+			return nil, err
+		}
+		user.PasswordHash = hash
+	}
+	if isAdmin != nil && !*isAdmin && user.IsAdmin {
+		if err := checkOtherAdmin(&user); err != nil {
+			return nil, err
+		}
+	}
+	if isAdmin != nil {
+		user.IsAdmin = *isAdmin
+	}
+	if err := db.UpdateUser(&user); err != nil {
+		return nil, err
+	}
+	if password != nil {
+		if err := db.DeleteUserSessionsByUserID(user.ID); err != nil {
+			logger.Log.Errorw("ending sessions after a password change", "error", err, "user", user.Username)
+		}
+	}
+	return &user, nil
+}
+
+// CheckCurrentPassword returns ErrWrongPassword unless password is the password of an
+// account. Accounts without a password accept any.
+func CheckCurrentPassword(id, password string) error {
+	var user db.User
+	if err := db.GetUserByID(id, &user); err != nil {
+		return err
+	}
+	if !user.HasPassword() {
+		return nil
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+// DeleteUser removes an account with its sessions, tokens and listening state.
+func DeleteUser(id string) error {
+	var user db.User
+	if err := db.GetUserByID(id, &user); err != nil {
+		return err
+	}
+	if user.IsAdmin {
+		if err := checkOtherAdmin(&user); err != nil {
+			return err
+		}
+	}
+	return db.DeleteUserByID(id)
+}
+
+// checkOtherAdmin returns ErrLastAdmin when user is the only admin who can log in.
+func checkOtherAdmin(user *db.User) error {
+	admins, err := db.CountAdminUsers(true)
+	if err != nil {
+		return err
+	}
+	if admins == 0 || (admins == 1 && user.HasPassword()) {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// AuthenticatePassword returns the account matching a user name and password.
+func AuthenticatePassword(username, password string) (*db.User, error) {
+	var user db.User
+	if err := db.GetUserByUsername(username, &user); err != nil || !user.HasPassword() {
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &user, nil
+}
+
+// Login checks a user name and password and starts a session. It returns the value
+// for the session cookie, which is not stored.
+func Login(username, password string, now time.Time) (string, *db.User, error) {
+	user, err := AuthenticatePassword(username, password)
+	if err != nil {
+		return "", nil, err
+	}
+	value, err := StartSession(user.ID, now)
+	if err != nil {
+		return "", nil, err
+	}
+	return value, user, nil
+}
+
+// StartSession starts a login session for an account that has already proven who it
+// is, returning the session cookie value.
+func StartSession(userID string, now time.Time) (string, error) {
+	value, err := randomSecret()
+	if err != nil {
+		return "", err
+	}
+	session := db.UserSession{UserID: userID, TokenHash: hashToken(value), ExpiresAt: now.Add(SessionDuration)}
+	if err := db.CreateUserSession(&session); err != nil {
+		return "", err
+	}
+	if err := db.DeleteExpiredUserSessions(now); err != nil {
+		logger.Log.Errorw("deleting expired sessions", "error", err)
+	}
+	return value, nil
+}
+
+// AuthenticateSession returns the account of a session cookie value.
+func AuthenticateSession(value string, now time.Time) (*db.User, error) {
+	var session db.UserSession
+	if err := db.GetUserSessionByHash(hashToken(value), &session); err != nil {
+		return nil, ErrInvalidSession
+	}
+	if !now.Before(session.ExpiresAt) {
+		return nil, ErrInvalidSession
+	}
+	var user db.User
+	if err := db.GetUserByID(session.UserID, &user); err != nil {
+		return nil, ErrInvalidSession
+	}
+	return &user, nil
+}
+
+// Logout ends the session of a cookie value.
+func Logout(value string) error {
+	return db.DeleteUserSessionByHash(hashToken(value))
+}
+
+// UserForAPIToken returns the account a token acts for.
+func UserForAPIToken(token *db.APIToken) (*db.User, error) {
+	if token.UserID == "" {
+		return DefaultUser()
+	}
+	var user db.User
+	if err := db.GetUserByID(token.UserID, &user); err != nil {
+		return nil, ErrInvalidToken
+	}
+	return &user, nil
+}
+
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	return nil
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
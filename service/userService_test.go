@@ -0,0 +1,206 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toozej/podgrab/db"
+	testhelpers "github.com/toozej/podgrab/internal/testing"
+)
+
+// TestEnsureDefaultUser tests that the first account takes over the listening state
+// and tokens from before accounts existed.
+func TestEnsureDefaultUser(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	podcast := db.CreateTestPodcast(t, database)
+	played := db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{Title: "Played", IsPlayed: true})
+	bookmarked := db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{Title: "Bookmarked"})
+	require.NoError(t, database.Model(bookmarked).Update("bookmark_date", time.Now()).Error)
+	untouched := db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{Title: "Untouched"})
+	require.NoError(t, db.CreateAPIToken(&db.APIToken{Name: "Old", TokenHash: "hash", Scope: db.TokenScopeRead}))
+
+	required, err := LoginRequired()
+	require.NoError(t, err)
+	assert.False(t, required)
+
+	user, err := EnsureDefaultUser("s3cret-password")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultUsername, user.Username)
+	assert.True(t, user.IsAdmin)
+	required, err = LoginRequired()
+	require.NoError(t, err)
+	assert.True(t, required, "PASSWORD should turn on the login")
+
+	items := []db.PodcastItem{*played, *bookmarked, *untouched}
+	require.NoError(t, ApplyEpisodeStates(user.ID, items))
+	assert.True(t, items[0].IsPlayed)
+	assert.False(t, items[1].BookmarkDate.IsZero())
+	assert.False(t, items[2].IsPlayed)
+	tokens, err := GetAPITokens(user.ID)
+	require.NoError(t, err)
+	assert.Len(t, tokens, 1)
+
+	again, err := EnsureDefaultUser("another-password")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, again.ID, "Should only create the default user once")
+	_, err = AuthenticatePassword(DefaultUsername, "another-password")
+	assert.ErrorIs(t, err, ErrInvalidCredentials, "PASSWORD should only seed the first account")
+}
+
+// TestLoginSessions tests logging in, session expiry and logging out.
+func TestLoginSessions(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	_, err := EnsureDefaultUser("admin-password")
+	require.NoError(t, err)
+	alice, err := CreateUser("alice", "alice-password", false)
+	require.NoError(t, err)
+	assert.NotEqual(t, "alice-password", alice.PasswordHash)
+
+	now := time.Now()
+	_, _, err = Login("alice", "wrong-password", now)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, _, err = Login("nobody", "alice-password", now)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	value, user, err := Login("alice", "alice-password", now)
+	require.NoError(t, err)
+	assert.Equal(t, alice.ID, user.ID)
+
+	user, err = AuthenticateSession(value, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user.Username)
+	_, err = AuthenticateSession(value, now.Add(SessionDuration))
+	assert.ErrorIs(t, err, ErrInvalidSession)
+	_, err = AuthenticateSession("unknown", now)
+	assert.ErrorIs(t, err, ErrInvalidSession)
+
+	require.NoError(t, Logout(value))
+	_, err = AuthenticateSession(value, now)
+	assert.ErrorIs(t, err, ErrInvalidSession)
+
+	value, _, err = Login("alice", "alice-password", now)
+	require.NoError(t, err)
+	password := "new-alice-password"
+	_, err = UpdateUser(alice.ID, &password, nil)
+	require.NoError(t, err)
+	_, err = AuthenticateSession(value, now)
+	assert.ErrorIs(t, err, ErrInvalidSession, "Changing the password should end sessions")
+	_, err = AuthenticatePassword("alice", password)
+	assert.NoError(t, err)
+}
+
+// TestManageUsers tests the checks on creating, changing and deleting users.
+func TestManageUsers(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	admin, err := DefaultUser()
+	require.NoError(t, err)
+	assert.False(t, admin.HasPassword())
+	assert.NoError(t, CheckCurrentPassword(admin.ID, ""), "Accounts without a password accept any")
+
+	_, err = CreateUser("alice", "alice-password", false)
+	assert.ErrorIs(t, err, ErrLastAdmin, "Users can only be added once an admin can log in")
+
+	password := "admin-password"
+	_, err = UpdateUser(admin.ID, &password, nil)
+	require.NoError(t, err)
+	assert.ErrorIs(t, CheckCurrentPassword(admin.ID, "wrong-password"), ErrWrongPassword)
+	assert.NoError(t, CheckCurrentPassword(admin.ID, password))
+
+	alice, err := CreateUser(" alice ", "alice-password", false)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", alice.Username)
+	_, err = CreateUser("alice", "other-password", false)
+	assert.ErrorIs(t, err, ErrUserExists)
+	_, err = CreateUser("bob", "short", false)
+	assert.Error(t, err)
+	_, err = CreateUser(" ", "bob-password", false)
+	assert.Error(t, err)
+
+	notAdmin := false
+	_, err = UpdateUser(admin.ID, nil, &notAdmin)
+	assert.ErrorIs(t, err, ErrLastAdmin)
+	assert.ErrorIs(t, DeleteUser(admin.ID), ErrLastAdmin)
+
+	isAdmin := true
+	_, err = UpdateUser(alice.ID, nil, &isAdmin)
+	require.NoError(t, err)
+	require.NoError(t, DeleteUser(admin.ID), "Another admin can log in")
+
+	podcast := db.CreateTestPodcast(t, database)
+	item := db.CreateTestPodcastItem(t, database, podcast.ID)
+	require.NoError(t, SetPodcastItemPlayedStatus(alice.ID, item.ID, true))
+	_, _, err = CreateAPIToken(alice.ID, "Phone", db.TokenScopeFeeds, 0)
+	require.NoError(t, err)
+
+	bob, err := CreateUser("bob", "bob-password", true)
+	require.NoError(t, err)
+	require.NoError(t, DeleteUser(alice.ID))
+	users, err := GetAllUsers()
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, bob.ID, users[0].ID)
+
+	var states, tokens int64
+	database.Model(&db.EpisodeState{}).Count(&states)
+	database.Model(&db.APIToken{}).Count(&tokens)
+	assert.Zero(t, states, "Deleting a user should delete their listening state")
+	assert.Zero(t, tokens, "Deleting a user should delete their tokens")
+}
+
+// TestEpisodeQueue tests adding episodes to a user's queue in order.
+func TestEpisodeQueue(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	podcast := db.CreateTestPodcast(t, database)
+	first := db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{Title: "First"})
+	second := db.CreateTestPodcastItem(t, database, podcast.ID, &db.PodcastItem{Title: "Second"})
+
+	require.NoError(t, SetPodcastItemQueued("alice", second.ID, true))
+	require.NoError(t, SetPodcastItemQueued("alice", first.ID, true))
+	require.NoError(t, SetPodcastItemQueued("alice", second.ID, true), "Queueing twice should keep the place")
+	require.NoError(t, SetPodcastItemPlayedStatus("alice", first.ID, true))
+
+	queue, err := GetQueue("alice")
+	require.NoError(t, err)
+	require.Len(t, queue, 2)
+	assert.Equal(t, second.ID, queue[0].ID)
+	assert.Equal(t, first.ID, queue[1].ID)
+	assert.True(t, queue[1].IsPlayed)
+	assert.Equal(t, 2, queue[1].QueuePosition)
+
+	queue, err = GetQueue("bob")
+	require.NoError(t, err)
+	assert.Empty(t, queue)
+
+	require.NoError(t, SetPodcastItemQueued("alice", second.ID, false))
+	queue, err = GetQueue("alice")
+	require.NoError(t, err)
+	require.Len(t, queue, 1)
+	assert.Equal(t, first.ID, queue[0].ID)
+}
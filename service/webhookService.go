@@ -0,0 +1,449 @@
+// Package service implements business logic for podcast management and downloads.
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/toozej/podgrab/db"
+	"github.com/toozej/podgrab/internal/logger"
+	"github.com/toozej/podgrab/internal/secrets"
+	"github.com/toozej/podgrab/model"
+	"github.com/toozej/podgrab/pkg/version"
+)
+
+// Webhook events.
+const (
+	WebhookEpisodeDiscovered     = "episode.discovered"
+	WebhookEpisodeDownloaded     = "episode.downloaded"
+	WebhookEpisodeDownloadFailed = "episode.download_failed"
+	WebhookPodcastAdded          = "podcast.added"
+	WebhookPodcastRemoved        = "podcast.removed"
+	WebhookFeedBroken            = "feed.broken"
+	WebhookBackupCreated         = "backup.created"
+	// WebhookTest is only sent when a webhook is tested, whatever its events.
+	WebhookTest = "webhook.test"
+)
+
+// WebhookEvents lists the events a webhook can subscribe to.
+var WebhookEvents = []string{
+	WebhookEpisodeDiscovered,
+	WebhookEpisodeDownloaded,
+	WebhookEpisodeDownloadFailed,
+	WebhookPodcastAdded,
+	WebhookPodcastRemoved,
+	WebhookFeedBroken,
+	WebhookBackupCreated,
+}
+
+// Headers identifying webhook deliveries.
+const (
+	WebhookEventHeader     = "X-Podgrab-Event"
+	WebhookDeliveryHeader  = "X-Podgrab-Delivery"
+	WebhookSignatureHeader = "X-Podgrab-Signature"
+)
+
+// webhookTimeout bounds a single delivery attempt and webhookDeliveryLogSize is the
+// number of deliveries kept per webhook.
+const (
+	webhookTimeout         = 15 * time.Second
+	webhookDeliveryLogSize = 100
+)
+
+// webhookRetryDelays are the waits before each retry of a failed delivery. Retries wait
+// in memory and are lost when Podgrab stops, see AbandonWebhookDeliveries.
+var webhookRetryDelays = []time.Duration{10 * time.Second, time.Minute, 5 * time.Minute, 30 * time.Minute}
+
+// webhookDeliveries tracks the deliveries in flight.
+var webhookDeliveries sync.WaitGroup
+
+// WebhookInput holds the webhook fields set by clients. A nil Secret, Headers or
+// Enabled keeps the stored value when updating; an empty Secret removes it.
+type WebhookInput struct {
+	Secret  *string
+	Headers map[string]string
+	Enabled *bool
+	Name    string
+	URL     string
+	Events  []string
+}
+
+// GetAllWebhooks returns the webhooks with the names of their custom headers.
+func GetAllWebhooks() ([]db.Webhook, error) {
+	var webhooks []db.Webhook
+	if err := db.GetAllWebhooks(&webhooks); err != nil {
+		return nil, err
+	}
+	for i := range webhooks {
+		webhooks[i].HeaderNames = webhookHeaderNames(&webhooks[i])
+	}
+	return webhooks, nil
+}
+
+// CreateWebhook validates and stores a webhook. It is enabled unless input says otherwise.
+func CreateWebhook(input *WebhookInput) (*db.Webhook, error) {
+	webhook := db.Webhook{Enabled: true}
+	if err := applyWebhookInput(&webhook, input); err != nil {
+		return nil, err
+	}
+	if err := db.CreateWebhook(&webhook); err != nil {
+		return nil, err
+	}
+	webhook.HasSecret = webhook.Secret != ""
+	webhook.HeaderNames = webhookHeaderNames(&webhook)
+	return &webhook, nil
+}
+
+// UpdateWebhook replaces the settings of a webhook.
+func UpdateWebhook(id string, input *WebhookInput) (*db.Webhook, error) {
+	var webhook db.Webhook
+	if err := db.GetWebhookByID(id, &webhook); err != nil {
+		return nil, err
+	}
+	if err := applyWebhookInput(&webhook, input); err != nil {
+		return nil, err
+	}
+	if err := db.UpdateWebhook(&webhook); err != nil {
+		return nil, err
+	}
+	webhook.HasSecret = webhook.Secret != ""
+	webhook.HeaderNames = webhookHeaderNames(&webhook)
+	return &webhook, nil
+}
+
+// DeleteWebhook deletes a webhook with its delivery log.
+func DeleteWebhook(id string) error {
+	return db.DeleteWebhookByID(id)
+}
+
+// GetWebhookDeliveries returns the latest deliveries of a webhook, newest first.
+func GetWebhookDeliveries(id string) ([]db.WebhookDelivery, error) {
+	var webhook db.Webhook
+	if err := db.GetWebhookByID(id, &webhook); err != nil {
+		return nil, err
+	}
+	deliveries := []db.WebhookDelivery{}
+	err := db.GetWebhookDeliveries(id, webhookDeliveryLogSize, &deliveries)
+	return deliveries, err
+}
+
+// TestWebhook sends a test event to a webhook once, without retries, and returns the
+// delivery.
+func TestWebhook(id string) (*db.WebhookDelivery, error) {
+	var webhook db.Webhook
+	if err := db.GetWebhookByID(id, &webhook); err != nil {
+		return nil, err
+	}
+	body, err := webhookPayload(WebhookTest, model.WebhookData{}, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	delivery, err := newWebhookDelivery(&webhook, WebhookTest, body)
+	if err != nil {
+		return nil, err
+	}
+	deliverWebhook(&webhook, delivery, body, nil)
+	return delivery, nil
+}
+
+// EmitWebhookEvent sends an event to every enabled webhook subscribed to it. Deliveries
+// run in the background and are retried with backoff.
+func EmitWebhookEvent(event string, data model.WebhookData) {
+	if db.DB == nil {
+		return
+	}
+	var webhooks []db.Webhook
+	if err := db.GetEnabledWebhooks(&webhooks); err != nil {
+		logger.Log.Errorw("getting webhooks", "error", err)
+		return
+	}
+	var body []byte
+	for i := range webhooks {
+		webhook := webhooks[i]
+		if !webhookWants(&webhook, event) {
+			continue
+		}
+		if body == nil {
+			var err error
+			if body, err = webhookPayload(event, data, time.Now()); err != nil {
+				logger.Log.Errorw("encoding webhook payload", "event", event, "error", err)
+				return
+			}
+		}
+		delivery, err := newWebhookDelivery(&webhook, event, body)
+		if err != nil {
+			logger.Log.Errorw("recording webhook delivery", "error", err)
+			continue
+		}
+		webhookDeliveries.Add(1)
+		go func() {
+			defer webhookDeliveries.Done()
+			deliverWebhook(&webhook, delivery, body, webhookRetryDelays)
+		}()
+	}
+}
+
+// webhookPodcast returns the payload description of a podcast.
+func webhookPodcast(podcast *db.Podcast) *model.WebhookPodcast {
+	return &model.WebhookPodcast{
+		ID:    podcast.ID,
+		Title: podcast.Title,
+		URL:   RedactURL(podcast.URL),
+		Image: podcast.Image,
+	}
+}
+
+// webhookEpisode returns the payload description of an episode.
+func webhookEpisode(item *db.PodcastItem) *model.WebhookEpisode {
+	episode := &model.WebhookEpisode{
+		ID:       item.ID,
+		Title:    item.Title,
+		GUID:     item.GUID,
+		FileURL:  RedactURL(item.FileURL),
+		PubDate:  item.PubDate,
+		Duration: item.Duration,
+	}
+	if item.DownloadStatus == db.Downloaded {
+		episode.DownloadPath = item.DownloadPath
+		episode.FileSize = item.FileSize
+	}
+	return episode
+}
+
+// emitEpisodeEvent sends an episode event with the episode's podcast.
+func emitEpisodeEvent(event string, item *db.PodcastItem, err error) {
+	data := model.WebhookData{Podcast: webhookPodcast(&item.Podcast), Episode: webhookEpisode(item)}
+	if err != nil {
+		data.Error = err.Error()
+	}
+	EmitWebhookEvent(event, data)
+}
+
+// webhookPayload encodes the JSON body of an event.
+func webhookPayload(event string, data model.WebhookData, now time.Time) ([]byte, error) {
+	return json.Marshal(model.WebhookPayload{Event: event, Timestamp: now.UTC(), Data: data})
+}
+
+// webhookWants reports whether a webhook is subscribed to an event.
+func webhookWants(webhook *db.Webhook, event string) bool {
+	return eventSelected(webhook.Events, event)
+}
+
+// eventSelected reports whether a comma separated list of events, empty for every
+// event, holds an event.
+func eventSelected(events, event string) bool {
+	return events == "" || slices.Contains(strings.Split(events, ","), event)
+}
+
+// newWebhookDelivery records a delivery before its first attempt.
+func newWebhookDelivery(webhook *db.Webhook, event string, body []byte) (*db.WebhookDelivery, error) {
+	delivery := &db.WebhookDelivery{WebhookID: webhook.ID, Event: event, Payload: string(body)}
+	if err := db.CreateWebhookDelivery(delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// AbandonWebhookDeliveries fails the deliveries that were still running or waiting for
+// a retry when Podgrab stopped, so the delivery log does not show them retrying forever.
+func AbandonWebhookDeliveries() error {
+	abandoned, err := db.CloseUnfinishedWebhookDeliveries("Podgrab restarted before the delivery finished", time.Now())
+	if abandoned > 0 {
+		logger.Log.Infow("Abandoned unfinished webhook deliveries", "count", abandoned)
+	}
+	return err
+}
+
+// deliverWebhook posts a delivery, retrying network errors, rate limits and server
+// errors after each of retryDelays, and records every attempt in the delivery log.
+func deliverWebhook(webhook *db.Webhook, delivery *db.WebhookDelivery, body []byte, retryDelays []time.Duration) {
+	headers := webhookHeaders(webhook)
+	secret := webhookSecret(webhook)
+	for {
+		statusCode, err := postWebhook(webhook.URL, headers, secret, delivery, body)
+		delivery.Attempts++
+		delivery.StatusCode = statusCode
+		delivery.Success = err == nil
+		delivery.Error = ""
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		retry := err != nil && webhookRetryable(statusCode) && delivery.Attempts <= len(retryDelays)
+		if !retry {
+			now := time.Now()
+			delivery.CompletedAt = &now
+		}
+		if updateErr := db.UpdateWebhookDelivery(delivery); updateErr != nil {
+			logger.Log.Errorw("updating webhook delivery", "error", updateErr)
+		}
+		if !retry {
+			break
+		}
+		logger.Log.Debugw("Retrying webhook delivery", "url", RedactURL(webhook.URL), "event", delivery.Event, "error", err)
+		time.Sleep(retryDelays[delivery.Attempts-1])
+	}
+	if !delivery.Success {
+		logger.Log.Warnw("Webhook delivery failed", "url", RedactURL(webhook.URL), "event", delivery.Event, "attempts", delivery.Attempts, "error", delivery.Error)
+	}
+	if err := db.PruneWebhookDeliveries(webhook.ID, webhookDeliveryLogSize); err != nil {
+		logger.Log.Errorw("pruning webhook deliveries", "error", err)
+	}
+}
+
+// postWebhook makes one delivery attempt and returns the response status. Responses
+// outside 2xx are errors.
+func postWebhook(link string, headers map[string]string, secret string, delivery *db.WebhookDelivery, body []byte) (int, error) {
+	client, err := adminHTTPClient(webhookTimeout)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, link, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Podgrab/"+version.Version)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set(WebhookEventHeader, delivery.Event)
+	req.Header.Set(WebhookDeliveryHeader, delivery.ID)
+	if secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(secret, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			logger.Log.Errorw("closing webhook response", "error", closeErr)
+		}
+	}()
+	if _, err := io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)); err != nil {
+		logger.Log.Debugw("reading webhook response", "error", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// webhookRetryable reports whether a failed attempt is worth retrying: the request
+// did not get a response, was rate limited or hit a server error.
+func webhookRetryable(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// SignWebhookPayload returns the signature header value of a body: "sha256=" followed
+// by the hex HMAC-SHA256 of the body keyed with the secret.
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// applyWebhookInput validates input and copies it onto a webhook, encrypting the
+// secret and headers.
+func applyWebhookInput(webhook *db.Webhook, input *WebhookInput) error {
+	parsed, err := url.Parse(strings.TrimSpace(input.URL))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("the URL must be an http or https URL")
+	}
+	for _, event := range input.Events {
+		if !slices.Contains(WebhookEvents, event) {
+			return fmt.Errorf("unknown event: %q", event)
+		}
+	}
+	webhook.Name = strings.TrimSpace(input.Name)
+	webhook.URL = parsed.String()
+	webhook.Events = strings.Join(input.Events, ",")
+	if input.Enabled != nil {
+		webhook.Enabled = *input.Enabled
+	}
+	if input.Secret != nil {
+		webhook.Secret = ""
+		if *input.Secret != "" {
+			if webhook.Secret, err = secrets.Encrypt(*input.Secret); err != nil {
+				return err
+			}
+		}
+	}
+	if input.Headers != nil {
+		webhook.Headers = ""
+		if len(input.Headers) > 0 {
+			for name, value := range input.Headers {
+				if !validHeaderName(name) {
+					return fmt.Errorf("invalid header name: %q", name)
+				}
+				if strings.ContainsAny(value, "\r\n") {
+					return fmt.Errorf("invalid value for header %q", name)
+				}
+			}
+			data, err := json.Marshal(input.Headers)
+			if err != nil {
+				return err
+			}
+			if webhook.Headers, err = secrets.Encrypt(string(data)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// webhookSecret returns the decrypted secret of a webhook, or "" when it has none.
+func webhookSecret(webhook *db.Webhook) string {
+	if webhook.Secret == "" {
+		return ""
+	}
+	secret, err := secrets.Decrypt(webhook.Secret)
+	if err != nil {
+		logger.Log.Errorw("decrypting webhook secret", "url", RedactURL(webhook.URL), "error", err)
+	}
+	return secret
+}
+
+// webhookHeaders returns the decrypted custom headers of a webhook.
+func webhookHeaders(webhook *db.Webhook) map[string]string {
+	if webhook.Headers == "" {
+		return nil
+	}
+	data, err := secrets.Decrypt(webhook.Headers)
+	if err != nil {
+		logger.Log.Errorw("decrypting webhook headers", "url", RedactURL(webhook.URL), "error", err)
+		return nil
+	}
+	var headers map[string]string
+	if err := json.Unmarshal([]byte(data), &headers); err != nil {
+		logger.Log.Errorw("reading webhook headers", "url", RedactURL(webhook.URL), "error", err)
+		return nil
+	}
+	return headers
+}
+
+// webhookHeaderNames returns the sorted names of the custom headers of a webhook.
+func webhookHeaderNames(webhook *db.Webhook) []string {
+	names := []string{}
+	for name := range webhookHeaders(webhook) {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}